@@ -7,13 +7,29 @@
 
 package discord
 
+// A Presence stores the online, offline, or idle and game status of Guild members.
+type Presence struct {
+	User         *User        `json:"user"`
+	Status       Status       `json:"status"`
+	Activities   []*Activity  `json:"activities"`
+	Since        *int         `json:"since"`
+	ClientStatus ClientStatus `json:"client_status"`
+}
+
+// ClientStatus stores the online, offline, idle, or dnd status of each device of a Guild member.
+type ClientStatus struct {
+	Desktop Status `json:"desktop"`
+	Mobile  Status `json:"mobile"`
+	Web     Status `json:"web"`
+}
+
 // Activity defines the Activity sent with GatewayStatusUpdate.
 //
 // https://discord.com/developers/docs/topics/gateway#activity-object
 type Activity struct {
 	Name string       `json:"name"`
 	Type ActivityType `json:"type"`
-	Url  string       `json:"url, omitempty"`
+	Url  string       `json:"url,omitempty"`
 }
 
 // ActivityType is the type of activity in the Activity struct.
@@ -0,0 +1,436 @@
+// Discord bindings for the Hrngh bot.
+// Available at https://github.com/abeiron/hrngh
+
+// Copyright 2020-2021, Undying Memory <abeiron@outlook.com>.  All rights reserved.
+// Use of this source code is governed by the Microsoft Public License
+// that can be found in the LICENSE file.
+
+// This file contains code related to autocompletion of slash command options.
+
+package discord
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxAutocompleteChoices is the maximum number of choices Discord accepts in
+// an autocomplete result.
+const MaxAutocompleteChoices = 25
+
+// AutocompleteDeadline is the time Discord allows between an autocomplete
+// interaction being created and its result being received.
+const AutocompleteDeadline = 3 * time.Second
+
+// An Autocomplete describes the option a user is typing in.
+type Autocomplete struct {
+	// Command is the name of the command, followed by the names of the
+	// subcommand group and subcommand if any, separated by spaces.
+	Command string
+
+	// Option is the focused option.
+	Option *ApplicationCommandInteractionDataOption
+
+	// Query is the partial input of the focused option, as text.
+	Query string
+}
+
+// AutocompleteHandler produces the choices offered for a focused option.
+// At most MaxAutocompleteChoices choices are sent; the rest are dropped.
+type AutocompleteHandler func(ctx *InteractionContext, ac *Autocomplete) ([]*ApplicationCommandOptionChoice, error)
+
+// AutocompleteStats holds latency statistics for one autocomplete handler.
+type AutocompleteStats struct {
+	Command string
+	Option  string
+
+	// Calls is the number of times the handler was called.
+	Calls int
+
+	// Errors is the number of times the handler returned an error.
+	Errors int
+
+	// Late is the number of results which were ready only after
+	// AutocompleteDeadline had passed since the interaction was created.
+	Late int
+
+	// Total and Max are the cumulative and the longest handler latency.
+	Total time.Duration
+	Max   time.Duration
+}
+
+// Mean returns the mean handler latency.
+func (st AutocompleteStats) Mean() time.Duration {
+	if st.Calls == 0 {
+		return 0
+	}
+
+	return st.Total / time.Duration(st.Calls)
+}
+
+// autocompleteKey identifies an autocomplete handler.
+type autocompleteKey struct {
+	command string
+	option  string
+}
+
+// AutocompleteRouter dispatches autocomplete interactions to handlers
+// registered by command and option name, and tracks how long each handler
+// takes to produce its choices.
+type AutocompleteRouter struct {
+	sync.RWMutex
+
+	// SlowThreshold is the handler latency above which a warning is
+	// logged.  If zero, no warnings are logged.
+	SlowThreshold time.Duration
+
+	handlers map[autocompleteKey]AutocompleteHandler
+	stats    map[autocompleteKey]*AutocompleteStats
+}
+
+// NewAutocompleteRouter creates an empty AutocompleteRouter.
+func NewAutocompleteRouter() *AutocompleteRouter {
+	return &AutocompleteRouter{
+		SlowThreshold: AutocompleteDeadline / 2,
+		handlers:      make(map[autocompleteKey]AutocompleteHandler),
+		stats:         make(map[autocompleteKey]*AutocompleteStats),
+	}
+}
+
+// Handle registers the handler for the named option of command.  For
+// options of subcommands, command includes the subcommand group and
+// subcommand names separated by spaces, e.g. "config set".
+//
+// The return value of this method is a function, that when called will
+// remove the handler.
+func (r *AutocompleteRouter) Handle(command, option string, h AutocompleteHandler) func() {
+	key := autocompleteKey{command, option}
+
+	r.Lock()
+	defer r.Unlock()
+
+	r.handlers[key] = h
+
+	return func() {
+		r.Lock()
+		defer r.Unlock()
+
+		delete(r.handlers, key)
+	}
+}
+
+// Stats returns the latency statistics of every handler which has been
+// called, sorted by command and option name.
+func (r *AutocompleteRouter) Stats() []AutocompleteStats {
+	r.RLock()
+	defer r.RUnlock()
+
+	stats := make([]AutocompleteStats, 0, len(r.stats))
+	for _, st := range r.stats {
+		stats = append(stats, *st)
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Command != stats[j].Command {
+			return stats[i].Command < stats[j].Command
+		}
+		return stats[i].Option < stats[j].Option
+	})
+
+	return stats
+}
+
+// record adds one call of a handler to its statistics.
+func (r *AutocompleteRouter) record(key autocompleteKey, latency time.Duration, late bool, err error) {
+	r.Lock()
+	defer r.Unlock()
+
+	st, ok := r.stats[key]
+	if !ok {
+		st = &AutocompleteStats{Command: key.command, Option: key.option}
+		r.stats[key] = st
+	}
+
+	st.Calls++
+	st.Total += latency
+	if latency > st.Max {
+		st.Max = latency
+	}
+	if late {
+		st.Late++
+	}
+	if err != nil {
+		st.Errors++
+	}
+}
+
+// HandleInteraction dispatches an autocomplete interaction to the handler
+// registered for its focused option and responds with the choices it
+// returns.  Interactions of other types are ignored.
+//
+// HandleInteraction is an InteractionHandler, so an AutocompleteRouter can
+// be used directly as the Handler of an InteractionServer.
+func (r *AutocompleteRouter) HandleInteraction(ctx *InteractionContext) error {
+	if ctx.Interaction.Type != InteractionApplicationCommandAutocomplete {
+		return nil
+	}
+
+	data := ctx.Interaction.ApplicationCommandData()
+	ac := FocusedOption(data)
+	if ac == nil {
+		return ctx.Autocomplete()
+	}
+
+	key := autocompleteKey{ac.Command, ac.Option.Name}
+
+	r.RLock()
+	h, ok := r.handlers[key]
+	r.RUnlock()
+
+	if !ok {
+		return ctx.Autocomplete()
+	}
+
+	start := time.Now()
+	choices, err := h(ctx, ac)
+	latency := time.Since(start)
+
+	late := false
+	if created, terr := SnowflakeTimestamp(ctx.Interaction.ID); terr == nil {
+		late = time.Since(created) > AutocompleteDeadline
+	}
+
+	r.record(key, latency, late, err)
+
+	if r.SlowThreshold > 0 && latency > r.SlowThreshold {
+		ctx.Session.log(LogWarning, "autocomplete handler for %s/%s took %s", ac.Command, ac.Option.Name, latency)
+	}
+
+	if err != nil {
+		ctx.Autocomplete()
+		return err
+	}
+
+	return ctx.Autocomplete(choices...)
+}
+
+// Attach routes autocomplete interactions received from the gateway by s
+// through the router.
+//
+// The return value of this method is a function, that when called will
+// detach the router from the session.
+func (r *AutocompleteRouter) Attach(s *Session) func() {
+	return s.AddHandler(func(s *Session, i *InteractionCreate) {
+		if i.Type != InteractionApplicationCommandAutocomplete {
+			return
+		}
+
+		ctx := NewInteractionContext(s, i.Interaction)
+		if err := r.HandleInteraction(ctx); err != nil {
+			s.log(LogError, "error handling autocomplete interaction %s, %s", i.ID, err)
+		}
+
+		ctx.finish()
+	})
+}
+
+// Autocomplete responds to an autocomplete interaction with choices.  Only
+// the first MaxAutocompleteChoices choices are sent.
+func (ctx *InteractionContext) Autocomplete(choices ...*ApplicationCommandOptionChoice) error {
+	if len(choices) > MaxAutocompleteChoices {
+		choices = choices[:MaxAutocompleteChoices]
+	}
+
+	return ctx.Respond(&InteractionResponse{
+		Type: InteractionApplicationCommandAutocompleteResult,
+		Data: &InteractionResponseData{Choices: choices},
+	})
+}
+
+// FocusedOption finds the option the user is typing in, descending into
+// subcommand groups and subcommands.  It returns nil if no option is
+// focused.
+func FocusedOption(data ApplicationCommandInteractionData) *Autocomplete {
+	command := data.Name
+	options := data.Options
+
+	for len(options) > 0 {
+		var next []*ApplicationCommandInteractionDataOption
+		for _, o := range options {
+			if o.Focused {
+				return &Autocomplete{
+					Command: command,
+					Option:  o,
+					Query:   fmt.Sprint(valueOrEmpty(o.Value)),
+				}
+			}
+
+			if o.Type == ApplicationCommandOptionSubCommand || o.Type == ApplicationCommandOptionSubCommandGroup {
+				command += " " + o.Name
+				next = o.Options
+				break
+			}
+		}
+		options = next
+	}
+
+	return nil
+}
+
+// valueOrEmpty returns v, or an empty string if v is nil.
+func valueOrEmpty(v interface{}) interface{} {
+	if v == nil {
+		return ""
+	}
+
+	return v
+}
+
+// fuzzyScore scores how well name matches query, both already lowercased.
+// Higher is better; a negative score means no match.
+func fuzzyScore(name, query string) int {
+	switch {
+	case query == "":
+		return 0
+	case name == query:
+		return 400
+	case strings.HasPrefix(name, query):
+		return 300
+	}
+
+	for _, word := range strings.FieldsFunc(name, func(r rune) bool {
+		return r == ' ' || r == '-' || r == '_'
+	}) {
+		if strings.HasPrefix(word, query) {
+			return 200
+		}
+	}
+
+	if strings.Contains(name, query) {
+		return 100
+	}
+
+	// Subsequence match: every rune of query appears in name, in order.
+	// Prefer matches with fewer skipped runes.
+	skipped, qi := 0, 0
+	q := []rune(query)
+	for _, r := range name {
+		if qi < len(q) && r == q[qi] {
+			qi++
+		} else if qi > 0 {
+			skipped++
+		}
+	}
+	if qi < len(q) {
+		return -1
+	}
+
+	if skipped > 99 {
+		skipped = 99
+	}
+	return 99 - skipped
+}
+
+// FuzzyChoices filters candidates by a case-insensitive fuzzy match of their
+// names against query, best matches first.  Exact matches rank above
+// prefix matches, which rank above word prefix, substring and finally
+// subsequence matches; ties keep their original order.  At most
+// MaxAutocompleteChoices choices are returned.
+func FuzzyChoices(query string, candidates []*ApplicationCommandOptionChoice) []*ApplicationCommandOptionChoice {
+	type scored struct {
+		choice *ApplicationCommandOptionChoice
+		score  int
+	}
+
+	query = strings.ToLower(strings.TrimSpace(query))
+
+	matches := make([]scored, 0, len(candidates))
+	for _, c := range candidates {
+		if score := fuzzyScore(strings.ToLower(c.Name), query); score >= 0 {
+			matches = append(matches, scored{c, score})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+
+	if len(matches) > MaxAutocompleteChoices {
+		matches = matches[:MaxAutocompleteChoices]
+	}
+
+	choices := make([]*ApplicationCommandOptionChoice, len(matches))
+	for i, m := range matches {
+		choices[i] = m.choice
+	}
+
+	return choices
+}
+
+// FuzzyStrings is like FuzzyChoices for plain strings, each of which is
+// used as both the name and the value of its choice.
+func FuzzyStrings(query string, candidates []string) []*ApplicationCommandOptionChoice {
+	choices := make([]*ApplicationCommandOptionChoice, len(candidates))
+	for i, c := range candidates {
+		choices[i] = &ApplicationCommandOptionChoice{Name: c, Value: c}
+	}
+
+	return FuzzyChoices(query, choices)
+}
+
+// RoleChoices returns choices for the roles of a guild whose names fuzzily
+// match query, valued by role ID.  The @everyone role is left out.
+func (s *State) RoleChoices(guildID, query string) ([]*ApplicationCommandOptionChoice, error) {
+	guild, err := s.Guild(guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.RLock()
+	candidates := make([]*ApplicationCommandOptionChoice, 0, len(guild.Roles))
+	for _, r := range guild.Roles {
+		if r.ID == guild.ID {
+			continue
+		}
+		candidates = append(candidates, &ApplicationCommandOptionChoice{Name: r.Name, Value: r.ID})
+	}
+	s.RUnlock()
+
+	return FuzzyChoices(query, candidates), nil
+}
+
+// ChannelChoices returns choices for the channels of a guild whose names
+// fuzzily match query, valued by channel ID.  If types are given, only
+// channels of those types are considered.
+func (s *State) ChannelChoices(guildID, query string, types ...ChannelType) ([]*ApplicationCommandOptionChoice, error) {
+	guild, err := s.Guild(guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.RLock()
+	candidates := make([]*ApplicationCommandOptionChoice, 0, len(guild.Channels))
+	for _, c := range guild.Channels {
+		if len(types) > 0 && !hasChannelType(types, c.Type) {
+			continue
+		}
+		candidates = append(candidates, &ApplicationCommandOptionChoice{Name: c.Name, Value: c.ID})
+	}
+	s.RUnlock()
+
+	return FuzzyChoices(query, candidates), nil
+}
+
+// hasChannelType reports whether t is one of types.
+func hasChannelType(types []ChannelType, t ChannelType) bool {
+	for _, ct := range types {
+		if ct == t {
+			return true
+		}
+	}
+
+	return false
+}
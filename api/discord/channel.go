@@ -7,6 +7,10 @@
 
 // This file contains code related to Discord channels.
 
+package discord
+
+import "fmt"
+
 // ChannelType is the type of a Channel
 type ChannelType int
 
@@ -19,6 +23,10 @@ const (
 	ChannelTypeGuildCategory
 	ChannelTypeGuildNews
 	ChannelTypeGuildStore
+	ChannelTypeGuildNewsThread    ChannelType = 10
+	ChannelTypeGuildPublicThread  ChannelType = 11
+	ChannelTypeGuildPrivateThread ChannelType = 12
+	ChannelTypeGuildStageVoice    ChannelType = 13
 )
 
 // A Channel holds all data related to an individual Discord channel.
@@ -63,7 +71,7 @@ type Channel struct {
 	Recipients []*User `json:"recipients"`
 
 	// The messages in the channel. This is only present in state-cached channels,
-	// and State.MaxMessageCount must be non-zero.
+	// and State.MaxMessageCount must be non-zero, with no State.MessageCache.
 	Messages []*Message `json:"-"`
 
 	// A list of permission overwrites present for the channel.
@@ -84,6 +92,31 @@ type Channel struct {
 
 	// ApplicationID of the DM creator Zeroed if guild channel or not a bot user
 	ApplicationID string `json:"application_id"`
+
+	// Thread-specific fields, which are only set in threads. ParentID is
+	// the ID of the channel the thread was started in.
+	ThreadMetadata *ThreadMetadata `json:"thread_metadata,omitempty"`
+
+	// The thread member of the current user, if the user has joined the
+	// thread.
+	Member *ThreadMember `json:"member,omitempty"`
+
+	// An approximate count of the messages in the thread, which stops
+	// counting at 50.
+	MessageCount int `json:"message_count,omitempty"`
+
+	// An approximate count of the users in the thread, which stops counting
+	// at 50.
+	MemberCount int `json:"member_count,omitempty"`
+
+	// The default auto archive duration, in minutes, of the threads started
+	// in the channel.
+	DefaultAutoArchiveDuration int `json:"default_auto_archive_duration,omitempty"`
+}
+
+// IsThread reports whether the channel is a thread.
+func (c *Channel) IsThread() bool {
+	return c.Type == ChannelTypeGuildNewsThread || c.Type == ChannelTypeGuildPublicThread || c.Type == ChannelTypeGuildPrivateThread
 }
 
 // Mention returns a string which mentions the channel
@@ -102,6 +135,76 @@ type ChannelEdit struct {
 	PermissionOverwrites []*PermissionOverwrite `json:"permission_overwrites,omitempty"`
 	ParentID             string                 `json:"parent_id,omitempty"`
 	RateLimitPerUser     int                    `json:"rate_limit_per_user,omitempty"`
+
+	// Thread-specific fields.
+	Archived            *bool `json:"archived,omitempty"`
+	AutoArchiveDuration int   `json:"auto_archive_duration,omitempty"`
+	Locked              *bool `json:"locked,omitempty"`
+	Invitable           *bool `json:"invitable,omitempty"`
+}
+
+// ThreadMetadata holds the fields of a thread which other channels lack.
+type ThreadMetadata struct {
+	// Whether the thread is archived.
+	Archived bool `json:"archived"`
+
+	// The minutes of inactivity after which the thread is archived: 60,
+	// 1440, 4320 or 10080.
+	AutoArchiveDuration int `json:"auto_archive_duration"`
+
+	// When the thread was last archived or unarchived.
+	ArchiveTimestamp Timestamp `json:"archive_timestamp"`
+
+	// Whether the thread is locked, so that only users with the
+	// MANAGE_THREADS permission may unarchive it.
+	Locked bool `json:"locked"`
+
+	// Whether non-moderators may add other non-moderators to the thread;
+	// only set in private threads.
+	Invitable bool `json:"invitable"`
+}
+
+// A ThreadMember is a user who has joined a thread.
+type ThreadMember struct {
+	// The ID of the thread; not set in the member of a thread.
+	ID string `json:"id,omitempty"`
+
+	// The ID of the user; not set in the member of a thread.
+	UserID string `json:"user_id,omitempty"`
+
+	// When the user last joined the thread.
+	JoinTimestamp Timestamp `json:"join_timestamp"`
+
+	// The notification settings of the user in the thread.
+	Flags int `json:"flags"`
+}
+
+// An AddedThreadMember is a member added to a thread, as sent in a
+// ThreadMembersUpdate event.
+type AddedThreadMember struct {
+	*ThreadMember
+	Member   *Member   `json:"member"`
+	Presence *Presence `json:"presence"`
+}
+
+// A ThreadStart holds the fields of a thread to start.
+type ThreadStart struct {
+	Name                string      `json:"name"`
+	AutoArchiveDuration int         `json:"auto_archive_duration,omitempty"`
+	Type                ChannelType `json:"type,omitempty"`
+	Invitable           *bool       `json:"invitable,omitempty"`
+	RateLimitPerUser    int         `json:"rate_limit_per_user,omitempty"`
+}
+
+// A ThreadsList holds a list of threads, with the thread members of the
+// current user in those it has joined.
+type ThreadsList struct {
+	Threads []*Channel      `json:"threads"`
+	Members []*ThreadMember `json:"members"`
+
+	// Whether there are more threads to fetch, in lists of archived
+	// threads.
+	HasMore bool `json:"has_more"`
 }
 
 // A ChannelFollow holds data returned after following a news channel
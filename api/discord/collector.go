@@ -0,0 +1,176 @@
+// Discord bindings for the Hrngh bot.
+// Available at https://github.com/abeiron/hrngh
+
+// Copyright 2020-2021, Undying Memory <abeiron@outlook.com>.  All rights reserved.
+// Use of this source code is governed by the Microsoft Public License
+// that can be found in the LICENSE file.
+
+// This file contains code for collecting component interactions on a
+// single message.
+
+package discord
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultCollectorTimeout is the lifetime of a Collector created without
+// an explicit timeout.
+const DefaultCollectorTimeout = 5 * time.Minute
+
+// CollectorOptions configures a Collector.
+type CollectorOptions struct {
+	// Max is the number of interactions after which the collector ends.
+	// If zero, the collector runs until its timeout.
+	Max int
+
+	// Timeout bounds the lifetime of the collector.
+	// If zero, DefaultCollectorTimeout is used.
+	Timeout time.Duration
+
+	// Filter decides whether an interaction is passed to the handler and
+	// counted towards Max.  Rejected interactions are acknowledged without
+	// a response.  If nil, every interaction is accepted.
+	Filter func(ctx *InteractionContext) bool
+}
+
+// A Collector waits for component interactions on one message, up to a
+// number of interactions or until a timeout, whichever comes first.  When
+// it ends, the components of the message are disabled and the collector
+// removes itself from its router, so nothing is left behind when nobody
+// clicks.
+type Collector struct {
+	ChannelID string
+	MessageID string
+
+	session *Session
+	router  *ComponentRouter
+	handler InteractionHandler
+	opts    CollectorOptions
+
+	mu         sync.Mutex
+	count      int
+	components []MessageComponent
+	ended      bool
+	timer      *time.Timer
+	done       chan struct{}
+}
+
+// Collect starts a collector on message m which passes each component
+// interaction on it to h.  Interactions on m are routed to the collector
+// before any custom_id pattern is tried.
+func (r *ComponentRouter) Collect(s *Session, m *Message, opts CollectorOptions, h InteractionHandler) *Collector {
+	if opts.Timeout == 0 {
+		opts.Timeout = DefaultCollectorTimeout
+	}
+
+	c := &Collector{
+		ChannelID:  m.ChannelID,
+		MessageID:  m.ID,
+		session:    s,
+		router:     r,
+		handler:    h,
+		opts:       opts,
+		components: m.Components,
+		done:       make(chan struct{}),
+	}
+
+	r.Lock()
+	if old, ok := r.collectors[m.ID]; ok {
+		defer old.Stop()
+	}
+	r.collectors[m.ID] = c
+	r.Unlock()
+
+	// The collector may already have ended, if interactions reached Max.
+	c.mu.Lock()
+	if !c.ended {
+		c.timer = time.AfterFunc(opts.Timeout, c.Stop)
+	}
+	c.mu.Unlock()
+
+	return c
+}
+
+// Count returns the number of interactions collected so far.
+func (c *Collector) Count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.count
+}
+
+// Done returns a channel that is closed when the collector ends.
+func (c *Collector) Done() <-chan struct{} {
+	return c.done
+}
+
+// Stop ends the collector early, disabling the message's components.
+// It is safe to call Stop more than once.
+func (c *Collector) Stop() {
+	c.mu.Lock()
+	if c.ended {
+		c.mu.Unlock()
+		return
+	}
+	c.ended = true
+	components := c.components
+	timer := c.timer
+	c.mu.Unlock()
+
+	if timer != nil {
+		timer.Stop()
+	}
+
+	c.router.Lock()
+	if c.router.collectors[c.MessageID] == c {
+		delete(c.router.collectors, c.MessageID)
+	}
+	c.router.Unlock()
+
+	close(c.done)
+
+	if len(components) == 0 {
+		return
+	}
+
+	edit := NewMessageEdit(c.ChannelID, c.MessageID).SetComponents(DisableComponents(components)...)
+	if _, err := c.session.ChannelMessageEditComplex(edit); err != nil {
+		c.session.log(LogWarning, "error disabling components of message %s, %s", c.MessageID, err)
+	}
+}
+
+// handle passes an interaction to the collector's handler, ending the
+// collector once Max interactions have been collected.
+func (c *Collector) handle(ctx *InteractionContext) error {
+	if c.opts.Filter != nil && !c.opts.Filter(ctx) {
+		return nil
+	}
+
+	c.mu.Lock()
+	if c.ended {
+		c.mu.Unlock()
+		return nil
+	}
+	c.count++
+	last := c.opts.Max > 0 && c.count >= c.opts.Max
+	if ctx.Interaction.Message != nil {
+		c.components = ctx.Interaction.Message.Components
+	}
+	c.mu.Unlock()
+
+	var err error
+	if c.handler != nil {
+		err = c.handler(ctx)
+	}
+
+	if last {
+		// Acknowledge the final interaction before editing the message, so
+		// the edit does not eat into the interaction's response deadline.
+		ctx.finish()
+		c.Stop()
+	}
+
+	return err
+}
@@ -0,0 +1,423 @@
+// Discord bindings for the Hrngh bot.
+// Available at https://github.com/abeiron/hrngh
+
+// Copyright 2020-2021, Undying Memory <abeiron@outlook.com>.  All rights reserved.
+// Use of this source code is governed by the Microsoft Public License
+// that can be found in the LICENSE file.
+
+// This file contains typed accessors for the options of an application
+// command interaction and the targets of context menu commands.
+
+package discord
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Errors returned, wrapped in an OptionError, by CommandOptions accessors.
+var (
+	ErrOptionNotFound   = errors.New("option not provided")
+	ErrOptionType       = errors.New("option has a different type")
+	ErrOptionUnresolved = errors.New("option value missing from resolved data")
+	ErrOptionValue      = errors.New("option value is malformed")
+	ErrOptionRange      = errors.New("option value is out of range")
+)
+
+// ErrNotContextMenu is returned when the target of an interaction which is
+// not a context menu command of the requested kind is asked for.
+var ErrNotContextMenu = errors.New("interaction is not a context menu command of this type")
+
+// An OptionError describes why an option could not be read.
+type OptionError struct {
+	// Name is the name of the option.
+	Name string
+
+	// Want is the type which was asked for, and Got the type which was
+	// received.  Got is zero if the option was not provided.
+	Want ApplicationCommandOptionType
+	Got  ApplicationCommandOptionType
+
+	Err error
+}
+
+func (e *OptionError) Error() string {
+	if e.Err == ErrOptionType {
+		return fmt.Sprintf("option %q: expected %s, got %s", e.Name, e.Want, e.Got)
+	}
+
+	return fmt.Sprintf("option %q: %s", e.Name, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *OptionError) Unwrap() error { return e.Err }
+
+// CommandOptions gives typed access to the options at one level of an
+// application command: the top level, or the options of a subcommand.
+// Values of user, member, channel, role and attachment options are looked
+// up in the resolved data of the interaction.
+type CommandOptions struct {
+	guildID  string
+	options  []*ApplicationCommandInteractionDataOption
+	resolved *ApplicationCommandInteractionDataResolved
+}
+
+// Options returns the top level options of an application command
+// interaction.
+func (i *Interaction) Options() *CommandOptions {
+	o := &CommandOptions{guildID: i.GuildID}
+
+	if data, ok := i.Data.(ApplicationCommandInteractionData); ok {
+		o.options = data.Options
+		o.resolved = data.Resolved
+	}
+
+	return o
+}
+
+// Options returns the top level options of the command the context's
+// interaction invokes.
+func (ctx *InteractionContext) Options() *CommandOptions {
+	return ctx.Interaction.Options()
+}
+
+// All returns the raw options at this level.
+func (o *CommandOptions) All() []*ApplicationCommandInteractionDataOption {
+	return o.options
+}
+
+// Has reports whether the named option was provided.
+func (o *CommandOptions) Has(name string) bool {
+	return o.find(name) != nil
+}
+
+// find returns the named option, or nil.
+func (o *CommandOptions) find(name string) *ApplicationCommandInteractionDataOption {
+	for _, opt := range o.options {
+		if opt.Name == name {
+			return opt
+		}
+	}
+
+	return nil
+}
+
+// get returns the named option, checking that it has one of the given types.
+func (o *CommandOptions) get(name string, want ...ApplicationCommandOptionType) (*ApplicationCommandInteractionDataOption, error) {
+	opt := o.find(name)
+	if opt == nil {
+		return nil, &OptionError{Name: name, Want: want[0], Err: ErrOptionNotFound}
+	}
+
+	for _, t := range want {
+		if opt.Type == t {
+			return opt, nil
+		}
+	}
+
+	return nil, &OptionError{Name: name, Want: want[0], Got: opt.Type, Err: ErrOptionType}
+}
+
+// id returns the snowflake value of an option.
+func (o *CommandOptions) id(opt *ApplicationCommandInteractionDataOption) (string, error) {
+	id, ok := opt.Value.(string)
+	if !ok || id == "" {
+		return "", &OptionError{Name: opt.Name, Want: opt.Type, Got: opt.Type, Err: ErrOptionValue}
+	}
+
+	return id, nil
+}
+
+// String returns the value of a string option.
+func (o *CommandOptions) String(name string) (string, error) {
+	opt, err := o.get(name, ApplicationCommandOptionString)
+	if err != nil {
+		return "", err
+	}
+
+	v, ok := opt.Value.(string)
+	if !ok {
+		return "", &OptionError{Name: name, Want: opt.Type, Got: opt.Type, Err: ErrOptionValue}
+	}
+
+	return v, nil
+}
+
+// Int returns the value of an integer option.
+func (o *CommandOptions) Int(name string) (int64, error) {
+	opt, err := o.get(name, ApplicationCommandOptionInteger)
+	if err != nil {
+		return 0, err
+	}
+
+	switch v := opt.Value.(type) {
+	case float64:
+		return int64(v), nil
+	case string:
+		// Autocomplete interactions carry the partial input as typed.
+		i, err := strconv.ParseInt(v, 10, 64)
+		if err == nil {
+			return i, nil
+		}
+	}
+
+	return 0, &OptionError{Name: name, Want: opt.Type, Got: opt.Type, Err: ErrOptionValue}
+}
+
+// Float returns the value of a number option.  Integer options are
+// accepted too.
+func (o *CommandOptions) Float(name string) (float64, error) {
+	opt, err := o.get(name, ApplicationCommandOptionNumber, ApplicationCommandOptionInteger)
+	if err != nil {
+		return 0, err
+	}
+
+	switch v := opt.Value.(type) {
+	case float64:
+		return v, nil
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		if err == nil {
+			return f, nil
+		}
+	}
+
+	return 0, &OptionError{Name: name, Want: opt.Type, Got: opt.Type, Err: ErrOptionValue}
+}
+
+// Bool returns the value of a boolean option.
+func (o *CommandOptions) Bool(name string) (bool, error) {
+	opt, err := o.get(name, ApplicationCommandOptionBoolean)
+	if err != nil {
+		return false, err
+	}
+
+	v, ok := opt.Value.(bool)
+	if !ok {
+		return false, &OptionError{Name: name, Want: opt.Type, Got: opt.Type, Err: ErrOptionValue}
+	}
+
+	return v, nil
+}
+
+// User returns the user given for a user or mentionable option.
+func (o *CommandOptions) User(name string) (*User, error) {
+	opt, err := o.get(name, ApplicationCommandOptionUser, ApplicationCommandOptionMentionable)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := o.id(opt)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.resolved != nil {
+		if u, ok := o.resolved.Users[id]; ok {
+			return u, nil
+		}
+	}
+
+	if opt.Type == ApplicationCommandOptionMentionable {
+		return nil, &OptionError{Name: name, Want: ApplicationCommandOptionUser, Got: ApplicationCommandOptionRole, Err: ErrOptionType}
+	}
+
+	return nil, &OptionError{Name: name, Want: opt.Type, Got: opt.Type, Err: ErrOptionUnresolved}
+}
+
+// Member returns the guild member given for a user or mentionable option.
+// The member is only resolved for commands invoked in a guild, and only if
+// the user is a member of it.
+func (o *CommandOptions) Member(name string) (*Member, error) {
+	u, err := o.User(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return resolveMember(o.resolved, o.guildID, u, name)
+}
+
+// resolveMember combines the partial member and the user resolved for id.
+func resolveMember(resolved *ApplicationCommandInteractionDataResolved, guildID string, u *User, name string) (*Member, error) {
+	if resolved == nil {
+		return nil, &OptionError{Name: name, Want: ApplicationCommandOptionUser, Err: ErrOptionUnresolved}
+	}
+
+	m, ok := resolved.Members[u.ID]
+	if !ok {
+		return nil, &OptionError{Name: name, Want: ApplicationCommandOptionUser, Err: ErrOptionUnresolved}
+	}
+
+	member := *m
+	member.User = u
+	member.GuildID = guildID
+
+	return &member, nil
+}
+
+// Channel returns the channel given for a channel option.  Only the ID,
+// name, type and permissions of the channel are resolved.
+func (o *CommandOptions) Channel(name string) (*Channel, error) {
+	opt, err := o.get(name, ApplicationCommandOptionChannel)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := o.id(opt)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.resolved != nil {
+		if c, ok := o.resolved.Channels[id]; ok {
+			return c, nil
+		}
+	}
+
+	return nil, &OptionError{Name: name, Want: opt.Type, Got: opt.Type, Err: ErrOptionUnresolved}
+}
+
+// Role returns the role given for a role or mentionable option.
+func (o *CommandOptions) Role(name string) (*Role, error) {
+	opt, err := o.get(name, ApplicationCommandOptionRole, ApplicationCommandOptionMentionable)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := o.id(opt)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.resolved != nil {
+		if r, ok := o.resolved.Roles[id]; ok {
+			return r, nil
+		}
+	}
+
+	if opt.Type == ApplicationCommandOptionMentionable {
+		return nil, &OptionError{Name: name, Want: ApplicationCommandOptionRole, Got: ApplicationCommandOptionUser, Err: ErrOptionType}
+	}
+
+	return nil, &OptionError{Name: name, Want: opt.Type, Got: opt.Type, Err: ErrOptionUnresolved}
+}
+
+// Attachment returns the file given for an attachment option.
+func (o *CommandOptions) Attachment(name string) (*MessageAttachment, error) {
+	opt, err := o.get(name, ApplicationCommandOptionAttachment)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := o.id(opt)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.resolved != nil {
+		if a, ok := o.resolved.Attachments[id]; ok {
+			return a, nil
+		}
+	}
+
+	return nil, &OptionError{Name: name, Want: opt.Type, Got: opt.Type, Err: ErrOptionUnresolved}
+}
+
+// sub returns the subcommand or subcommand group at this level.
+func (o *CommandOptions) sub(t ApplicationCommandOptionType) (string, *CommandOptions, error) {
+	for _, opt := range o.options {
+		switch opt.Type {
+		case t:
+			return opt.Name, &CommandOptions{guildID: o.guildID, options: opt.Options, resolved: o.resolved}, nil
+		case ApplicationCommandOptionSubCommand, ApplicationCommandOptionSubCommandGroup:
+			return "", nil, &OptionError{Name: opt.Name, Want: t, Got: opt.Type, Err: ErrOptionType}
+		}
+	}
+
+	return "", nil, &OptionError{Want: t, Err: ErrOptionNotFound}
+}
+
+// Subcommand returns the name and the options of the subcommand invoked at
+// this level.
+func (o *CommandOptions) Subcommand() (string, *CommandOptions, error) {
+	return o.sub(ApplicationCommandOptionSubCommand)
+}
+
+// SubcommandGroup returns the name and the options of the subcommand group
+// invoked at this level.  Call Subcommand on the returned options to get to
+// the subcommand itself.
+func (o *CommandOptions) SubcommandGroup() (string, *CommandOptions, error) {
+	return o.sub(ApplicationCommandOptionSubCommandGroup)
+}
+
+// Path returns the names of the subcommand group and subcommand invoked
+// below this level, if any, and the options of the innermost of them.
+func (o *CommandOptions) Path() ([]string, *CommandOptions) {
+	var path []string
+
+	for {
+		var next *CommandOptions
+		for _, opt := range o.options {
+			if opt.Type == ApplicationCommandOptionSubCommand || opt.Type == ApplicationCommandOptionSubCommandGroup {
+				path = append(path, opt.Name)
+				next = &CommandOptions{guildID: o.guildID, options: opt.Options, resolved: o.resolved}
+				break
+			}
+		}
+
+		if next == nil {
+			return path, o
+		}
+		o = next
+	}
+}
+
+// TargetUser returns the user a USER context menu command was invoked on.
+func (i *Interaction) TargetUser() (*User, error) {
+	data, ok := i.Data.(ApplicationCommandInteractionData)
+	if !ok || data.CommandType != UserApplicationCommand {
+		return nil, ErrNotContextMenu
+	}
+
+	if data.Resolved != nil {
+		if u, ok := data.Resolved.Users[data.TargetID]; ok {
+			return u, nil
+		}
+	}
+
+	return nil, ErrOptionUnresolved
+}
+
+// TargetMember returns the guild member a USER context menu command was
+// invoked on.  It fails for commands invoked outside a guild.
+func (i *Interaction) TargetMember() (*Member, error) {
+	u, err := i.TargetUser()
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := resolveMember(i.ApplicationCommandData().Resolved, i.GuildID, u, "")
+	if err != nil {
+		return nil, ErrOptionUnresolved
+	}
+
+	return m, nil
+}
+
+// TargetMessage returns the message a MESSAGE context menu command was
+// invoked on.
+func (i *Interaction) TargetMessage() (*Message, error) {
+	data, ok := i.Data.(ApplicationCommandInteractionData)
+	if !ok || data.CommandType != MessageApplicationCommand {
+		return nil, ErrNotContextMenu
+	}
+
+	if data.Resolved != nil {
+		if m, ok := data.Resolved.Messages[data.TargetID]; ok {
+			return m, nil
+		}
+	}
+
+	return nil, ErrOptionUnresolved
+}
@@ -0,0 +1,388 @@
+// Discord bindings for the Hrngh bot.
+// Available at https://github.com/abeiron/hrngh
+
+// Copyright 2020-2021, Undying Memory <abeiron@outlook.com>.  All rights reserved.
+// Use of this source code is governed by the Microsoft Public License
+// that can be found in the LICENSE file.
+
+// This file contains code for registering slash commands defined as Go
+// structs and routing their interactions.
+
+package discord
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// commandNode is a command, subcommand group or subcommand.  Nodes with a
+// schema are invoked; the others only hold children.
+type commandNode struct {
+	name        string
+	description string
+	schema      *commandSchema
+	middleware  []Middleware
+	children    map[string]*commandNode
+}
+
+// child returns the named child of the node, creating it if needed.
+func (n *commandNode) child(name string) *commandNode {
+	if n.children == nil {
+		n.children = make(map[string]*commandNode)
+	}
+
+	c, ok := n.children[name]
+	if !ok {
+		c = &commandNode{name: name, description: name}
+		n.children[name] = c
+	}
+
+	return c
+}
+
+// sortedChildren returns the children of the node sorted by name.
+func (n *commandNode) sortedChildren() []*commandNode {
+	children := make([]*commandNode, 0, len(n.children))
+	for _, c := range n.children {
+		children = append(children, c)
+	}
+
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].name < children[j].name
+	})
+
+	return children
+}
+
+// option returns the node as a subcommand or subcommand group option.
+func (n *commandNode) option() *ApplicationCommandOption {
+	if n.schema != nil {
+		return &ApplicationCommandOption{
+			Type:        ApplicationCommandOptionSubCommand,
+			Name:        n.name,
+			Description: n.description,
+			Options:     n.schema.options(),
+		}
+	}
+
+	opt := &ApplicationCommandOption{
+		Type:        ApplicationCommandOptionSubCommandGroup,
+		Name:        n.name,
+		Description: n.description,
+	}
+	for _, c := range n.sortedChildren() {
+		opt.Options = append(opt.Options, c.option())
+	}
+
+	return opt
+}
+
+// CommandRouter holds slash commands defined as structs implementing
+// SlashCommand.  It generates their ApplicationCommand definitions and
+// dispatches application command and autocomplete interactions to them.
+type CommandRouter struct {
+	sync.RWMutex
+
+	// NotFound is called for chat commands which are not registered.  If
+	// nil, such interactions are acknowledged without a response.
+	NotFound InteractionHandler
+
+	commands   map[string]*commandNode
+	middleware []Middleware
+}
+
+// CommandMiddleware is implemented by slash commands which need middleware
+// of their own, such as permission checks or cooldowns.  It is called once
+// when the command is registered.
+type CommandMiddleware interface {
+	Middleware() []Middleware
+}
+
+// NewCommandRouter creates an empty CommandRouter.
+func NewCommandRouter() *CommandRouter {
+	return &CommandRouter{
+		commands: make(map[string]*commandNode),
+	}
+}
+
+// splitCommandPath splits and validates a command path.
+func splitCommandPath(path string) ([]string, error) {
+	names := strings.Fields(path)
+	if len(names) == 0 || len(names) > 3 {
+		return nil, fmt.Errorf("command path %q must have one to three names", path)
+	}
+
+	for _, name := range names {
+		if !commandNameRegexp.MatchString(name) {
+			return nil, fmt.Errorf("invalid command name %q in %q", name, path)
+		}
+	}
+
+	return names, nil
+}
+
+// node returns the node for a path, creating it and its parents if needed.
+func (r *CommandRouter) node(names []string) *commandNode {
+	n, ok := r.commands[names[0]]
+	if !ok {
+		n = &commandNode{name: names[0], description: names[0]}
+		r.commands[names[0]] = n
+	}
+
+	for _, name := range names[1:] {
+		n = n.child(name)
+	}
+
+	return n
+}
+
+// Register adds a slash command.  path is the name of the command, or of
+// the command and its subcommand, or of the command, subcommand group and
+// subcommand, separated by spaces; e.g. "ban" or "config set".
+// description is shown to users and must be at most 100 characters.
+//
+// cmd must be a pointer to a struct; see SlashCommand for how its fields
+// map to options.  An error is returned if the struct is not a valid
+// command, or if the path clashes with a registered command.
+func (r *CommandRouter) Register(path, description string, cmd SlashCommand) error {
+	names, err := splitCommandPath(path)
+	if err != nil {
+		return err
+	}
+
+	if description == "" || len(description) > 100 {
+		return fmt.Errorf("description of command %q must be 1 to 100 characters", path)
+	}
+
+	schema, err := parseCommandStruct(cmd)
+	if err != nil {
+		return err
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	// A command with subcommands cannot be invoked itself.
+	n, ok := r.commands[names[0]]
+	for i, name := range names[1:] {
+		if !ok {
+			break
+		}
+		if n.schema != nil {
+			return fmt.Errorf("command %q is registered, so it cannot have subcommands", strings.Join(names[:i+1], " "))
+		}
+		n, ok = n.children[name]
+	}
+
+	if ok && (n.schema != nil || len(n.children) > 0) {
+		return fmt.Errorf("command %q is already registered", path)
+	}
+
+	n = r.node(names)
+	n.description = description
+	n.schema = schema
+	if cm, ok := cmd.(CommandMiddleware); ok {
+		n.middleware = cm.Middleware()
+	}
+
+	return nil
+}
+
+// MustRegister is like Register but panics on error.  It is meant for
+// registering commands at startup.
+func (r *CommandRouter) MustRegister(path, description string, cmd SlashCommand) {
+	if err := r.Register(path, description, cmd); err != nil {
+		panic(err)
+	}
+}
+
+// Use adds middleware which wraps every command of the router, outside
+// of the commands' own middleware.  It applies to autocompletion too.
+func (r *CommandRouter) Use(mw ...Middleware) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.middleware = append(r.middleware, mw...)
+}
+
+// Describe sets the description of a command or subcommand group which
+// only holds subcommands.  Without one, its name is used.
+func (r *CommandRouter) Describe(path, description string) error {
+	names, err := splitCommandPath(path)
+	if err != nil {
+		return err
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	r.node(names).description = description
+	return nil
+}
+
+// ApplicationCommands returns the definitions of the registered commands,
+// sorted by name, ready to be created with
+// Session.ApplicationCommandBulkOverwrite.
+func (r *CommandRouter) ApplicationCommands() []*ApplicationCommand {
+	r.RLock()
+	defer r.RUnlock()
+
+	commands := make([]*ApplicationCommand, 0, len(r.commands))
+	for _, n := range r.commands {
+		cmd := &ApplicationCommand{
+			Type:        ChatApplicationCommand,
+			Name:        n.name,
+			Description: n.description,
+		}
+
+		if n.schema != nil {
+			cmd.Options = n.schema.options()
+		} else {
+			for _, c := range n.sortedChildren() {
+				cmd.Options = append(cmd.Options, c.option())
+			}
+		}
+
+		commands = append(commands, cmd)
+	}
+
+	sort.Slice(commands, func(i, j int) bool {
+		return commands[i].Name < commands[j].Name
+	})
+
+	return commands
+}
+
+// Sync overwrites the commands of the application, in a guild or globally
+// if guildID is empty, with the registered commands.
+func (r *CommandRouter) Sync(s *Session, appID, guildID string) ([]*ApplicationCommand, error) {
+	return s.ApplicationCommandBulkOverwrite(appID, guildID, r.ApplicationCommands())
+}
+
+// lookup finds the invoked command, the options at its level and the
+// middleware wrapping it.
+func (r *CommandRouter) lookup(i *Interaction) (*commandNode, *CommandOptions, []Middleware) {
+	data := i.ApplicationCommandData()
+
+	r.RLock()
+	defer r.RUnlock()
+
+	n, ok := r.commands[data.Name]
+	if !ok {
+		return nil, nil, nil
+	}
+
+	path, opts := i.Options().Path()
+	for _, name := range path {
+		if n, ok = n.children[name]; !ok {
+			return nil, nil, nil
+		}
+	}
+
+	if n.schema == nil {
+		return nil, nil, nil
+	}
+
+	mw := make([]Middleware, 0, len(r.middleware)+len(n.middleware))
+	mw = append(mw, r.middleware...)
+	mw = append(mw, n.middleware...)
+
+	return n, opts, mw
+}
+
+// HandleInteraction binds the options of a chat command interaction into
+// a copy of the registered command and runs it.  If the options do not
+// fit the command, the user is told so in an ephemeral reply.
+// Autocomplete interactions are passed to the command's Autocomplete
+// method.  Interactions of other types are ignored.
+//
+// HandleInteraction is an InteractionHandler, so a CommandRouter can be
+// used directly as the Handler of an InteractionServer.
+func (r *CommandRouter) HandleInteraction(ctx *InteractionContext) error {
+	switch ctx.Interaction.Type {
+	case InteractionApplicationCommand, InteractionApplicationCommandAutocomplete:
+	default:
+		return nil
+	}
+
+	data := ctx.Interaction.ApplicationCommandData()
+	if data.CommandType != 0 && data.CommandType != ChatApplicationCommand {
+		return nil
+	}
+
+	n, opts, mw := r.lookup(ctx.Interaction)
+
+	if n == nil {
+		if ctx.Interaction.Type == InteractionApplicationCommandAutocomplete {
+			return ctx.Autocomplete()
+		}
+		if r.NotFound != nil {
+			return r.NotFound(ctx)
+		}
+		return nil
+	}
+
+	h := func(ctx *InteractionContext) error {
+		if ctx.Interaction.Type == InteractionApplicationCommandAutocomplete {
+			return n.autocomplete(ctx, opts)
+		}
+
+		cmd, err := n.schema.bind(opts, false)
+		if err != nil {
+			return ctx.ReplyEphemeral(fmt.Sprintf("Invalid command options: %s.", err))
+		}
+
+		return cmd.Run(ctx)
+	}
+
+	return Chain(h, mw...)(ctx)
+}
+
+// autocomplete answers an autocomplete interaction for the command.
+func (n *commandNode) autocomplete(ctx *InteractionContext, opts *CommandOptions) error {
+	ac := FocusedOption(ctx.Interaction.ApplicationCommandData())
+	if ac == nil {
+		return ctx.Autocomplete()
+	}
+
+	cmd, _ := n.schema.bind(opts, true)
+	completer, ok := cmd.(CommandAutocompleter)
+	if !ok {
+		return ctx.Autocomplete()
+	}
+
+	choices, err := completer.Autocomplete(ctx, ac)
+	if err != nil {
+		ctx.Autocomplete()
+		return err
+	}
+
+	return ctx.Autocomplete(choices...)
+}
+
+// Attach routes application command and autocomplete interactions
+// received from the gateway by s through the router.
+//
+// The return value of this method is a function, that when called will
+// detach the router from the session.
+func (r *CommandRouter) Attach(s *Session) func() {
+	return s.AddHandler(func(s *Session, i *InteractionCreate) {
+		if i.Type != InteractionApplicationCommand && i.Type != InteractionApplicationCommandAutocomplete {
+			return
+		}
+
+		// Context menu commands are left to other handlers.
+		if t := i.ApplicationCommandData().CommandType; t != 0 && t != ChatApplicationCommand {
+			return
+		}
+
+		ctx := NewInteractionContext(s, i.Interaction)
+		if err := r.HandleInteraction(ctx); err != nil {
+			s.log(LogError, "error handling command interaction %s, %s", i.ID, err)
+		}
+
+		ctx.finish()
+	})
+}
@@ -0,0 +1,107 @@
+// Discord bindings for the Hrngh bot.
+// Available at https://github.com/abeiron/hrngh
+
+// Copyright 2020-2021, Undying Memory <abeiron@outlook.com>.  All rights reserved.
+// Use of this source code is governed by the Microsoft Public License
+// that can be found in the LICENSE file.
+
+// This file contains code related to application commands: slash commands
+// and user and message context menu commands.
+
+package discord
+
+import "fmt"
+
+// ApplicationCommandType represents the type of application command.
+// https://discord.com/developers/docs/interactions/application-commands#application-command-object-application-command-types
+type ApplicationCommandType uint8
+
+// Block contains known ApplicationCommandType values
+const (
+	// ChatApplicationCommand is default command type. They are slash commands (i.e. called directly from the chat).
+	ChatApplicationCommand ApplicationCommandType = 1
+	// UserApplicationCommand adds command to user context menu.
+	UserApplicationCommand ApplicationCommandType = 2
+	// MessageApplicationCommand adds command to message context menu.
+	MessageApplicationCommand ApplicationCommandType = 3
+)
+
+// ApplicationCommand represents an application's slash command.
+type ApplicationCommand struct {
+	ID                string                 `json:"id,omitempty"`
+	ApplicationID     string                 `json:"application_id,omitempty"`
+	GuildID           string                 `json:"guild_id,omitempty"`
+	Version           string                 `json:"version,omitempty"`
+	Type              ApplicationCommandType `json:"type,omitempty"`
+	Name              string                 `json:"name"`
+	DefaultPermission *bool                  `json:"default_permission,omitempty"`
+
+	// NOTE: Chat commands only. Otherwise it mustn't be set.
+
+	Description string                      `json:"description,omitempty"`
+	Options     []*ApplicationCommandOption `json:"options,omitempty"`
+}
+
+// ApplicationCommandOptionType indicates the type of a slash command's option.
+type ApplicationCommandOptionType uint8
+
+// Block contains known ApplicationCommandOptionType values
+const (
+	ApplicationCommandOptionSubCommand      ApplicationCommandOptionType = 1
+	ApplicationCommandOptionSubCommandGroup ApplicationCommandOptionType = 2
+	ApplicationCommandOptionString          ApplicationCommandOptionType = 3
+	ApplicationCommandOptionInteger         ApplicationCommandOptionType = 4
+	ApplicationCommandOptionBoolean         ApplicationCommandOptionType = 5
+	ApplicationCommandOptionUser            ApplicationCommandOptionType = 6
+	ApplicationCommandOptionChannel         ApplicationCommandOptionType = 7
+	ApplicationCommandOptionRole            ApplicationCommandOptionType = 8
+	ApplicationCommandOptionMentionable     ApplicationCommandOptionType = 9
+	ApplicationCommandOptionNumber          ApplicationCommandOptionType = 10
+	ApplicationCommandOptionAttachment      ApplicationCommandOptionType = 11
+)
+
+// String returns the name of the option type.
+func (t ApplicationCommandOptionType) String() string {
+	switch t {
+	case ApplicationCommandOptionSubCommand:
+		return "SubCommand"
+	case ApplicationCommandOptionSubCommandGroup:
+		return "SubCommandGroup"
+	case ApplicationCommandOptionString:
+		return "String"
+	case ApplicationCommandOptionInteger:
+		return "Integer"
+	case ApplicationCommandOptionBoolean:
+		return "Boolean"
+	case ApplicationCommandOptionUser:
+		return "User"
+	case ApplicationCommandOptionChannel:
+		return "Channel"
+	case ApplicationCommandOptionRole:
+		return "Role"
+	case ApplicationCommandOptionMentionable:
+		return "Mentionable"
+	case ApplicationCommandOptionNumber:
+		return "Number"
+	case ApplicationCommandOptionAttachment:
+		return "Attachment"
+	}
+	return fmt.Sprintf("ApplicationCommandOptionType(%d)", t)
+}
+
+// ApplicationCommandOption represents an option/subcommand/subcommands group.
+type ApplicationCommandOption struct {
+	Type         ApplicationCommandOptionType      `json:"type"`
+	Name         string                            `json:"name"`
+	Description  string                            `json:"description,omitempty"`
+	ChannelTypes []ChannelType                     `json:"channel_types,omitempty"`
+	Required     bool                              `json:"required"`
+	Options      []*ApplicationCommandOption       `json:"options,omitempty"`
+	Autocomplete bool                              `json:"autocomplete,omitempty"`
+	Choices      []*ApplicationCommandOptionChoice `json:"choices,omitempty"`
+
+	// Minimal value of number/integer option.
+	MinValue *float64 `json:"min_value,omitempty"`
+	// Maximum value of number/integer option.
+	MaxValue *float64 `json:"max_value,omitempty"`
+}
@@ -0,0 +1,527 @@
+// Discord bindings for the Hrngh bot.
+// Available at https://github.com/abeiron/hrngh
+
+// Copyright 2020-2021, Undying Memory <abeiron@outlook.com>.  All rights reserved.
+// Use of this source code is governed by the Microsoft Public License
+// that can be found in the LICENSE file.
+
+// This file contains code which derives the options of slash commands from
+// the fields of Go structs and binds interaction options into them.
+
+package discord
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SlashCommand is implemented by structs describing slash commands.  The
+// exported fields of the struct tagged with `option` become the options of
+// the command:
+//
+//	type Ban struct {
+//		User   *discord.User `option:"user,required" description:"The user to ban"`
+//		Days   int           `option:"days,min=0,max=7" description:"Days of messages to delete"`
+//		Reason *string       `option:"reason" description:"Why"`
+//	}
+//
+// The option tag holds the option name followed by comma separated flags:
+//
+//	required       the option must be given.
+//	min=N, max=N   bounds of an integer or number option.
+//	choices=a|b|c  the values the option is limited to.
+//	autocomplete   the command implements CommandAutocompleter for it.
+//	channel=T|T    channel types a channel option accepts: text, dm,
+//	               voice, group, category, news and store.
+//
+// The option type follows from the field type: string, signed and unsigned
+// integers, floats, bool, *User, *Member, *Channel, *Role, *Mentionable
+// and *MessageAttachment.  Pointers to strings, numbers and bools are nil
+// when an optional option is not given.  Fields without an option tag are
+// copied over from the registered value, which makes them suitable for
+// dependencies such as database handles.  Embedded structs are searched
+// for options too.
+type SlashCommand interface {
+	// Run is called on a fresh copy of the registered value, with the
+	// options of the interaction bound into its fields.
+	Run(ctx *InteractionContext) error
+}
+
+// CommandAutocompleter is implemented by slash commands with options
+// flagged autocomplete.  The options which were already given are bound
+// into the receiver, as far as they are valid.
+type CommandAutocompleter interface {
+	Autocomplete(ctx *InteractionContext, ac *Autocomplete) ([]*ApplicationCommandOptionChoice, error)
+}
+
+// Mentionable holds the value of a mentionable option: a user, with the
+// guild member if any, or a role.
+type Mentionable struct {
+	User   *User
+	Member *Member
+	Role   *Role
+}
+
+// commandNameRegexp matches valid names of commands and options.
+var commandNameRegexp = regexp.MustCompile(`^[-_\p{Ll}\p{Lo}\p{N}]{1,32}$`)
+
+// channelTypeNames maps the names accepted by the channel flag to types.
+var channelTypeNames = map[string]ChannelType{
+	"text":     ChannelTypeGuildText,
+	"dm":       ChannelTypeDM,
+	"voice":    ChannelTypeGuildVoice,
+	"group":    ChannelTypeGroupDM,
+	"category": ChannelTypeGuildCategory,
+	"news":     ChannelTypeGuildNews,
+	"store":    ChannelTypeGuildStore,
+}
+
+var (
+	userType        = reflect.TypeOf((*User)(nil))
+	memberType      = reflect.TypeOf((*Member)(nil))
+	channelType     = reflect.TypeOf((*Channel)(nil))
+	roleType        = reflect.TypeOf((*Role)(nil))
+	mentionableType = reflect.TypeOf((*Mentionable)(nil))
+	attachmentType  = reflect.TypeOf((*MessageAttachment)(nil))
+)
+
+// commandField describes a struct field bound to an option.
+type commandField struct {
+	index  []int
+	option *ApplicationCommandOption
+
+	// optional is set for pointers to basic types, which are left nil if
+	// the option is not given.
+	optional bool
+	min, max *float64
+}
+
+// commandSchema describes the options of a slash command struct.
+type commandSchema struct {
+	typ    reflect.Type
+	proto  reflect.Value
+	fields []*commandField
+}
+
+// optionTypeOf returns the option type for a field type.
+func optionTypeOf(t reflect.Type) (ApplicationCommandOptionType, bool) {
+	switch t {
+	case userType, memberType:
+		return ApplicationCommandOptionUser, false
+	case channelType:
+		return ApplicationCommandOptionChannel, false
+	case roleType:
+		return ApplicationCommandOptionRole, false
+	case mentionableType:
+		return ApplicationCommandOptionMentionable, false
+	case attachmentType:
+		return ApplicationCommandOptionAttachment, false
+	}
+
+	optional := false
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		optional = true
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return ApplicationCommandOptionString, optional
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return ApplicationCommandOptionInteger, optional
+	case reflect.Float32, reflect.Float64:
+		return ApplicationCommandOptionNumber, optional
+	case reflect.Bool:
+		return ApplicationCommandOptionBoolean, optional
+	}
+
+	return 0, false
+}
+
+// parseCommandStruct derives the schema of a slash command struct.  cmd
+// must be a pointer to a struct.
+func parseCommandStruct(cmd SlashCommand) (*commandSchema, error) {
+	v := reflect.ValueOf(cmd)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("slash command %T is not a pointer to a struct", cmd)
+	}
+
+	schema := &commandSchema{typ: v.Elem().Type(), proto: v.Elem()}
+	if err := schema.addFields(schema.typ, nil); err != nil {
+		return nil, fmt.Errorf("slash command %T: %s", cmd, err)
+	}
+
+	seen := make(map[string]bool, len(schema.fields))
+	optional := false
+	for _, f := range schema.fields {
+		name := f.option.Name
+		if seen[name] {
+			return nil, fmt.Errorf("slash command %T: duplicate option %q", cmd, name)
+		}
+		seen[name] = true
+
+		if f.option.Required && optional {
+			return nil, fmt.Errorf("slash command %T: required option %q follows an optional one", cmd, name)
+		}
+		optional = !f.option.Required
+	}
+
+	if len(schema.fields) > 25 {
+		return nil, fmt.Errorf("slash command %T has more than 25 options", cmd)
+	}
+
+	return schema, nil
+}
+
+// addFields adds the options of the fields of t, which is found at index
+// within the command struct.
+func (cs *commandSchema) addFields(t reflect.Type, index []int) error {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		fieldIndex := append(append([]int(nil), index...), i)
+
+		tag, ok := sf.Tag.Lookup("option")
+		if !ok {
+			if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+				if err := cs.addFields(sf.Type, fieldIndex); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if sf.PkgPath != "" {
+			return fmt.Errorf("option field %s is not exported", sf.Name)
+		}
+
+		f, err := parseCommandField(sf, tag)
+		if err != nil {
+			return fmt.Errorf("field %s: %s", sf.Name, err)
+		}
+		f.index = fieldIndex
+
+		cs.fields = append(cs.fields, f)
+	}
+
+	return nil
+}
+
+// parseCommandField parses the option tag of a field.
+func parseCommandField(sf reflect.StructField, tag string) (*commandField, error) {
+	optType, optional := optionTypeOf(sf.Type)
+	if optType == 0 {
+		return nil, fmt.Errorf("unsupported option type %s", sf.Type)
+	}
+
+	parts := strings.Split(tag, ",")
+	name := parts[0]
+	if name == "" {
+		name = strings.ToLower(sf.Name)
+	}
+	if !commandNameRegexp.MatchString(name) {
+		return nil, fmt.Errorf("invalid option name %q", name)
+	}
+
+	description := sf.Tag.Get("description")
+	if description == "" {
+		description = name
+	}
+	if len(description) > 100 {
+		return nil, fmt.Errorf("description of option %q is longer than 100 characters", name)
+	}
+
+	f := &commandField{
+		optional: optional,
+		option: &ApplicationCommandOption{
+			Type:        optType,
+			Name:        name,
+			Description: description,
+		},
+	}
+
+	for _, flag := range parts[1:] {
+		key, value := flag, ""
+		if i := strings.IndexByte(flag, '='); i >= 0 {
+			key, value = flag[:i], flag[i+1:]
+		}
+
+		switch key {
+		case "required":
+			if optional {
+				return nil, fmt.Errorf("required option %q has pointer type %s", name, sf.Type)
+			}
+			f.option.Required = true
+
+		case "autocomplete":
+			f.option.Autocomplete = true
+
+		case "min", "max":
+			if optType != ApplicationCommandOptionInteger && optType != ApplicationCommandOptionNumber {
+				return nil, fmt.Errorf("%s given for non-numeric option %q", key, name)
+			}
+
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s for option %q: %s", key, name, err)
+			}
+
+			if key == "min" {
+				f.min = &n
+			} else {
+				f.max = &n
+			}
+
+		case "choices":
+			for _, c := range strings.Split(value, "|") {
+				choice, err := parseCommandChoice(optType, c)
+				if err != nil {
+					return nil, fmt.Errorf("invalid choice for option %q: %s", name, err)
+				}
+				f.option.Choices = append(f.option.Choices, choice)
+			}
+
+		case "channel":
+			if optType != ApplicationCommandOptionChannel {
+				return nil, fmt.Errorf("channel types given for non-channel option %q", name)
+			}
+
+			for _, c := range strings.Split(value, "|") {
+				ct, ok := channelTypeNames[c]
+				if !ok {
+					return nil, fmt.Errorf("unknown channel type %q for option %q", c, name)
+				}
+				f.option.ChannelTypes = append(f.option.ChannelTypes, ct)
+			}
+
+		default:
+			return nil, fmt.Errorf("unknown flag %q for option %q", key, name)
+		}
+	}
+
+	// Unsigned fields cannot hold negative values.
+	if optType == ApplicationCommandOptionInteger && f.min == nil {
+		switch sf.Type.Kind() {
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			zero := 0.0
+			f.min = &zero
+		}
+	}
+
+	if f.option.Autocomplete && len(f.option.Choices) > 0 {
+		return nil, fmt.Errorf("option %q has both choices and autocomplete", name)
+	}
+
+	f.option.MinValue = f.min
+	f.option.MaxValue = f.max
+
+	return f, nil
+}
+
+// parseCommandChoice parses a choice of an option of type t.
+func parseCommandChoice(t ApplicationCommandOptionType, s string) (*ApplicationCommandOptionChoice, error) {
+	switch t {
+	case ApplicationCommandOptionString:
+		return &ApplicationCommandOptionChoice{Name: s, Value: s}, nil
+	case ApplicationCommandOptionInteger:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return &ApplicationCommandOptionChoice{Name: s, Value: n}, nil
+	case ApplicationCommandOptionNumber:
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, err
+		}
+		return &ApplicationCommandOptionChoice{Name: s, Value: n}, nil
+	}
+
+	return nil, fmt.Errorf("options of type %s cannot have choices", t)
+}
+
+// options returns the options of the command.
+func (cs *commandSchema) options() []*ApplicationCommandOption {
+	options := make([]*ApplicationCommandOption, len(cs.fields))
+	for i, f := range cs.fields {
+		options[i] = f.option
+	}
+
+	return options
+}
+
+// bind returns a copy of the registered command with the given options
+// bound into its fields.  If lenient is set, invalid options are skipped
+// rather than reported, as is needed while a user is still typing.
+func (cs *commandSchema) bind(opts *CommandOptions, lenient bool) (SlashCommand, error) {
+	v := reflect.New(cs.typ)
+	v.Elem().Set(cs.proto)
+
+	for _, f := range cs.fields {
+		if err := f.bind(v.Elem().FieldByIndex(f.index), opts); err != nil && !lenient {
+			return nil, err
+		}
+	}
+
+	return v.Interface().(SlashCommand), nil
+}
+
+// bind sets a field from the options.
+func (f *commandField) bind(field reflect.Value, opts *CommandOptions) error {
+	name := f.option.Name
+
+	if !opts.Has(name) {
+		if f.option.Required {
+			return &OptionError{Name: name, Want: f.option.Type, Err: ErrOptionNotFound}
+		}
+
+		// The registered value may carry a default for the option.
+		if f.optional {
+			field.Set(reflect.Zero(field.Type()))
+		}
+		return nil
+	}
+
+	if f.optional {
+		field.Set(reflect.New(field.Type().Elem()))
+		field = field.Elem()
+	}
+
+	switch f.option.Type {
+	case ApplicationCommandOptionString:
+		s, err := opts.String(name)
+		if err != nil {
+			return err
+		}
+		if err := f.checkChoice(s); err != nil {
+			return err
+		}
+		field.SetString(s)
+
+	case ApplicationCommandOptionInteger:
+		n, err := opts.Int(name)
+		if err != nil {
+			return err
+		}
+		if err := f.checkRange(float64(n)); err != nil {
+			return err
+		}
+		if err := f.checkChoice(n); err != nil {
+			return err
+		}
+
+		switch field.Kind() {
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if n < 0 || field.OverflowUint(uint64(n)) {
+				return &OptionError{Name: name, Want: f.option.Type, Got: f.option.Type, Err: ErrOptionValue}
+			}
+			field.SetUint(uint64(n))
+		default:
+			if field.OverflowInt(n) {
+				return &OptionError{Name: name, Want: f.option.Type, Got: f.option.Type, Err: ErrOptionValue}
+			}
+			field.SetInt(n)
+		}
+
+	case ApplicationCommandOptionNumber:
+		n, err := opts.Float(name)
+		if err != nil {
+			return err
+		}
+		if err := f.checkRange(n); err != nil {
+			return err
+		}
+		if err := f.checkChoice(n); err != nil {
+			return err
+		}
+		field.SetFloat(n)
+
+	case ApplicationCommandOptionBoolean:
+		b, err := opts.Bool(name)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+
+	case ApplicationCommandOptionUser:
+		if field.Type() == memberType {
+			m, err := opts.Member(name)
+			if err != nil {
+				return err
+			}
+			field.Set(reflect.ValueOf(m))
+			return nil
+		}
+
+		u, err := opts.User(name)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(u))
+
+	case ApplicationCommandOptionChannel:
+		c, err := opts.Channel(name)
+		if err != nil {
+			return err
+		}
+		if len(f.option.ChannelTypes) > 0 && !hasChannelType(f.option.ChannelTypes, c.Type) {
+			return &OptionError{Name: name, Want: f.option.Type, Got: f.option.Type, Err: ErrOptionValue}
+		}
+		field.Set(reflect.ValueOf(c))
+
+	case ApplicationCommandOptionRole:
+		r, err := opts.Role(name)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(r))
+
+	case ApplicationCommandOptionMentionable:
+		m := &Mentionable{}
+		if r, err := opts.Role(name); err == nil {
+			m.Role = r
+		} else if u, err := opts.User(name); err == nil {
+			m.User = u
+			m.Member, _ = opts.Member(name)
+		} else {
+			return err
+		}
+		field.Set(reflect.ValueOf(m))
+
+	case ApplicationCommandOptionAttachment:
+		a, err := opts.Attachment(name)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(a))
+	}
+
+	return nil
+}
+
+// checkRange checks a numeric option against its bounds.
+func (f *commandField) checkRange(n float64) error {
+	if (f.min != nil && n < *f.min) || (f.max != nil && n > *f.max) {
+		return &OptionError{Name: f.option.Name, Want: f.option.Type, Got: f.option.Type, Err: ErrOptionRange}
+	}
+
+	return nil
+}
+
+// checkChoice checks that an option has one of its choices, if it has any.
+func (f *commandField) checkChoice(v interface{}) error {
+	if len(f.option.Choices) == 0 {
+		return nil
+	}
+
+	for _, c := range f.option.Choices {
+		if fmt.Sprint(c.Value) == fmt.Sprint(v) {
+			return nil
+		}
+	}
+
+	return &OptionError{Name: f.option.Name, Want: f.option.Type, Got: f.option.Type, Err: ErrOptionValue}
+}
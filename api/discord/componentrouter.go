@@ -0,0 +1,236 @@
+// Discord bindings for the Hrngh bot.
+// Available at https://github.com/abeiron/hrngh
+
+// Copyright 2020-2021, Undying Memory <abeiron@outlook.com>.  All rights reserved.
+// Use of this source code is governed by the Microsoft Public License
+// that can be found in the LICENSE file.
+
+// This file contains code for routing message component interactions to
+// handlers by their custom_id.
+
+package discord
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// paramRegexp matches a {param} placeholder in a custom_id pattern.
+var paramRegexp = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// componentRoute is a compiled custom_id pattern.
+type componentRoute struct {
+	pattern string
+	prefix  string
+	re      *regexp.Regexp
+	params  []string
+	handler InteractionHandler
+}
+
+// match reports whether customID matches the route, returning the
+// captured parameters if so.
+func (cr *componentRoute) match(customID string) (map[string]string, bool) {
+	if cr.re == nil {
+		return nil, strings.HasPrefix(customID, cr.prefix)
+	}
+
+	m := cr.re.FindStringSubmatch(customID)
+	if m == nil {
+		return nil, false
+	}
+
+	params := make(map[string]string, len(cr.params))
+	for i, name := range cr.params {
+		params[name] = m[i+1]
+	}
+
+	return params, true
+}
+
+// compileComponentRoute compiles a prefix or template pattern.
+func compileComponentRoute(pattern string, h InteractionHandler) *componentRoute {
+	cr := &componentRoute{pattern: pattern, handler: h}
+
+	if strings.HasSuffix(pattern, "*") && !strings.Contains(pattern, "{") {
+		cr.prefix = strings.TrimSuffix(pattern, "*")
+		return cr
+	}
+
+	var expr strings.Builder
+	expr.WriteString("^")
+
+	last := 0
+	for _, loc := range paramRegexp.FindAllStringSubmatchIndex(pattern, -1) {
+		expr.WriteString(regexp.QuoteMeta(pattern[last:loc[0]]))
+		expr.WriteString("([^:]+)")
+		cr.params = append(cr.params, pattern[loc[2]:loc[3]])
+		last = loc[1]
+	}
+
+	rest := pattern[last:]
+	if strings.HasSuffix(rest, "*") {
+		expr.WriteString(regexp.QuoteMeta(strings.TrimSuffix(rest, "*")))
+		expr.WriteString(".*")
+	} else {
+		expr.WriteString(regexp.QuoteMeta(rest))
+	}
+	expr.WriteString("$")
+
+	cr.re = regexp.MustCompile(expr.String())
+	return cr
+}
+
+// ComponentRouter dispatches message component interactions to handlers
+// registered on custom_id patterns, and to collectors waiting on clicks on
+// a particular message.
+//
+// A pattern takes one of three forms:
+//
+//	"confirm"          matches the custom_id "confirm" exactly.
+//	"page:*"           matches every custom_id starting with "page:".
+//	"vote:{poll}:{id}" matches "vote:12:3", with Params poll=12 and id=3.
+//
+// A {param} matches one or more characters other than ':'.  Exact patterns
+// take precedence; other patterns are tried in the order they were added.
+type ComponentRouter struct {
+	sync.RWMutex
+
+	// NotFound is called for component interactions no route matched.
+	// If nil, such interactions are acknowledged without a response.
+	NotFound InteractionHandler
+
+	exact      map[string]InteractionHandler
+	routes     []*componentRoute
+	collectors map[string]*Collector
+	middleware []Middleware
+}
+
+// NewComponentRouter creates an empty ComponentRouter.
+func NewComponentRouter() *ComponentRouter {
+	return &ComponentRouter{
+		exact:      make(map[string]InteractionHandler),
+		collectors: make(map[string]*Collector),
+	}
+}
+
+// Handle registers a handler for component interactions whose custom_id
+// matches pattern.  See ComponentRouter for the pattern syntax.
+//
+// The return value of this method is a function, that when called will
+// remove the route.
+func (r *ComponentRouter) Handle(pattern string, h InteractionHandler) func() {
+	r.Lock()
+	defer r.Unlock()
+
+	if !strings.Contains(pattern, "{") && !strings.HasSuffix(pattern, "*") {
+		r.exact[pattern] = h
+		return func() {
+			r.Lock()
+			defer r.Unlock()
+
+			delete(r.exact, pattern)
+		}
+	}
+
+	cr := compileComponentRoute(pattern, h)
+	r.routes = append(r.routes, cr)
+
+	return func() {
+		r.Lock()
+		defer r.Unlock()
+
+		for i, route := range r.routes {
+			if route == cr {
+				r.routes = append(r.routes[:i], r.routes[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Use adds middleware which wraps the handling of every component
+// interaction by the router, including those passed to collectors.
+// Middleware for a single route can be added with Chain.
+func (r *ComponentRouter) Use(mw ...Middleware) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.middleware = append(r.middleware, mw...)
+}
+
+// route finds the handler for a custom_id.
+func (r *ComponentRouter) route(customID string) (InteractionHandler, map[string]string) {
+	r.RLock()
+	defer r.RUnlock()
+
+	if h, ok := r.exact[customID]; ok {
+		return h, nil
+	}
+
+	for _, cr := range r.routes {
+		if params, ok := cr.match(customID); ok {
+			return cr.handler, params
+		}
+	}
+
+	return r.NotFound, nil
+}
+
+// collector returns the collector waiting on a message, if any.
+func (r *ComponentRouter) collector(messageID string) *Collector {
+	r.RLock()
+	defer r.RUnlock()
+
+	return r.collectors[messageID]
+}
+
+// HandleInteraction dispatches a component interaction to the collector
+// waiting on its message, or else to the handler whose pattern matches its
+// custom_id.  Interactions of other types are ignored.
+//
+// HandleInteraction is an InteractionHandler, so a ComponentRouter can be
+// used directly as the Handler of an InteractionServer.
+func (r *ComponentRouter) HandleInteraction(ctx *InteractionContext) error {
+	if ctx.Interaction.Type != InteractionMessageComponent {
+		return nil
+	}
+
+	r.RLock()
+	mw := r.middleware
+	r.RUnlock()
+
+	if ctx.Interaction.Message != nil {
+		if c := r.collector(ctx.Interaction.Message.ID); c != nil {
+			return Chain(c.handle, mw...)(ctx)
+		}
+	}
+
+	h, params := r.route(ctx.Interaction.MessageComponentData().CustomID)
+	if h == nil {
+		return nil
+	}
+
+	ctx.Params = params
+	return Chain(h, mw...)(ctx)
+}
+
+// Attach routes component interactions received from the gateway by s
+// through the router.
+//
+// The return value of this method is a function, that when called will
+// detach the router from the session.
+func (r *ComponentRouter) Attach(s *Session) func() {
+	return s.AddHandler(func(s *Session, i *InteractionCreate) {
+		if i.Type != InteractionMessageComponent {
+			return
+		}
+
+		ctx := NewInteractionContext(s, i.Interaction)
+		if err := r.HandleInteraction(ctx); err != nil {
+			s.log(LogError, "error handling component interaction %s, %s", i.ID, err)
+		}
+
+		ctx.finish()
+	})
+}
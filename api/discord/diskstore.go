@@ -0,0 +1,951 @@
+// Discord bindings for the Hrngh bot.
+// Available at https://github.com/abeiron/hrngh
+
+// Copyright 2020-2021, Undying Memory <abeiron@outlook.com>.  All rights reserved.
+// Use of this source code is governed by the Microsoft Public License
+// that can be found in the LICENSE file.
+
+// This file contains DiskStore, a StateStore keeping the state in a file.
+// The file is a log of records, each of which sets, deletes or drops a
+// bucket of entities, encoded as JSON; only an index of the live records is
+// kept in memory.  Superseded records are removed by compacting the log into
+// a new file.
+
+package discord
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ErrDiskStoreFormat is returned by OpenDiskStore for a file which is not a
+// DiskStore.
+var ErrDiskStoreFormat = errors.New("not a state store file, or of an unknown version")
+
+// diskStoreMagic starts a DiskStore file, with the version of its format.
+const diskStoreMagic = "hrngh-state\x00\x00\x00\x00\x01"
+
+// Record operations.
+const (
+	diskOpSet byte = iota + 1
+	diskOpDelete
+	diskOpDrop
+)
+
+// A record is laid out as its header, the CRC-32 of the rest of the record,
+// the operation, and the lengths of the bucket, ID and value, followed by
+// them.
+const diskHeaderSize = 4 + 1 + 2 + 2 + 4
+
+// The log is compacted when the bytes of superseded records are at least
+// diskCompactMin and half the file.
+const diskCompactMin = 4 << 20
+
+// A DiskStore is a StateStore keeping the state in a file, so that a bot
+// with many members needs little memory for it and a restarted bot starts
+// with the state it had.  Open one with OpenDiskStore and pass it to
+// NewStateWithStore.
+//
+// Each entity is decoded from the file when it is got, so changes to what
+// is returned are not seen by the store until it is set again.  Guilds are
+// returned with their Channels, Threads, Roles and Emojis, but not their Members,
+// Presences or VoiceStates; channels are returned without their Messages.
+//
+// As the state is kept from before the session began, a State using a
+// DiskStore drops the guilds that READY doesn't list, and keeps what it
+// holds of those that READY lists as unavailable.
+type DiskStore struct {
+	path string
+	f    *os.File
+	size int64 // of the file
+	dead int64 // bytes of superseded records
+
+	// index holds the live records by bucket and ID.
+	index map[string]map[string]diskRecord
+	// channels holds the buckets of channels and threads by channel ID.
+	channels map[string]string
+}
+
+type diskRecord struct {
+	value int64 // offset of the value
+	n     int   // length of the value
+	size  int   // length of the record
+}
+
+// Buckets of the entities of a DiskStore.  Each but guildBucket is followed
+// by the ID of the guild or channel the entity belongs to.
+const (
+	guildBucket      = "g"
+	channelBucket    = "c/"
+	threadBucket     = "t/"
+	memberBucket     = "m/"
+	roleBucket       = "r/"
+	emojiBucket      = "e/"
+	messageBucket    = "msg/"
+	presenceBucket   = "p/"
+	voiceStateBucket = "v/"
+)
+
+// OpenDiskStore opens the DiskStore kept in the file at path, creating the
+// file if it doesn't exist.  A record torn by a crash is discarded.
+func OpenDiskStore(path string) (*DiskStore, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &DiskStore{path: path, f: f}
+	if err = d.load(); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// load reads the index from the file.
+func (d *DiskStore) load() error {
+	d.index = make(map[string]map[string]diskRecord)
+	d.channels = make(map[string]string)
+	d.size, d.dead = 0, 0
+
+	fi, err := d.f.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.Size() == 0 {
+		if _, err = d.f.WriteAt([]byte(diskStoreMagic), 0); err != nil {
+			return err
+		}
+		d.size = int64(len(diskStoreMagic))
+		return nil
+	}
+
+	r := bufio.NewReader(io.NewSectionReader(d.f, 0, fi.Size()))
+	magic := make([]byte, len(diskStoreMagic))
+	if _, err = io.ReadFull(r, magic); err != nil || string(magic) != diskStoreMagic {
+		return ErrDiskStoreFormat
+	}
+	d.size = int64(len(magic))
+
+	header := make([]byte, diskHeaderSize)
+	var body []byte
+	for {
+		if _, err = io.ReadFull(r, header); err != nil {
+			break
+		}
+
+		op := header[4]
+		blen := int(binary.BigEndian.Uint16(header[5:]))
+		ilen := int(binary.BigEndian.Uint16(header[7:]))
+		vlen := int(binary.BigEndian.Uint32(header[9:]))
+		if op < diskOpSet || op > diskOpDrop || int64(vlen) > fi.Size() {
+			err = io.ErrUnexpectedEOF
+			break
+		}
+
+		if n := blen + ilen + vlen; cap(body) < n {
+			body = make([]byte, n)
+		} else {
+			body = body[:n]
+		}
+		if _, err = io.ReadFull(r, body); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			break
+		}
+
+		crc := crc32.NewIEEE()
+		crc.Write(header[4:])
+		crc.Write(body)
+		if crc.Sum32() != binary.BigEndian.Uint32(header) {
+			err = io.ErrUnexpectedEOF
+			break
+		}
+
+		bucket, id := string(body[:blen]), string(body[blen:blen+ilen])
+		d.apply(op, bucket, id, diskRecord{
+			value: d.size + int64(diskHeaderSize+blen+ilen),
+			n:     vlen,
+			size:  diskHeaderSize + len(body),
+		})
+		d.size += int64(diskHeaderSize + len(body))
+	}
+
+	if err == io.EOF {
+		return nil
+	}
+	if err != io.ErrUnexpectedEOF {
+		return err
+	}
+
+	// The last record is torn; drop it so that the next is written in its place.
+	return d.f.Truncate(d.size)
+}
+
+// apply applies a record to the index.
+func (d *DiskStore) apply(op byte, bucket, id string, rec diskRecord) {
+	records := d.index[bucket]
+
+	switch op {
+	case diskOpSet:
+		if records == nil {
+			records = make(map[string]diskRecord)
+			d.index[bucket] = records
+		}
+		if old, ok := records[id]; ok {
+			d.dead += int64(old.size)
+		}
+		records[id] = rec
+
+		if isChannelBucket(bucket) {
+			d.channels[id] = bucket
+		}
+	case diskOpDelete:
+		if old, ok := records[id]; ok {
+			d.dead += int64(old.size)
+			delete(records, id)
+		}
+		d.dead += int64(rec.size)
+
+		if isChannelBucket(bucket) {
+			delete(d.channels, id)
+		}
+	case diskOpDrop:
+		for id, old := range records {
+			d.dead += int64(old.size)
+			if isChannelBucket(bucket) {
+				delete(d.channels, id)
+			}
+		}
+		delete(d.index, bucket)
+		d.dead += int64(rec.size)
+	}
+}
+
+// isChannelBucket reports whether a bucket holds channels or threads.
+func isChannelBucket(bucket string) bool {
+	return strings.HasPrefix(bucket, channelBucket) || strings.HasPrefix(bucket, threadBucket)
+}
+
+// write appends a record to the file and applies it.
+func (d *DiskStore) write(op byte, bucket, id string, value []byte) error {
+	b := make([]byte, diskHeaderSize+len(bucket)+len(id)+len(value))
+	b[4] = op
+	binary.BigEndian.PutUint16(b[5:], uint16(len(bucket)))
+	binary.BigEndian.PutUint16(b[7:], uint16(len(id)))
+	binary.BigEndian.PutUint32(b[9:], uint32(len(value)))
+	n := copy(b[diskHeaderSize:], bucket)
+	n += copy(b[diskHeaderSize+n:], id)
+	copy(b[diskHeaderSize+n:], value)
+	binary.BigEndian.PutUint32(b, crc32.ChecksumIEEE(b[4:]))
+
+	if _, err := d.f.WriteAt(b, d.size); err != nil {
+		return err
+	}
+
+	d.apply(op, bucket, id, diskRecord{
+		value: d.size + int64(diskHeaderSize+len(bucket)+len(id)),
+		n:     len(value),
+		size:  len(b),
+	})
+	d.size += int64(len(b))
+
+	if d.dead >= diskCompactMin && d.dead >= d.size/2 {
+		return d.Compact()
+	}
+
+	return nil
+}
+
+// has reports whether the store holds an entity.
+func (d *DiskStore) has(bucket, id string) bool {
+	_, ok := d.index[bucket][id]
+	return ok
+}
+
+// get decodes an entity into v.
+func (d *DiskStore) get(bucket, id string, v interface{}) error {
+	rec, ok := d.index[bucket][id]
+	if !ok {
+		return ErrStateNotFound
+	}
+
+	return d.decode(rec, v)
+}
+
+func (d *DiskStore) decode(rec diskRecord, v interface{}) error {
+	b := make([]byte, rec.n)
+	if _, err := d.f.ReadAt(b, rec.value); err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
+
+// each decodes the entities of a bucket in order of ID with decode.
+func (d *DiskStore) each(bucket string, decode func(b []byte) error) error {
+	records := d.index[bucket]
+
+	var b []byte
+	for _, id := range sortedIDs(records) {
+		rec := records[id]
+		if cap(b) < rec.n {
+			b = make([]byte, rec.n)
+		}
+		b = b[:rec.n]
+		if _, err := d.f.ReadAt(b, rec.value); err != nil {
+			return err
+		}
+		if err := decode(b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// set encodes and sets an entity.
+func (d *DiskStore) set(bucket, id string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return d.write(diskOpSet, bucket, id, b)
+}
+
+// delete deletes an entity.
+func (d *DiskStore) delete(bucket, id string) error {
+	if !d.has(bucket, id) {
+		return ErrStateNotFound
+	}
+
+	return d.write(diskOpDelete, bucket, id, nil)
+}
+
+// drop deletes all the entities of a bucket.
+func (d *DiskStore) drop(bucket string) error {
+	if len(d.index[bucket]) == 0 {
+		return nil
+	}
+
+	return d.write(diskOpDrop, bucket, "", nil)
+}
+
+// Compact rewrites the file of the store with only its live records.  It is
+// done as the store is written, once enough of the file is superseded.
+func (d *DiskStore) Compact() error {
+	tmp := d.path + ".compact"
+	f, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	w := bufio.NewWriter(f)
+	w.WriteString(diskStoreMagic)
+	size := int64(len(diskStoreMagic))
+
+	index := make(map[string]map[string]diskRecord, len(d.index))
+	for bucket, records := range d.index {
+		compacted := make(map[string]diskRecord, len(records))
+		for id, rec := range records {
+			b := make([]byte, rec.size)
+			if _, err = d.f.ReadAt(b, rec.value-int64(rec.size-rec.n)); err != nil {
+				f.Close()
+				return err
+			}
+			w.Write(b)
+
+			rec.value = size + int64(rec.size-rec.n)
+			compacted[id] = rec
+			size += int64(rec.size)
+		}
+		index[bucket] = compacted
+	}
+
+	if err = w.Flush(); err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	if err = os.Rename(tmp, d.path); err != nil {
+		f.Close()
+		return err
+	}
+
+	d.f.Close()
+	d.f, d.size, d.dead, d.index = f, size, 0, index
+
+	return nil
+}
+
+// Close syncs and closes the file of the store.
+func (d *DiskStore) Close() error {
+	if err := d.f.Sync(); err != nil {
+		d.f.Close()
+		return err
+	}
+
+	return d.f.Close()
+}
+
+// Guild implements StateStore.
+func (d *DiskStore) Guild(guildID string) (*Guild, error) {
+	g := &Guild{}
+	if err := d.get(guildBucket, guildID, g); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if g.Channels, err = d.Channels(guildID); err != nil {
+		return nil, err
+	}
+	if g.Threads, err = d.Threads(guildID); err != nil {
+		return nil, err
+	}
+	if g.Roles, err = d.Roles(guildID); err != nil {
+		return nil, err
+	}
+	if g.Emojis, err = d.Emojis(guildID); err != nil {
+		return nil, err
+	}
+
+	return g, nil
+}
+
+// Guilds implements StateStore.
+func (d *DiskStore) Guilds() ([]*Guild, error) {
+	guilds := []*Guild{}
+	for _, id := range sortedIDs(d.index[guildBucket]) {
+		g, err := d.Guild(id)
+		if err != nil {
+			return nil, err
+		}
+		guilds = append(guilds, g)
+	}
+
+	return guilds, nil
+}
+
+// GuildIDs returns the IDs of all the guilds, without reading the guilds.
+func (d *DiskStore) GuildIDs() ([]string, error) {
+	return sortedIDs(d.index[guildBucket]), nil
+}
+
+// SetGuild implements StateStore.
+func (d *DiskStore) SetGuild(guild *Guild) error {
+	g := *guild
+	g.Channels, g.Threads, g.Roles, g.Emojis = nil, nil, nil, nil
+	g.Members, g.Presences, g.VoiceStates = nil, nil, nil
+	if err := d.set(guildBucket, g.ID, &g); err != nil {
+		return err
+	}
+
+	if guild.Channels != nil {
+		keep := make(map[string]bool, len(guild.Channels))
+		for _, c := range guild.Channels {
+			keep[c.ID] = true
+		}
+		for id := range d.index[channelBucket+g.ID] {
+			if !keep[id] {
+				if err := d.drop(messageBucket + id); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := d.drop(channelBucket + g.ID); err != nil {
+			return err
+		}
+		for _, c := range guild.Channels {
+			if err := d.set(channelBucket+g.ID, c.ID, c); err != nil {
+				return err
+			}
+		}
+	}
+
+	if guild.Threads != nil {
+		if err := d.setThreads(g.ID, guild.Threads); err != nil {
+			return err
+		}
+	}
+
+	if guild.Roles != nil {
+		if err := d.drop(roleBucket + g.ID); err != nil {
+			return err
+		}
+		for _, r := range guild.Roles {
+			if err := d.set(roleBucket+g.ID, r.ID, r); err != nil {
+				return err
+			}
+		}
+	}
+
+	if guild.Emojis != nil {
+		if err := d.drop(emojiBucket + g.ID); err != nil {
+			return err
+		}
+		for _, e := range guild.Emojis {
+			if err := d.set(emojiBucket+g.ID, e.ID, e); err != nil {
+				return err
+			}
+		}
+	}
+
+	if guild.Members != nil {
+		if err := d.drop(memberBucket + g.ID); err != nil {
+			return err
+		}
+		for _, m := range guild.Members {
+			if err := d.set(memberBucket+g.ID, m.User.ID, m); err != nil {
+				return err
+			}
+		}
+	}
+
+	if guild.Presences != nil {
+		if err := d.drop(presenceBucket + g.ID); err != nil {
+			return err
+		}
+		for _, p := range guild.Presences {
+			if err := d.set(presenceBucket+g.ID, p.User.ID, p); err != nil {
+				return err
+			}
+		}
+	}
+
+	if guild.VoiceStates != nil {
+		if err := d.drop(voiceStateBucket + g.ID); err != nil {
+			return err
+		}
+		for _, v := range guild.VoiceStates {
+			if err := d.set(voiceStateBucket+g.ID, v.UserID, v); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// DeleteGuild implements StateStore.
+func (d *DiskStore) DeleteGuild(guildID string) error {
+	if err := d.delete(guildBucket, guildID); err != nil {
+		return err
+	}
+
+	for _, bucket := range []string{channelBucket, threadBucket} {
+		for id := range d.index[bucket+guildID] {
+			if err := d.drop(messageBucket + id); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, bucket := range []string{channelBucket, threadBucket, memberBucket, roleBucket, emojiBucket, presenceBucket, voiceStateBucket} {
+		if err := d.drop(bucket + guildID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Channel implements StateStore.
+func (d *DiskStore) Channel(channelID string) (*Channel, error) {
+	bucket, ok := d.channels[channelID]
+	if !ok {
+		return nil, ErrStateNotFound
+	}
+
+	c := &Channel{}
+	if err := d.get(bucket, channelID, c); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Channels implements StateStore.
+func (d *DiskStore) Channels(guildID string) ([]*Channel, error) {
+	if guildID != "" && !d.has(guildBucket, guildID) {
+		return nil, ErrStateNotFound
+	}
+
+	channels := []*Channel{}
+	err := d.each(channelBucket+guildID, func(b []byte) error {
+		c := &Channel{}
+		channels = append(channels, c)
+		return json.Unmarshal(b, c)
+	})
+
+	return channels, err
+}
+
+// SetChannel implements StateStore.
+func (d *DiskStore) SetChannel(channel *Channel) error {
+	guildID := ""
+	if !isPrivateChannel(channel) {
+		guildID = channel.GuildID
+		if !d.has(guildBucket, guildID) {
+			return ErrStateNotFound
+		}
+	}
+
+	bucket := channelBucket
+	if channel.IsThread() {
+		bucket = threadBucket
+	}
+
+	return d.set(bucket+guildID, channel.ID, channel)
+}
+
+// Threads implements StateStore.
+func (d *DiskStore) Threads(guildID string) ([]*Channel, error) {
+	if !d.has(guildBucket, guildID) {
+		return nil, ErrStateNotFound
+	}
+
+	threads := []*Channel{}
+	err := d.each(threadBucket+guildID, func(b []byte) error {
+		c := &Channel{}
+		threads = append(threads, c)
+		return json.Unmarshal(b, c)
+	})
+
+	return threads, err
+}
+
+// setThreads replaces the threads of a guild, dropping the messages of
+// those which are gone.
+func (d *DiskStore) setThreads(guildID string, threads []*Channel) error {
+	keep := make(map[string]bool, len(threads))
+	for _, c := range threads {
+		keep[c.ID] = true
+	}
+	for id := range d.index[threadBucket+guildID] {
+		if !keep[id] {
+			if err := d.drop(messageBucket + id); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := d.drop(threadBucket + guildID); err != nil {
+		return err
+	}
+	for _, c := range threads {
+		if err := d.set(threadBucket+guildID, c.ID, c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteChannel implements StateStore.
+func (d *DiskStore) DeleteChannel(channelID string) error {
+	bucket, ok := d.channels[channelID]
+	if !ok {
+		return ErrStateNotFound
+	}
+
+	if err := d.delete(bucket, channelID); err != nil {
+		return err
+	}
+
+	return d.drop(messageBucket + channelID)
+}
+
+// Member implements StateStore.
+func (d *DiskStore) Member(guildID, userID string) (*Member, error) {
+	m := &Member{}
+	if err := d.get(memberBucket+guildID, userID, m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Members implements StateStore.
+func (d *DiskStore) Members(guildID string) ([]*Member, error) {
+	if !d.has(guildBucket, guildID) {
+		return nil, ErrStateNotFound
+	}
+
+	members := []*Member{}
+	err := d.each(memberBucket+guildID, func(b []byte) error {
+		m := &Member{}
+		members = append(members, m)
+		return json.Unmarshal(b, m)
+	})
+
+	return members, err
+}
+
+// SetMember implements StateStore.
+func (d *DiskStore) SetMember(member *Member) error {
+	if !d.has(guildBucket, member.GuildID) {
+		return ErrStateNotFound
+	}
+
+	return d.set(memberBucket+member.GuildID, member.User.ID, member)
+}
+
+// DeleteMember implements StateStore.
+func (d *DiskStore) DeleteMember(guildID, userID string) error {
+	return d.delete(memberBucket+guildID, userID)
+}
+
+// Role implements StateStore.
+func (d *DiskStore) Role(guildID, roleID string) (*Role, error) {
+	r := &Role{}
+	if err := d.get(roleBucket+guildID, roleID, r); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Roles implements StateStore.
+func (d *DiskStore) Roles(guildID string) ([]*Role, error) {
+	if !d.has(guildBucket, guildID) {
+		return nil, ErrStateNotFound
+	}
+
+	roles := []*Role{}
+	err := d.each(roleBucket+guildID, func(b []byte) error {
+		r := &Role{}
+		roles = append(roles, r)
+		return json.Unmarshal(b, r)
+	})
+
+	return roles, err
+}
+
+// SetRole implements StateStore.
+func (d *DiskStore) SetRole(guildID string, role *Role) error {
+	if !d.has(guildBucket, guildID) {
+		return ErrStateNotFound
+	}
+
+	return d.set(roleBucket+guildID, role.ID, role)
+}
+
+// DeleteRole implements StateStore.
+func (d *DiskStore) DeleteRole(guildID, roleID string) error {
+	return d.delete(roleBucket+guildID, roleID)
+}
+
+// Emoji implements StateStore.
+func (d *DiskStore) Emoji(guildID, emojiID string) (*Emoji, error) {
+	e := &Emoji{}
+	if err := d.get(emojiBucket+guildID, emojiID, e); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// Emojis implements StateStore.
+func (d *DiskStore) Emojis(guildID string) ([]*Emoji, error) {
+	if !d.has(guildBucket, guildID) {
+		return nil, ErrStateNotFound
+	}
+
+	emojis := []*Emoji{}
+	err := d.each(emojiBucket+guildID, func(b []byte) error {
+		e := &Emoji{}
+		emojis = append(emojis, e)
+		return json.Unmarshal(b, e)
+	})
+
+	return emojis, err
+}
+
+// SetEmoji implements StateStore.
+func (d *DiskStore) SetEmoji(guildID string, emoji *Emoji) error {
+	if !d.has(guildBucket, guildID) {
+		return ErrStateNotFound
+	}
+
+	return d.set(emojiBucket+guildID, emoji.ID, emoji)
+}
+
+// DeleteEmoji implements StateStore.
+func (d *DiskStore) DeleteEmoji(guildID, emojiID string) error {
+	return d.delete(emojiBucket+guildID, emojiID)
+}
+
+// Message implements StateStore.
+func (d *DiskStore) Message(channelID, messageID string) (*Message, error) {
+	m := &Message{}
+	if err := d.get(messageBucket+channelID, messageID, m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Messages implements StateStore.
+func (d *DiskStore) Messages(channelID string) ([]*Message, error) {
+	if _, ok := d.channels[channelID]; !ok {
+		return nil, ErrStateNotFound
+	}
+
+	messages := []*Message{}
+	err := d.each(messageBucket+channelID, func(b []byte) error {
+		m := &Message{}
+		messages = append(messages, m)
+		return json.Unmarshal(b, m)
+	})
+
+	return messages, err
+}
+
+// SetMessage implements StateStore.
+func (d *DiskStore) SetMessage(message *Message, limit int) error {
+	if _, ok := d.channels[message.ChannelID]; !ok {
+		return ErrStateNotFound
+	}
+
+	bucket := messageBucket + message.ChannelID
+	if err := d.set(bucket, message.ID, message); err != nil {
+		return err
+	}
+
+	if limit <= 0 || len(d.index[bucket]) <= limit {
+		return nil
+	}
+
+	// Message IDs are snowflakes, so the oldest sort first.
+	ids := sortedIDs(d.index[bucket])
+	for _, id := range ids[:len(ids)-limit] {
+		if err := d.delete(bucket, id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteMessage implements StateStore.
+func (d *DiskStore) DeleteMessage(channelID, messageID string) error {
+	return d.delete(messageBucket+channelID, messageID)
+}
+
+// Presence implements StateStore.
+func (d *DiskStore) Presence(guildID, userID string) (*Presence, error) {
+	p := &Presence{}
+	if err := d.get(presenceBucket+guildID, userID, p); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Presences implements StateStore.
+func (d *DiskStore) Presences(guildID string) ([]*Presence, error) {
+	if !d.has(guildBucket, guildID) {
+		return nil, ErrStateNotFound
+	}
+
+	presences := []*Presence{}
+	err := d.each(presenceBucket+guildID, func(b []byte) error {
+		p := &Presence{}
+		presences = append(presences, p)
+		return json.Unmarshal(b, p)
+	})
+
+	return presences, err
+}
+
+// SetPresence implements StateStore.
+func (d *DiskStore) SetPresence(guildID string, presence *Presence) error {
+	if !d.has(guildBucket, guildID) {
+		return ErrStateNotFound
+	}
+
+	return d.set(presenceBucket+guildID, presence.User.ID, presence)
+}
+
+// DeletePresence implements StateStore.
+func (d *DiskStore) DeletePresence(guildID, userID string) error {
+	return d.delete(presenceBucket+guildID, userID)
+}
+
+// VoiceState implements StateStore.
+func (d *DiskStore) VoiceState(guildID, userID string) (*VoiceState, error) {
+	v := &VoiceState{}
+	if err := d.get(voiceStateBucket+guildID, userID, v); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// VoiceStates implements StateStore.
+func (d *DiskStore) VoiceStates(guildID string) ([]*VoiceState, error) {
+	if !d.has(guildBucket, guildID) {
+		return nil, ErrStateNotFound
+	}
+
+	states := []*VoiceState{}
+	err := d.each(voiceStateBucket+guildID, func(b []byte) error {
+		v := &VoiceState{}
+		states = append(states, v)
+		return json.Unmarshal(b, v)
+	})
+
+	return states, err
+}
+
+// SetVoiceState implements StateStore.
+func (d *DiskStore) SetVoiceState(guildID string, voiceState *VoiceState) error {
+	if !d.has(guildBucket, guildID) {
+		return ErrStateNotFound
+	}
+
+	return d.set(voiceStateBucket+guildID, voiceState.UserID, voiceState)
+}
+
+// DeleteVoiceState implements StateStore.
+func (d *DiskStore) DeleteVoiceState(guildID, userID string) error {
+	return d.delete(voiceStateBucket+guildID, userID)
+}
+
+// sortedIDs returns the IDs of records in order; snowflakes sort by time.
+func sortedIDs(records map[string]diskRecord) []string {
+	ids := make([]string, 0, len(records))
+	for id := range records {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return lessID(ids[i], ids[j])
+	})
+
+	return ids
+}
+
+// lessID reports whether the snowflake a is less than b, comparing them as
+// numbers.
+func lessID(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+
+	return a < b
+}
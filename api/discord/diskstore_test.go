@@ -0,0 +1,179 @@
+// Discord bindings for the Hrngh bot.
+// Available at https://github.com/abeiron/hrngh
+
+// Copyright 2020-2021, Undying Memory <abeiron@outlook.com>.  All rights reserved.
+// Use of this source code is governed by the Microsoft Public License
+// that can be found in the LICENSE file.
+
+// This file contains tests of the file of DiskStore: its recovery from torn
+// and corrupt records, and its compaction.
+
+package discord
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// openDiskStore opens a DiskStore in the file at path, closing it at the
+// end of the test.
+func openDiskStore(t *testing.T, path string) *DiskStore {
+	d, err := OpenDiskStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { d.Close() })
+
+	return d
+}
+
+func setGuild(t *testing.T, d *DiskStore) {
+	if err := d.SetGuild(&Guild{ID: "g", Name: "guild"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func setMember(t *testing.T, d *DiskStore, userID, nick string) {
+	if err := d.SetMember(&Member{GuildID: "g", User: &User{ID: userID}, Nick: nick}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// expectMembers checks the nicks of the members of a store, an empty nick
+// meaning that the member must not be found.
+func expectMembers(t *testing.T, d *DiskStore, nicks map[string]string) {
+	t.Helper()
+
+	for userID, nick := range nicks {
+		m, err := d.Member("g", userID)
+		switch {
+		case nick == "" && err != ErrStateNotFound:
+			t.Errorf("member %s: got %+v, %v, want %v", userID, m, err, ErrStateNotFound)
+		case nick != "" && (err != nil || m.Nick != nick):
+			t.Errorf("member %s: got %+v, %v, want nick %q", userID, m, err, nick)
+		}
+	}
+}
+
+func fileSize(t *testing.T, path string) int64 {
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return fi.Size()
+}
+
+// TestDiskStoreRecovery checks that a store reopened after a crash drops
+// its last record, if torn or corrupt, and writes over it.
+func TestDiskStoreRecovery(t *testing.T) {
+	// Each damages the file b, whose last record starts at last.
+	damages := map[string]func(b []byte, last int64) []byte{
+		"torn": func(b []byte, last int64) []byte { return b[:len(b)-3] },
+		"corrupt value": func(b []byte, last int64) []byte {
+			b[len(b)-1] ^= 0xff
+			return b
+		},
+		"corrupt checksum": func(b []byte, last int64) []byte {
+			b[last] ^= 0xff
+			return b
+		},
+	}
+
+	for name, damage := range damages {
+		damage := damage
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "state")
+
+			d, err := OpenDiskStore(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			setGuild(t, d)
+			setMember(t, d, "a", "first")
+			size := fileSize(t, path)
+			setMember(t, d, "b", "second")
+			if err = d.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			b, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = ioutil.WriteFile(path, damage(b, size), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			d = openDiskStore(t, path)
+			expectMembers(t, d, map[string]string{"a": "first", "b": ""})
+			if got := fileSize(t, path); got != size {
+				t.Errorf("got a file of %d bytes, want the %d before the damaged record", got, size)
+			}
+
+			setMember(t, d, "c", "third")
+			d.Close()
+
+			d = openDiskStore(t, path)
+			expectMembers(t, d, map[string]string{"a": "first", "b": "", "c": "third"})
+		})
+	}
+}
+
+func TestDiskStoreFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state")
+	if err := ioutil.WriteFile(path, []byte("not a state store"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := OpenDiskStore(path); err != ErrDiskStoreFormat {
+		t.Errorf("got %v, want %v", err, ErrDiskStoreFormat)
+	}
+}
+
+// TestDiskStoreCompact checks that compacting a store drops its superseded
+// records and keeps its live ones, in the file as in the store.
+func TestDiskStoreCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state")
+	d := openDiskStore(t, path)
+	setGuild(t, d)
+
+	for _, nick := range []string{"one", "two", "three", "four"} {
+		setMember(t, d, "a", nick)
+		setMember(t, d, "b", nick)
+	}
+	setMember(t, d, "c", "deleted")
+	if err := d.DeleteMember("g", "c"); err != nil {
+		t.Fatal(err)
+	}
+
+	before := fileSize(t, path)
+	if err := d.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	after := fileSize(t, path)
+	if after >= before/2 || d.size != after || d.dead != 0 {
+		t.Errorf("compacted %d bytes to %d, with %d in the index and %d dead", before, after, d.size, d.dead)
+	}
+	if _, err := os.Stat(path + ".compact"); !os.IsNotExist(err) {
+		t.Errorf("compaction file left: %v", err)
+	}
+
+	nicks := map[string]string{"a": "four", "b": "four", "c": ""}
+	expectMembers(t, d, nicks)
+
+	// The compacted file is written to like the old one.
+	setMember(t, d, "d", "after")
+	nicks["d"] = "after"
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	d = openDiskStore(t, path)
+	expectMembers(t, d, nicks)
+	if g, err := d.Guild("g"); err != nil || g.Name != "guild" {
+		t.Errorf("guild: got %+v, %v", g, err)
+	}
+}
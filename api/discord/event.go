@@ -172,7 +172,7 @@ func (s *Session) removeEventHandlerInstance(t string, ehi *eventHandlerInstance
 // Handles calling permanent and once handlers for an event type.
 func (s *Session) handle(t string, i interface{}) {
 	for _, eh := range s.handlers[t] {
-		if s.SyncEvents {
+		if s.SyncEnabled {
 			eh.eventHandler.Handle(s, i)
 		} else {
 			go eh.eventHandler.Handle(s, i)
@@ -181,7 +181,7 @@ func (s *Session) handle(t string, i interface{}) {
 
 	if len(s.onceHandlers[t]) > 0 {
 		for _, eh := range s.onceHandlers[t] {
-			if s.SyncEvents {
+			if s.SyncEnabled {
 				eh.eventHandler.Handle(s, i)
 			} else {
 				go eh.eventHandler.Handle(s, i)
@@ -244,6 +244,7 @@ func (s *Session) onInterface(i interface{}) {
 	if err != nil {
 		s.log(LogDebug, "error dispatching internal event, %s", err)
 	}
+	s.chunkMembers(i)
 }
 
 // onReady handles the ready event.
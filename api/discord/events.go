@@ -68,6 +68,8 @@ type ChannelCreate struct {
 // ChannelUpdate is the data for a ChannelUpdate event.
 type ChannelUpdate struct {
 	*Channel
+	// BeforeUpdate will be nil if the Channel was not previously cached in the state cache.
+	BeforeUpdate *Channel `json:"-"`
 }
 
 // ChannelDelete is the data for a ChannelDelete event.
@@ -82,6 +84,54 @@ type ChannelPinsUpdate struct {
 	GuildID          string `json:"guild_id,omitempty"`
 }
 
+// ThreadCreate is the data for a ThreadCreate event.
+type ThreadCreate struct {
+	*Channel
+	// NewlyCreated is set when the thread was just created, rather than
+	// added when the current user was added to a private thread.
+	NewlyCreated bool `json:"newly_created"`
+}
+
+// ThreadUpdate is the data for a ThreadUpdate event.
+type ThreadUpdate struct {
+	*Channel
+	// BeforeUpdate will be nil if the thread was not previously cached in the state cache.
+	BeforeUpdate *Channel `json:"-"`
+}
+
+// ThreadDelete is the data for a ThreadDelete event.  Only the ID, GuildID,
+// ParentID and Type of the Channel are set.
+type ThreadDelete struct {
+	*Channel
+}
+
+// ThreadListSync is the data for a ThreadListSync event, sent when the
+// current user gains access to channels.  It holds the active threads of
+// the channels with ChannelIDs, or of the whole guild if ChannelIDs is empty.
+type ThreadListSync struct {
+	GuildID    string          `json:"guild_id"`
+	ChannelIDs []string        `json:"channel_ids"`
+	Threads    []*Channel      `json:"threads"`
+	Members    []*ThreadMember `json:"members"`
+}
+
+// ThreadMemberUpdate is the data for a ThreadMemberUpdate event, sent when
+// the thread member of the current user changes.
+type ThreadMemberUpdate struct {
+	*ThreadMember
+	GuildID string `json:"guild_id"`
+}
+
+// ThreadMembersUpdate is the data for a ThreadMembersUpdate event, sent
+// when users are added to or removed from a thread.
+type ThreadMembersUpdate struct {
+	ID             string               `json:"id"`
+	GuildID        string               `json:"guild_id"`
+	MemberCount    int                  `json:"member_count"`
+	AddedMembers   []*AddedThreadMember `json:"added_members"`
+	RemovedMembers []string             `json:"removed_member_ids"`
+}
+
 // GuildCreate is the data for a GuildCreate event.
 type GuildCreate struct {
 	*Guild
@@ -117,11 +167,15 @@ type GuildMemberAdd struct {
 // GuildMemberUpdate is the data for a GuildMemberUpdate event.
 type GuildMemberUpdate struct {
 	*Member
+	// BeforeUpdate will be nil if the Member was not previously cached in the state cache.
+	BeforeUpdate *Member `json:"-"`
 }
 
 // GuildMemberRemove is the data for a GuildMemberRemove event.
 type GuildMemberRemove struct {
 	*Member
+	// BeforeDelete will be nil if the Member was not previously cached in the state cache.
+	BeforeDelete *Member `json:"-"`
 }
 
 // GuildRoleCreate is the data for a GuildRoleCreate event.
@@ -132,6 +186,8 @@ type GuildRoleCreate struct {
 // GuildRoleUpdate is the data for a GuildRoleUpdate event.
 type GuildRoleUpdate struct {
 	*GuildRole
+	// BeforeUpdate will be nil if the Role was not previously cached in the state cache.
+	BeforeUpdate *Role `json:"-"`
 }
 
 // A GuildRoleDelete is the data for a GuildRoleDelete event.
@@ -152,7 +208,16 @@ type GuildMembersChunk struct {
 	Members    []*Member   `json:"members"`
 	ChunkIndex int         `json:"chunk_index"`
 	ChunkCount int         `json:"chunk_count"`
+	NotFound   []string    `json:"not_found,omitempty"`
 	Presences  []*Presence `json:"presences,omitempty"`
+	Nonce      string      `json:"nonce,omitempty"`
+}
+
+// GuildMembersReady is the data for a GuildMembersReady event, which is
+// synthetic: it is sent once all the members of a guild have been received,
+// when Session.MemberChunking is set.
+type GuildMembersReady struct {
+	GuildID string `json:"guild_id"`
 }
 
 // GuildIntegrationsUpdate is the data for a GuildIntegrationsUpdate event.
@@ -181,6 +246,7 @@ type MessageUpdate struct {
 // MessageDelete is the data for a MessageDelete event.
 type MessageDelete struct {
 	*Message
+	// BeforeDelete will be nil if the Message was not previously cached in the state cache.
 	BeforeDelete *Message `json:"-"`
 }
 
@@ -276,3 +342,13 @@ type WebhooksUpdate struct {
 	GuildID   string `json:"guild_id"`
 	ChannelID string `json:"channel_id"`
 }
+
+// InteractionCreate is the data for an InteractionCreate event
+type InteractionCreate struct {
+	*Interaction
+}
+
+// UnmarshalJSON is a helper function to unmarshal Interaction object.
+func (i *InteractionCreate) UnmarshalJSON(b []byte) error {
+	return json.Unmarshal(b, &i.Interaction)
+}
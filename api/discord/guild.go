@@ -9,6 +9,8 @@
 
 package discord
 
+import "strings"
+
 // VerificationLevel type definition
 type VerificationLevel int
 
@@ -133,6 +135,11 @@ type Guild struct {
   // update events, and thus is only present in state-cached guilds.
   Channels []*Channel `json:"channels"`
 
+  // A list of the active threads in the guild which the current user can
+  // see.  This field is only present in GUILD_CREATE events, and thus is
+  // only present in state-cached guilds.
+  Threads []*Channel `json:"threads"`
+
   // A list of voice states for the guild.
   // This field is only present in GUILD_CREATE events and websocket
   // update events, and thus is only present in state-cached guilds.
@@ -237,6 +244,84 @@ func (g *Guild) IconURL() string {
   return EndpointGuildIcon(g.ID, g.Icon)
 }
 
+// A Member stores user information for Guild members. A guild
+// member represents a certain user's presence in a guild.
+type Member struct {
+  // The guild ID on which the member exists.
+  GuildID string `json:"guild_id"`
+
+  // The time at which the member joined the guild.
+  JoinedAt Timestamp `json:"joined_at"`
+
+  // The nickname of the member, if they have one.
+  Nick string `json:"nick"`
+
+  // Whether the member is deafened at a guild level.
+  Deaf bool `json:"deaf"`
+
+  // Whether the member is muted at a guild level.
+  Mute bool `json:"mute"`
+
+  // The underlying user on which the member is based.
+  User *User `json:"user"`
+
+  // A list of IDs of the roles which are possessed by the member.
+  Roles []string `json:"roles"`
+
+  // When the user used their Nitro boost on the server.
+  PremiumSince Timestamp `json:"premium_since"`
+
+  // Whether the user has not yet passed the guild's Membership Screening requirements.
+  Pending bool `json:"pending"`
+
+  // Total permissions of the member in the channel, including overrides,
+  // returned when in the interaction object.
+  Permissions int64 `json:"permissions,string"`
+}
+
+// A Role stores information about Discord guild member roles.
+type Role struct {
+  // The ID of the role.
+  ID string `json:"id"`
+
+  // The name of the role.
+  Name string `json:"name"`
+
+  // Whether this role is managed by an integration, and
+  // thus cannot be manually added to, or taken from, members.
+  Managed bool `json:"managed"`
+
+  // Whether this role is mentionable.
+  Mentionable bool `json:"mentionable"`
+
+  // Whether this role is hoisted (shows up separately in member list).
+  Hoist bool `json:"hoist"`
+
+  // The hex color of this role.
+  Color int `json:"color"`
+
+  // The position of this role in the guild's role hierarchy.
+  Position int `json:"position"`
+
+  // The permissions of the role on the guild (doesn't include channel overrides).
+  Permissions int64 `json:"permissions,string"`
+}
+
+// Roles are a collection of Role, sorted by Position with the highest first.
+type Roles []*Role
+
+func (r Roles) Len() int {
+  return len(r)
+}
+
+func (r Roles) Less(i, j int) bool {
+  return r[i].Position > r[j].Position
+}
+
+func (r Roles) Swap(i, j int) {
+  r[i], r[j] = r[j], r[i]
+}
+
 // A UserGuild holds a brief version of a Guild
 type UserGuild struct {
   ID          string `json:"id"`
@@ -446,6 +531,12 @@ type VoiceRegion struct {
   Port     int    `json:"sample_port"`
 }
 
+// A VoiceICE stores data for voice ICE servers.
+type VoiceICE struct {
+  TTL     string       `json:"ttl"`
+  Servers []*ICEServer `json:"servers"`
+}
+
 // A ICEServer stores data for a specific voice ICE server.
 type ICEServer struct {
   URL        string `json:"url"`
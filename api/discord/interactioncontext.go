@@ -0,0 +1,234 @@
+// Discord bindings for the Hrngh bot.
+// Available at https://github.com/abeiron/hrngh
+
+// Copyright 2020-2021, Undying Memory <abeiron@outlook.com>.  All rights reserved.
+// Use of this source code is governed by the Microsoft Public License
+// that can be found in the LICENSE file.
+
+// This file contains the context handed to interaction handlers, which
+// abstracts over how the initial response reaches Discord.
+
+package discord
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrInteractionResponded is returned when an initial response is sent for
+// an interaction that has already been responded to.
+var ErrInteractionResponded = errors.New("interaction has already been responded to")
+
+// ErrInteractionDeferred is returned when an ephemeral response is sent for
+// an interaction whose visible deferred response was sent on the handler's
+// behalf, since the response would then be shown to everyone.
+var ErrInteractionDeferred = errors.New("interaction was deferred publicly, cannot respond ephemerally")
+
+// InteractionHandler handles an interaction described by an InteractionContext.
+type InteractionHandler func(ctx *InteractionContext) error
+
+// InteractionContext carries an interaction to its handler along with the
+// means to respond to it.  The initial response is delivered over REST for
+// interactions received from the gateway, and as the HTTP response body for
+// interactions received by an InteractionServer; handlers need not care which.
+type InteractionContext struct {
+	Session     *Session
+	Interaction *Interaction
+
+	// Params holds the values captured by {param} segments of the
+	// custom_id pattern which matched a component interaction.
+	Params map[string]string
+
+	mu           sync.Mutex
+	responded    bool
+	acknowledged bool
+	respond      func(*InteractionResponse) error
+}
+
+// NewInteractionContext creates a context for an interaction received from
+// the gateway.  Its initial response is sent with Session.InteractionRespond.
+func NewInteractionContext(s *Session, i *Interaction) *InteractionContext {
+	return &InteractionContext{
+		Session:     s,
+		Interaction: i,
+		respond: func(resp *InteractionResponse) error {
+			return s.InteractionRespond(i, resp)
+		},
+	}
+}
+
+// Param returns the value of the named custom_id parameter, or an empty
+// string if the matched pattern did not capture it.
+func (ctx *InteractionContext) Param(name string) string {
+	return ctx.Params[name]
+}
+
+// User returns the user who invoked the interaction, whether it was
+// invoked in a guild or in a DM.
+func (ctx *InteractionContext) User() *User {
+	if ctx.Interaction.Member != nil {
+		return ctx.Interaction.Member.User
+	}
+
+	return ctx.Interaction.User
+}
+
+// Responded reports whether the initial response has been sent.
+func (ctx *InteractionContext) Responded() bool {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+
+	return ctx.responded
+}
+
+// Respond sends the initial response to the interaction.  Only one initial
+// response may be sent; later calls return ErrInteractionResponded.
+//
+// If the interaction was already acknowledged with a deferred response on
+// the handler's behalf, the response data is applied by editing the
+// original response instead.  A message sent in answer to a component is
+// sent as a followup, which keeps its flags; an ephemeral message cannot
+// replace the loading state of a command, which everyone sees, and fails
+// with ErrInteractionDeferred.
+func (ctx *InteractionContext) Respond(resp *InteractionResponse) error {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+
+	if ctx.responded {
+		return ErrInteractionResponded
+	}
+
+	if ctx.acknowledged {
+		if resp.Data == nil {
+			ctx.responded = true
+			return nil
+		}
+
+		// Autocomplete results cannot be delivered once the interaction was
+		// answered on the handler's behalf.
+		if resp.Type == InteractionApplicationCommandAutocompleteResult {
+			ctx.responded = true
+			return ErrInteractionResponded
+		}
+
+		deferred := ctx.deferredResponse().Type
+		if resp.Data.Flags&MessageFlagsEphemeral != 0 && deferred == InteractionResponseDeferredChannelMessageWithSource {
+			return ErrInteractionDeferred
+		}
+
+		ctx.responded = true
+		if deferred == InteractionResponseDeferredMessageUpdate && resp.Type == InteractionResponseChannelMessageWithSource {
+			_, err := ctx.Session.FollowupMessageCreate(ctx.Interaction.AppID, ctx.Interaction, true, &WebhookParams{
+				Content:         resp.Data.Content,
+				Components:      resp.Data.Components,
+				Embeds:          resp.Data.Embeds,
+				AllowedMentions: resp.Data.AllowedMentions,
+				Flags:           resp.Data.Flags,
+			})
+			return err
+		}
+
+		_, err := ctx.Session.InteractionResponseEdit(ctx.Interaction.AppID, ctx.Interaction, &WebhookEdit{
+			Content:         resp.Data.Content,
+			Components:      resp.Data.Components,
+			Embeds:          resp.Data.Embeds,
+			AllowedMentions: resp.Data.AllowedMentions,
+		})
+		return err
+	}
+
+	err := ctx.respond(resp)
+	if err == nil {
+		ctx.responded = true
+	}
+
+	return err
+}
+
+// Reply responds to the interaction with a message.
+func (ctx *InteractionContext) Reply(content string) error {
+	return ctx.Respond(&InteractionResponse{
+		Type: InteractionResponseChannelMessageWithSource,
+		Data: &InteractionResponseData{Content: content},
+	})
+}
+
+// ReplyEphemeral responds to the interaction with a message only the
+// invoking user can see.
+func (ctx *InteractionContext) ReplyEphemeral(content string) error {
+	return ctx.Respond(&InteractionResponse{
+		Type: InteractionResponseChannelMessageWithSource,
+		Data: &InteractionResponseData{
+			Content: content,
+			Flags:   MessageFlagsEphemeral,
+		},
+	})
+}
+
+// Update responds to a component interaction by editing the message the
+// component is attached to.
+func (ctx *InteractionContext) Update(data *InteractionResponseData) error {
+	return ctx.Respond(&InteractionResponse{
+		Type: InteractionResponseUpdateMessage,
+		Data: data,
+	})
+}
+
+// Defer acknowledges the interaction without a visible response.  Use
+// Edit or Followup to send the actual response later.
+func (ctx *InteractionContext) Defer() error {
+	return ctx.Respond(ctx.deferredResponse())
+}
+
+// Edit edits the original response to the interaction.
+func (ctx *InteractionContext) Edit(data *WebhookEdit) (*Message, error) {
+	return ctx.Session.InteractionResponseEdit(ctx.Interaction.AppID, ctx.Interaction, data)
+}
+
+// Followup sends a followup message for the interaction.
+func (ctx *InteractionContext) Followup(data *WebhookParams) (*Message, error) {
+	return ctx.Session.FollowupMessageCreate(ctx.Interaction.AppID, ctx.Interaction, true, data)
+}
+
+// deferredResponse returns the deferred response type suitable for the
+// interaction: component interactions keep their message as is,
+// autocomplete interactions get no choices, and everything else shows a
+// loading state.
+func (ctx *InteractionContext) deferredResponse() *InteractionResponse {
+	switch ctx.Interaction.Type {
+	case InteractionMessageComponent:
+		return &InteractionResponse{Type: InteractionResponseDeferredMessageUpdate}
+	case InteractionApplicationCommandAutocomplete:
+		return &InteractionResponse{
+			Type: InteractionApplicationCommandAutocompleteResult,
+			Data: &InteractionResponseData{},
+		}
+	}
+
+	return &InteractionResponse{Type: InteractionResponseDeferredChannelMessageWithSource}
+}
+
+// acknowledge marks the interaction as acknowledged on the handler's behalf
+// and returns the deferred response to send, unless the handler has already
+// responded.
+func (ctx *InteractionContext) acknowledge() (*InteractionResponse, bool) {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+
+	if ctx.responded || ctx.acknowledged {
+		return nil, false
+	}
+
+	ctx.acknowledged = true
+	return ctx.deferredResponse(), true
+}
+
+// finish makes sure an interaction received from the gateway gets a
+// response, so that the user does not see it fail once the handler returns.
+func (ctx *InteractionContext) finish() {
+	if resp, ok := ctx.acknowledge(); ok {
+		if err := ctx.respond(resp); err != nil {
+			ctx.Session.log(LogWarning, "error acknowledging interaction %s, %s", ctx.Interaction.ID, err)
+		}
+	}
+}
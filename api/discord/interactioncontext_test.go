@@ -0,0 +1,169 @@
+// Discord bindings for the Hrngh bot.
+// Available at https://github.com/abeiron/hrngh
+
+// Copyright 2020-2021, Undying Memory <abeiron@outlook.com>.  All rights reserved.
+// Use of this source code is governed by the Microsoft Public License
+// that can be found in the LICENSE file.
+
+// This file contains tests of the responses of an InteractionContext, whose
+// REST requests are recorded rather than sent to Discord.
+
+package discord
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// A restRequest is a REST request recorded by a restRecorder.
+type restRequest struct {
+	Method string
+	Path   string
+	Body   map[string]interface{}
+}
+
+// A restRecorder answers the REST requests of a Session with an empty
+// object, and records them.
+type restRecorder struct {
+	requests []restRequest
+}
+
+func (r *restRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	rr := restRequest{Method: req.Method, Path: req.URL.Path}
+	if req.Body != nil {
+		b, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) > 0 {
+			if err = json.Unmarshal(b, &rr.Body); err != nil {
+				return nil, err
+			}
+		}
+	}
+	r.requests = append(r.requests, rr)
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     make(http.Header),
+		Body:       ioutil.NopCloser(strings.NewReader("{}")),
+		Request:    req,
+	}, nil
+}
+
+// recordedSession returns a session whose REST requests go to a recorder.
+func recordedSession() (*Session, *restRecorder) {
+	r := &restRecorder{}
+	s := &Session{
+		Client:      &http.Client{Transport: r},
+		Ratelimiter: NewRatelimiter(),
+	}
+
+	return s, r
+}
+
+func TestRespondAfterDefer(t *testing.T) {
+	cases := []struct {
+		name      string
+		typ       InteractionType
+		respond   func(ctx *InteractionContext) error
+		err       error
+		responded bool
+
+		// method and path are those of the request expected, if any, and
+		// flags the flags it carries.
+		method string
+		path   string
+		flags  float64
+	}{{
+		name:    "ephemeral reply to a command",
+		typ:     InteractionApplicationCommand,
+		respond: func(ctx *InteractionContext) error { return ctx.ReplyEphemeral("secret") },
+		err:     ErrInteractionDeferred,
+	}, {
+		name:      "reply to a command",
+		typ:       InteractionApplicationCommand,
+		respond:   func(ctx *InteractionContext) error { return ctx.Reply("hello") },
+		responded: true,
+		method:    "PATCH",
+		path:      "/webhooks/app/token/messages/@original",
+	}, {
+		name:      "ephemeral reply to a component",
+		typ:       InteractionMessageComponent,
+		respond:   func(ctx *InteractionContext) error { return ctx.ReplyEphemeral("secret") },
+		responded: true,
+		method:    "POST",
+		path:      "/webhooks/app/token",
+		flags:     float64(MessageFlagsEphemeral),
+	}, {
+		name: "update of a component's message",
+		typ:  InteractionMessageComponent,
+		respond: func(ctx *InteractionContext) error {
+			return ctx.Update(&InteractionResponseData{Content: "updated"})
+		},
+		responded: true,
+		method:    "PATCH",
+		path:      "/webhooks/app/token/messages/@original",
+	}}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			s, r := recordedSession()
+			ctx := NewInteractionContext(s, &Interaction{Type: tc.typ, AppID: "app", Token: "token"})
+			if _, ok := ctx.acknowledge(); !ok {
+				t.Fatal("interaction not acknowledged")
+			}
+
+			if err := tc.respond(ctx); err != tc.err {
+				t.Fatalf("got error %v, want %v", err, tc.err)
+			}
+			if ctx.Responded() != tc.responded {
+				t.Errorf("Responded() = %v, want %v", ctx.Responded(), tc.responded)
+			}
+
+			if tc.method == "" {
+				if len(r.requests) != 0 {
+					t.Fatalf("got requests %+v, want none", r.requests)
+				}
+				return
+			}
+			if len(r.requests) != 1 {
+				t.Fatalf("got requests %+v, want one", r.requests)
+			}
+
+			req := r.requests[0]
+			if req.Method != tc.method || !strings.HasSuffix(req.Path, tc.path) {
+				t.Errorf("got %s %s, want %s %s", req.Method, req.Path, tc.method, tc.path)
+			}
+			if flags, _ := req.Body["flags"].(float64); flags != tc.flags {
+				t.Errorf("got flags %v, want %v", flags, tc.flags)
+			}
+		})
+	}
+}
+
+// TestRespondEphemeralFallback checks that a handler refused an ephemeral
+// reply may still reply publicly.
+func TestRespondEphemeralFallback(t *testing.T) {
+	s, r := recordedSession()
+	ctx := NewInteractionContext(s, &Interaction{Type: InteractionApplicationCommand, AppID: "app", Token: "token"})
+	ctx.acknowledge()
+
+	if err := ctx.ReplyEphemeral("secret"); err != ErrInteractionDeferred {
+		t.Fatalf("got error %v, want %v", err, ErrInteractionDeferred)
+	}
+	if err := ctx.Reply("public"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.Reply("again"); err != ErrInteractionResponded {
+		t.Errorf("second reply: got error %v, want %v", err, ErrInteractionResponded)
+	}
+
+	if len(r.requests) != 1 || r.requests[0].Body["content"] != "public" {
+		t.Errorf("got requests %+v, want the public reply", r.requests)
+	}
+}
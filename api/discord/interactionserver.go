@@ -0,0 +1,123 @@
+// Discord bindings for the Hrngh bot.
+// Available at https://github.com/abeiron/hrngh
+
+// Copyright 2020-2021, Undying Memory <abeiron@outlook.com>.  All rights reserved.
+// Use of this source code is governed by the Microsoft Public License
+// that can be found in the LICENSE file.
+
+// This file contains code for receiving interactions over HTTP rather than
+// through the gateway.
+
+package discord
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// DefaultInteractionTimeout is how long an InteractionServer waits for a
+// handler's initial response before acknowledging the interaction itself.
+// Discord fails interactions which are not answered within three seconds.
+const DefaultInteractionTimeout = 2500 * time.Millisecond
+
+// InteractionServer is an http.Handler for Discord's "interactions endpoint
+// URL".  It verifies request signatures, answers pings, and hands every
+// other interaction to Handler.
+//
+// The initial response is written as the HTTP response body.  If Handler
+// does not respond within Timeout, or returns without responding, the
+// interaction is acknowledged with a deferred response and a later
+// InteractionContext.Respond edits the original response instead.
+type InteractionServer struct {
+	Session   *Session
+	PublicKey ed25519.PublicKey
+	Handler   InteractionHandler
+
+	// Timeout bounds the time Handler has to produce the initial response.
+	// If zero, DefaultInteractionTimeout is used.
+	Timeout time.Duration
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (srv *InteractionServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !VerifyInteraction(r, srv.PublicKey) {
+		http.Error(w, "invalid request signature", http.StatusUnauthorized)
+		return
+	}
+
+	var i Interaction
+	err := json.NewDecoder(r.Body).Decode(&i)
+	if err != nil {
+		http.Error(w, "malformed interaction", http.StatusBadRequest)
+		return
+	}
+
+	if i.Type == InteractionPing {
+		srv.write(w, &InteractionResponse{Type: InteractionResponsePong})
+		return
+	}
+
+	responses := make(chan *InteractionResponse, 1)
+	ctx := &InteractionContext{
+		Session:     srv.Session,
+		Interaction: &i,
+		respond: func(resp *InteractionResponse) error {
+			responses <- resp
+			return nil
+		},
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		if srv.Handler == nil {
+			return
+		}
+
+		if err := srv.Handler(ctx); err != nil {
+			srv.Session.log(LogError, "error handling interaction %s, %s", i.ID, err)
+		}
+	}()
+
+	timeout := srv.Timeout
+	if timeout == 0 {
+		timeout = DefaultInteractionTimeout
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case resp := <-responses:
+		srv.write(w, resp)
+		return
+	case <-done:
+	case <-timer.C:
+	}
+
+	if resp, ok := ctx.acknowledge(); ok {
+		srv.write(w, resp)
+		return
+	}
+
+	// The handler responded concurrently with the deadline.
+	srv.write(w, <-responses)
+}
+
+// write writes an interaction response as the HTTP response body.
+func (srv *InteractionServer) write(w http.ResponseWriter, resp *InteractionResponse) {
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		srv.Session.log(LogError, "error writing interaction response, %s", err)
+	}
+}
@@ -0,0 +1,252 @@
+// Discord bindings for the Hrngh bot.
+// Available at https://github.com/abeiron/hrngh
+
+// Copyright 2020-2021, Undying Memory <abeiron@outlook.com>.  All rights reserved.
+// Use of this source code is governed by the Microsoft Public License
+// that can be found in the LICENSE file.
+
+// This file contains code related to requesting the members of large
+// guilds, which Discord leaves out of GUILD_CREATE, to fill the State.
+
+package discord
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultMemberChunkInterval is the interval between member requests when
+// MemberChunking.Interval is zero.
+const DefaultMemberChunkInterval = time.Second
+
+// memberChunkNonce leads the nonce of the member requests of a session,
+// which is followed by the guild ID.
+const memberChunkNonce = "hrngh:"
+
+// MemberChunking sets how a Session requests the members of large guilds.
+// When it is set, the session requests the members of each large guild as
+// the guild becomes available, adding them to the State as they arrive, and
+// sends a GuildMembersReady event once it has them all.  The members of a
+// guild which is not large all come with its GUILD_CREATE.
+//
+// Requests need the GUILD_MEMBERS intent, and are only made while
+// State.TrackMembers is set.
+type MemberChunking struct {
+	// Interval is the least time between two member requests of the
+	// session, as Discord limits the commands each shard may send.  Zero
+	// is DefaultMemberChunkInterval.
+	Interval time.Duration
+
+	// Presences requests the presences of the members too, which needs
+	// the GUILD_PRESENCES intent.
+	Presences bool
+}
+
+func (c *MemberChunking) interval() time.Duration {
+	if c.Interval > 0 {
+		return c.Interval
+	}
+	return DefaultMemberChunkInterval
+}
+
+// A memberChunkQueue holds the guilds whose members a session is yet to
+// request, in order, and the guild whose request is being sent, if any.
+type memberChunkQueue struct {
+	mu      sync.Mutex
+	guilds  []string
+	queued  map[string]bool
+	current string
+	running bool
+}
+
+// chunkMembers requests the members of large guilds as they become
+// available, and marks guilds ready as their members arrive.  It is called
+// for each event after the state has handled it.
+func (s *Session) chunkMembers(i interface{}) {
+	if s.MemberChunking == nil || s.State == nil || !s.StateEnabled || !s.State.TrackMembers {
+		return
+	}
+
+	switch t := i.(type) {
+	case *GuildCreate:
+		if t.Unavailable {
+			return
+		}
+		if !t.Large || len(t.Members) >= t.MemberCount {
+			s.guildMembersReady(t.ID)
+			return
+		}
+		s.State.membersPending(t.ID)
+		s.queueMemberChunks(t.ID)
+	case *GuildMembersChunk:
+		if t.Nonce == memberChunkNonce+t.GuildID && t.ChunkIndex == t.ChunkCount-1 {
+			s.guildMembersReady(t.GuildID)
+		}
+	case *GuildDelete:
+		s.State.membersPending(t.ID)
+		s.unqueueMemberChunks(t.ID)
+	}
+}
+
+// guildMembersReady marks the members of a guild ready, sending a
+// GuildMembersReady event unless they were already.
+func (s *Session) guildMembersReady(guildID string) {
+	if s.State.setMembersReady(guildID) {
+		// Handlers are being called; they may not be called again from here.
+		go s.handleEvent(guildMembersReadyEventType, &GuildMembersReady{GuildID: guildID})
+	}
+}
+
+// queueMemberChunks queues the request of the members of a guild, starting
+// the goroutine sending the requests if it is not running.
+func (s *Session) queueMemberChunks(guildID string) {
+	q := &s.memberChunks
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.queued == nil {
+		q.queued = make(map[string]bool)
+	}
+	if q.queued[guildID] {
+		return
+	}
+	q.queued[guildID] = true
+	q.guilds = append(q.guilds, guildID)
+
+	if !q.running {
+		q.running = true
+		go s.requestMemberChunks()
+	}
+}
+
+// unqueueMemberChunks drops the request of the members of a guild, if it is
+// queued or being sent.
+func (s *Session) unqueueMemberChunks(guildID string) {
+	q := &s.memberChunks
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.current == guildID {
+		q.current = ""
+	}
+	if !q.queued[guildID] {
+		return
+	}
+	delete(q.queued, guildID)
+
+	for i, id := range q.guilds {
+		if id == guildID {
+			q.guilds = append(q.guilds[:i], q.guilds[i+1:]...)
+			break
+		}
+	}
+}
+
+// requestMemberChunks sends the queued member requests, one per interval,
+// until the queue is empty.  A guild whose request fails, as it does while
+// the session reconnects, is queued again, unless it was deleted meanwhile.
+func (s *Session) requestMemberChunks() {
+	q := &s.memberChunks
+
+	for {
+		q.mu.Lock()
+		if len(q.guilds) == 0 {
+			q.running = false
+			q.mu.Unlock()
+			return
+		}
+		guildID := q.guilds[0]
+		q.guilds = q.guilds[1:]
+		delete(q.queued, guildID)
+		q.current = guildID
+		q.mu.Unlock()
+
+		c := s.MemberChunking
+		if c == nil {
+			c = &MemberChunking{}
+		}
+
+		err := s.RequestGuildMembers(guildID, "", 0, memberChunkNonce+guildID, c.Presences)
+		if err != nil {
+			s.log(LogWarning, "error requesting members of guild %s, %s", guildID, err)
+		}
+
+		q.mu.Lock()
+		if err != nil && q.current == guildID && !q.queued[guildID] {
+			q.queued[guildID] = true
+			q.guilds = append(q.guilds, guildID)
+		}
+		q.current = ""
+		q.mu.Unlock()
+
+		time.Sleep(c.interval())
+	}
+}
+
+// membersChan returns the channel closed once the members of a guild are
+// ready.  s.membersMu must be held.
+func (s *State) membersChan(guildID string) chan struct{} {
+	if s.membersReady == nil {
+		s.membersReady = make(map[string]chan struct{})
+	}
+
+	c, ok := s.membersReady[guildID]
+	if !ok {
+		c = make(chan struct{})
+		s.membersReady[guildID] = c
+	}
+
+	return c
+}
+
+// membersPending marks the members of a guild as not yet ready.
+func (s *State) membersPending(guildID string) {
+	s.membersMu.Lock()
+	defer s.membersMu.Unlock()
+
+	select {
+	case <-s.membersChan(guildID):
+		s.membersReady[guildID] = make(chan struct{})
+	default:
+	}
+}
+
+// setMembersReady marks the members of a guild ready, reporting whether
+// they were not already.
+func (s *State) setMembersReady(guildID string) bool {
+	s.membersMu.Lock()
+	defer s.membersMu.Unlock()
+
+	c := s.membersChan(guildID)
+	select {
+	case <-c:
+		return false
+	default:
+		close(c)
+		return true
+	}
+}
+
+// WaitForMembers waits until the state holds all the members of a guild,
+// or until ctx is done, returning its error.  The members are only known to
+// be complete when Session.MemberChunking is set; otherwise WaitForMembers
+// waits for ctx.
+func (s *State) WaitForMembers(ctx context.Context, guildID string) error {
+	if s == nil {
+		return ErrNilState
+	}
+
+	s.membersMu.Lock()
+	c := s.membersChan(guildID)
+	s.membersMu.Unlock()
+
+	select {
+	case <-c:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,143 @@
+// Discord bindings for the Hrngh bot.
+// Available at https://github.com/abeiron/hrngh
+
+// Copyright 2020-2021, Undying Memory <abeiron@outlook.com>.  All rights reserved.
+// Use of this source code is governed by the Microsoft Public License
+// that can be found in the LICENSE file.
+
+// This file contains tests of the member requests of large guilds.  The
+// sessions have no gateway connection, so every request fails.
+
+package discord
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// chunkingSession returns a session requesting the members of large guilds
+// every interval.
+func chunkingSession(interval time.Duration) *Session {
+	s := NewState()
+	s.TrackMembers = true
+
+	return &Session{StateEnabled: true, State: s, MemberChunking: &MemberChunking{Interval: interval}}
+}
+
+// memberChunkQueued reports whether the members of a guild are queued to be
+// requested, or being requested, and whether the requests are running.
+func memberChunkQueued(s *Session, guildID string) (queued, running bool) {
+	q := &s.memberChunks
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.queued[guildID] || q.current == guildID, q.running
+}
+
+func TestWaitForMembers(t *testing.T) {
+	se := chunkingSession(10 * time.Millisecond)
+	t.Cleanup(func() { se.unqueueMemberChunks("g") })
+
+	ready := make(chan string, 2)
+	se.AddHandler(func(_ *Session, r *GuildMembersReady) { ready <- r.GuildID })
+
+	waited := make(chan error, 1)
+	go func() { waited <- se.State.WaitForMembers(context.Background(), "g") }()
+
+	guild := &Guild{ID: "g", Large: true, MemberCount: 2, Members: []*Member{{User: &User{ID: "a"}}}}
+	se.handleEvent(guildCreateEventType, &GuildCreate{Guild: guild})
+
+	select {
+	case err := <-waited:
+		t.Fatalf("WaitForMembers returned %v before the members arrived", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// A chunk of another request does not complete the guild.
+	se.handleEvent(guildMembersChunkEventType, &GuildMembersChunk{GuildID: "g", ChunkCount: 1, Nonce: "other"})
+	select {
+	case err := <-waited:
+		t.Fatalf("WaitForMembers returned %v on a chunk of another request", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	se.handleEvent(guildMembersChunkEventType, &GuildMembersChunk{
+		GuildID:    "g",
+		Members:    []*Member{{User: &User{ID: "b"}}},
+		ChunkCount: 1,
+		Nonce:      memberChunkNonce + "g",
+	})
+
+	select {
+	case err := <-waited:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("WaitForMembers did not return once the members arrived")
+	}
+	select {
+	case guildID := <-ready:
+		if guildID != "g" {
+			t.Errorf("got GuildMembersReady for %q, want g", guildID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no GuildMembersReady event")
+	}
+
+	if _, err := se.State.Member("g", "b"); err != nil {
+		t.Errorf("member of the chunk: %v", err)
+	}
+
+	// The guild stays ready, and is not announced again.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := se.State.WaitForMembers(ctx, "g"); err != nil {
+		t.Errorf("second wait: %v", err)
+	}
+	se.handleEvent(guildMembersChunkEventType, &GuildMembersChunk{GuildID: "g", ChunkCount: 1, Nonce: memberChunkNonce + "g"})
+	select {
+	case <-ready:
+		t.Error("GuildMembersReady sent twice")
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+// TestWaitForMembersContext checks that WaitForMembers gives up with its
+// context.
+func TestWaitForMembersContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := NewState().WaitForMembers(ctx, "g"); err != context.DeadlineExceeded {
+		t.Errorf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+// TestMemberChunkRequeue checks that a guild whose request failed is queued
+// again, until it is deleted.
+func TestMemberChunkRequeue(t *testing.T) {
+	const interval = 5 * time.Millisecond
+
+	se := chunkingSession(interval)
+	se.handleEvent(guildCreateEventType, &GuildCreate{Guild: &Guild{ID: "g", Large: true, MemberCount: 2}})
+
+	time.Sleep(5 * interval)
+	if queued, running := memberChunkQueued(se, "g"); !queued || !running {
+		t.Fatalf("after failed requests: got queued %v and running %v, want both", queued, running)
+	}
+
+	se.handleEvent(guildDeleteEventType, &GuildDelete{Guild: &Guild{ID: "g"}})
+
+	for end := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		queued, running := memberChunkQueued(se, "g")
+		if !queued && !running {
+			break
+		}
+		if time.Now().After(end) {
+			t.Fatalf("after the guild was deleted: got queued %v and running %v, want neither", queued, running)
+		}
+	}
+}
@@ -10,6 +10,7 @@
 package discord
 
 import (
+  "encoding/json"
   "io"
   "regexp"
   "strings"
@@ -124,6 +125,25 @@ type Message struct {
   // This is a combination of bit masks; the presence of a certain permission can
   // be checked by performing a bitwise AND between this int and the flag.
   Flags MessageFlags `json:"flags"`
+
+  // A list of components attached to the message.
+  Components []MessageComponent `json:"components"`
+}
+
+// UnmarshalJSON is a helper function to unmarshal the Message.
+func (m *Message) UnmarshalJSON(data []byte) error {
+  type message Message
+  var v struct {
+    message
+    RawComponents []unmarshalableMessageComponent `json:"components"`
+  }
+  err := json.Unmarshal(data, &v)
+  if err != nil {
+    return err
+  }
+  *m = Message(v.message)
+  m.Components = unmarshalComponents(v.RawComponents)
+  return err
 }
 
 // MessageFlags is the flags of "message" (see MessageFlags* consts)
@@ -137,6 +157,7 @@ const (
   MessageFlagsSupressEmbeds
   MessageFlagsSourceMessageDeleted
   MessageFlagsUrgent
+  MessageFlagsEphemeral MessageFlags = 1 << 6
 )
 
 // File stores info about files you e.g. send in messages.
@@ -151,6 +172,7 @@ type MessageSend struct {
   Content         string                  `json:"content,omitempty"`
   Embed           *MessageEmbed           `json:"embed,omitempty"`
   TTS             bool                    `json:"tts"`
+  Components      []MessageComponent      `json:"components,omitempty"`
   Files           []*File                 `json:"-"`
   AllowedMentions *MessageAllowedMentions `json:"allowed_mentions,omitempty"`
   Reference       *MessageReference       `json:"message_reference,omitempty"`
@@ -163,6 +185,7 @@ type MessageSend struct {
 // is also where you should get the instance from.
 type MessageEdit struct {
   Content         *string                 `json:"content,omitempty"`
+  Components      []MessageComponent      `json:"components,omitempty"`
   Embed           *MessageEmbed           `json:"embed,omitempty"`
   AllowedMentions *MessageAllowedMentions `json:"allowed_mentions,omitempty"`
 
@@ -186,6 +209,13 @@ func (m *MessageEdit) SetContent(str string) *MessageEdit {
   return m
 }
 
+// SetComponents is a convenience function for setting the components,
+// so you can chain commands.
+func (m *MessageEdit) SetComponents(components ...MessageComponent) *MessageEdit {
+  m.Components = components
+  return m
+}
+
 // SetEmbed is a convenience function for setting the embed,
 // so you can chain commands.
 func (m *MessageEdit) SetEmbed(embed *MessageEmbed) *MessageEdit {
@@ -0,0 +1,392 @@
+// Discord bindings for the Hrngh bot.
+// Available at https://github.com/abeiron/hrngh
+
+// Copyright 2020-2021, Undying Memory <abeiron@outlook.com>.  All rights reserved.
+// Use of this source code is governed by the Microsoft Public License
+// that can be found in the LICENSE file.
+
+// This file contains MessageCache, a bounded cache of messages which can
+// back the messages of the State.
+
+package discord
+
+import (
+	"sync"
+	"time"
+)
+
+// A MessageCachePolicy sets how the messages of a channel are cached.  A
+// policy set for a guild or channel overrides the policy of the guild or
+// the defaults field by field, a zero field being left to them.
+type MessageCachePolicy struct {
+	// Limit is the most messages cached per channel, the oldest being
+	// evicted first.  Zero is no limit; a negative Limit disables caching.
+	Limit int
+
+	// TTL is how long a message stays cached after it was first added.
+	// Zero or negative is forever; use a negative TTL to override a TTL
+	// with forever.
+	TTL time.Duration
+}
+
+// MessageCacheStats holds the statistics of a MessageCache.
+type MessageCacheStats struct {
+	Len         int    // messages cached
+	Hits        uint64 // lookups which found a message
+	Misses      uint64 // lookups which did not
+	Evictions   uint64 // messages evicted by the limits
+	Expirations uint64 // messages evicted by their TTL
+}
+
+// A MessageCache caches messages by ID, up to a limit per channel and a
+// limit overall, beyond which the least recently used messages are
+// evicted.  Each channel or guild may override the default policy.  Finding,
+// adding and removing a message take constant time.  It is safe for
+// concurrent use.
+//
+// A State uses a MessageCache for its messages when one is set as its
+// MessageCache.
+type MessageCache struct {
+	mu sync.Mutex
+
+	// max is the most messages cached overall, zero being no limit.
+	max             int
+	defaults        MessageCachePolicy
+	channelPolicies map[string]MessageCachePolicy
+	guildPolicies   map[string]MessageCachePolicy
+
+	messages map[string]*cachedMessage
+	channels map[string]*messageChannel
+
+	// lru lists the messages from the least recently used.
+	lru messageList
+
+	stats MessageCacheStats
+}
+
+// A cachedMessage is in two lists: the lru list of the cache, and the list
+// of its channel, in the order it was added.
+type cachedMessage struct {
+	message *Message
+	added   time.Time
+	channel *messageChannel
+
+	lru, inChannel messageLinks
+}
+
+type messageLinks struct {
+	prev, next *cachedMessage
+}
+
+// A messageList is a doubly linked list of messages, threaded through the
+// links chosen by its link function.
+type messageList struct {
+	head, tail *cachedMessage
+	n          int
+	link       func(m *cachedMessage) *messageLinks
+}
+
+func (l *messageList) pushBack(m *cachedMessage) {
+	links := l.link(m)
+	links.prev, links.next = l.tail, nil
+	if l.tail != nil {
+		l.link(l.tail).next = m
+	} else {
+		l.head = m
+	}
+	l.tail = m
+	l.n++
+}
+
+func (l *messageList) remove(m *cachedMessage) {
+	links := l.link(m)
+	if links.prev != nil {
+		l.link(links.prev).next = links.next
+	} else {
+		l.head = links.next
+	}
+	if links.next != nil {
+		l.link(links.next).prev = links.prev
+	} else {
+		l.tail = links.prev
+	}
+	links.prev, links.next = nil, nil
+	l.n--
+}
+
+func lruLinks(m *cachedMessage) *messageLinks       { return &m.lru }
+func inChannelLinks(m *cachedMessage) *messageLinks { return &m.inChannel }
+
+// A messageChannel holds the messages cached of a channel.
+type messageChannel struct {
+	id, guildID string
+	policy      MessageCachePolicy
+	messages    messageList
+}
+
+// NewMessageCache returns a MessageCache holding at most max messages,
+// zero being no limit, with the default policy defaults.
+func NewMessageCache(max int, defaults MessageCachePolicy) *MessageCache {
+	return &MessageCache{
+		max:             max,
+		defaults:        defaults,
+		channelPolicies: make(map[string]MessageCachePolicy),
+		guildPolicies:   make(map[string]MessageCachePolicy),
+		messages:        make(map[string]*cachedMessage),
+		channels:        make(map[string]*messageChannel),
+		lru:             messageList{link: lruLinks},
+	}
+}
+
+// SetChannelPolicy overrides the default policy for a channel, and any
+// policy of its guild.  Messages already cached are evicted as the policy
+// next applies to the channel.
+func (c *MessageCache) SetChannelPolicy(channelID string, policy MessageCachePolicy) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.channelPolicies[channelID] = policy
+	if ch, ok := c.channels[channelID]; ok {
+		ch.policy = c.policy(channelID, ch.guildID)
+	}
+}
+
+// SetGuildPolicy overrides the default policy for the channels of a guild.
+func (c *MessageCache) SetGuildPolicy(guildID string, policy MessageCachePolicy) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.guildPolicies[guildID] = policy
+	for _, ch := range c.channels {
+		if ch.guildID == guildID {
+			ch.policy = c.policy(ch.id, guildID)
+		}
+	}
+}
+
+// policy returns the policy for a channel.
+func (c *MessageCache) policy(channelID, guildID string) MessageCachePolicy {
+	policy := c.defaults
+
+	for _, override := range []MessageCachePolicy{c.guildPolicies[guildID], c.channelPolicies[channelID]} {
+		if override.Limit != 0 {
+			policy.Limit = override.Limit
+		}
+		if override.TTL != 0 {
+			policy.TTL = override.TTL
+		}
+	}
+
+	return policy
+}
+
+// Get returns a message by channel and ID, counting a hit or miss.
+func (c *MessageCache) Get(channelID, messageID string) (*Message, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	m := c.get(channelID, messageID, time.Now())
+	if m == nil {
+		c.stats.Misses++
+		return nil, false
+	}
+
+	c.stats.Hits++
+	c.lru.remove(m)
+	c.lru.pushBack(m)
+
+	return m.message, true
+}
+
+// peek returns a message by channel and ID, counting no hit or miss.
+func (c *MessageCache) peek(channelID, messageID string) *Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if m := c.get(channelID, messageID, time.Now()); m != nil {
+		return m.message
+	}
+
+	return nil
+}
+
+// get returns a cached message, evicting it if it has expired.
+func (c *MessageCache) get(channelID, messageID string, now time.Time) *cachedMessage {
+	m, ok := c.messages[messageID]
+	if !ok || m.channel.id != channelID {
+		return nil
+	}
+
+	if c.expired(m, now) {
+		c.remove(m)
+		c.stats.Expirations++
+		return nil
+	}
+
+	return m
+}
+
+func (c *MessageCache) expired(m *cachedMessage, now time.Time) bool {
+	ttl := m.channel.policy.TTL
+	return ttl > 0 && now.Sub(m.added) > ttl
+}
+
+// Add adds a message to the cache, or replaces the cached message with its
+// ID, evicting messages past the limits.  Replacing a message leaves its
+// place in its channel and its TTL as they were.
+func (c *MessageCache) Add(message *Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+
+	if m := c.get(message.ChannelID, message.ID, now); m != nil {
+		m.message = message
+		c.lru.remove(m)
+		c.lru.pushBack(m)
+		return
+	}
+
+	ch, ok := c.channels[message.ChannelID]
+	if !ok {
+		ch = &messageChannel{
+			id:       message.ChannelID,
+			guildID:  message.GuildID,
+			policy:   c.policy(message.ChannelID, message.GuildID),
+			messages: messageList{link: inChannelLinks},
+		}
+		if ch.policy.Limit < 0 {
+			return
+		}
+		c.channels[ch.id] = ch
+	} else if ch.policy.Limit < 0 {
+		c.removeChannel(ch)
+		return
+	}
+
+	m := &cachedMessage{message: message, added: now, channel: ch}
+	c.messages[message.ID] = m
+	c.lru.pushBack(m)
+	ch.messages.pushBack(m)
+
+	// The oldest messages of the channel are the first to expire.
+	for ch.messages.head != nil && c.expired(ch.messages.head, now) {
+		c.remove(ch.messages.head)
+		c.stats.Expirations++
+	}
+	for ch.policy.Limit > 0 && ch.messages.n > ch.policy.Limit {
+		c.remove(ch.messages.head)
+		c.stats.Evictions++
+	}
+	for c.max > 0 && c.lru.n > c.max {
+		if c.expired(c.lru.head, now) {
+			c.stats.Expirations++
+		} else {
+			c.stats.Evictions++
+		}
+		c.remove(c.lru.head)
+	}
+}
+
+// remove removes a message from the cache.
+func (c *MessageCache) remove(m *cachedMessage) {
+	delete(c.messages, m.message.ID)
+	c.lru.remove(m)
+	m.channel.messages.remove(m)
+	if m.channel.messages.n == 0 {
+		delete(c.channels, m.channel.id)
+	}
+}
+
+func (c *MessageCache) removeChannel(ch *messageChannel) {
+	for ch.messages.head != nil {
+		c.remove(ch.messages.head)
+	}
+	delete(c.channels, ch.id)
+}
+
+// Remove removes a message from the cache, reporting whether it was cached.
+func (c *MessageCache) Remove(channelID, messageID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	m := c.get(channelID, messageID, time.Now())
+	if m == nil {
+		return false
+	}
+
+	c.remove(m)
+	return true
+}
+
+// RemoveChannel removes the messages of a channel from the cache.
+func (c *MessageCache) RemoveChannel(channelID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if ch, ok := c.channels[channelID]; ok {
+		c.removeChannel(ch)
+	}
+}
+
+// RemoveGuild removes the messages of the channels of a guild from the
+// cache.
+func (c *MessageCache) RemoveGuild(guildID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, ch := range c.channels {
+		if ch.guildID == guildID {
+			c.removeChannel(ch)
+		}
+	}
+}
+
+// Messages returns the messages cached of a channel, in the order they
+// were added.  It counts no hits or misses.
+func (c *MessageCache) Messages(channelID string) []*Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch, ok := c.channels[channelID]
+	if !ok {
+		return nil
+	}
+
+	now := time.Now()
+	messages := make([]*Message, 0, ch.messages.n)
+	for m := ch.messages.head; m != nil; m = m.inChannel.next {
+		if !c.expired(m, now) {
+			messages = append(messages, m.message)
+		}
+	}
+
+	return messages
+}
+
+// Expire evicts every expired message.  Expired messages are otherwise
+// evicted as they are looked up or as the cache fills; a bot caching many
+// channels with a TTL may call Expire periodically to free them sooner.
+func (c *MessageCache) Expire() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for _, ch := range c.channels {
+		for ch.messages.head != nil && c.expired(ch.messages.head, now) {
+			c.remove(ch.messages.head)
+			c.stats.Expirations++
+		}
+	}
+}
+
+// Stats returns the statistics of the cache.
+func (c *MessageCache) Stats() MessageCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Len = c.lru.n
+
+	return stats
+}
@@ -0,0 +1,145 @@
+// Discord bindings for the Hrngh bot.
+// Available at https://github.com/abeiron/hrngh
+
+// Copyright 2020-2021, Undying Memory <abeiron@outlook.com>.  All rights reserved.
+// Use of this source code is governed by the Microsoft Public License
+// that can be found in the LICENSE file.
+
+// This file contains tests of the eviction and policies of MessageCache.
+
+package discord
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// addMessages adds n messages to a channel of a guild, with IDs numbered
+// after the channel.
+func addMessages(c *MessageCache, guildID, channelID string, n int) {
+	for i := 0; i < n; i++ {
+		c.Add(&Message{ID: fmt.Sprintf("%s-%d", channelID, i), ChannelID: channelID, GuildID: guildID})
+	}
+}
+
+// cachedIDs returns the IDs of the messages cached of a channel.
+func cachedIDs(c *MessageCache, channelID string) []string {
+	var ids []string
+	for _, m := range c.Messages(channelID) {
+		ids = append(ids, m.ID)
+	}
+
+	return ids
+}
+
+// TestMessageCacheLRU checks that a full cache evicts the least recently
+// used message, which a lookup makes recent.
+func TestMessageCacheLRU(t *testing.T) {
+	c := NewMessageCache(2, MessageCachePolicy{})
+	c.Add(&Message{ID: "a", ChannelID: "c1"})
+	c.Add(&Message{ID: "b", ChannelID: "c2"})
+
+	if _, ok := c.Get("c1", "a"); !ok {
+		t.Fatal("a not cached")
+	}
+	c.Add(&Message{ID: "c", ChannelID: "c3"})
+
+	if _, ok := c.Get("c2", "b"); ok {
+		t.Error("least recently used message b not evicted")
+	}
+	for _, m := range []struct{ channelID, id string }{{"c1", "a"}, {"c3", "c"}} {
+		if _, ok := c.Get(m.channelID, m.id); !ok {
+			t.Errorf("%s evicted", m.id)
+		}
+	}
+
+	if stats := c.Stats(); stats.Len != 2 || stats.Evictions != 1 || stats.Hits != 3 || stats.Misses != 1 {
+		t.Errorf("got stats %+v, want 2 cached, 1 eviction, 3 hits and 1 miss", stats)
+	}
+}
+
+// TestMessageCacheChannelLimit checks that a channel past its limit evicts
+// its oldest messages, however recently they were used.
+func TestMessageCacheChannelLimit(t *testing.T) {
+	c := NewMessageCache(0, MessageCachePolicy{Limit: 2})
+	c.Add(&Message{ID: "c-0", ChannelID: "c"})
+	c.Add(&Message{ID: "c-1", ChannelID: "c"})
+	c.Get("c", "c-0")
+	c.Add(&Message{ID: "c-2", ChannelID: "c"})
+
+	if ids := cachedIDs(c, "c"); fmt.Sprint(ids) != "[c-1 c-2]" {
+		t.Errorf("got messages %v, want [c-1 c-2]", ids)
+	}
+
+	// Replacing a message keeps its place.
+	c.Add(&Message{ID: "c-1", ChannelID: "c", Content: "edited"})
+	c.Add(&Message{ID: "c-3", ChannelID: "c"})
+	if ids := cachedIDs(c, "c"); fmt.Sprint(ids) != "[c-2 c-3]" {
+		t.Errorf("after an edit: got messages %v, want [c-2 c-3]", ids)
+	}
+}
+
+func TestMessageCacheTTL(t *testing.T) {
+	const ttl = 20 * time.Millisecond
+
+	c := NewMessageCache(0, MessageCachePolicy{TTL: ttl})
+	addMessages(c, "", "c", 2)
+	if _, ok := c.Get("c", "c-0"); !ok {
+		t.Fatal("message expired before its TTL")
+	}
+
+	time.Sleep(2 * ttl)
+
+	if ids := cachedIDs(c, "c"); len(ids) != 0 {
+		t.Errorf("got expired messages %v", ids)
+	}
+	if _, ok := c.Get("c", "c-0"); ok {
+		t.Error("got an expired message")
+	}
+	c.Expire()
+
+	if stats := c.Stats(); stats.Len != 0 || stats.Expirations != 2 || stats.Evictions != 0 {
+		t.Errorf("got stats %+v, want 0 cached, 2 expirations and no evictions", stats)
+	}
+}
+
+// TestMessageCachePolicies checks that channel policies override guild
+// policies, which override the defaults, field by field.
+func TestMessageCachePolicies(t *testing.T) {
+	const ttl = 20 * time.Millisecond
+
+	c := NewMessageCache(0, MessageCachePolicy{Limit: 1, TTL: ttl})
+	c.SetGuildPolicy("g", MessageCachePolicy{Limit: 3})
+	c.SetChannelPolicy("forever", MessageCachePolicy{TTL: -1})
+	c.SetChannelPolicy("off", MessageCachePolicy{Limit: -1})
+
+	addMessages(c, "", "default", 5)
+	addMessages(c, "g", "guild", 5)
+	addMessages(c, "g", "forever", 5)
+	addMessages(c, "g", "off", 5)
+
+	limits := map[string]int{"default": 1, "guild": 3, "forever": 3, "off": 0}
+	for channelID, limit := range limits {
+		if n := len(c.Messages(channelID)); n != limit {
+			t.Errorf("%s: got %d messages, want %d", channelID, n, limit)
+		}
+	}
+
+	time.Sleep(2 * ttl)
+
+	// The guild keeps the default TTL, but a channel overrides it.
+	ttls := map[string]int{"default": 0, "guild": 0, "forever": 3}
+	for channelID, n := range ttls {
+		if got := len(c.Messages(channelID)); got != n {
+			t.Errorf("%s after the TTL: got %d messages, want %d", channelID, got, n)
+		}
+	}
+
+	// A policy set later applies to the messages cached.
+	c.SetChannelPolicy("forever", MessageCachePolicy{Limit: 1})
+	c.Add(&Message{ID: "forever-5", ChannelID: "forever", GuildID: "g"})
+	if ids := cachedIDs(c, "forever"); fmt.Sprint(ids) != "[forever-5]" {
+		t.Errorf("after a new policy: got messages %v, want [forever-5]", ids)
+	}
+}
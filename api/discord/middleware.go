@@ -0,0 +1,444 @@
+// Discord bindings for the Hrngh bot.
+// Available at https://github.com/abeiron/hrngh
+
+// Copyright 2020-2021, Undying Memory <abeiron@outlook.com>.  All rights reserved.
+// Use of this source code is governed by the Microsoft Public License
+// that can be found in the LICENSE file.
+
+// This file contains middleware for interaction handlers: permission and
+// context checks, cooldowns and panic recovery.
+
+package discord
+
+import (
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Middleware wraps an InteractionHandler, typically to check whether the
+// interaction may proceed before calling the next handler.
+type Middleware func(next InteractionHandler) InteractionHandler
+
+// Chain wraps h in the given middleware.  The first middleware is the
+// outermost, so it runs first.
+func Chain(h InteractionHandler, mw ...Middleware) InteractionHandler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+
+	return h
+}
+
+// DenialReason is the reason an interaction was denied by middleware.
+type DenialReason int
+
+// Block contains the reasons for denying an interaction.
+const (
+	DeniedMemberPermissions DenialReason = iota + 1
+	DeniedBotPermissions
+	DeniedGuildOnly
+	DeniedDMOnly
+	DeniedOwnerOnly
+	DeniedCooldown
+	DeniedBotUnknown
+)
+
+// A Denial describes why middleware did not let an interaction through.
+type Denial struct {
+	Reason DenialReason
+
+	// Missing holds the missing permissions for permission denials.
+	Missing int64
+
+	// Scope and RetryAfter are set for cooldown denials.
+	Scope      CooldownScope
+	RetryAfter time.Duration
+}
+
+// Error returns the message shown to the user.
+func (d *Denial) Error() string {
+	switch d.Reason {
+	case DeniedMemberPermissions:
+		return fmt.Sprintf("You need the %s permission to do this.", PermissionNames(d.Missing))
+	case DeniedBotPermissions:
+		return fmt.Sprintf("I need the %s permission in this channel to do this.", PermissionNames(d.Missing))
+	case DeniedGuildOnly:
+		return "This can only be used in a server."
+	case DeniedDMOnly:
+		return "This can only be used in direct messages."
+	case DeniedOwnerOnly:
+		return "This can only be used by the owners of the bot."
+	case DeniedCooldown:
+		wait := d.RetryAfter.Round(time.Second)
+		if wait < time.Second {
+			wait = time.Second
+		}
+		if d.Scope == CooldownUser {
+			return fmt.Sprintf("You are doing that too often. Try again in %s.", wait)
+		}
+		return fmt.Sprintf("This is being used too often here. Try again in %s.", wait)
+	case DeniedBotUnknown:
+		return "I can't check my permissions here until I'm fully connected."
+	}
+
+	return "You cannot do this."
+}
+
+// DenialResponse builds the response sent when middleware denies an
+// interaction.  It may be replaced to change how denials look; by default
+// the denial's message is sent as an ephemeral reply.
+var DenialResponse = func(d *Denial) *InteractionResponseData {
+	return &InteractionResponseData{
+		Content: d.Error(),
+		Flags:   MessageFlagsEphemeral,
+	}
+}
+
+// Deny tells the user why their interaction was denied.  Autocomplete
+// interactions, which cannot be replied to, get no choices instead.
+func Deny(ctx *InteractionContext, d *Denial) error {
+	if ctx.Interaction.Type == InteractionApplicationCommandAutocomplete {
+		return ctx.Autocomplete()
+	}
+
+	data := DenialResponse(d)
+	if ctx.Responded() {
+		_, err := ctx.Followup(&WebhookParams{
+			Content: data.Content,
+			Embeds:  data.Embeds,
+			Flags:   data.Flags,
+		})
+		return err
+	}
+
+	return ctx.Respond(&InteractionResponse{
+		Type: InteractionResponseChannelMessageWithSource,
+		Data: data,
+	})
+}
+
+// permissionNames lists the names of permissions in the order they are
+// shown to users.
+var permissionNames = []struct {
+	permission int64
+	name       string
+}{
+	{PermissionAdministrator, "Administrator"},
+	{PermissionManageServer, "Manage Server"},
+	{PermissionManageRoles, "Manage Roles"},
+	{PermissionManageChannels, "Manage Channels"},
+	{PermissionKickMembers, "Kick Members"},
+	{PermissionBanMembers, "Ban Members"},
+	{PermissionCreateInstantInvite, "Create Invite"},
+	{PermissionChangeNickname, "Change Nickname"},
+	{PermissionManageNicknames, "Manage Nicknames"},
+	{PermissionManageEmojis, "Manage Emojis"},
+	{PermissionManageWebhooks, "Manage Webhooks"},
+	{PermissionViewAuditLogs, "View Audit Log"},
+	{PermissionViewChannel, "View Channel"},
+	{PermissionSendMessages, "Send Messages"},
+	{PermissionSendTTSMessages, "Send TTS Messages"},
+	{PermissionManageMessages, "Manage Messages"},
+	{PermissionEmbedLinks, "Embed Links"},
+	{PermissionAttachFiles, "Attach Files"},
+	{PermissionReadMessageHistory, "Read Message History"},
+	{PermissionMentionEveryone, "Mention Everyone"},
+	{PermissionUseExternalEmojis, "Use External Emojis"},
+	{PermissionAddReactions, "Add Reactions"},
+	{PermissionVoiceConnect, "Connect"},
+	{PermissionVoiceSpeak, "Speak"},
+	{PermissionVoiceMuteMembers, "Mute Members"},
+	{PermissionVoiceDeafenMembers, "Deafen Members"},
+	{PermissionVoiceMoveMembers, "Move Members"},
+	{PermissionVoiceUseVAD, "Use Voice Activity"},
+	{PermissionVoicePrioritySpeaker, "Priority Speaker"},
+}
+
+// PermissionNames returns the names of the given permissions as shown in
+// the Discord client, separated by commas.
+func PermissionNames(permissions int64) string {
+	var names []string
+	for _, p := range permissionNames {
+		if permissions&p.permission != 0 {
+			names = append(names, p.name)
+		}
+	}
+
+	if len(names) == 0 {
+		return fmt.Sprintf("0x%x", permissions)
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// channelPermissions returns the permissions of a user in the channel of an
+// interaction, from the state if possible and else over REST.
+func channelPermissions(ctx *InteractionContext, userID string) (int64, error) {
+	perms, err := ctx.Session.State.UserChannelPermissions(userID, ctx.Interaction.ChannelID)
+	if err == nil {
+		return perms, nil
+	}
+
+	return ctx.Session.UserChannelPermissions(userID, ctx.Interaction.ChannelID)
+}
+
+// requirePermissions denies interactions unless the user returned by who
+// has all of permissions in the channel.  If who returns no user, the
+// interaction is denied with DeniedBotUnknown.
+func requirePermissions(permissions int64, reason DenialReason, who func(*InteractionContext) string) Middleware {
+	return func(next InteractionHandler) InteractionHandler {
+		return func(ctx *InteractionContext) error {
+			// Outside guilds there are no permissions to check.
+			if ctx.Interaction.GuildID == "" {
+				return next(ctx)
+			}
+
+			userID := who(ctx)
+			if userID == "" {
+				return Deny(ctx, &Denial{Reason: DeniedBotUnknown})
+			}
+
+			perms, err := channelPermissions(ctx, userID)
+			if err != nil {
+				ctx.Session.log(LogWarning, "error computing permissions for interaction %s, %s", ctx.Interaction.ID, err)
+				return Deny(ctx, &Denial{Reason: reason, Missing: permissions})
+			}
+
+			if missing := permissions &^ perms; missing != 0 && perms&PermissionAdministrator == 0 {
+				return Deny(ctx, &Denial{Reason: reason, Missing: missing})
+			}
+
+			return next(ctx)
+		}
+	}
+}
+
+// RequireMemberPermissions denies interactions in guilds unless the
+// invoking member has all of permissions in the channel, as computed by
+// State.UserChannelPermissions.
+func RequireMemberPermissions(permissions int64) Middleware {
+	return requirePermissions(permissions, DeniedMemberPermissions, func(ctx *InteractionContext) string {
+		return ctx.User().ID
+	})
+}
+
+// RequireBotPermissions denies interactions in guilds unless the bot has
+// all of permissions in the channel.  The bot user is known from the READY
+// of the State; until then, interactions are denied with DeniedBotUnknown.
+func RequireBotPermissions(permissions int64) Middleware {
+	return requirePermissions(permissions, DeniedBotPermissions, func(ctx *InteractionContext) string {
+		if ctx.Session.State != nil && ctx.Session.State.User != nil {
+			return ctx.Session.State.User.ID
+		}
+		return ""
+	})
+}
+
+// GuildOnly denies interactions outside of guilds.
+func GuildOnly() Middleware {
+	return func(next InteractionHandler) InteractionHandler {
+		return func(ctx *InteractionContext) error {
+			if ctx.Interaction.GuildID == "" {
+				return Deny(ctx, &Denial{Reason: DeniedGuildOnly})
+			}
+			return next(ctx)
+		}
+	}
+}
+
+// DMOnly denies interactions in guilds.
+func DMOnly() Middleware {
+	return func(next InteractionHandler) InteractionHandler {
+		return func(ctx *InteractionContext) error {
+			if ctx.Interaction.GuildID != "" {
+				return Deny(ctx, &Denial{Reason: DeniedDMOnly})
+			}
+			return next(ctx)
+		}
+	}
+}
+
+// OwnerOnly denies interactions from users other than the given owners of
+// the bot.
+func OwnerOnly(ownerIDs ...string) Middleware {
+	owners := make(map[string]bool, len(ownerIDs))
+	for _, id := range ownerIDs {
+		owners[id] = true
+	}
+
+	return func(next InteractionHandler) InteractionHandler {
+		return func(ctx *InteractionContext) error {
+			if u := ctx.User(); u == nil || !owners[u.ID] {
+				return Deny(ctx, &Denial{Reason: DeniedOwnerOnly})
+			}
+			return next(ctx)
+		}
+	}
+}
+
+// Recover recovers from panics in the handlers it wraps.  The panic is
+// logged with its stack trace, the user is told that something went wrong,
+// and an error is returned in place of the panic.  It should be the
+// outermost middleware.
+func Recover() Middleware {
+	return func(next InteractionHandler) InteractionHandler {
+		return func(ctx *InteractionContext) (err error) {
+			defer func() {
+				r := recover()
+				if r == nil {
+					return
+				}
+
+				ctx.Session.log(LogError, "panic handling interaction %s, %v\n%s", ctx.Interaction.ID, r, debug.Stack())
+				err = fmt.Errorf("panic handling interaction: %v", r)
+
+				const message = "Something went wrong while handling this. The error has been logged."
+				if ctx.Interaction.Type == InteractionApplicationCommandAutocomplete {
+					ctx.Autocomplete()
+				} else if ctx.Responded() {
+					ctx.Followup(&WebhookParams{Content: message, Flags: MessageFlagsEphemeral})
+				} else {
+					ctx.ReplyEphemeral(message)
+				}
+			}()
+
+			return next(ctx)
+		}
+	}
+}
+
+// CooldownScope is what a cooldown limits.
+type CooldownScope int
+
+// Block contains the cooldown scopes.
+const (
+	// CooldownUser limits each user, wherever they are.
+	CooldownUser CooldownScope = iota
+
+	// CooldownChannel limits each channel, whoever uses it.
+	CooldownChannel
+
+	// CooldownGuild limits each guild, or each DM channel outside guilds.
+	CooldownGuild
+)
+
+// key returns the bucket key for an interaction.
+func (scope CooldownScope) key(i *Interaction) string {
+	switch scope {
+	case CooldownChannel:
+		return i.ChannelID
+	case CooldownGuild:
+		if i.GuildID != "" {
+			return i.GuildID
+		}
+		return i.ChannelID
+	}
+
+	if i.Member != nil && i.Member.User != nil {
+		return i.Member.User.ID
+	}
+	if i.User != nil {
+		return i.User.ID
+	}
+
+	return ""
+}
+
+// tokenBucket holds the tokens left for one cooldown key.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// cooldown is a set of token buckets sharing a capacity and a refill rate.
+type cooldown struct {
+	sync.Mutex
+
+	capacity float64
+	interval time.Duration // time to refill one token
+
+	buckets   map[string]*tokenBucket
+	nextPrune int
+}
+
+// take takes a token from the bucket for key.  It returns zero if a token
+// was taken, and else the time until one is available.
+func (c *cooldown) take(key string, now time.Time) time.Duration {
+	c.Lock()
+	defer c.Unlock()
+
+	if len(c.buckets) >= c.nextPrune {
+		c.prune(now)
+	}
+
+	b, ok := c.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: c.capacity, last: now}
+		c.buckets[key] = b
+	}
+
+	b.tokens += float64(now.Sub(b.last)) / float64(c.interval)
+	if b.tokens > c.capacity {
+		b.tokens = c.capacity
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) * float64(c.interval))
+	}
+
+	b.tokens--
+	return 0
+}
+
+// prune drops the buckets which have refilled completely, as they are the
+// same as new ones.
+func (c *cooldown) prune(now time.Time) {
+	for key, b := range c.buckets {
+		if b.tokens+float64(now.Sub(b.last))/float64(c.interval) >= c.capacity {
+			delete(c.buckets, key)
+		}
+	}
+
+	c.nextPrune = 2*len(c.buckets) + 64
+}
+
+// Cooldown limits how often the handlers it wraps can be used, per user,
+// channel or guild depending on scope.  It allows bursts of uses, after
+// which one more use becomes available every per/uses.
+//
+// Each call of Cooldown creates separate buckets: using the result for one
+// command limits that command alone, while using it for a whole router
+// limits all of its commands together.
+func Cooldown(scope CooldownScope, uses int, per time.Duration) Middleware {
+	if uses < 1 {
+		uses = 1
+	}
+
+	c := &cooldown{
+		capacity: float64(uses),
+		interval: per / time.Duration(uses),
+		buckets:  make(map[string]*tokenBucket),
+	}
+	if c.interval <= 0 {
+		c.interval = time.Nanosecond
+	}
+
+	return func(next InteractionHandler) InteractionHandler {
+		return func(ctx *InteractionContext) error {
+			// Autocompletion must not use up the command's tokens.
+			if ctx.Interaction.Type == InteractionApplicationCommandAutocomplete {
+				return next(ctx)
+			}
+
+			if wait := c.take(scope.key(ctx.Interaction), time.Now()); wait > 0 {
+				return Deny(ctx, &Denial{Reason: DeniedCooldown, Scope: scope, RetryAfter: wait})
+			}
+
+			return next(ctx)
+		}
+	}
+}
@@ -0,0 +1,384 @@
+// Discord bindings for the Hrngh bot.
+// Available at https://github.com/abeiron/hrngh
+
+// Copyright 2020-2021, Undying Memory <abeiron@outlook.com>.  All rights reserved.
+// Use of this source code is governed by the Microsoft Public License
+// that can be found in the LICENSE file.
+
+// This file contains PresenceCache, a compact cache of presences which can
+// back the presences of the State.
+
+package discord
+
+import (
+	"strings"
+	"sync"
+)
+
+// A presenceStatus is a Status in a byte.
+type presenceStatus uint8
+
+const (
+	statusNone presenceStatus = iota
+	statusOnline
+	statusIdle
+	statusDoNotDisturb
+	statusInvisible
+	statusOffline
+)
+
+var statusNames = [...]Status{"", StatusOnline, StatusIdle, StatusDoNotDisturb, StatusInvisible, StatusOffline}
+
+func compactStatus(s Status) presenceStatus {
+	for i, name := range statusNames {
+		if name == s {
+			return presenceStatus(i)
+		}
+	}
+
+	// An unknown status is kept as offline.
+	return statusOffline
+}
+
+// online reports whether a status shows the user as online.
+func (s presenceStatus) online() bool {
+	return s == statusOnline || s == statusIdle || s == statusDoNotDisturb
+}
+
+// A presenceRecord holds the presence of a user, shared by the guilds in
+// which it was seen.
+type presenceRecord struct {
+	userID     string
+	status     presenceStatus
+	client     [3]presenceStatus // desktop, mobile and web
+	since      *int
+	activities []activityRecord
+	guilds     []string
+}
+
+// An activityRecord holds an Activity; its name is interned.
+type activityRecord struct {
+	name string
+	url  string
+	typ  ActivityType
+}
+
+// A PresenceCache holds presences once per user, however many guilds the
+// user shares with the bot, with their activities in compact records whose
+// names are shared between users.  It counts the users online in each
+// guild, and indexes users by the names of their activities.  It is safe for
+// concurrent use.
+//
+// The presences it returns are built afresh, and their users hold only an
+// ID; get the rest of the user from the member.
+//
+// A State uses a PresenceCache for its presences when one is set as its
+// PresenceCache.
+type PresenceCache struct {
+	mu sync.RWMutex
+
+	statusOnly bool
+
+	users  map[string]*presenceRecord
+	guilds map[string]map[string]*presenceRecord
+	online map[string]int
+
+	// names interns the names of activities, counting their uses, and
+	// playing indexes users by the lowercased names of their activities.
+	names   map[string]*internedName
+	playing map[string]map[string]*presenceRecord
+}
+
+type internedName struct {
+	name string
+	refs int
+}
+
+// NewPresenceCache returns an empty PresenceCache.  If statusOnly is set, it
+// keeps the status of users and none of their activities.
+func NewPresenceCache(statusOnly bool) *PresenceCache {
+	return &PresenceCache{
+		statusOnly: statusOnly,
+		users:      make(map[string]*presenceRecord),
+		guilds:     make(map[string]map[string]*presenceRecord),
+		online:     make(map[string]int),
+		names:      make(map[string]*internedName),
+		playing:    make(map[string]map[string]*presenceRecord),
+	}
+}
+
+// Set adds the presence of a user in a guild, or updates it, as
+// State.PresenceAdd does: its activities are replaced, and its status too
+// unless the update has none.  The presence is updated in every guild the
+// user was seen in.
+func (c *PresenceCache) Set(guildID string, presence *Presence) {
+	if presence.User == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	r, ok := c.users[presence.User.ID]
+	if !ok {
+		r = &presenceRecord{userID: presence.User.ID}
+		c.users[r.userID] = r
+	}
+
+	wasOnline := r.status.online()
+	if presence.Status != "" {
+		r.status = compactStatus(presence.Status)
+	}
+	r.client = [3]presenceStatus{
+		compactStatus(presence.ClientStatus.Desktop),
+		compactStatus(presence.ClientStatus.Mobile),
+		compactStatus(presence.ClientStatus.Web),
+	}
+	r.since = presence.Since
+
+	if !c.statusOnly {
+		c.setActivities(r, presence.Activities)
+	}
+
+	if isOnline := r.status.online(); isOnline != wasOnline {
+		delta := 1
+		if !isOnline {
+			delta = -1
+		}
+		for _, g := range r.guilds {
+			c.online[g] += delta
+		}
+	}
+
+	users, ok := c.guilds[guildID]
+	if !ok {
+		users = make(map[string]*presenceRecord)
+		c.guilds[guildID] = users
+	}
+	if _, ok := users[r.userID]; !ok {
+		users[r.userID] = r
+		r.guilds = append(r.guilds, guildID)
+		if r.status.online() {
+			c.online[guildID]++
+		}
+	}
+}
+
+// setActivities replaces the activities of a record, keeping the index and
+// the interned names up to date.
+func (c *PresenceCache) setActivities(r *presenceRecord, activities []*Activity) {
+	c.releaseActivities(r)
+
+	if len(activities) == 0 {
+		r.activities = nil
+		return
+	}
+
+	r.activities = make([]activityRecord, 0, len(activities))
+	for _, a := range activities {
+		if a == nil {
+			continue
+		}
+
+		r.activities = append(r.activities, activityRecord{name: c.intern(a.Name), url: a.Url, typ: a.Type})
+
+		key := strings.ToLower(a.Name)
+		users, ok := c.playing[key]
+		if !ok {
+			users = make(map[string]*presenceRecord)
+			c.playing[key] = users
+		}
+		users[r.userID] = r
+	}
+}
+
+// releaseActivities drops the activities of a record from the index and
+// the interned names.
+func (c *PresenceCache) releaseActivities(r *presenceRecord) {
+	for _, a := range r.activities {
+		key := strings.ToLower(a.name)
+		if users, ok := c.playing[key]; ok {
+			delete(users, r.userID)
+			if len(users) == 0 {
+				delete(c.playing, key)
+			}
+		}
+		c.release(a.name)
+	}
+	r.activities = nil
+}
+
+func (c *PresenceCache) intern(name string) string {
+	if n, ok := c.names[name]; ok {
+		n.refs++
+		return n.name
+	}
+
+	c.names[name] = &internedName{name: name, refs: 1}
+	return name
+}
+
+func (c *PresenceCache) release(name string) {
+	if n, ok := c.names[name]; ok {
+		if n.refs--; n.refs == 0 {
+			delete(c.names, name)
+		}
+	}
+}
+
+// Remove removes the presence of a user from a guild, reporting whether it
+// was cached.  The presence is dropped once it is in no guild.
+func (c *PresenceCache) Remove(guildID, userID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	r, ok := c.guilds[guildID][userID]
+	if !ok {
+		return false
+	}
+
+	c.remove(guildID, r)
+	return true
+}
+
+func (c *PresenceCache) remove(guildID string, r *presenceRecord) {
+	users := c.guilds[guildID]
+	delete(users, r.userID)
+	if len(users) == 0 {
+		delete(c.guilds, guildID)
+	}
+
+	if r.status.online() {
+		if c.online[guildID]--; c.online[guildID] <= 0 {
+			delete(c.online, guildID)
+		}
+	}
+
+	for i, g := range r.guilds {
+		if g == guildID {
+			r.guilds = append(r.guilds[:i], r.guilds[i+1:]...)
+			break
+		}
+	}
+
+	if len(r.guilds) == 0 {
+		c.releaseActivities(r)
+		delete(c.users, r.userID)
+	}
+}
+
+// RemoveGuild removes the presences of a guild.
+func (c *PresenceCache) RemoveGuild(guildID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, r := range c.guilds[guildID] {
+		c.remove(guildID, r)
+	}
+}
+
+// presence builds the Presence of a record.
+func (r *presenceRecord) presence() *Presence {
+	p := &Presence{
+		User:   &User{ID: r.userID},
+		Status: statusNames[r.status],
+		ClientStatus: ClientStatus{
+			Desktop: statusNames[r.client[0]],
+			Mobile:  statusNames[r.client[1]],
+			Web:     statusNames[r.client[2]],
+		},
+		Since: r.since,
+	}
+
+	if r.activities != nil {
+		p.Activities = make([]*Activity, len(r.activities))
+		for i, a := range r.activities {
+			p.Activities[i] = &Activity{Name: a.name, Type: a.typ, Url: a.url}
+		}
+	}
+
+	return p
+}
+
+// Presence returns the presence of a user in a guild.
+func (c *PresenceCache) Presence(guildID, userID string) (*Presence, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	r, ok := c.guilds[guildID][userID]
+	if !ok {
+		return nil, false
+	}
+
+	return r.presence(), true
+}
+
+// Presences returns the presences of a guild.
+func (c *PresenceCache) Presences(guildID string) []*Presence {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	users := c.guilds[guildID]
+	presences := make([]*Presence, 0, len(users))
+	for _, r := range users {
+		presences = append(presences, r.presence())
+	}
+
+	return presences
+}
+
+// Status returns the status of a user, whatever the guild, or the empty
+// Status if the user has no presence cached.
+func (c *PresenceCache) Status(userID string) Status {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if r, ok := c.users[userID]; ok {
+		return statusNames[r.status]
+	}
+
+	return ""
+}
+
+// OnlineCount returns how many users of a guild are online, idle or do not
+// disturb.
+func (c *PresenceCache) OnlineCount(guildID string) int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.online[guildID]
+}
+
+// UsersWithActivity returns the IDs of the users of a guild with an
+// activity of a type and name, ignoring case; "who is playing X" is
+// UsersWithActivity(guildID, ActivityTypeGame, "X").  It finds none if the
+// cache keeps only statuses.
+func (c *PresenceCache) UsersWithActivity(guildID string, typ ActivityType, name string) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	guild := c.guilds[guildID]
+
+	var userIDs []string
+	for userID, r := range c.playing[strings.ToLower(name)] {
+		if _, ok := guild[userID]; !ok {
+			continue
+		}
+		for _, a := range r.activities {
+			if a.typ == typ && strings.EqualFold(a.name, name) {
+				userIDs = append(userIDs, userID)
+				break
+			}
+		}
+	}
+
+	return userIDs
+}
+
+// Len returns how many users have a presence cached.
+func (c *PresenceCache) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return len(c.users)
+}
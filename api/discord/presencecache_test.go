@@ -0,0 +1,152 @@
+// Discord bindings for the Hrngh bot.
+// Available at https://github.com/abeiron/hrngh
+
+// Copyright 2020-2021, Undying Memory <abeiron@outlook.com>.  All rights reserved.
+// Use of this source code is governed by the Microsoft Public License
+// that can be found in the LICENSE file.
+
+// This file contains tests of PresenceCache, alone and behind a State.
+
+package discord
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+)
+
+func playing(name string) []*Activity {
+	return []*Activity{{Name: name, Type: ActivityTypeGame}}
+}
+
+// usersPlaying returns the sorted IDs of the users of a guild playing a
+// game.
+func usersPlaying(c *PresenceCache, guildID, name string) string {
+	users := c.UsersWithActivity(guildID, ActivityTypeGame, name)
+	sort.Strings(users)
+
+	return fmt.Sprint(users)
+}
+
+// TestPresenceCacheShared checks that the presence of a user is kept once,
+// and updated in every guild the user was seen in.
+func TestPresenceCacheShared(t *testing.T) {
+	c := NewPresenceCache(false)
+	c.Set("g1", &Presence{User: &User{ID: "u"}, Status: StatusOnline, Activities: playing("Chess")})
+	c.Set("g2", &Presence{User: &User{ID: "u"}, Status: StatusOnline})
+	c.Set("g1", &Presence{User: &User{ID: "v"}, Status: StatusOffline})
+
+	if n := c.Len(); n != 2 {
+		t.Errorf("got %d users, want 2", n)
+	}
+	if n1, n2 := c.OnlineCount("g1"), c.OnlineCount("g2"); n1 != 1 || n2 != 1 {
+		t.Errorf("got %d and %d online, want 1 and 1", n1, n2)
+	}
+
+	// The update through g2 replaced the activities seen in g1.
+	if p, ok := c.Presence("g1", "u"); !ok || len(p.Activities) != 0 {
+		t.Errorf("got presence %+v in g1, want one without activities", p)
+	}
+
+	c.Set("g2", &Presence{User: &User{ID: "u"}, Status: StatusDoNotDisturb, Activities: playing("Go")})
+	if s := c.Status("u"); s != StatusDoNotDisturb {
+		t.Errorf("got status %q, want %q", s, StatusDoNotDisturb)
+	}
+	if users := usersPlaying(c, "g1", "go"); users != "[u]" {
+		t.Errorf("got %s playing go in g1, want [u]", users)
+	}
+
+	// An update without a status keeps it.
+	c.Set("g1", &Presence{User: &User{ID: "u"}, Activities: playing("Chess")})
+	if s := c.Status("u"); s != StatusDoNotDisturb {
+		t.Errorf("after an update without a status: got status %q, want %q", s, StatusDoNotDisturb)
+	}
+	if users := usersPlaying(c, "g1", "Go"); users != "[]" {
+		t.Errorf("got %s playing a game no longer played", users)
+	}
+
+	c.Set("g1", &Presence{User: &User{ID: "u"}, Status: StatusOffline})
+	if n1, n2 := c.OnlineCount("g1"), c.OnlineCount("g2"); n1 != 0 || n2 != 0 {
+		t.Errorf("offline: got %d and %d online, want 0 and 0", n1, n2)
+	}
+}
+
+func TestPresenceCacheRemove(t *testing.T) {
+	c := NewPresenceCache(false)
+	for _, g := range []string{"g1", "g2"} {
+		c.Set(g, &Presence{User: &User{ID: "u"}, Status: StatusIdle, Activities: playing("Chess")})
+	}
+
+	if !c.Remove("g1", "u") {
+		t.Fatal("presence in g1 not cached")
+	}
+	if _, ok := c.Presence("g1", "u"); ok {
+		t.Error("presence in g1 not removed")
+	}
+	if p, ok := c.Presence("g2", "u"); !ok || p.Status != StatusIdle {
+		t.Errorf("got presence %+v in g2, want it kept", p)
+	}
+	if n1, n2 := c.OnlineCount("g1"), c.OnlineCount("g2"); n1 != 0 || n2 != 1 {
+		t.Errorf("got %d and %d online, want 0 and 1", n1, n2)
+	}
+
+	c.RemoveGuild("g2")
+	if n := c.Len(); n != 0 {
+		t.Errorf("got %d users in no guild, want 0", n)
+	}
+	if users := usersPlaying(c, "g2", "Chess"); users != "[]" {
+		t.Errorf("got %s playing in a removed guild", users)
+	}
+	if c.Remove("g2", "u") {
+		t.Error("removed presence removed again")
+	}
+}
+
+func TestPresenceCacheStatusOnly(t *testing.T) {
+	c := NewPresenceCache(true)
+	c.Set("g", &Presence{User: &User{ID: "u"}, Status: StatusOnline, Activities: playing("Chess")})
+
+	p, ok := c.Presence("g", "u")
+	if !ok || p.Status != StatusOnline || len(p.Activities) != 0 {
+		t.Errorf("got presence %+v, want online without activities", p)
+	}
+	if users := usersPlaying(c, "g", "Chess"); users != "[]" {
+		t.Errorf("got %s playing, want none", users)
+	}
+}
+
+// TestStatePresenceCache checks that a State keeps its presences in its
+// PresenceCache, and that what it returns is the caller's.
+func TestStatePresenceCache(t *testing.T) {
+	s := NewState()
+	s.PresenceCache = NewPresenceCache(false)
+
+	guild := &Guild{ID: "g", Presences: []*Presence{{User: &User{ID: "u"}, Status: StatusOnline}}}
+	if err := s.GuildAdd(guild); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PresenceAdd("g", &Presence{User: &User{ID: "v"}, Status: StatusIdle, Activities: playing("Chess")}); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := s.PresenceCache.OnlineCount("g"); n != 2 {
+		t.Errorf("got %d online, want 2", n)
+	}
+
+	p, err := s.Presence("g", "v")
+	if err != nil || p.Status != StatusIdle || len(p.Activities) != 1 {
+		t.Fatalf("got presence %+v, %v", p, err)
+	}
+	p.Status = StatusOffline
+	p.Activities[0].Name = "changed"
+	if p, _ = s.Presence("g", "v"); p.Status != StatusIdle || p.Activities[0].Name != "Chess" {
+		t.Errorf("changing a presence changed the cache: got %+v", p)
+	}
+
+	if err = s.PresenceRemove("g", &Presence{User: &User{ID: "v"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Presence("g", "v"); err != ErrStateNotFound {
+		t.Errorf("removed presence: got error %v, want %v", err, ErrStateNotFound)
+	}
+}
@@ -0,0 +1,387 @@
+// Discord bindings for the Hrngh bot.
+// Available at https://github.com/abeiron/hrngh
+
+// Copyright 2020-2021, Undying Memory <abeiron@outlook.com>.  All rights reserved.
+// Use of this source code is governed by the Microsoft Public License
+// that can be found in the LICENSE file.
+
+// This file contains Resolver, which gets entities from the State, falling
+// back to the REST API and adding what it fetches to the State.
+
+package discord
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned by a Resolver for an entity which is neither in
+// the State nor known to Discord.
+var ErrNotFound = errors.New("not found in the state or by Discord")
+
+// DefaultNotFoundTTL is how long a Resolver remembers that an entity was
+// not found when Resolver.NotFoundTTL is zero.
+const DefaultNotFoundTTL = 10 * time.Second
+
+// A Resolver gets guilds, channels, members, roles, users and messages
+// from the State of a session, and from the REST API when the state doesn't
+// hold them, adding what it fetches to the state as its Track fields allow.
+// Get the Resolver of a session with Session.Resolve:
+//
+//	member, err := s.Resolve().Member(ctx, guildID, userID)
+//
+// Concurrent calls for the same entity share one request, and the value it
+// returns, which must be treated as read-only.  An entity Discord doesn't
+// know is remembered for NotFoundTTL, during which ErrNotFound is returned
+// without a request, unless the state gains the entity.
+//
+// The requests cannot be canceled: a call returns when its ctx is done,
+// but the request goes on, and its result is still added to the state.
+type Resolver struct {
+	// NotFoundTTL is how long an entity which was not found is
+	// remembered; zero is DefaultNotFoundTTL, and a negative duration
+	// disables it.  It should be set before the resolver is used.
+	NotFoundTTL time.Duration
+
+	s *Session
+
+	mu        sync.Mutex
+	calls     map[string]*resolveCall
+	notFound  map[string]time.Time
+	nextSweep time.Time
+}
+
+// A resolveCall is a request in flight, shared by those waiting for it.
+type resolveCall struct {
+	done chan struct{}
+	val  interface{}
+	err  error
+}
+
+// Resolve returns the Resolver of the session.
+func (s *Session) Resolve() *Resolver {
+	s.resolverOnce.Do(func() {
+		s.resolver = &Resolver{
+			s:        s,
+			calls:    make(map[string]*resolveCall),
+			notFound: make(map[string]time.Time),
+		}
+	})
+
+	return s.resolver
+}
+
+func (r *Resolver) notFoundTTL() time.Duration {
+	if r.NotFoundTTL == 0 {
+		return DefaultNotFoundTTL
+	}
+	return r.NotFoundTTL
+}
+
+// state returns the state of the session, or nil if it is disabled.
+func (r *Resolver) state() *State {
+	if !r.s.StateEnabled {
+		return nil
+	}
+	return r.s.State
+}
+
+// isNotFound reports whether err is a 404 response of the REST API.
+func isNotFound(err error) bool {
+	var restErr *RESTError
+	return errors.As(err, &restErr) && restErr.Response != nil && restErr.Response.StatusCode == http.StatusNotFound
+}
+
+// do returns the result of fetch for key, sharing it with the calls for
+// key made while it runs.
+func (r *Resolver) do(ctx context.Context, key string, fetch func() (interface{}, error)) (interface{}, error) {
+	r.mu.Lock()
+	if until, ok := r.notFound[key]; ok {
+		if time.Now().Before(until) {
+			r.mu.Unlock()
+			return nil, ErrNotFound
+		}
+		delete(r.notFound, key)
+	}
+
+	c, ok := r.calls[key]
+	if !ok {
+		c = &resolveCall{done: make(chan struct{})}
+		r.calls[key] = c
+		go r.call(key, c, fetch)
+	}
+	r.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.val, c.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// call runs fetch for a call, remembering key if it was not found.
+func (r *Resolver) call(key string, c *resolveCall, fetch func() (interface{}, error)) {
+	c.val, c.err = fetch()
+	if isNotFound(c.err) {
+		c.err = ErrNotFound
+	}
+
+	r.mu.Lock()
+	delete(r.calls, key)
+	if ttl := r.notFoundTTL(); c.err == ErrNotFound && ttl > 0 {
+		now := time.Now()
+		r.notFound[key] = now.Add(ttl)
+
+		// Drop the expired entries now and then.
+		if now.After(r.nextSweep) {
+			for k, until := range r.notFound {
+				if now.After(until) {
+					delete(r.notFound, k)
+				}
+			}
+			r.nextSweep = now.Add(ttl)
+		}
+	}
+	r.mu.Unlock()
+
+	close(c.done)
+}
+
+// forget drops what the resolver remembers of a key which was not found,
+// as the state now holds its entity.
+func (r *Resolver) forget(key string) {
+	r.mu.Lock()
+	delete(r.notFound, key)
+	r.mu.Unlock()
+}
+
+// Guild returns a guild.  A guild fetched from the API is added to the
+// state without its channels, members, presences and voice states.
+func (r *Resolver) Guild(ctx context.Context, guildID string) (*Guild, error) {
+	key := "g:" + guildID
+	if st := r.state(); st != nil {
+		if g, err := st.Guild(guildID); err == nil {
+			r.forget(key)
+			return g, nil
+		}
+	}
+
+	v, err := r.do(ctx, key, func() (interface{}, error) {
+		g, err := r.s.Guild(guildID)
+		if err != nil {
+			return nil, err
+		}
+
+		if st := r.state(); st != nil {
+			st.GuildAdd(g)
+		}
+		return g, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(*Guild), nil
+}
+
+// Channel returns a channel.
+func (r *Resolver) Channel(ctx context.Context, channelID string) (*Channel, error) {
+	key := "c:" + channelID
+	if st := r.state(); st != nil {
+		if c, err := st.Channel(channelID); err == nil {
+			r.forget(key)
+			return c, nil
+		}
+	}
+
+	v, err := r.do(ctx, key, func() (interface{}, error) {
+		c, err := r.s.Channel(channelID)
+		if err != nil {
+			return nil, err
+		}
+
+		// A channel whose guild the state doesn't hold is not added.
+		if st := r.state(); st != nil && st.TrackChannels {
+			st.ChannelAdd(c)
+		}
+		return c, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(*Channel), nil
+}
+
+// Member returns a member of a guild.
+func (r *Resolver) Member(ctx context.Context, guildID, userID string) (*Member, error) {
+	key := "m:" + guildID + ":" + userID
+	if st := r.state(); st != nil {
+		if m, err := st.Member(guildID, userID); err == nil {
+			r.forget(key)
+			return m, nil
+		}
+	}
+
+	v, err := r.do(ctx, key, func() (interface{}, error) {
+		m, err := r.s.GuildMember(guildID, userID)
+		if err != nil {
+			return nil, err
+		}
+		m.GuildID = guildID
+
+		if st := r.state(); st != nil && st.TrackMembers {
+			st.MemberAdd(m)
+		}
+		return m, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(*Member), nil
+}
+
+// Role returns a role of a guild.  As Discord has no request for a single
+// role, all the roles of the guild are fetched, and added to the state.
+func (r *Resolver) Role(ctx context.Context, guildID, roleID string) (*Role, error) {
+	key := "r:" + guildID + ":" + roleID
+	if st := r.state(); st != nil {
+		if role, err := st.Role(guildID, roleID); err == nil {
+			r.forget(key)
+			return role, nil
+		}
+	}
+
+	v, err := r.do(ctx, key, func() (interface{}, error) {
+		roles, err := r.s.GuildRoles(guildID)
+		if err != nil {
+			return nil, err
+		}
+
+		var found *Role
+		st := r.state()
+		for _, role := range roles {
+			if st != nil && st.TrackRoles {
+				st.RoleAdd(guildID, role)
+			}
+			if role.ID == roleID {
+				found = role
+			}
+		}
+		if found == nil {
+			return nil, ErrNotFound
+		}
+		return found, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(*Role), nil
+}
+
+// User returns a user.  The state holds users as the current user and the
+// users of members, so a user who shares no guild with the current user is
+// fetched every time, after NotFoundTTL.
+func (r *Resolver) User(ctx context.Context, userID string) (*User, error) {
+	key := "u:" + userID
+	if st := r.state(); st != nil {
+		if u, err := st.user(userID); err == nil {
+			r.forget(key)
+			return u, nil
+		}
+	}
+
+	v, err := r.do(ctx, key, func() (interface{}, error) {
+		return r.s.User(userID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(*User), nil
+}
+
+// Message returns a message of a channel.  A message fetched from the API
+// is added to the state if it keeps messages.
+func (r *Resolver) Message(ctx context.Context, channelID, messageID string) (*Message, error) {
+	key := "msg:" + channelID + ":" + messageID
+	if st := r.state(); st != nil {
+		if m, err := st.Message(channelID, messageID); err == nil {
+			r.forget(key)
+			return m, nil
+		}
+	}
+
+	v, err := r.do(ctx, key, func() (interface{}, error) {
+		m, err := r.s.ChannelMessage(channelID, messageID)
+		if err != nil {
+			return nil, err
+		}
+
+		if st := r.state(); st != nil && st.tracksMessages() {
+			st.MessageAdd(m)
+		}
+		return m, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(*Message), nil
+}
+
+// user returns a user the state holds, as the current user or the user of
+// a member of any guild.
+func (s *State) user(userID string) (*User, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	if s.User != nil && s.User.ID == userID {
+		return s.userResult(s.User), nil
+	}
+
+	guildIDs, err := s.guildIDs()
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range guildIDs {
+		if m, err := s.store.Member(id, userID); err == nil && m.User != nil {
+			return s.userResult(m.User), nil
+		}
+	}
+
+	return nil, ErrStateNotFound
+}
+
+// guildIDs returns the IDs of the guilds the state holds, without reading
+// the guilds if the store can list them.  The lock of s must be held.
+func (s *State) guildIDs() ([]string, error) {
+	if store, ok := s.store.(guildIDStore); ok {
+		return store.GuildIDs()
+	}
+
+	guilds, err := s.store.Guilds()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(guilds))
+	for i, g := range guilds {
+		ids[i] = g.ID
+	}
+
+	return ids, nil
+}
+
+// userResult returns a user the state holds, copied if s.CopyOnRead is set.
+func (s *State) userResult(u *User) *User {
+	if s.CopyOnRead {
+		return userCopy(u)
+	}
+	return u
+}
@@ -0,0 +1,138 @@
+// Discord bindings for the Hrngh bot.
+// Available at https://github.com/abeiron/hrngh
+
+// Copyright 2020-2021, Undying Memory <abeiron@outlook.com>.  All rights reserved.
+// Use of this source code is governed by the Microsoft Public License
+// that can be found in the LICENSE file.
+
+// This file contains tests of how a Resolver remembers the entities Discord
+// doesn't know.
+
+package discord
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A statusTransport answers every REST request with an error status, and
+// counts them.
+type statusTransport struct {
+	status int
+
+	mu       sync.Mutex
+	requests int
+}
+
+func (t *statusTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	t.requests++
+	t.mu.Unlock()
+
+	return &http.Response{
+		StatusCode: t.status,
+		Header:     make(http.Header),
+		Body:       ioutil.NopCloser(strings.NewReader(`{"message": "Unknown Channel", "code": 10003}`)),
+		Request:    req,
+	}, nil
+}
+
+func (t *statusTransport) count() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.requests
+}
+
+// resolverSession returns a session with a state whose REST requests get
+// status.
+func resolverSession(status int) (*Session, *statusTransport) {
+	t := &statusTransport{status: status}
+	s := &Session{
+		Client:       &http.Client{Transport: t},
+		Ratelimiter:  NewRatelimiter(),
+		StateEnabled: true,
+		State:        NewState(),
+	}
+
+	return s, t
+}
+
+// resolveChannel resolves channel c, expecting err and the requests made
+// so far.
+func resolveChannel(t *testing.T, s *Session, tr *statusTransport, err error, requests int) {
+	t.Helper()
+
+	if _, got := s.Resolve().Channel(context.Background(), "c"); got != err {
+		t.Errorf("got error %v, want %v", got, err)
+	}
+	if n := tr.count(); n != requests {
+		t.Errorf("got %d requests, want %d", n, requests)
+	}
+}
+
+func TestResolverNotFound(t *testing.T) {
+	s, tr := resolverSession(http.StatusNotFound)
+
+	resolveChannel(t, s, tr, ErrNotFound, 1)
+	resolveChannel(t, s, tr, ErrNotFound, 1)
+
+	// The state gaining the channel makes the resolver forget it was not
+	// found.
+	if err := s.State.ChannelAdd(&Channel{ID: "c", Type: ChannelTypeDM}); err != nil {
+		t.Fatal(err)
+	}
+	resolveChannel(t, s, tr, nil, 1)
+	if err := s.State.ChannelRemove(&Channel{ID: "c", Type: ChannelTypeDM}); err != nil {
+		t.Fatal(err)
+	}
+	resolveChannel(t, s, tr, ErrNotFound, 2)
+
+	// Entities are remembered apart.
+	if _, err := s.Resolve().User(context.Background(), "c"); err != ErrNotFound {
+		t.Errorf("user: got error %v, want %v", err, ErrNotFound)
+	}
+	if n := tr.count(); n != 3 {
+		t.Errorf("user: got %d requests, want 3", n)
+	}
+}
+
+func TestResolverNotFoundTTL(t *testing.T) {
+	const ttl = 20 * time.Millisecond
+
+	s, tr := resolverSession(http.StatusNotFound)
+	s.Resolve().NotFoundTTL = ttl
+
+	resolveChannel(t, s, tr, ErrNotFound, 1)
+	resolveChannel(t, s, tr, ErrNotFound, 1)
+	time.Sleep(2 * ttl)
+	resolveChannel(t, s, tr, ErrNotFound, 2)
+
+	// A negative TTL remembers nothing.
+	s, tr = resolverSession(http.StatusNotFound)
+	s.Resolve().NotFoundTTL = -1
+
+	resolveChannel(t, s, tr, ErrNotFound, 1)
+	resolveChannel(t, s, tr, ErrNotFound, 2)
+}
+
+// TestResolverError checks that errors other than not found are neither
+// turned into ErrNotFound nor remembered.
+func TestResolverError(t *testing.T) {
+	s, tr := resolverSession(http.StatusForbidden)
+
+	for i := 1; i <= 2; i++ {
+		_, err := s.Resolve().Channel(context.Background(), "c")
+		if err == nil || err == ErrNotFound {
+			t.Errorf("got error %v, want the REST error", err)
+		}
+		if n := tr.count(); n != i {
+			t.Errorf("got %d requests, want %d", n, i)
+		}
+	}
+}
@@ -70,7 +70,7 @@ func (s *Session) request(method, urlStr, contentType string, b []byte, bucketID
 
 // RequestWithLockedBucket makes a request using a bucket that's already been locked
 func (s *Session) RequestWithLockedBucket(method, urlStr, contentType string, b []byte, bucket *Bucket, sequence int) (response []byte, err error) {
-  if s.Debug {
+  if s.LogLevel >= LogDebug {
     log.Printf("API REQUEST %8s :: %s\n", method, urlStr)
     log.Printf("API REQUEST  PAYLOAD :: [%s]\n", string(b))
   }
@@ -96,7 +96,7 @@ func (s *Session) RequestWithLockedBucket(method, urlStr, contentType string, b
   // TODO: Make a configurable static variable.
   req.Header.Set("User-Agent", s.UserAgent)
 
-  if s.Debug {
+  if s.LogLevel >= LogDebug {
     for k, v := range req.Header {
       log.Printf("API REQUEST   HEADER :: [%s] = %+v\n", k, v)
     }
@@ -124,7 +124,7 @@ func (s *Session) RequestWithLockedBucket(method, urlStr, contentType string, b
     return
   }
 
-  if s.Debug {
+  if s.LogLevel >= LogDebug {
 
     log.Printf("API RESPONSE  STATUS :: %s\n", resp.Status)
     for k, v := range resp.Header {
@@ -1864,6 +1864,229 @@ func (s *Session) ChannelNewsFollow(channelID, targetID string) (st *ChannelFoll
   return
 }
 
+// ------------------------------------------------------------------------------------------------
+// Functions specific to Discord Threads
+// ------------------------------------------------------------------------------------------------
+
+// MessageThreadStartComplex starts a thread from a message.
+// channelID : The ID of a Channel.
+// messageID : The ID of a Message.
+// data      : The fields of the thread; its Type is ignored.
+func (s *Session) MessageThreadStartComplex(channelID, messageID string, data *ThreadStart) (st *Channel, err error) {
+
+  endpoint := EndpointChannelMessageThreads(channelID, messageID)
+
+  body, err := s.RequestWithBucketID("POST", endpoint, data, EndpointChannelMessageThreads(channelID, ""))
+  if err != nil {
+    return
+  }
+
+  err = unmarshal(body, &st)
+  return
+}
+
+// MessageThreadStart starts a thread from a message.
+// channelID       : The ID of a Channel.
+// messageID       : The ID of a Message.
+// name            : The name of the thread.
+// archiveDuration : The minutes of inactivity after which the thread is archived.
+func (s *Session) MessageThreadStart(channelID, messageID, name string, archiveDuration int) (*Channel, error) {
+  return s.MessageThreadStartComplex(channelID, messageID, &ThreadStart{
+    Name:                name,
+    AutoArchiveDuration: archiveDuration,
+  })
+}
+
+// ThreadStartComplex starts a thread which is not attached to a message.
+// channelID : The ID of a Channel.
+// data      : The fields of the thread.
+func (s *Session) ThreadStartComplex(channelID string, data *ThreadStart) (st *Channel, err error) {
+
+  endpoint := EndpointChannelThreads(channelID)
+
+  body, err := s.RequestWithBucketID("POST", endpoint, data, endpoint)
+  if err != nil {
+    return
+  }
+
+  err = unmarshal(body, &st)
+  return
+}
+
+// ThreadStart starts a thread which is not attached to a message.
+// channelID       : The ID of a Channel.
+// name            : The name of the thread.
+// typ             : The type of the thread.
+// archiveDuration : The minutes of inactivity after which the thread is archived.
+func (s *Session) ThreadStart(channelID, name string, typ ChannelType, archiveDuration int) (*Channel, error) {
+  return s.ThreadStartComplex(channelID, &ThreadStart{
+    Name:                name,
+    Type:                typ,
+    AutoArchiveDuration: archiveDuration,
+  })
+}
+
+// ThreadJoin adds the current user to a thread.
+// threadID : The ID of a thread.
+func (s *Session) ThreadJoin(threadID string) (err error) {
+
+  endpoint := EndpointThreadMember(threadID, "@me")
+
+  _, err = s.RequestWithBucketID("PUT", endpoint, nil, endpoint)
+  return
+}
+
+// ThreadLeave removes the current user from a thread.
+// threadID : The ID of a thread.
+func (s *Session) ThreadLeave(threadID string) (err error) {
+
+  endpoint := EndpointThreadMember(threadID, "@me")
+
+  _, err = s.RequestWithBucketID("DELETE", endpoint, nil, endpoint)
+  return
+}
+
+// ThreadMemberAdd adds a user to a thread.
+// threadID : The ID of a thread.
+// userID   : The ID of a User.
+func (s *Session) ThreadMemberAdd(threadID, userID string) (err error) {
+
+  _, err = s.RequestWithBucketID("PUT", EndpointThreadMember(threadID, userID), nil, EndpointThreadMember(threadID, ""))
+  return
+}
+
+// ThreadMemberRemove removes a user from a thread.
+// threadID : The ID of a thread.
+// userID   : The ID of a User.
+func (s *Session) ThreadMemberRemove(threadID, userID string) (err error) {
+
+  _, err = s.RequestWithBucketID("DELETE", EndpointThreadMember(threadID, userID), nil, EndpointThreadMember(threadID, ""))
+  return
+}
+
+// ThreadMember returns the thread member of a user in a thread.
+// threadID : The ID of a thread.
+// userID   : The ID of a User.
+func (s *Session) ThreadMember(threadID, userID string) (st *ThreadMember, err error) {
+
+  body, err := s.RequestWithBucketID("GET", EndpointThreadMember(threadID, userID), nil, EndpointThreadMember(threadID, ""))
+  if err != nil {
+    return
+  }
+
+  err = unmarshal(body, &st)
+  return
+}
+
+// ThreadMembers returns the members of a thread, which needs the
+// GUILD_MEMBERS intent.
+// threadID : The ID of a thread.
+func (s *Session) ThreadMembers(threadID string) (st []*ThreadMember, err error) {
+
+  endpoint := EndpointThreadMembers(threadID)
+
+  body, err := s.RequestWithBucketID("GET", endpoint, nil, endpoint)
+  if err != nil {
+    return
+  }
+
+  err = unmarshal(body, &st)
+  return
+}
+
+// ThreadsActive returns the active threads of a channel.
+// channelID : The ID of a Channel.
+func (s *Session) ThreadsActive(channelID string) (st *ThreadsList, err error) {
+
+  endpoint := EndpointChannelActiveThreads(channelID)
+
+  body, err := s.RequestWithBucketID("GET", endpoint, nil, endpoint)
+  if err != nil {
+    return
+  }
+
+  err = unmarshal(body, &st)
+  return
+}
+
+// GuildThreadsActive returns the active threads of a guild.
+// guildID : The ID of a Guild.
+func (s *Session) GuildThreadsActive(guildID string) (st *ThreadsList, err error) {
+
+  endpoint := EndpointGuildActiveThreads(guildID)
+
+  body, err := s.RequestWithBucketID("GET", endpoint, nil, endpoint)
+  if err != nil {
+    return
+  }
+
+  err = unmarshal(body, &st)
+  return
+}
+
+// archivedThreads returns a page of archived threads from an endpoint.
+func (s *Session) archivedThreads(endpoint string, before string, limit int) (st *ThreadsList, err error) {
+
+  uri := endpoint
+
+  v := url.Values{}
+
+  if before != "" {
+    v.Set("before", before)
+  }
+
+  if limit > 0 {
+    v.Set("limit", strconv.Itoa(limit))
+  }
+
+  if len(v) > 0 {
+    uri += "?" + v.Encode()
+  }
+
+  body, err := s.RequestWithBucketID("GET", uri, nil, endpoint)
+  if err != nil {
+    return
+  }
+
+  err = unmarshal(body, &st)
+  return
+}
+
+// ThreadsArchived returns the public archived threads of a channel, most
+// recently archived first.
+// channelID : The ID of a Channel.
+// before    : Returns threads archived before this time, if not nil.
+// limit     : The maximum number of threads to return, if not 0.
+func (s *Session) ThreadsArchived(channelID string, before *time.Time, limit int) (*ThreadsList, error) {
+  return s.archivedThreads(EndpointChannelPublicArchivedThreads(channelID), archivedBefore(before), limit)
+}
+
+// ThreadsPrivateArchived returns the private archived threads of a channel,
+// most recently archived first, which needs the MANAGE_THREADS permission.
+// channelID : The ID of a Channel.
+// before    : Returns threads archived before this time, if not nil.
+// limit     : The maximum number of threads to return, if not 0.
+func (s *Session) ThreadsPrivateArchived(channelID string, before *time.Time, limit int) (*ThreadsList, error) {
+  return s.archivedThreads(EndpointChannelPrivateArchivedThreads(channelID), archivedBefore(before), limit)
+}
+
+// ThreadsPrivateJoinedArchived returns the private archived threads of a
+// channel which the current user has joined, newest first.
+// channelID : The ID of a Channel.
+// beforeID  : Returns threads older than the thread with this ID, if not empty.
+// limit     : The maximum number of threads to return, if not 0.
+func (s *Session) ThreadsPrivateJoinedArchived(channelID, beforeID string, limit int) (*ThreadsList, error) {
+  return s.archivedThreads(EndpointChannelJoinedPrivateArchivedThreads(channelID), beforeID, limit)
+}
+
+// archivedBefore formats the time before which archived threads are listed.
+func archivedBefore(before *time.Time) string {
+  if before == nil {
+    return ""
+  }
+  return before.Format(time.RFC3339)
+}
+
 // ------------------------------------------------------------------------------------------------
 // Functions specific to Discord Invites
 // ------------------------------------------------------------------------------------------------
@@ -2171,6 +2394,49 @@ func (s *Session) WebhookExecute(webhookID, token string, wait bool, data *Webho
   return
 }
 
+// WebhookMessage gets a webhook message.
+// webhookID : The ID of a webhook
+// token     : The auth token for the webhook
+// messageID : The ID of message to get
+func (s *Session) WebhookMessage(webhookID, token, messageID string) (message *Message, err error) {
+  uri := EndpointWebhookMessage(webhookID, token, messageID)
+
+  body, err := s.RequestWithBucketID("GET", uri, nil, EndpointWebhookToken("", ""))
+  if err != nil {
+    return
+  }
+
+  err = unmarshal(body, &message)
+  return
+}
+
+// WebhookMessageEdit edits a webhook message and returns a new one.
+// webhookID : The ID of a webhook
+// token     : The auth token for the webhook
+// messageID : The ID of message to edit
+func (s *Session) WebhookMessageEdit(webhookID, token, messageID string, data *WebhookEdit) (st *Message, err error) {
+  uri := EndpointWebhookMessage(webhookID, token, messageID)
+
+  response, err := s.RequestWithBucketID("PATCH", uri, data, EndpointWebhookToken("", ""))
+  if err != nil {
+    return
+  }
+
+  err = unmarshal(response, &st)
+  return
+}
+
+// WebhookMessageDelete deletes a webhook message.
+// webhookID : The ID of a webhook
+// token     : The auth token for the webhook
+// messageID : The ID of a message to delete
+func (s *Session) WebhookMessageDelete(webhookID, token, messageID string) (err error) {
+  uri := EndpointWebhookMessage(webhookID, token, messageID)
+
+  _, err = s.RequestWithBucketID("DELETE", uri, nil, EndpointWebhookToken("", ""))
+  return
+}
+
 // MessageReactionAdd creates an emoji reaction to a message.
 // channelID : The channel ID.
 // messageID : The message ID.
@@ -2337,4 +2603,184 @@ func (s *Session) RelationshipsMutualGet(userID string) (mf []*User, err error)
 
   err = unmarshal(body, &mf)
   return
-}
\ No newline at end of file
+}
+// ------------------------------------------------------------------------------------------------
+// Functions specific to application commands
+// ------------------------------------------------------------------------------------------------
+
+// applicationCommandsEndpoint returns the endpoint for the global commands
+// of an application, or for its commands in a guild if guildID is set.
+func applicationCommandsEndpoint(appID, guildID string) string {
+  if guildID != "" {
+    return EndpointApplicationGuildCommands(appID, guildID)
+  }
+
+  return EndpointApplicationGlobalCommands(appID)
+}
+
+// applicationCommandEndpoint returns the endpoint for a single command.
+func applicationCommandEndpoint(appID, guildID, cmdID string) string {
+  if guildID != "" {
+    return EndpointApplicationGuildCommand(appID, guildID, cmdID)
+  }
+
+  return EndpointApplicationGlobalCommand(appID, cmdID)
+}
+
+// ApplicationCommandCreate creates an application command and returns it.
+// appID   : The application ID.
+// guildID : Guild ID to create guild-specific application command. If empty - creates global application command.
+// cmd     : New application command data.
+func (s *Session) ApplicationCommandCreate(appID, guildID string, cmd *ApplicationCommand) (ccmd *ApplicationCommand, err error) {
+  endpoint := applicationCommandsEndpoint(appID, guildID)
+
+  body, err := s.RequestWithBucketID("POST", endpoint, *cmd, endpoint)
+  if err != nil {
+    return
+  }
+
+  err = unmarshal(body, &ccmd)
+  return
+}
+
+// ApplicationCommandEdit edits application command and returns new command data.
+// appID   : The application ID.
+// cmdID   : Application command ID to edit.
+// guildID : Guild ID to edit guild-specific application command. If empty - edits global application command.
+// cmd     : Updated application command data.
+func (s *Session) ApplicationCommandEdit(appID, guildID, cmdID string, cmd *ApplicationCommand) (updated *ApplicationCommand, err error) {
+  endpoint := applicationCommandEndpoint(appID, guildID, cmdID)
+
+  body, err := s.RequestWithBucketID("PATCH", endpoint, *cmd, applicationCommandEndpoint(appID, guildID, ""))
+  if err != nil {
+    return
+  }
+
+  err = unmarshal(body, &updated)
+  return
+}
+
+// ApplicationCommandBulkOverwrite creates commands overwriting all existing commands
+// in a guild, or globally if guildID is empty.
+// appID    : The application ID.
+// guildID  : The ID of the guild; empty for global commands.
+// commands : The commands to create.
+func (s *Session) ApplicationCommandBulkOverwrite(appID, guildID string, commands []*ApplicationCommand) (createdCommands []*ApplicationCommand, err error) {
+  endpoint := applicationCommandsEndpoint(appID, guildID)
+
+  body, err := s.RequestWithBucketID("PUT", endpoint, commands, endpoint)
+  if err != nil {
+    return
+  }
+
+  err = unmarshal(body, &createdCommands)
+  return
+}
+
+// ApplicationCommand retrieves an application command by given ID.
+// appID   : The application ID.
+// cmdID   : Application command ID.
+// guildID : Guild ID to retrieve guild-specific application command. If empty - retrieves global application command.
+func (s *Session) ApplicationCommand(appID, guildID, cmdID string) (cmd *ApplicationCommand, err error) {
+  endpoint := applicationCommandEndpoint(appID, guildID, cmdID)
+
+  body, err := s.RequestWithBucketID("GET", endpoint, nil, applicationCommandEndpoint(appID, guildID, ""))
+  if err != nil {
+    return
+  }
+
+  err = unmarshal(body, &cmd)
+  return
+}
+
+// ApplicationCommandDelete deletes application command by ID.
+// appID   : The application ID.
+// cmdID   : Application command ID to delete.
+// guildID : Guild ID to delete guild-specific application command. If empty - deletes global application command.
+func (s *Session) ApplicationCommandDelete(appID, guildID, cmdID string) (err error) {
+  endpoint := applicationCommandEndpoint(appID, guildID, cmdID)
+
+  _, err = s.RequestWithBucketID("DELETE", endpoint, nil, applicationCommandEndpoint(appID, guildID, ""))
+  return
+}
+
+// ApplicationCommands retrieves all commands in application.
+// appID   : The application ID.
+// guildID : Guild ID to retrieve all guild-specific application commands. If empty - retrieves global application commands.
+func (s *Session) ApplicationCommands(appID, guildID string) (cmd []*ApplicationCommand, err error) {
+  endpoint := applicationCommandsEndpoint(appID, guildID)
+
+  body, err := s.RequestWithBucketID("GET", endpoint, nil, endpoint)
+  if err != nil {
+    return
+  }
+
+  err = unmarshal(body, &cmd)
+  return
+}
+
+// ------------------------------------------------------------------------------------------------
+// Functions specific to interactions
+// ------------------------------------------------------------------------------------------------
+
+// InteractionRespond creates the response to an interaction.
+// interaction : Interaction instance.
+// resp        : Response message data.
+func (s *Session) InteractionRespond(interaction *Interaction, resp *InteractionResponse) (err error) {
+  endpoint := EndpointInteractionResponse(interaction.ID, interaction.Token)
+
+  _, err = s.RequestWithBucketID("POST", endpoint, *resp, endpoint)
+  return
+}
+
+// InteractionResponse gets the response to an interaction.
+// appID       : The application ID.
+// interaction : Interaction instance.
+func (s *Session) InteractionResponse(appID string, interaction *Interaction) (*Message, error) {
+  return s.WebhookMessage(appID, interaction.Token, "@original")
+}
+
+// InteractionResponseEdit edits the response to an interaction.
+// appID       : The application ID.
+// interaction : Interaction instance.
+// newresp     : Updated response message data.
+func (s *Session) InteractionResponseEdit(appID string, interaction *Interaction, newresp *WebhookEdit) (*Message, error) {
+  return s.WebhookMessageEdit(appID, interaction.Token, "@original", newresp)
+}
+
+// InteractionResponseDelete deletes the response to an interaction.
+// appID       : The application ID.
+// interaction : Interaction instance.
+func (s *Session) InteractionResponseDelete(appID string, interaction *Interaction) (err error) {
+  endpoint := EndpointInteractionResponseActions(appID, interaction.Token)
+
+  _, err = s.RequestWithBucketID("DELETE", endpoint, nil, endpoint)
+  return
+}
+
+// FollowupMessageCreate creates the followup message for an interaction.
+// appID       : The application ID.
+// interaction : Interaction instance.
+// wait        : Waits for server confirmation of message send and ensures that the return struct is populated (it is nil otherwise)
+// data        : Data of the message to send.
+func (s *Session) FollowupMessageCreate(appID string, interaction *Interaction, wait bool, data *WebhookParams) (*Message, error) {
+  return s.WebhookExecute(appID, interaction.Token, wait, data)
+}
+
+// FollowupMessageEdit edits a followup message of an interaction.
+// appID       : The application ID.
+// interaction : Interaction instance.
+// messageID   : The followup message ID.
+// data        : Data to update the message
+func (s *Session) FollowupMessageEdit(appID string, interaction *Interaction, messageID string, data *WebhookEdit) (*Message, error) {
+  return s.WebhookMessageEdit(appID, interaction.Token, messageID, data)
+}
+
+// FollowupMessageDelete deletes a followup message of an interaction.
+// appID       : The application ID.
+// interaction : Interaction instance.
+// messageID   : The followup message ID.
+func (s *Session) FollowupMessageDelete(appID string, interaction *Interaction, messageID string) (err error) {
+  _, err = s.RequestWithBucketID("DELETE", EndpointFollowupMessageActions(appID, interaction.Token, messageID), nil, EndpointFollowupMessageActions(appID, interaction.Token, ""))
+  return
+}
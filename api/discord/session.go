@@ -10,7 +10,6 @@
 package discord
 
 import (
-  "errors"
   "net/http"
   "sync"
   "time"
@@ -64,6 +63,10 @@ type Session struct {
   // e.g false = launch handlers in their own coroutines.
   SyncEnabled bool
 
+  // MemberChunking, if set, requests the members of large guilds from the
+  // gateway to fill the State.  See MemberChunking.
+  MemberChunking *MemberChunking
+
   // Exposed but should not be modified by the User:
 
   // Whether WebSocket data is ready.
@@ -120,6 +123,13 @@ type Session struct {
 
   // used to make sure gateway websocket writes do not happen concurrently
   wsMutex sync.Mutex
+
+  // the guilds whose members are yet to be requested
+  memberChunks memberChunkQueue
+
+  // the resolver returned by Resolve
+  resolverOnce sync.Once
+  resolver     *Resolver
 }
 
 // Identify is sent during initial handshake with the Discord gateway.
@@ -0,0 +1,245 @@
+// Discord bindings for the Hrngh bot.
+// Available at https://github.com/abeiron/hrngh
+
+// Copyright 2020-2021, Undying Memory <abeiron@outlook.com>.  All rights reserved.
+// Use of this source code is governed by the Microsoft Public License
+// that can be found in the LICENSE file.
+
+// This file contains code related to snapshots of the state, which let a
+// restarted bot begin with the cache it had.
+
+package discord
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrSnapshotFormat is returned when restoring from something which is not a
+// snapshot, or is one of an unknown version.
+var ErrSnapshotFormat = errors.New("not a state snapshot, or of an unknown version")
+
+// ErrSnapshotShard is returned when restoring a session from the snapshot of
+// another shard, whose guilds are not those of the session.
+var ErrSnapshotShard = errors.New("state snapshot of another shard")
+
+// snapshotFormat and snapshotVersion identify the format of snapshots.  The
+// version is raised whenever the body changes incompatibly.
+const (
+	snapshotFormat  = "hrngh-state"
+	snapshotVersion = 1
+)
+
+// A snapshot is written as two JSON values: a snapshotHeader, which can be
+// read whatever the version, and a snapshotBody.
+type snapshotHeader struct {
+	Format  string         `json:"format"`
+	Version int            `json:"version"`
+	Time    time.Time      `json:"time"`
+	Shard   *snapshotShard `json:"shard,omitempty"`
+}
+
+// A snapshotShard identifies the shard of the session a snapshot is of.
+//
+// TODO: Save the session ID, sequence number and gateway URL too, once the
+// session opens its gateway connection and can resume with them.
+type snapshotShard struct {
+	ID    int `json:"id"`
+	Count int `json:"count"`
+}
+
+type snapshotBody struct {
+	User            *User                 `json:"user"`
+	Guilds          []*Guild              `json:"guilds"`
+	PrivateChannels []*Channel            `json:"private_channels"`
+	Messages        map[string][]*Message `json:"messages"`
+}
+
+// Snapshot writes the state to w, to be restored by Restore.  The snapshot
+// is JSON, led by a header giving its version.  The state is read-locked
+// while it is written.
+func (s *State) Snapshot(w io.Writer) error {
+	return s.writeSnapshot(w, nil)
+}
+
+// Restore reads a snapshot written by Snapshot into the state, adding to or
+// replacing what the state holds.  It is meant to be called on a new state,
+// before the session is opened.
+func (s *State) Restore(r io.Reader) error {
+	return s.readSnapshot(r, nil)
+}
+
+func (s *State) writeSnapshot(w io.Writer, shard *snapshotShard) error {
+	if s == nil {
+		return ErrNilState
+	}
+
+	s.RLock()
+	defer s.RUnlock()
+
+	body, err := s.snapshotBody()
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	err = enc.Encode(&snapshotHeader{
+		Format:  snapshotFormat,
+		Version: snapshotVersion,
+		Time:    time.Now().UTC(),
+		Shard:   shard,
+	})
+	if err != nil {
+		return err
+	}
+
+	return enc.Encode(body)
+}
+
+// snapshotBody collects the state.  The lock of s must be held.
+func (s *State) snapshotBody() (*snapshotBody, error) {
+	body := &snapshotBody{
+		User:     s.User,
+		Messages: make(map[string][]*Message),
+	}
+
+	guilds, err := s.store.Guilds()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, g := range guilds {
+		// A store may leave these out of the guild.
+		guild := *g
+		if guild.Members, err = s.store.Members(g.ID); err != nil {
+			return nil, err
+		}
+		if guild.Presences, err = s.guildPresences(g.ID); err != nil {
+			return nil, err
+		}
+		if guild.VoiceStates, err = s.store.VoiceStates(g.ID); err != nil {
+			return nil, err
+		}
+		body.Guilds = append(body.Guilds, &guild)
+
+		if err = s.snapshotMessages(body, guild.Channels); err != nil {
+			return nil, err
+		}
+		if err = s.snapshotMessages(body, guild.Threads); err != nil {
+			return nil, err
+		}
+	}
+
+	if body.PrivateChannels, err = s.store.Channels(""); err != nil {
+		return nil, err
+	}
+	if err = s.snapshotMessages(body, body.PrivateChannels); err != nil {
+		return nil, err
+	}
+
+	return body, nil
+}
+
+func (s *State) snapshotMessages(body *snapshotBody, channels []*Channel) error {
+	for _, c := range channels {
+		messages, err := s.channelMessages(c.ID)
+		if err != nil {
+			return err
+		}
+		if len(messages) > 0 {
+			body.Messages[c.ID] = messages
+		}
+	}
+
+	return nil
+}
+
+// readSnapshot reads a snapshot into the state, if check, when not nil,
+// accepts its header.
+func (s *State) readSnapshot(r io.Reader, check func(*snapshotHeader) error) error {
+	if s == nil {
+		return ErrNilState
+	}
+
+	dec := json.NewDecoder(r)
+
+	var header snapshotHeader
+	if err := dec.Decode(&header); err != nil {
+		return err
+	}
+	if header.Format != snapshotFormat || header.Version != snapshotVersion {
+		return ErrSnapshotFormat
+	}
+	if check != nil {
+		if err := check(&header); err != nil {
+			return err
+		}
+	}
+
+	var body snapshotBody
+	if err := dec.Decode(&body); err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if body.User != nil {
+		s.User = body.User
+	}
+
+	for _, g := range body.Guilds {
+		if err := s.guildAdd(g); err != nil {
+			return err
+		}
+	}
+
+	for _, c := range body.PrivateChannels {
+		if err := s.store.SetChannel(c); err != nil {
+			return err
+		}
+	}
+
+	for _, messages := range body.Messages {
+		for _, m := range messages {
+			if err := s.setMessage(m); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Snapshot writes the state of the session to w, as State.Snapshot, along
+// with the shard of the session.  A bot can restore the snapshot after a
+// restart with Session.Restore, to serve its cache while it connects.
+func (s *Session) Snapshot(w io.Writer) error {
+	s.RLock()
+	shard := &snapshotShard{ID: s.ShardId, Count: s.ShardCount}
+	s.RUnlock()
+
+	return s.State.writeSnapshot(w, shard)
+}
+
+// Restore reads a snapshot written by Session.Snapshot into the state of
+// the session, as State.Restore.  It must be called before the session is
+// opened.  The snapshot of another shard is not restored, and returns
+// ErrSnapshotShard.
+//
+// The gateway session is not resumed: the session identifies again, and
+// the events it receives then update the restored state.
+func (s *Session) Restore(r io.Reader) error {
+	s.RLock()
+	shardID, shardCount := s.ShardId, s.ShardCount
+	s.RUnlock()
+
+	return s.State.readSnapshot(r, func(header *snapshotHeader) error {
+		if header.Shard != nil && (header.Shard.ID != shardID || header.Shard.Count != shardCount) {
+			return ErrSnapshotShard
+		}
+		return nil
+	})
+}
@@ -0,0 +1,140 @@
+// Discord bindings for the Hrngh bot.
+// Available at https://github.com/abeiron/hrngh
+
+// Copyright 2020-2021, Undying Memory <abeiron@outlook.com>.  All rights reserved.
+// Use of this source code is governed by the Microsoft Public License
+// that can be found in the LICENSE file.
+
+// This file contains tests of the snapshots of the state.
+
+package discord
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+// snapshotState returns a state holding one of everything a snapshot keeps.
+func snapshotState(t *testing.T) *State {
+	s := NewState()
+	s.MaxMessageCount = 10
+
+	guild := &Guild{
+		ID:          "g",
+		Name:        "guild",
+		Channels:    []*Channel{{ID: "c", GuildID: "g", Name: "general"}},
+		Threads:     []*Channel{{ID: "t", GuildID: "g", ParentID: "c", Name: "thread"}},
+		Members:     []*Member{{GuildID: "g", User: &User{ID: "u", Username: "user"}, Nick: "nick"}},
+		Presences:   []*Presence{{User: &User{ID: "u"}, Status: StatusOnline}},
+		VoiceStates: []*VoiceState{{GuildID: "g", UserID: "u", ChannelID: "c"}},
+	}
+	if err := s.GuildAdd(guild); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range []*Message{{ID: "m1", ChannelID: "c", Content: "first"}, {ID: "m2", ChannelID: "t", Content: "second"}} {
+		if err := s.MessageAdd(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return s
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := snapshotState(t).Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewState()
+	s.MaxMessageCount = 10
+	if err := s.Restore(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, err := s.Guild("g"); err != nil || g.Name != "guild" {
+		t.Errorf("guild: got %+v, %v", g, err)
+	}
+	if c, err := s.Channel("c"); err != nil || c.Name != "general" {
+		t.Errorf("channel: got %+v, %v", c, err)
+	}
+	if c, err := s.Channel("t"); err != nil || c.Name != "thread" {
+		t.Errorf("thread: got %+v, %v", c, err)
+	}
+	if m, err := s.Member("g", "u"); err != nil || m.Nick != "nick" {
+		t.Errorf("member: got %+v, %v", m, err)
+	}
+	if p, err := s.Presence("g", "u"); err != nil || p.Status != StatusOnline {
+		t.Errorf("presence: got %+v, %v", p, err)
+	}
+	if v, err := s.VoiceState("g", "u"); err != nil || v.ChannelID != "c" {
+		t.Errorf("voice state: got %+v, %v", v, err)
+	}
+	if m, err := s.Message("c", "m1"); err != nil || m.Content != "first" {
+		t.Errorf("message: got %+v, %v", m, err)
+	}
+	if m, err := s.Message("t", "m2"); err != nil || m.Content != "second" {
+		t.Errorf("thread message: got %+v, %v", m, err)
+	}
+}
+
+func TestSnapshotFormat(t *testing.T) {
+	headers := map[string]snapshotHeader{
+		"unknown format":  {Format: "other", Version: snapshotVersion},
+		"unknown version": {Format: snapshotFormat, Version: snapshotVersion + 1},
+	}
+
+	for name, header := range headers {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		if err := enc.Encode(&header); err != nil {
+			t.Fatal(err)
+		}
+		if err := enc.Encode(&snapshotBody{Guilds: []*Guild{{ID: "g"}}}); err != nil {
+			t.Fatal(err)
+		}
+
+		s := NewState()
+		if err := s.Restore(&buf); err != ErrSnapshotFormat {
+			t.Errorf("%s: got error %v, want %v", name, err, ErrSnapshotFormat)
+		}
+		if _, err := s.Guild("g"); err != ErrStateNotFound {
+			t.Errorf("%s: guild restored", name)
+		}
+	}
+}
+
+// TestSessionRestoreShard checks that a session restores the snapshot of its
+// own shard only, and that no gateway session comes with it.
+func TestSessionRestoreShard(t *testing.T) {
+	var buf bytes.Buffer
+	se := &Session{State: snapshotState(t), ShardId: 0, ShardCount: 2}
+	if err := se.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	snapshot := buf.Bytes()
+
+	other := &Session{State: NewState(), ShardId: 1, ShardCount: 2}
+	if err := other.Restore(bytes.NewReader(snapshot)); err != ErrSnapshotShard {
+		t.Fatalf("other shard: got error %v, want %v", err, ErrSnapshotShard)
+	}
+	if _, err := other.State.Guild("g"); err != ErrStateNotFound {
+		t.Error("other shard: guild restored")
+	}
+
+	same := &Session{State: NewState(), ShardId: 0, ShardCount: 2}
+	if err := same.Restore(bytes.NewReader(snapshot)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := same.State.Guild("g"); err != nil {
+		t.Errorf("same shard: %v", err)
+	}
+
+	for _, s := range []*Session{other, same} {
+		if s.sessionID != "" || s.sequence != nil || s.gateway != "" {
+			t.Errorf("shard %d: got session %q, sequence %v and gateway %q, want none",
+				s.ShardId, s.sessionID, s.sequence, s.gateway)
+		}
+	}
+}
@@ -33,6 +33,11 @@ var ErrMessageIncompletePermissions = errors.New("message incomplete, unable to
 // A State contains the current known state.
 // As discord sends this in a READY blob, it seems reasonable to simply
 // use that struct as the data store.
+//
+// The guilds, channels, threads, members, roles, emojis, messages, presences and
+// voice states are cached in a StateStore, by default a MemoryStore, which
+// also keeps Ready.Guilds and Ready.PrivateChannels.  With another store,
+// those are left empty; get them from the store instead.
 type State struct {
 	sync.RWMutex
 	Ready
@@ -46,14 +51,48 @@ type State struct {
 	TrackVoice      bool
 	TrackPresences  bool
 
-	guildMap   map[string]*Guild
-	channelMap map[string]*Channel
-	memberMap  map[string]map[string]*Member
+	// MessageCache, if set, holds the messages of the state in place of
+	// the store, with its own limits; MaxMessageCount is then unused.
+	MessageCache *MessageCache
+
+	// PresenceCache, if set, holds the presences of the state in place of
+	// the store, once per user; guilds then hold no presences.
+	PresenceCache *PresenceCache
+
+	// CopyOnRead makes the state copy what it is given and what it
+	// returns, so that the values returned by its getters, and those of
+	// the events it has handled, are never changed by it, and handlers may
+	// read them while it handles further events.  It should be set before
+	// the state is used.  Copying a guild copies all its members.
+	CopyOnRead bool
+
+	store StateStore
+
+	// membersReady holds, by guild, a channel closed once the members of
+	// the guild are ready; see WaitForMembers.
+	membersMu    sync.Mutex
+	membersReady map[string]chan struct{}
+
+	// memberIndices holds, by guild, the index of the members queried by
+	// name; see FindMember.  indexGen holds, by guild, the generation of
+	// the last change of its members, and indexAll that of the last change
+	// of all guilds, both counted by indexSeq.
+	indexMu       sync.Mutex
+	indexSeq      uint64
+	indexAll      uint64
+	indexGen      map[string]uint64
+	memberIndices map[string]*memberIndex
 }
 
-// NewState creates an empty state.
+// NewState creates an empty state, cached in memory.
 func NewState() *State {
-	return &State{
+	return NewStateWithStore(nil)
+}
+
+// NewStateWithStore creates an empty state cached in store, such as a
+// DiskStore, or in a new MemoryStore if store is nil.
+func NewStateWithStore(store StateStore) *State {
+	s := &State{
 		Ready: Ready{
 			PrivateChannels: []*Channel{},
 			Guilds:          []*Guild{},
@@ -64,18 +103,23 @@ func NewState() *State {
 		TrackRoles:     true,
 		TrackVoice:     true,
 		TrackPresences: true,
-		guildMap:       make(map[string]*Guild),
-		channelMap:     make(map[string]*Channel),
-		memberMap:      make(map[string]map[string]*Member),
 	}
-}
 
-func (s *State) createMemberMap(guild *Guild) {
-	members := make(map[string]*Member)
-	for _, m := range guild.Members {
-		members[m.User.ID] = m
+	if store == nil {
+		store = NewMemoryStore()
 	}
-	s.memberMap[guild.ID] = members
+	if m, ok := store.(*MemoryStore); ok {
+		m.bind(&s.Ready)
+	}
+	s.store = store
+
+	return s
+}
+
+// Store returns the store in which the state is cached.  It must only be
+// used while holding the lock of the state.
+func (s *State) Store() StateStore {
+	return s.store
 }
 
 // GuildAdd adds a guild to the current world state, or
@@ -88,20 +132,29 @@ func (s *State) GuildAdd(guild *Guild) error {
 	s.Lock()
 	defer s.Unlock()
 
-	// Update the channels to point to the right guild, adding them to the channelMap as we go
-	for _, c := range guild.Channels {
-		s.channelMap[c.ID] = c
+	return s.guildAdd(guild)
+}
+
+func (s *State) guildAdd(guild *Guild) error {
+	if s.CopyOnRead {
+		guild = guildCopy(guild)
 	}
 
-	// If this guild contains a new member slice, we must regenerate the member map so the pointers stay valid
-	if guild.Members != nil {
-		s.createMemberMap(guild)
-	} else if _, ok := s.memberMap[guild.ID]; !ok {
-		// Even if we have no new member slice, we still initialize the member map for this guild if it doesn't exist
-		s.memberMap[guild.ID] = make(map[string]*Member)
+	if s.PresenceCache != nil && guild.Presences != nil {
+		// The presences of a created guild replace those cached.
+		s.PresenceCache.RemoveGuild(guild.ID)
+		if s.TrackPresences {
+			for _, p := range guild.Presences {
+				s.PresenceCache.Set(guild.ID, p)
+			}
+		}
+
+		g := *guild
+		g.Presences = nil
+		guild = &g
 	}
 
-	if g, ok := s.guildMap[guild.ID]; ok {
+	if g, err := s.store.Guild(guild.ID); err == nil {
 		// We are about to replace `g` in the state with `guild`, but first we need to
 		// make sure we preserve any fields that the `guild` doesn't contain from `g`.
 		if guild.MemberCount == 0 {
@@ -122,17 +175,43 @@ func (s *State) GuildAdd(guild *Guild) error {
 		if guild.Channels == nil {
 			guild.Channels = g.Channels
 		}
+		if guild.Threads == nil {
+			guild.Threads = g.Threads
+		}
 		if guild.VoiceStates == nil {
 			guild.VoiceStates = g.VoiceStates
 		}
-		*g = *guild
-		return nil
 	}
 
-	s.Guilds = append(s.Guilds, guild)
-	s.guildMap[guild.ID] = guild
+	// The threads of GUILD_CREATE lack their guild ID.
+	for _, c := range guild.Threads {
+		if c.GuildID == "" {
+			c.GuildID = guild.ID
+		}
+	}
 
-	return nil
+	s.membersChanged(guild.ID)
+
+	return s.store.SetGuild(guild)
+}
+
+// guildMemberCountAdd adds delta to the MemberCount of a guild.
+func (s *State) guildMemberCountAdd(guildID string, delta int) error {
+	s.Lock()
+	defer s.Unlock()
+
+	g, err := s.store.Guild(guildID)
+	if err != nil {
+		return err
+	}
+
+	// Set only the guild itself, leaving what it holds unchanged.
+	update := *g
+	update.MemberCount += delta
+	update.Channels, update.Threads, update.Roles, update.Emojis = nil, nil, nil, nil
+	update.Members, update.Presences, update.VoiceStates = nil, nil, nil
+
+	return s.store.SetGuild(&update)
 }
 
 // GuildRemove removes a guild from current world state.
@@ -141,24 +220,22 @@ func (s *State) GuildRemove(guild *Guild) error {
 		return ErrNilState
 	}
 
-	_, err := s.Guild(guild.ID)
-	if err != nil {
-		return err
-	}
-
 	s.Lock()
 	defer s.Unlock()
 
-	delete(s.guildMap, guild.ID)
+	return s.guildRemove(guild)
+}
 
-	for i, g := range s.Guilds {
-		if g.ID == guild.ID {
-			s.Guilds = append(s.Guilds[:i], s.Guilds[i+1:]...)
-			return nil
-		}
+func (s *State) guildRemove(guild *Guild) error {
+	if s.MessageCache != nil {
+		s.MessageCache.RemoveGuild(guild.ID)
+	}
+	if s.PresenceCache != nil {
+		s.PresenceCache.RemoveGuild(guild.ID)
 	}
+	s.membersChanged(guild.ID)
 
-	return nil
+	return s.store.DeleteGuild(guild.ID)
 }
 
 // Guild gets a guild by ID.
@@ -173,11 +250,16 @@ func (s *State) Guild(guildID string) (*Guild, error) {
 	s.RLock()
 	defer s.RUnlock()
 
-	if g, ok := s.guildMap[guildID]; ok {
-		return g, nil
+	return s.guild(guildID)
+}
+
+func (s *State) guild(guildID string) (*Guild, error) {
+	g, err := s.store.Guild(guildID)
+	if err != nil || !s.CopyOnRead {
+		return g, err
 	}
 
-	return nil, ErrStateNotFound
+	return guildCopy(g), nil
 }
 
 // PresenceAdd adds a presence to the current world state, or
@@ -187,50 +269,58 @@ func (s *State) PresenceAdd(guildID string, presence *Presence) error {
 		return ErrNilState
 	}
 
-	guild, err := s.Guild(guildID)
-	if err != nil {
-		return err
-	}
-
 	s.Lock()
 	defer s.Unlock()
 
-	for i, p := range guild.Presences {
-		if p.User.ID == presence.User.ID {
-			//guild.Presences[i] = presence
+	return s.presenceAdd(guildID, presence)
+}
 
-			//Update status
-			guild.Presences[i].Activities = presence.Activities
-			if presence.Status != "" {
-				guild.Presences[i].Status = presence.Status
-			}
+func (s *State) presenceAdd(guildID string, presence *Presence) error {
+	if s.PresenceCache != nil {
+		if _, err := s.store.Guild(guildID); err != nil {
+			return err
+		}
 
-			//Update the optionally sent user information
-			//ID Is a mandatory field so you should not need to check if it is empty
-			guild.Presences[i].User.ID = presence.User.ID
+		s.PresenceCache.Set(guildID, presence)
+		return nil
+	}
 
-			if presence.User.Avatar != "" {
-				guild.Presences[i].User.Avatar = presence.User.Avatar
-			}
-			if presence.User.Discriminator != "" {
-				guild.Presences[i].User.Discriminator = presence.User.Discriminator
-			}
-			if presence.User.Email != "" {
-				guild.Presences[i].User.Email = presence.User.Email
-			}
-			if presence.User.Token != "" {
-				guild.Presences[i].User.Token = presence.User.Token
-			}
-			if presence.User.Username != "" {
-				guild.Presences[i].User.Username = presence.User.Username
-			}
+	if s.CopyOnRead {
+		presence = presenceCopy(presence)
+	}
 
-			return nil
-		}
+	p, err := s.store.Presence(guildID, presence.User.ID)
+	if err != nil {
+		return s.store.SetPresence(guildID, presence)
 	}
 
-	guild.Presences = append(guild.Presences, presence)
-	return nil
+	//Update status
+	p.Activities = presence.Activities
+	if presence.Status != "" {
+		p.Status = presence.Status
+	}
+
+	//Update the optionally sent user information
+	//ID Is a mandatory field so you should not need to check if it is empty
+	p.User.ID = presence.User.ID
+
+	if presence.User.Avatar != "" {
+		p.User.Avatar = presence.User.Avatar
+	}
+	if presence.User.Discriminator != "" {
+		p.User.Discriminator = presence.User.Discriminator
+	}
+	if presence.User.Email != "" {
+		p.User.Email = presence.User.Email
+	}
+	if presence.User.Token != "" {
+		p.User.Token = presence.User.Token
+	}
+	if presence.User.Username != "" {
+		p.User.Username = presence.User.Username
+	}
+
+	return s.store.SetPresence(guildID, p)
 }
 
 // PresenceRemove removes a presence from the current world state.
@@ -239,22 +329,21 @@ func (s *State) PresenceRemove(guildID string, presence *Presence) error {
 		return ErrNilState
 	}
 
-	guild, err := s.Guild(guildID)
-	if err != nil {
-		return err
-	}
-
 	s.Lock()
 	defer s.Unlock()
 
-	for i, p := range guild.Presences {
-		if p.User.ID == presence.User.ID {
-			guild.Presences = append(guild.Presences[:i], guild.Presences[i+1:]...)
-			return nil
+	return s.presenceRemove(guildID, presence)
+}
+
+func (s *State) presenceRemove(guildID string, presence *Presence) error {
+	if s.PresenceCache != nil {
+		if !s.PresenceCache.Remove(guildID, presence.User.ID) {
+			return ErrStateNotFound
 		}
+		return nil
 	}
 
-	return ErrStateNotFound
+	return s.store.DeletePresence(guildID, presence.User.ID)
 }
 
 // Presence gets a presence by ID from a guild.
@@ -263,18 +352,41 @@ func (s *State) Presence(guildID, userID string) (*Presence, error) {
 		return nil, ErrNilState
 	}
 
-	guild, err := s.Guild(guildID)
-	if err != nil {
-		return nil, err
-	}
+	s.RLock()
+	defer s.RUnlock()
 
-	for _, p := range guild.Presences {
-		if p.User.ID == userID {
+	return s.presence(guildID, userID)
+}
+
+func (s *State) presence(guildID, userID string) (*Presence, error) {
+	if s.PresenceCache != nil {
+		// The cache builds a new presence each time.
+		if p, ok := s.PresenceCache.Presence(guildID, userID); ok {
 			return p, nil
 		}
+		return nil, ErrStateNotFound
 	}
 
-	return nil, ErrStateNotFound
+	p, err := s.store.Presence(guildID, userID)
+	if err != nil || !s.CopyOnRead {
+		return p, err
+	}
+
+	return presenceCopy(p), nil
+}
+
+// guildPresences returns the presences of a guild from the PresenceCache,
+// if set, or the store.  The lock of s must be held.
+func (s *State) guildPresences(guildID string) ([]*Presence, error) {
+	if s.PresenceCache == nil {
+		return s.store.Presences(guildID)
+	}
+
+	if _, err := s.store.Guild(guildID); err != nil {
+		return nil, err
+	}
+
+	return s.PresenceCache.Presences(guildID), nil
 }
 
 // TODO: Consider moving Guild state update methods onto *Guild.
@@ -286,31 +398,28 @@ func (s *State) MemberAdd(member *Member) error {
 		return ErrNilState
 	}
 
-	guild, err := s.Guild(member.GuildID)
-	if err != nil {
-		return err
-	}
-
 	s.Lock()
 	defer s.Unlock()
 
-	members, ok := s.memberMap[member.GuildID]
-	if !ok {
-		return ErrStateNotFound
+	return s.memberAdd(member)
+}
+
+func (s *State) memberAdd(member *Member) error {
+	if s.CopyOnRead {
+		member = memberCopy(member)
 	}
 
-	m, ok := members[member.User.ID]
-	if !ok {
-		members[member.User.ID] = member
-		guild.Members = append(guild.Members, member)
-	} else {
+	if m, err := s.store.Member(member.GuildID, member.User.ID); err == nil {
 		// We are about to replace `m` in the state with `member`, but first we need to
 		// make sure we preserve any fields that the `member` doesn't contain from `m`.
 		if member.JoinedAt == "" {
 			member.JoinedAt = m.JoinedAt
 		}
-		*m = *member
 	}
+	if err := s.store.SetMember(member); err != nil {
+		return err
+	}
+	s.memberIndexed(member)
 
 	return nil
 }
@@ -321,33 +430,19 @@ func (s *State) MemberRemove(member *Member) error {
 		return ErrNilState
 	}
 
-	guild, err := s.Guild(member.GuildID)
-	if err != nil {
-		return err
-	}
-
 	s.Lock()
 	defer s.Unlock()
 
-	members, ok := s.memberMap[member.GuildID]
-	if !ok {
-		return ErrStateNotFound
-	}
-
-	_, ok = members[member.User.ID]
-	if !ok {
-		return ErrStateNotFound
-	}
-	delete(members, member.User.ID)
+	return s.memberRemove(member)
+}
 
-	for i, m := range guild.Members {
-		if m.User.ID == member.User.ID {
-			guild.Members = append(guild.Members[:i], guild.Members[i+1:]...)
-			return nil
-		}
+func (s *State) memberRemove(member *Member) error {
+	if err := s.store.DeleteMember(member.GuildID, member.User.ID); err != nil {
+		return err
 	}
+	s.memberUnindexed(member.GuildID, member.User.ID)
 
-	return ErrStateNotFound
+	return nil
 }
 
 // Member gets a member by ID from a guild.
@@ -359,17 +454,16 @@ func (s *State) Member(guildID, userID string) (*Member, error) {
 	s.RLock()
 	defer s.RUnlock()
 
-	members, ok := s.memberMap[guildID]
-	if !ok {
-		return nil, ErrStateNotFound
-	}
+	return s.member(guildID, userID)
+}
 
-	m, ok := members[userID]
-	if ok {
-		return m, nil
+func (s *State) member(guildID, userID string) (*Member, error) {
+	m, err := s.store.Member(guildID, userID)
+	if err != nil || !s.CopyOnRead {
+		return m, err
 	}
 
-	return nil, ErrStateNotFound
+	return memberCopy(m), nil
 }
 
 // RoleAdd adds a role to the current world state, or
@@ -379,23 +473,18 @@ func (s *State) RoleAdd(guildID string, role *Role) error {
 		return ErrNilState
 	}
 
-	guild, err := s.Guild(guildID)
-	if err != nil {
-		return err
-	}
-
 	s.Lock()
 	defer s.Unlock()
 
-	for i, r := range guild.Roles {
-		if r.ID == role.ID {
-			guild.Roles[i] = role
-			return nil
-		}
+	return s.roleAdd(guildID, role)
+}
+
+func (s *State) roleAdd(guildID string, role *Role) error {
+	if s.CopyOnRead {
+		role = roleCopy(role)
 	}
 
-	guild.Roles = append(guild.Roles, role)
-	return nil
+	return s.store.SetRole(guildID, role)
 }
 
 // RoleRemove removes a role from current world state by ID.
@@ -404,22 +493,14 @@ func (s *State) RoleRemove(guildID, roleID string) error {
 		return ErrNilState
 	}
 
-	guild, err := s.Guild(guildID)
-	if err != nil {
-		return err
-	}
-
 	s.Lock()
 	defer s.Unlock()
 
-	for i, r := range guild.Roles {
-		if r.ID == roleID {
-			guild.Roles = append(guild.Roles[:i], guild.Roles[i+1:]...)
-			return nil
-		}
-	}
+	return s.roleRemove(guildID, roleID)
+}
 
-	return ErrStateNotFound
+func (s *State) roleRemove(guildID, roleID string) error {
+	return s.store.DeleteRole(guildID, roleID)
 }
 
 // Role gets a role by ID from a guild.
@@ -428,21 +509,19 @@ func (s *State) Role(guildID, roleID string) (*Role, error) {
 		return nil, ErrNilState
 	}
 
-	guild, err := s.Guild(guildID)
-	if err != nil {
-		return nil, err
-	}
-
 	s.RLock()
 	defer s.RUnlock()
 
-	for _, r := range guild.Roles {
-		if r.ID == roleID {
-			return r, nil
-		}
+	return s.role(guildID, roleID)
+}
+
+func (s *State) role(guildID, roleID string) (*Role, error) {
+	r, err := s.store.Role(guildID, roleID)
+	if err != nil || !s.CopyOnRead {
+		return r, err
 	}
 
-	return nil, ErrStateNotFound
+	return roleCopy(r), nil
 }
 
 // ChannelAdd adds a channel to the current world state, or
@@ -457,33 +536,29 @@ func (s *State) ChannelAdd(channel *Channel) error {
 	s.Lock()
 	defer s.Unlock()
 
+	return s.channelAdd(channel)
+}
+
+func (s *State) channelAdd(channel *Channel) error {
+	if s.CopyOnRead {
+		channel = channelCopy(channel)
+	}
+
 	// If the channel exists, replace it
-	if c, ok := s.channelMap[channel.ID]; ok {
+	if c, err := s.store.Channel(channel.ID); err == nil {
 		if channel.Messages == nil {
 			channel.Messages = c.Messages
 		}
 		if channel.PermissionOverwrites == nil {
 			channel.PermissionOverwrites = c.PermissionOverwrites
 		}
-
-		*c = *channel
-		return nil
-	}
-
-	if channel.Type == ChannelTypeDM || channel.Type == ChannelTypeGroupDM {
-		s.PrivateChannels = append(s.PrivateChannels, channel)
-	} else {
-		guild, ok := s.guildMap[channel.GuildID]
-		if !ok {
-			return ErrStateNotFound
+		// Thread updates leave out the thread member of the current user.
+		if channel.Member == nil && channel.IsThread() {
+			channel.Member = c.Member
 		}
-
-		guild.Channels = append(guild.Channels, channel)
 	}
 
-	s.channelMap[channel.ID] = channel
-
-	return nil
+	return s.store.SetChannel(channel)
 }
 
 // ChannelRemove removes a channel from current world state.
@@ -492,41 +567,28 @@ func (s *State) ChannelRemove(channel *Channel) error {
 		return ErrNilState
 	}
 
-	_, err := s.Channel(channel.ID)
-	if err != nil {
-		return err
-	}
-
-	if channel.Type == ChannelTypeDM || channel.Type == ChannelTypeGroupDM {
-		s.Lock()
-		defer s.Unlock()
+	s.Lock()
+	defer s.Unlock()
 
-		for i, c := range s.PrivateChannels {
-			if c.ID == channel.ID {
-				s.PrivateChannels = append(s.PrivateChannels[:i], s.PrivateChannels[i+1:]...)
-				break
-			}
-		}
-	} else {
-		guild, err := s.Guild(channel.GuildID)
-		if err != nil {
-			return err
-		}
+	return s.channelRemove(channel)
+}
 
-		s.Lock()
-		defer s.Unlock()
+func (s *State) channelRemove(channel *Channel) error {
+	if s.MessageCache != nil {
+		s.MessageCache.RemoveChannel(channel.ID)
+	}
 
-		for i, c := range guild.Channels {
-			if c.ID == channel.ID {
-				guild.Channels = append(guild.Channels[:i], guild.Channels[i+1:]...)
-				break
-			}
+	// The threads of a channel go with it.
+	if !channel.IsThread() && channel.GuildID != "" {
+		err := s.removeThreads(channel.GuildID, func(c *Channel) bool {
+			return c.ParentID == channel.ID
+		})
+		if err != nil && err != ErrStateNotFound {
+			return err
 		}
 	}
 
-	delete(s.channelMap, channel.ID)
-
-	return nil
+	return s.store.DeleteChannel(channel.ID)
 }
 
 // GuildChannel gets a channel by ID from a guild.
@@ -550,11 +612,30 @@ func (s *State) Channel(channelID string) (*Channel, error) {
 	s.RLock()
 	defer s.RUnlock()
 
-	if c, ok := s.channelMap[channelID]; ok {
-		return c, nil
+	return s.channel(channelID)
+}
+
+// channelBefore returns a copy of a channel about to be updated, without
+// its cached messages, which are not part of the update, or nil if it is not
+// cached.  The lock of s must be held.
+func (s *State) channelBefore(channelID string) *Channel {
+	c, err := s.store.Channel(channelID)
+	if err != nil {
+		return nil
 	}
 
-	return nil, ErrStateNotFound
+	before := *c
+	before.Messages = nil
+	return channelCopy(&before)
+}
+
+func (s *State) channel(channelID string) (*Channel, error) {
+	c, err := s.store.Channel(channelID)
+	if err != nil || !s.CopyOnRead {
+		return c, err
+	}
+
+	return channelCopy(c), nil
 }
 
 // Emoji returns an emoji for a guild and emoji id.
@@ -563,21 +644,19 @@ func (s *State) Emoji(guildID, emojiID string) (*Emoji, error) {
 		return nil, ErrNilState
 	}
 
-	guild, err := s.Guild(guildID)
-	if err != nil {
-		return nil, err
-	}
-
 	s.RLock()
 	defer s.RUnlock()
 
-	for _, e := range guild.Emojis {
-		if e.ID == emojiID {
-			return e, nil
-		}
+	return s.emoji(guildID, emojiID)
+}
+
+func (s *State) emoji(guildID, emojiID string) (*Emoji, error) {
+	e, err := s.store.Emoji(guildID, emojiID)
+	if err != nil || !s.CopyOnRead {
+		return e, err
 	}
 
-	return nil, ErrStateNotFound
+	return emojiCopy(e), nil
 }
 
 // EmojiAdd adds an emoji to the current world state.
@@ -586,86 +665,138 @@ func (s *State) EmojiAdd(guildID string, emoji *Emoji) error {
 		return ErrNilState
 	}
 
-	guild, err := s.Guild(guildID)
-	if err != nil {
-		return err
-	}
-
 	s.Lock()
 	defer s.Unlock()
 
-	for i, e := range guild.Emojis {
-		if e.ID == emoji.ID {
-			guild.Emojis[i] = emoji
-			return nil
-		}
+	return s.emojiAdd(guildID, emoji)
+}
+
+func (s *State) emojiAdd(guildID string, emoji *Emoji) error {
+	if s.CopyOnRead {
+		emoji = emojiCopy(emoji)
 	}
 
-	guild.Emojis = append(guild.Emojis, emoji)
-	return nil
+	return s.store.SetEmoji(guildID, emoji)
 }
 
 // EmojisAdd adds multiple emojis to the world state.
 func (s *State) EmojisAdd(guildID string, emojis []*Emoji) error {
+	if s == nil {
+		return ErrNilState
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
 	for _, e := range emojis {
-		if err := s.EmojiAdd(guildID, e); err != nil {
+		if err := s.emojiAdd(guildID, e); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// tracksMessages reports whether the state caches messages.
+func (s *State) tracksMessages() bool {
+	return s.MaxMessageCount != 0 || s.MessageCache != nil
+}
+
+// cachedMessage gets a message from the MessageCache, if set, or the store,
+// without counting a lookup in the statistics of the cache.  The lock of s
+// must be held.
+func (s *State) cachedMessage(channelID, messageID string) (*Message, error) {
+	if s.MessageCache == nil {
+		return s.store.Message(channelID, messageID)
+	}
+
+	if m := s.MessageCache.peek(channelID, messageID); m != nil {
+		return m, nil
+	}
+
+	return nil, ErrStateNotFound
+}
+
+// setMessage adds or replaces a message in the MessageCache, if set, or the
+// store.  The lock of s must be held.
+func (s *State) setMessage(message *Message) error {
+	if s.MessageCache == nil {
+		return s.store.SetMessage(message, s.MaxMessageCount)
+	}
+
+	channel, err := s.store.Channel(message.ChannelID)
+	if err != nil {
+		return err
+	}
+
+	// Messages fetched with the REST API have no guild ID, which the
+	// cache keeps them under.
+	if message.GuildID == "" {
+		message.GuildID = channel.GuildID
+	}
+
+	s.MessageCache.Add(message)
+	return nil
+}
+
+// channelMessages returns the messages of a channel from the MessageCache,
+// if set, or the store.  The lock of s must be held.
+func (s *State) channelMessages(channelID string) ([]*Message, error) {
+	if s.MessageCache == nil {
+		return s.store.Messages(channelID)
+	}
+
+	return s.MessageCache.Messages(channelID), nil
+}
+
 // MessageAdd adds a message to the current world state, or updates it if it exists.
 // If the channel cannot be found, the message is discarded.
-// Messages are kept in state up to s.MaxMessageCount per channel.
+// Messages are kept in state up to s.MaxMessageCount per channel,
+// or as s.MessageCache allows if it is set.
 func (s *State) MessageAdd(message *Message) error {
 	if s == nil {
 		return ErrNilState
 	}
 
-	c, err := s.Channel(message.ChannelID)
-	if err != nil {
-		return err
-	}
-
 	s.Lock()
 	defer s.Unlock()
 
-	// If the message exists, merge in the new message contents.
-	for _, m := range c.Messages {
-		if m.ID == message.ID {
-			if message.Content != "" {
-				m.Content = message.Content
-			}
-			if message.EditedTimestamp != "" {
-				m.EditedTimestamp = message.EditedTimestamp
-			}
-			if message.Mentions != nil {
-				m.Mentions = message.Mentions
-			}
-			if message.Embeds != nil {
-				m.Embeds = message.Embeds
-			}
-			if message.Attachments != nil {
-				m.Attachments = message.Attachments
-			}
-			if message.Timestamp != "" {
-				m.Timestamp = message.Timestamp
-			}
-			if message.Author != nil {
-				m.Author = message.Author
-			}
+	return s.messageAdd(message)
+}
 
-			return nil
-		}
+func (s *State) messageAdd(message *Message) error {
+	if s.CopyOnRead {
+		message = messageCopy(message)
 	}
 
-	c.Messages = append(c.Messages, message)
+	// If the message exists, merge in the new message contents.
+	m, err := s.cachedMessage(message.ChannelID, message.ID)
+	if err != nil {
+		return s.setMessage(message)
+	}
 
-	if len(c.Messages) > s.MaxMessageCount {
-		c.Messages = c.Messages[len(c.Messages)-s.MaxMessageCount:]
+	if message.Content != "" {
+		m.Content = message.Content
 	}
-	return nil
+	if message.EditedTimestamp != "" {
+		m.EditedTimestamp = message.EditedTimestamp
+	}
+	if message.Mentions != nil {
+		m.Mentions = message.Mentions
+	}
+	if message.Embeds != nil {
+		m.Embeds = message.Embeds
+	}
+	if message.Attachments != nil {
+		m.Attachments = message.Attachments
+	}
+	if message.Timestamp != "" {
+		m.Timestamp = message.Timestamp
+	}
+	if message.Author != nil {
+		m.Author = message.Author
+	}
+
+	return s.setMessage(m)
 }
 
 // MessageRemove removes a message from the world state.
@@ -679,53 +810,41 @@ func (s *State) MessageRemove(message *Message) error {
 
 // messageRemoveByID removes a message by channelID and messageID from the world state.
 func (s *State) messageRemoveByID(channelID, messageID string) error {
-	c, err := s.Channel(channelID)
-	if err != nil {
-		return err
-	}
-
 	s.Lock()
 	defer s.Unlock()
 
-	for i, m := range c.Messages {
-		if m.ID == messageID {
-			c.Messages = append(c.Messages[:i], c.Messages[i+1:]...)
-			return nil
+	return s.messageRemove(channelID, messageID)
+}
+
+func (s *State) messageRemove(channelID, messageID string) error {
+	if s.MessageCache != nil {
+		if !s.MessageCache.Remove(channelID, messageID) {
+			return ErrStateNotFound
 		}
+		return nil
 	}
 
-	return ErrStateNotFound
+	return s.store.DeleteMessage(channelID, messageID)
 }
 
+// voiceStateUpdate applies a voice state update.  The lock of s must be
+// held.
 func (s *State) voiceStateUpdate(update *VoiceStateUpdate) error {
-	guild, err := s.Guild(update.GuildID)
-	if err != nil {
-		return err
-	}
-
-	s.Lock()
-	defer s.Unlock()
-
 	// Handle Leaving Channel
 	if update.ChannelID == "" {
-		for i, state := range guild.VoiceStates {
-			if state.UserID == update.UserID {
-				guild.VoiceStates = append(guild.VoiceStates[:i], guild.VoiceStates[i+1:]...)
-				return nil
-			}
-		}
-	} else {
-		for i, state := range guild.VoiceStates {
-			if state.UserID == update.UserID {
-				guild.VoiceStates[i] = update.VoiceState
-				return nil
-			}
+		err := s.store.DeleteVoiceState(update.GuildID, update.UserID)
+		if err == ErrStateNotFound {
+			return nil
 		}
+		return err
+	}
 
-		guild.VoiceStates = append(guild.VoiceStates, update.VoiceState)
+	voiceState := update.VoiceState
+	if s.CopyOnRead {
+		voiceState = voiceStateCopy(voiceState)
 	}
 
-	return nil
+	return s.store.SetVoiceState(update.GuildID, voiceState)
 }
 
 // VoiceState gets a VoiceState by guild and user ID.
@@ -734,18 +853,19 @@ func (s *State) VoiceState(guildID, userID string) (*VoiceState, error) {
 		return nil, ErrNilState
 	}
 
-	guild, err := s.Guild(guildID)
-	if err != nil {
-		return nil, err
-	}
+	s.RLock()
+	defer s.RUnlock()
 
-	for _, state := range guild.VoiceStates {
-		if state.UserID == userID {
-			return state, nil
-		}
+	return s.voiceState(guildID, userID)
+}
+
+func (s *State) voiceState(guildID, userID string) (*VoiceState, error) {
+	v, err := s.store.VoiceState(guildID, userID)
+	if err != nil || !s.CopyOnRead {
+		return v, err
 	}
 
-	return nil, ErrStateNotFound
+	return voiceStateCopy(v), nil
 }
 
 // Message gets a message by channel and message ID.
@@ -754,21 +874,27 @@ func (s *State) Message(channelID, messageID string) (*Message, error) {
 		return nil, ErrNilState
 	}
 
-	c, err := s.Channel(channelID)
-	if err != nil {
-		return nil, err
-	}
-
 	s.RLock()
 	defer s.RUnlock()
 
-	for _, m := range c.Messages {
-		if m.ID == messageID {
-			return m, nil
+	return s.message(channelID, messageID)
+}
+
+func (s *State) message(channelID, messageID string) (m *Message, err error) {
+	if s.MessageCache != nil {
+		var ok bool
+		if m, ok = s.MessageCache.Get(channelID, messageID); !ok {
+			return nil, ErrStateNotFound
 		}
+	} else if m, err = s.store.Message(channelID, messageID); err != nil {
+		return nil, err
 	}
 
-	return nil, ErrStateNotFound
+	if s.CopyOnRead {
+		m = messageCopy(m)
+	}
+
+	return m, nil
 }
 
 // OnReady takes a Ready event and updates all internal state.
@@ -795,18 +921,53 @@ func (s *State) onReady(se *Session, r *Ready) (err error) {
 	}
 
 	s.Ready = *r
+	s.Guilds = []*Guild{}
+	s.PrivateChannels = []*Channel{}
+	s.membersChanged("")
+
+	if m, ok := s.store.(*MemoryStore); ok {
+		m.reset()
+	}
+
+	// A store may hold guilds from before this session; drop those the
+	// user is no longer in.
+	listed := make(map[string]bool, len(r.Guilds))
+	for _, g := range r.Guilds {
+		listed[g.ID] = true
+	}
+	guilds, err := s.store.Guilds()
+	if err != nil {
+		return err
+	}
+	for _, g := range guilds {
+		if !listed[g.ID] {
+			if s.PresenceCache != nil {
+				s.PresenceCache.RemoveGuild(g.ID)
+			}
+			if err = s.store.DeleteGuild(g.ID); err != nil {
+				return err
+			}
+		}
+	}
 
-	for _, g := range s.Guilds {
-		s.guildMap[g.ID] = g
-		s.createMemberMap(g)
+	for _, g := range r.Guilds {
+		if g.Unavailable {
+			// Keep what the store holds until the guild is available.
+			if cached, err := s.store.Guild(g.ID); err == nil {
+				cached.Unavailable = true
+				g = cached
+			}
+		}
 
-		for _, c := range g.Channels {
-			s.channelMap[c.ID] = c
+		if err = s.guildAdd(g); err != nil {
+			return err
 		}
 	}
 
-	for _, c := range s.PrivateChannels {
-		s.channelMap[c.ID] = c
+	for _, c := range r.PrivateChannels {
+		if err = s.store.SetChannel(c); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -836,11 +997,9 @@ func (s *State) OnInterface(se *Session, i interface{}) (err error) {
 		err = s.GuildRemove(t.Guild)
 	case *GuildMemberAdd:
 		// Updates the MemberCount of the guild.
-		guild, err := s.Guild(t.Member.GuildID)
-		if err != nil {
+		if err = s.guildMemberCountAdd(t.Member.GuildID, 1); err != nil {
 			return err
 		}
-		guild.MemberCount++
 
 		// Caches member if tracking is enabled.
 		if s.TrackMembers {
@@ -848,22 +1007,36 @@ func (s *State) OnInterface(se *Session, i interface{}) (err error) {
 		}
 	case *GuildMemberUpdate:
 		if s.TrackMembers {
-			err = s.MemberAdd(t.Member)
+			s.Lock()
+			if old, err := s.store.Member(t.GuildID, t.User.ID); err == nil {
+				t.BeforeUpdate = memberCopy(old)
+			}
+			err = s.memberAdd(t.Member)
+			s.Unlock()
 		}
 	case *GuildMemberRemove:
 		// Updates the MemberCount of the guild.
-		guild, err := s.Guild(t.Member.GuildID)
-		if err != nil {
+		if err = s.guildMemberCountAdd(t.Member.GuildID, -1); err != nil {
 			return err
 		}
-		guild.MemberCount--
 
 		// Removes member from the cache if tracking is enabled.
 		if s.TrackMembers {
-			err = s.MemberRemove(t.Member)
+			s.Lock()
+			if old, err := s.store.Member(t.GuildID, t.User.ID); err == nil {
+				t.BeforeDelete = memberCopy(old)
+			}
+			err = s.memberRemove(t.Member)
+			s.Unlock()
 		}
 	case *GuildMembersChunk:
 		if s.TrackMembers {
+			// Building the index again is cheaper than inserting a
+			// chunk into it member by member.
+			s.Lock()
+			s.membersChanged(t.GuildID)
+			s.Unlock()
+
 			for i := range t.Members {
 				t.Members[i].GuildID = t.GuildID
 				err = s.MemberAdd(t.Members[i])
@@ -881,7 +1054,12 @@ func (s *State) OnInterface(se *Session, i interface{}) (err error) {
 		}
 	case *GuildRoleUpdate:
 		if s.TrackRoles {
-			err = s.RoleAdd(t.GuildID, t.Role)
+			s.Lock()
+			if old, err := s.store.Role(t.GuildID, t.Role.ID); err == nil {
+				t.BeforeUpdate = roleCopy(old)
+			}
+			err = s.roleAdd(t.GuildID, t.Role)
+			s.Unlock()
 		}
 	case *GuildRoleDelete:
 		if s.TrackRoles {
@@ -897,54 +1075,78 @@ func (s *State) OnInterface(se *Session, i interface{}) (err error) {
 		}
 	case *ChannelUpdate:
 		if s.TrackChannels {
-			err = s.ChannelAdd(t.Channel)
+			s.Lock()
+			t.BeforeUpdate = s.channelBefore(t.ID)
+			err = s.channelAdd(t.Channel)
+			s.Unlock()
 		}
 	case *ChannelDelete:
 		if s.TrackChannels {
 			err = s.ChannelRemove(t.Channel)
 		}
+	case *ThreadCreate:
+		if s.TrackChannels {
+			err = s.ChannelAdd(t.Channel)
+		}
+	case *ThreadUpdate:
+		if s.TrackChannels {
+			s.Lock()
+			t.BeforeUpdate = s.channelBefore(t.ID)
+			err = s.channelAdd(t.Channel)
+			s.Unlock()
+		}
+	case *ThreadDelete:
+		if s.TrackChannels {
+			err = s.ChannelRemove(t.Channel)
+		}
+	case *ThreadListSync:
+		if s.TrackChannels {
+			err = s.threadListSync(t)
+		}
+	case *ThreadMemberUpdate:
+		if s.TrackChannels {
+			err = s.threadMemberUpdate(t)
+		}
+	case *ThreadMembersUpdate:
+		if s.TrackChannels {
+			err = s.threadMembersUpdate(t)
+		}
 	case *MessageCreate:
-		if s.MaxMessageCount != 0 {
+		if s.tracksMessages() {
 			err = s.MessageAdd(t.Message)
 		}
 	case *MessageUpdate:
-		if s.MaxMessageCount != 0 {
-			var old *Message
-			old, err = s.Message(t.ChannelID, t.ID)
-			if err == nil {
-				oldCopy := *old
-				t.BeforeUpdate = &oldCopy
+		if s.tracksMessages() {
+			s.Lock()
+			if old, err := s.cachedMessage(t.ChannelID, t.ID); err == nil {
+				t.BeforeUpdate = messageCopy(old)
 			}
-
-			err = s.MessageAdd(t.Message)
+			err = s.messageAdd(t.Message)
+			s.Unlock()
 		}
 	case *MessageDelete:
-		if s.MaxMessageCount != 0 {
-			var old *Message
-			old, err = s.Message(t.ChannelID, t.ID)
-			if err == nil {
-				oldCopy := *old
-				t.BeforeDelete = &oldCopy
+		if s.tracksMessages() {
+			s.Lock()
+			if old, err := s.cachedMessage(t.ChannelID, t.ID); err == nil {
+				t.BeforeDelete = messageCopy(old)
 			}
-
-			err = s.MessageRemove(t.Message)
+			err = s.messageRemove(t.ChannelID, t.ID)
+			s.Unlock()
 		}
 	case *MessageDeleteBulk:
-		if s.MaxMessageCount != 0 {
+		if s.tracksMessages() {
 			for _, mID := range t.Messages {
 				s.messageRemoveByID(t.ChannelID, mID)
 			}
 		}
 	case *VoiceStateUpdate:
 		if s.TrackVoice {
-			var old *VoiceState
-			old, err = s.VoiceState(t.GuildID, t.UserID)
-			if err == nil {
-				oldCopy := *old
-				t.BeforeUpdate = &oldCopy
+			s.Lock()
+			if old, err := s.store.VoiceState(t.GuildID, t.UserID); err == nil {
+				t.BeforeUpdate = voiceStateCopy(old)
 			}
-
 			err = s.voiceStateUpdate(t)
+			s.Unlock()
 		}
 	case *PresenceUpdate:
 		if s.TrackPresences {
@@ -986,17 +1188,20 @@ func (s *State) UserChannelPermissions(userID, channelID string) (apermissions i
 		return 0, ErrNilState
 	}
 
-	channel, err := s.Channel(channelID)
+	s.RLock()
+	defer s.RUnlock()
+
+	channel, err := s.store.Channel(channelID)
 	if err != nil {
 		return
 	}
 
-	guild, err := s.Guild(channel.GuildID)
+	guild, err := s.store.Guild(channel.GuildID)
 	if err != nil {
 		return
 	}
 
-	member, err := s.Member(guild.ID, userID)
+	member, err := s.store.Member(guild.ID, userID)
 	if err != nil {
 		return
 	}
@@ -1015,12 +1220,15 @@ func (s *State) MessagePermissions(message *Message) (apermissions int64, err er
 		return 0, ErrMessageIncompletePermissions
 	}
 
-	channel, err := s.Channel(message.ChannelID)
+	s.RLock()
+	defer s.RUnlock()
+
+	channel, err := s.store.Channel(message.ChannelID)
 	if err != nil {
 		return
 	}
 
-	guild, err := s.Guild(channel.GuildID)
+	guild, err := s.store.Guild(channel.GuildID)
 	if err != nil {
 		return
 	}
@@ -1038,17 +1246,20 @@ func (s *State) UserColor(userID, channelID string) int {
 		return 0
 	}
 
-	channel, err := s.Channel(channelID)
+	s.RLock()
+	defer s.RUnlock()
+
+	channel, err := s.store.Channel(channelID)
 	if err != nil {
 		return 0
 	}
 
-	guild, err := s.Guild(channel.GuildID)
+	guild, err := s.store.Guild(channel.GuildID)
 	if err != nil {
 		return 0
 	}
 
-	member, err := s.Member(guild.ID, userID)
+	member, err := s.store.Member(guild.ID, userID)
 	if err != nil {
 		return 0
 	}
@@ -1067,12 +1278,15 @@ func (s *State) MessageColor(message *Message) int {
 		return 0
 	}
 
-	channel, err := s.Channel(message.ChannelID)
+	s.RLock()
+	defer s.RUnlock()
+
+	channel, err := s.store.Channel(message.ChannelID)
 	if err != nil {
 		return 0
 	}
 
-	guild, err := s.Guild(channel.GuildID)
+	guild, err := s.store.Guild(channel.GuildID)
 	if err != nil {
 		return 0
 	}
@@ -1081,7 +1295,8 @@ func (s *State) MessageColor(message *Message) int {
 }
 
 func firstRoleColorColor(guild *Guild, memberRoles []string) int {
-	roles := Roles(guild.Roles)
+	// Sort a copy, as the roles may be read concurrently.
+	roles := append(Roles(nil), guild.Roles...)
 	sort.Sort(roles)
 
 	for _, role := range roles {
@@ -0,0 +1,78 @@
+// Discord bindings for the Hrngh bot.
+// Available at https://github.com/abeiron/hrngh
+
+// Copyright 2020-2021, Undying Memory <abeiron@outlook.com>.  All rights reserved.
+// Use of this source code is governed by the Microsoft Public License
+// that can be found in the LICENSE file.
+
+// This file contains tests of how the State applies gateway events.
+
+package discord
+
+import "testing"
+
+// stateSession returns a session whose state holds a guild with a channel.
+func stateSession(t *testing.T) (*Session, *State) {
+	s := NewState()
+	se := &Session{StateEnabled: true, State: s}
+
+	guild := &Guild{ID: "g", Channels: []*Channel{{ID: "c", GuildID: "g", Name: "general"}}}
+	if err := s.OnInterface(se, &GuildCreate{Guild: guild}); err != nil {
+		t.Fatal(err)
+	}
+
+	return se, s
+}
+
+// TestBeforeUpdate checks that update events carry the values they
+// replaced, which later changes of the state leave alone.
+func TestBeforeUpdate(t *testing.T) {
+	se, s := stateSession(t)
+
+	user := &User{ID: "u", Username: "old"}
+	if err := s.OnInterface(se, &GuildMemberAdd{Member: &Member{GuildID: "g", User: user, Nick: "before"}}); err != nil {
+		t.Fatal(err)
+	}
+	update := &GuildMemberUpdate{Member: &Member{GuildID: "g", User: &User{ID: "u", Username: "new"}, Nick: "after"}}
+	if err := s.OnInterface(se, update); err != nil {
+		t.Fatal(err)
+	}
+	if b := update.BeforeUpdate; b == nil || b.Nick != "before" || b.User.Username != "old" {
+		t.Fatalf("got member before update %+v", b)
+	}
+	user.Username = "changed"
+	if update.BeforeUpdate.User == user {
+		t.Error("member before update shares the cached user")
+	}
+
+	channelUpdate := &ChannelUpdate{Channel: &Channel{ID: "c", GuildID: "g", Name: "renamed"}}
+	if err := s.OnInterface(se, channelUpdate); err != nil {
+		t.Fatal(err)
+	}
+	if b := channelUpdate.BeforeUpdate; b == nil || b.Name != "general" {
+		t.Fatalf("got channel before update %+v", b)
+	}
+
+	voice := &VoiceStateUpdate{VoiceState: &VoiceState{GuildID: "g", UserID: "u", ChannelID: "c"}}
+	if err := s.OnInterface(se, voice); err != nil {
+		t.Fatal(err)
+	}
+	if voice.BeforeUpdate != nil {
+		t.Errorf("got voice state before joining %+v", voice.BeforeUpdate)
+	}
+	voice = &VoiceStateUpdate{VoiceState: &VoiceState{GuildID: "g", UserID: "u", ChannelID: "c", SelfMute: true}}
+	if err := s.OnInterface(se, voice); err != nil {
+		t.Fatal(err)
+	}
+	if b := voice.BeforeUpdate; b == nil || b.SelfMute || b.ChannelID != "c" {
+		t.Errorf("got voice state before update %+v", b)
+	}
+
+	remove := &GuildMemberRemove{Member: &Member{GuildID: "g", User: &User{ID: "u"}}}
+	if err := s.OnInterface(se, remove); err != nil {
+		t.Fatal(err)
+	}
+	if b := remove.BeforeDelete; b == nil || b.Nick != "after" {
+		t.Errorf("got member before delete %+v", b)
+	}
+}
@@ -0,0 +1,334 @@
+// Discord bindings for the Hrngh bot.
+// Available at https://github.com/abeiron/hrngh
+
+// Copyright 2020-2021, Undying Memory <abeiron@outlook.com>.  All rights reserved.
+// Use of this source code is governed by the Microsoft Public License
+// that can be found in the LICENSE file.
+
+// This file contains the copies the State makes of what it caches, when
+// State.CopyOnRead is set, and StateTx, for batches of changes.
+
+package discord
+
+// The copies below copy everything the state changes in place: the cached
+// values themselves, the slices holding them and the users they point to.
+// What the state only ever replaces, such as the embeds of a message or the
+// activities of a presence, is shared, and must be treated as read-only.
+
+func userCopy(u *User) *User {
+	if u == nil {
+		return nil
+	}
+
+	c := *u
+	return &c
+}
+
+func usersCopy(users []*User) []*User {
+	if users == nil {
+		return nil
+	}
+
+	c := make([]*User, len(users))
+	for i, u := range users {
+		c[i] = userCopy(u)
+	}
+
+	return c
+}
+
+func stringsCopy(s []string) []string {
+	if s == nil {
+		return nil
+	}
+
+	return append([]string{}, s...)
+}
+
+// memberCopy returns a copy of a cached member, with a copy of its user,
+// whose fields are updated in place by presence updates.
+func memberCopy(m *Member) *Member {
+	c := *m
+	c.User = userCopy(m.User)
+	c.Roles = stringsCopy(m.Roles)
+
+	return &c
+}
+
+func roleCopy(r *Role) *Role {
+	c := *r
+	return &c
+}
+
+func emojiCopy(e *Emoji) *Emoji {
+	c := *e
+	c.Roles = stringsCopy(e.Roles)
+	c.User = userCopy(e.User)
+
+	return &c
+}
+
+func channelCopy(ch *Channel) *Channel {
+	c := *ch
+	c.Recipients = usersCopy(ch.Recipients)
+
+	if ch.PermissionOverwrites != nil {
+		c.PermissionOverwrites = make([]*PermissionOverwrite, len(ch.PermissionOverwrites))
+		for i, o := range ch.PermissionOverwrites {
+			overwrite := *o
+			c.PermissionOverwrites[i] = &overwrite
+		}
+	}
+
+	if ch.Messages != nil {
+		c.Messages = make([]*Message, len(ch.Messages))
+		for i, m := range ch.Messages {
+			c.Messages[i] = messageCopy(m)
+		}
+	}
+
+	return &c
+}
+
+func messageCopy(m *Message) *Message {
+	c := *m
+	c.Author = userCopy(m.Author)
+	c.Mentions = usersCopy(m.Mentions)
+	c.MentionRoles = stringsCopy(m.MentionRoles)
+	if m.Member != nil {
+		c.Member = memberCopy(m.Member)
+	}
+
+	return &c
+}
+
+func presenceCopy(p *Presence) *Presence {
+	c := *p
+	c.User = userCopy(p.User)
+
+	return &c
+}
+
+func voiceStateCopy(v *VoiceState) *VoiceState {
+	c := *v
+	return &c
+}
+
+// guildCopy returns a copy of a guild and of all it holds, its members
+// included.
+func guildCopy(g *Guild) *Guild {
+	c := *g
+	c.Features = stringsCopy(g.Features)
+
+	if g.Roles != nil {
+		c.Roles = make([]*Role, len(g.Roles))
+		for i, r := range g.Roles {
+			c.Roles[i] = roleCopy(r)
+		}
+	}
+	if g.Emojis != nil {
+		c.Emojis = make([]*Emoji, len(g.Emojis))
+		for i, e := range g.Emojis {
+			c.Emojis[i] = emojiCopy(e)
+		}
+	}
+	if g.Members != nil {
+		c.Members = make([]*Member, len(g.Members))
+		for i, m := range g.Members {
+			c.Members[i] = memberCopy(m)
+		}
+	}
+	if g.Presences != nil {
+		c.Presences = make([]*Presence, len(g.Presences))
+		for i, p := range g.Presences {
+			c.Presences[i] = presenceCopy(p)
+		}
+	}
+	if g.Channels != nil {
+		c.Channels = make([]*Channel, len(g.Channels))
+		for i, ch := range g.Channels {
+			c.Channels[i] = channelCopy(ch)
+		}
+	}
+	if g.Threads != nil {
+		c.Threads = make([]*Channel, len(g.Threads))
+		for i, ch := range g.Threads {
+			c.Threads[i] = channelCopy(ch)
+		}
+	}
+	if g.VoiceStates != nil {
+		c.VoiceStates = make([]*VoiceState, len(g.VoiceStates))
+		for i, v := range g.VoiceStates {
+			c.VoiceStates[i] = voiceStateCopy(v)
+		}
+	}
+
+	return &c
+}
+
+// copyMembers replaces members with copies if s.CopyOnRead is set, taking
+// the read lock of s a batch at a time.
+func (s *State) copyMembers(members []*Member) {
+	if s.CopyOnRead {
+		s.scan(len(members), func(i int) {
+			members[i] = memberCopy(members[i])
+		})
+	}
+}
+
+// copyChannels replaces channels with copies if s.CopyOnRead is set.  The
+// lock of s must be held.
+func (s *State) copyChannels(channels []*Channel) {
+	if s.CopyOnRead {
+		for i, c := range channels {
+			channels[i] = channelCopy(c)
+		}
+	}
+}
+
+// copyRoles replaces roles with copies if s.CopyOnRead is set.  The lock of
+// s must be held.
+func (s *State) copyRoles(roles []*Role) {
+	if s.CopyOnRead {
+		for i, r := range roles {
+			roles[i] = roleCopy(r)
+		}
+	}
+}
+
+// A StateTx makes a batch of changes to a State, which holds its lock
+// throughout; see State.Update.  Its methods are those of the State, and
+// copy as they do when CopyOnRead is set.  A StateTx must not be used after
+// the function it was given returns.
+type StateTx struct {
+	s *State
+}
+
+// Update calls f with the state locked, so that the changes f makes through
+// tx are seen by readers all at once, and events are not handled in the
+// midst of them.  It returns the error of f.  Changes made before f returns
+// an error are kept.  f must not call the methods of the state itself.
+//
+//	err := s.State.Update(func(tx *discord.StateTx) error {
+//		for _, m := range members {
+//			if err := tx.MemberAdd(m); err != nil {
+//				return err
+//			}
+//		}
+//		return nil
+//	})
+func (s *State) Update(f func(tx *StateTx) error) error {
+	if s == nil {
+		return ErrNilState
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	return f(&StateTx{s})
+}
+
+// GuildAdd adds or updates a guild, as State.GuildAdd.
+func (tx *StateTx) GuildAdd(guild *Guild) error {
+	return tx.s.guildAdd(guild)
+}
+
+// GuildRemove removes a guild, as State.GuildRemove.
+func (tx *StateTx) GuildRemove(guild *Guild) error {
+	return tx.s.guildRemove(guild)
+}
+
+// Guild gets a guild by ID, as State.Guild.
+func (tx *StateTx) Guild(guildID string) (*Guild, error) {
+	return tx.s.guild(guildID)
+}
+
+// PresenceAdd adds or updates a presence, as State.PresenceAdd.
+func (tx *StateTx) PresenceAdd(guildID string, presence *Presence) error {
+	return tx.s.presenceAdd(guildID, presence)
+}
+
+// PresenceRemove removes a presence, as State.PresenceRemove.
+func (tx *StateTx) PresenceRemove(guildID string, presence *Presence) error {
+	return tx.s.presenceRemove(guildID, presence)
+}
+
+// Presence gets a presence, as State.Presence.
+func (tx *StateTx) Presence(guildID, userID string) (*Presence, error) {
+	return tx.s.presence(guildID, userID)
+}
+
+// MemberAdd adds or updates a member, as State.MemberAdd.
+func (tx *StateTx) MemberAdd(member *Member) error {
+	return tx.s.memberAdd(member)
+}
+
+// MemberRemove removes a member, as State.MemberRemove.
+func (tx *StateTx) MemberRemove(member *Member) error {
+	return tx.s.memberRemove(member)
+}
+
+// Member gets a member, as State.Member.
+func (tx *StateTx) Member(guildID, userID string) (*Member, error) {
+	return tx.s.member(guildID, userID)
+}
+
+// RoleAdd adds or updates a role, as State.RoleAdd.
+func (tx *StateTx) RoleAdd(guildID string, role *Role) error {
+	return tx.s.roleAdd(guildID, role)
+}
+
+// RoleRemove removes a role, as State.RoleRemove.
+func (tx *StateTx) RoleRemove(guildID, roleID string) error {
+	return tx.s.roleRemove(guildID, roleID)
+}
+
+// Role gets a role, as State.Role.
+func (tx *StateTx) Role(guildID, roleID string) (*Role, error) {
+	return tx.s.role(guildID, roleID)
+}
+
+// ChannelAdd adds or updates a channel, as State.ChannelAdd.
+func (tx *StateTx) ChannelAdd(channel *Channel) error {
+	return tx.s.channelAdd(channel)
+}
+
+// ChannelRemove removes a channel, as State.ChannelRemove.
+func (tx *StateTx) ChannelRemove(channel *Channel) error {
+	return tx.s.channelRemove(channel)
+}
+
+// Channel gets a channel, as State.Channel.
+func (tx *StateTx) Channel(channelID string) (*Channel, error) {
+	return tx.s.channel(channelID)
+}
+
+// EmojiAdd adds or updates an emoji, as State.EmojiAdd.
+func (tx *StateTx) EmojiAdd(guildID string, emoji *Emoji) error {
+	return tx.s.emojiAdd(guildID, emoji)
+}
+
+// Emoji gets an emoji, as State.Emoji.
+func (tx *StateTx) Emoji(guildID, emojiID string) (*Emoji, error) {
+	return tx.s.emoji(guildID, emojiID)
+}
+
+// MessageAdd adds or updates a message, as State.MessageAdd.
+func (tx *StateTx) MessageAdd(message *Message) error {
+	return tx.s.messageAdd(message)
+}
+
+// MessageRemove removes a message, as State.MessageRemove.
+func (tx *StateTx) MessageRemove(message *Message) error {
+	return tx.s.messageRemove(message.ChannelID, message.ID)
+}
+
+// Message gets a message, as State.Message.
+func (tx *StateTx) Message(channelID, messageID string) (*Message, error) {
+	return tx.s.message(channelID, messageID)
+}
+
+// VoiceState gets a voice state, as State.VoiceState.
+func (tx *StateTx) VoiceState(guildID, userID string) (*VoiceState, error) {
+	return tx.s.voiceState(guildID, userID)
+}
@@ -0,0 +1,154 @@
+// Discord bindings for the Hrngh bot.
+// Available at https://github.com/abeiron/hrngh
+
+// Copyright 2020-2021, Undying Memory <abeiron@outlook.com>.  All rights reserved.
+// Use of this source code is governed by the Microsoft Public License
+// that can be found in the LICENSE file.
+
+// This file contains tests of State.CopyOnRead and State.Update.
+
+package discord
+
+import (
+	"errors"
+	"testing"
+)
+
+// copySession returns a session whose state, copying on read or not, holds
+// a guild with a channel, a role and a member.  It returns the guild it was
+// given.
+func copySession(t *testing.T, copyOnRead bool) (*Session, *State, *Guild) {
+	s := NewState()
+	s.CopyOnRead = copyOnRead
+	s.TrackPresences = true
+	se := &Session{StateEnabled: true, State: s}
+
+	guild := &Guild{
+		ID:       "g",
+		Name:     "guild",
+		Channels: []*Channel{{ID: "c", GuildID: "g", Name: "general"}},
+		Roles:    []*Role{{ID: "r", Name: "role"}},
+		Members:  []*Member{{GuildID: "g", User: &User{ID: "u", Username: "user"}, Nick: "nick", Roles: []string{"r"}}},
+	}
+	if err := s.OnInterface(se, &GuildCreate{Guild: guild}); err != nil {
+		t.Fatal(err)
+	}
+
+	return se, s, guild
+}
+
+// TestCopyOnRead checks that what the state is given and what it returns
+// are the caller's, unlike without CopyOnRead.
+func TestCopyOnRead(t *testing.T) {
+	for _, copyOnRead := range []bool{true, false} {
+		se, s, given := copySession(t, copyOnRead)
+
+		// Change what the state was given.
+		given.Name = "given"
+		given.Members[0].Nick = "given"
+
+		g, err := s.Guild("g")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if kept := g.Name == "guild" && g.Members[0].Nick == "nick"; kept != copyOnRead {
+			t.Errorf("CopyOnRead %v: got guild %q and nick %q after changing the guild given", copyOnRead, g.Name, g.Members[0].Nick)
+		}
+
+		// Change what the state returned.
+		g.Name = "returned"
+		g.Channels[0].Name = "returned"
+		g.Roles[0].Name = "returned"
+		m, err := s.Member("g", "u")
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.Roles[0] = "returned"
+
+		c, err := s.Channel("c")
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := s.Role("g", "r")
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err = s.Member("g", "u")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if kept := c.Name == "general" && r.Name == "role" && m.Roles[0] == "r"; kept != copyOnRead {
+			t.Errorf("CopyOnRead %v: got channel %q, role %q and member roles %v after changing what was returned",
+				copyOnRead, c.Name, r.Name, m.Roles)
+		}
+
+		// A presence update changes the user of the member in place.
+		update := &PresenceUpdate{GuildID: "g", Presence: Presence{User: &User{ID: "u", Username: "renamed"}, Status: StatusOnline}}
+		if err = s.OnInterface(se, update); err != nil {
+			t.Fatal(err)
+		}
+		if kept := m.User.Username == "user"; kept != copyOnRead {
+			t.Errorf("CopyOnRead %v: got username %q in a member returned before a presence update", copyOnRead, m.User.Username)
+		}
+		if m, err = s.Member("g", "u"); err != nil || m.User.Username != "renamed" {
+			t.Errorf("CopyOnRead %v: got member %+v, %v after a presence update", copyOnRead, m, err)
+		}
+	}
+}
+
+// TestCopyOnReadEvents checks that the state leaves alone the values of the
+// events it has handled.
+func TestCopyOnReadEvents(t *testing.T) {
+	se, s, _ := copySession(t, true)
+
+	add := &GuildMemberAdd{Member: &Member{GuildID: "g", User: &User{ID: "v", Username: "first"}}}
+	if err := s.OnInterface(se, add); err != nil {
+		t.Fatal(err)
+	}
+	update := &PresenceUpdate{GuildID: "g", Presence: Presence{User: &User{ID: "v", Username: "second"}, Status: StatusOnline}}
+	if err := s.OnInterface(se, update); err != nil {
+		t.Fatal(err)
+	}
+
+	if name := add.Member.User.Username; name != "first" {
+		t.Errorf("got username %q in the handled event, want first", name)
+	}
+}
+
+func TestStateUpdate(t *testing.T) {
+	_, s, _ := copySession(t, false)
+
+	err := s.Update(func(tx *StateTx) error {
+		if err := tx.MemberAdd(&Member{GuildID: "g", User: &User{ID: "v"}}); err != nil {
+			return err
+		}
+		if _, err := tx.Member("g", "v"); err != nil {
+			return err
+		}
+		return tx.ChannelAdd(&Channel{ID: "d", GuildID: "g", Name: "other"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Member("g", "v"); err != nil {
+		t.Errorf("member added in the batch: %v", err)
+	}
+	if _, err = s.Channel("d"); err != nil {
+		t.Errorf("channel added in the batch: %v", err)
+	}
+
+	// Changes made before an error are kept.
+	errBatch := errors.New("batch failed")
+	err = s.Update(func(tx *StateTx) error {
+		if err := tx.MemberRemove(&Member{GuildID: "g", User: &User{ID: "v"}}); err != nil {
+			return err
+		}
+		return errBatch
+	})
+	if err != errBatch {
+		t.Errorf("got error %v, want %v", err, errBatch)
+	}
+	if _, err = s.Member("g", "v"); err != ErrStateNotFound {
+		t.Errorf("member removed before the error: got error %v, want %v", err, ErrStateNotFound)
+	}
+}
@@ -0,0 +1,935 @@
+// Discord bindings for the Hrngh bot.
+// Available at https://github.com/abeiron/hrngh
+
+// Copyright 2020-2021, Undying Memory <abeiron@outlook.com>.  All rights reserved.
+// Use of this source code is governed by the Microsoft Public License
+// that can be found in the LICENSE file.
+
+// This file contains queries over the State, finding members, channels and
+// roles by predicate or by name, in the order the Discord client lists them.
+
+package discord
+
+import (
+	"sort"
+	"strings"
+)
+
+// queryBatch is how many entities a scan reads before it releases the lock
+// of the state, so that long scans do not hold up its updates.
+const queryBatch = 256
+
+// scan calls f for each i in [0, n), holding the read lock of the state a
+// batch at a time.
+func (s *State) scan(n int, f func(i int)) {
+	for start := 0; start < n; start += queryBatch {
+		end := start + queryBatch
+		if end > n {
+			end = n
+		}
+
+		s.RLock()
+		for i := start; i < end; i++ {
+			f(i)
+		}
+		s.RUnlock()
+	}
+}
+
+// A nameMatch ranks how well a name matches a query; lower is better.
+type nameMatch int
+
+const (
+	matchExact nameMatch = iota
+	matchPrefix
+	matchContains
+	matchFuzzy
+	matchNone nameMatch = -1
+)
+
+// matchName matches a lowercase name against a lowercase query: exactly, as
+// a prefix, as a substring, or fuzzily, within an edit distance of about a
+// third of the length of the query.  Fuzzy matches rank by their distance.
+func matchName(name, query string) nameMatch {
+	switch {
+	case name == query:
+		return matchExact
+	case strings.HasPrefix(name, query):
+		return matchPrefix
+	case strings.Contains(name, query):
+		return matchContains
+	}
+
+	// Short queries are too short to be mistyped.
+	q := []rune(query)
+	if len(q) < 3 {
+		return matchNone
+	}
+
+	max := (len(q) + 1) / 3
+	if d := editDistance([]rune(name), q, max); d <= max {
+		return matchFuzzy + nameMatch(d)
+	}
+
+	return matchNone
+}
+
+// editDistance returns the Levenshtein distance between a and b, or max+1
+// once it is known to be greater than max.
+func editDistance(a, b []rune, max int) int {
+	if d := len(a) - len(b); d > max || -d > max {
+		return max + 1
+	}
+
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		least := cur[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if cur[j] < least {
+				least = cur[j]
+			}
+		}
+		if least > max {
+			return max + 1
+		}
+		prev, cur = cur, prev
+	}
+
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// A memberEntry holds the names of a member, lowercased, as they were when
+// the index was built.
+type memberEntry struct {
+	member   *Member
+	userID   string
+	name     string // the nickname, or else the username
+	username string
+	nick     string
+	discrim  string
+}
+
+func newMemberEntry(m *Member) memberEntry {
+	e := memberEntry{member: m, nick: strings.ToLower(m.Nick)}
+	if m.User != nil {
+		e.userID = m.User.ID
+		e.username = strings.ToLower(m.User.Username)
+		e.discrim = m.User.Discriminator
+	}
+	e.name = e.nick
+	if e.name == "" {
+		e.name = e.username
+	}
+	return e
+}
+
+// lessEntry reports whether a is listed before b: by name, then by ID.
+func lessEntry(a, b *memberEntry) bool {
+	if a.name != b.name {
+		return a.name < b.name
+	}
+	return lessID(a.userID, b.userID)
+}
+
+// A memberIndex holds the members of a guild sorted by name, as the
+// Discord client lists them, and by username, for prefix searches.  It is
+// updated as members change, with the lock of the state held, which must
+// be read-locked while it is read.
+type memberIndex struct {
+	byName     []memberEntry
+	byUsername []int             // indices into byName
+	names      map[string]string // the name of each member by user ID
+}
+
+// find returns the position in byName of the member with a user ID, or -1.
+func (idx *memberIndex) find(userID string) int {
+	name, ok := idx.names[userID]
+	if !ok {
+		return -1
+	}
+
+	key := memberEntry{name: name, userID: userID}
+	i := sort.Search(len(idx.byName), func(i int) bool {
+		return !lessEntry(&idx.byName[i], &key)
+	})
+	if i == len(idx.byName) || idx.byName[i].userID != userID {
+		return -1
+	}
+
+	return i
+}
+
+// remove removes the entry at position i of byName.
+func (idx *memberIndex) remove(i int) {
+	delete(idx.names, idx.byName[i].userID)
+	idx.byName = append(idx.byName[:i], idx.byName[i+1:]...)
+
+	n := 0
+	for _, j := range idx.byUsername {
+		if j == i {
+			continue
+		}
+		if j > i {
+			j--
+		}
+		idx.byUsername[n] = j
+		n++
+	}
+	idx.byUsername = idx.byUsername[:n]
+}
+
+// insert inserts an entry where it sorts.
+func (idx *memberIndex) insert(e memberEntry) {
+	i := sort.Search(len(idx.byName), func(i int) bool {
+		return !lessEntry(&idx.byName[i], &e)
+	})
+	idx.byName = append(idx.byName, memberEntry{})
+	copy(idx.byName[i+1:], idx.byName[i:])
+	idx.byName[i] = e
+	idx.names[e.userID] = e.name
+
+	for k, j := range idx.byUsername {
+		if j >= i {
+			idx.byUsername[k] = j + 1
+		}
+	}
+
+	// Equal usernames are in the order of byName.
+	k := sort.Search(len(idx.byUsername), func(k int) bool {
+		o := &idx.byName[idx.byUsername[k]]
+		return o.username > e.username || o.username == e.username && idx.byUsername[k] > i
+	})
+	idx.byUsername = append(idx.byUsername, 0)
+	copy(idx.byUsername[k+1:], idx.byUsername[k:])
+	idx.byUsername[k] = i
+}
+
+// memberGen returns the generation of the members of a guild, which
+// changes whenever they do.  s.indexMu must be held.
+func (s *State) memberGen(guildID string) uint64 {
+	if gen := s.indexGen[guildID]; gen > s.indexAll {
+		return gen
+	}
+
+	return s.indexAll
+}
+
+// bumpMemberGen marks a change of the members of a guild, or of all guilds
+// if guildID is empty, so that an index of them being built is not kept.
+// s.indexMu must be held.
+func (s *State) bumpMemberGen(guildID string) {
+	s.indexSeq++
+	if guildID == "" {
+		s.indexAll = s.indexSeq
+		s.indexGen = nil
+		return
+	}
+
+	if s.indexGen == nil {
+		s.indexGen = make(map[string]uint64)
+	}
+	s.indexGen[guildID] = s.indexSeq
+}
+
+// membersChanged drops the member indices of a guild, or of all guilds if
+// guildID is empty.  The lock of s must be held.
+func (s *State) membersChanged(guildID string) {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	s.bumpMemberGen(guildID)
+	if guildID == "" {
+		s.memberIndices = nil
+	} else {
+		delete(s.memberIndices, guildID)
+	}
+}
+
+// memberIndexed updates the member index of the guild of a member which was
+// added or updated, if it has one.  The member keeps its place unless its
+// names changed.  The lock of s must be held.
+func (s *State) memberIndexed(m *Member) {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	// An index being built may have missed the member.
+	s.bumpMemberGen(m.GuildID)
+
+	idx := s.memberIndices[m.GuildID]
+	if idx == nil || m.User == nil {
+		return
+	}
+
+	e := newMemberEntry(m)
+	if i := idx.find(e.userID); i >= 0 {
+		old := &idx.byName[i]
+		if old.nick == e.nick && old.username == e.username && old.discrim == e.discrim {
+			old.member = m
+			return
+		}
+		idx.remove(i)
+	}
+	idx.insert(e)
+}
+
+// memberUnindexed removes a member from the member index of its guild, if
+// it has one.  The lock of s must be held.
+func (s *State) memberUnindexed(guildID, userID string) {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	s.bumpMemberGen(guildID)
+
+	idx := s.memberIndices[guildID]
+	if idx == nil {
+		return
+	}
+	if i := idx.find(userID); i >= 0 {
+		idx.remove(i)
+	}
+}
+
+// memberIndex returns the member index of a guild, building it if it has
+// been dropped since it was last built.
+func (s *State) memberIndex(guildID string) (*memberIndex, error) {
+	s.indexMu.Lock()
+	idx := s.memberIndices[guildID]
+	s.indexMu.Unlock()
+	if idx != nil {
+		return idx, nil
+	}
+
+	s.RLock()
+	members, err := s.store.Members(guildID)
+	members = append([]*Member(nil), members...)
+	s.indexMu.Lock()
+	gen := s.memberGen(guildID)
+	s.indexMu.Unlock()
+	s.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	idx = &memberIndex{
+		byName: make([]memberEntry, len(members)),
+		names:  make(map[string]string, len(members)),
+	}
+	s.scan(len(members), func(i int) {
+		idx.byName[i] = newMemberEntry(members[i])
+	})
+
+	sort.Slice(idx.byName, func(i, j int) bool {
+		return lessEntry(&idx.byName[i], &idx.byName[j])
+	})
+	for _, e := range idx.byName {
+		idx.names[e.userID] = e.name
+	}
+
+	idx.byUsername = make([]int, len(idx.byName))
+	for i := range idx.byUsername {
+		idx.byUsername[i] = i
+	}
+	sort.SliceStable(idx.byUsername, func(i, j int) bool {
+		return idx.byName[idx.byUsername[i]].username < idx.byName[idx.byUsername[j]].username
+	})
+
+	// Keep the index only if the members did not change while it was built.
+	s.indexMu.Lock()
+	if s.memberGen(guildID) == gen {
+		if s.memberIndices == nil {
+			s.memberIndices = make(map[string]*memberIndex)
+		}
+		s.memberIndices[guildID] = idx
+	}
+	s.indexMu.Unlock()
+
+	return idx, nil
+}
+
+// FindMembers returns the members of a guild for which match returns true,
+// in the order the Discord client lists them: by nickname or username,
+// ignoring case.  match is called with the state read-locked, a batch of
+// members at a time, and must not call methods of the state.
+func (s *State) FindMembers(guildID string, match func(*Member) bool) ([]*Member, error) {
+	if s == nil {
+		return nil, ErrNilState
+	}
+
+	idx, err := s.memberIndex(guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.RLock()
+	n := len(idx.byName)
+	s.RUnlock()
+
+	var members []*Member
+	s.scan(n, func(i int) {
+		// Members may have been removed between batches.
+		if i >= len(idx.byName) {
+			return
+		}
+		if m := idx.byName[i].member; match(m) {
+			members = append(members, m)
+		}
+	})
+	s.copyMembers(members)
+
+	return members, nil
+}
+
+// FindMember finds a member of a guild by name, ignoring case.  The name is
+// either a username and discriminator, as "name#1234", or a username or
+// nickname, usernames being preferred.
+func (s *State) FindMember(guildID, name string) (*Member, error) {
+	if s == nil {
+		return nil, ErrNilState
+	}
+
+	idx, err := s.memberIndex(guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	name = strings.ToLower(name)
+	discrim := ""
+	if i := strings.LastIndexByte(name, '#'); i >= 0 && len(name)-i == 5 {
+		name, discrim = name[:i], name[i+1:]
+	}
+
+	s.RLock()
+	var found, byNick *Member
+	for _, e := range idx.byName {
+		if discrim != "" {
+			if e.username == name && e.discrim == discrim {
+				found = e.member
+				break
+			}
+		} else if e.username == name {
+			found = e.member
+			break
+		} else if e.nick == name && byNick == nil {
+			byNick = e.member
+		}
+	}
+
+	s.RUnlock()
+
+	if found == nil {
+		found = byNick
+	}
+	if found == nil {
+		return nil, ErrStateNotFound
+	}
+
+	members := []*Member{found}
+	s.copyMembers(members)
+
+	return members[0], nil
+}
+
+// MembersWithPrefix returns the members of a guild whose nickname or
+// username starts with prefix, ignoring case, in the order the Discord
+// client lists them.  At most limit are returned, unless limit is zero.
+func (s *State) MembersWithPrefix(guildID, prefix string, limit int) ([]*Member, error) {
+	if s == nil {
+		return nil, ErrNilState
+	}
+
+	idx, err := s.memberIndex(guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix = strings.ToLower(prefix)
+
+	s.RLock()
+	var found []int
+	n := len(idx.byName)
+	for i := sort.Search(n, func(i int) bool { return idx.byName[i].name >= prefix }); i < n; i++ {
+		if !strings.HasPrefix(idx.byName[i].name, prefix) {
+			break
+		}
+		found = append(found, i)
+	}
+	for j := sort.Search(n, func(j int) bool { return idx.byName[idx.byUsername[j]].username >= prefix }); j < n; j++ {
+		e := &idx.byName[idx.byUsername[j]]
+		if !strings.HasPrefix(e.username, prefix) {
+			break
+		}
+		// Those without a nickname were found by name.
+		if e.nick != "" && !strings.HasPrefix(e.nick, prefix) {
+			found = append(found, idx.byUsername[j])
+		}
+	}
+	sort.Ints(found)
+
+	if limit > 0 && len(found) > limit {
+		found = found[:limit]
+	}
+
+	members := make([]*Member, len(found))
+	for i, j := range found {
+		members[i] = idx.byName[j].member
+	}
+	s.RUnlock()
+	s.copyMembers(members)
+
+	return members, nil
+}
+
+// SearchMembers returns the members of a guild whose nickname or username
+// matches query, ignoring case: exactly, as a prefix, as a substring, or
+// else fuzzily, allowing a few typos.  The best matches come first, then
+// the order of the Discord client.  At most limit are returned, unless
+// limit is zero.
+func (s *State) SearchMembers(guildID, query string, limit int) ([]*Member, error) {
+	if s == nil {
+		return nil, ErrNilState
+	}
+
+	idx, err := s.memberIndex(guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	query = strings.ToLower(query)
+
+	type result struct {
+		match  nameMatch
+		member *Member
+	}
+	var results []result
+	s.RLock()
+	n := len(idx.byName)
+	s.RUnlock()
+	s.scan(n, func(i int) {
+		// Members may have been removed between batches.
+		if i >= len(idx.byName) {
+			return
+		}
+		e := &idx.byName[i]
+		match := matchName(e.name, query)
+		if e.username != e.name {
+			if m := matchName(e.username, query); m != matchNone && (match == matchNone || m < match) {
+				match = m
+			}
+		}
+		if match != matchNone {
+			results = append(results, result{match, e.member})
+		}
+	})
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].match < results[j].match
+	})
+
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+
+	members := make([]*Member, len(results))
+	for i, r := range results {
+		members[i] = r.member
+	}
+	s.copyMembers(members)
+
+	return members, nil
+}
+
+// MembersWithRole returns the members of a guild having a role, in the
+// order the Discord client lists them.
+func (s *State) MembersWithRole(guildID, roleID string) ([]*Member, error) {
+	return s.FindMembers(guildID, func(m *Member) bool {
+		for _, id := range m.Roles {
+			if id == roleID {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// OnlineCount returns how many members of a guild are online, idle or do
+// not disturb, as their presences show.
+func (s *State) OnlineCount(guildID string) (int, error) {
+	if s == nil {
+		return 0, ErrNilState
+	}
+
+	s.RLock()
+	defer s.RUnlock()
+
+	if _, err := s.store.Guild(guildID); err != nil {
+		return 0, err
+	}
+	if s.PresenceCache != nil {
+		return s.PresenceCache.OnlineCount(guildID), nil
+	}
+
+	presences, err := s.store.Presences(guildID)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, p := range presences {
+		if compactStatus(p.Status).online() {
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// MembersWithActivity returns the members of a guild whose presence has an
+// activity of a type and name, ignoring case, in the order the Discord
+// client lists them; "who is playing X" is
+// MembersWithActivity(guildID, ActivityTypeGame, "X").  Users whose member
+// is not cached are left out.
+func (s *State) MembersWithActivity(guildID string, typ ActivityType, name string) ([]*Member, error) {
+	if s == nil {
+		return nil, ErrNilState
+	}
+
+	users := make(map[string]bool)
+	if s.PresenceCache != nil {
+		for _, id := range s.PresenceCache.UsersWithActivity(guildID, typ, name) {
+			users[id] = true
+		}
+	} else {
+		s.RLock()
+		presences, err := s.store.Presences(guildID)
+		if err == nil {
+			for _, p := range presences {
+				for _, a := range p.Activities {
+					if a.Type == typ && strings.EqualFold(a.Name, name) {
+						users[p.User.ID] = true
+						break
+					}
+				}
+			}
+		}
+		s.RUnlock()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(users) == 0 {
+		return nil, nil
+	}
+
+	return s.FindMembers(guildID, func(m *Member) bool {
+		return m.User != nil && users[m.User.ID]
+	})
+}
+
+// channelGroup returns the group of a channel type within a category, as
+// the Discord client lists text channels before voice channels.
+func channelGroup(t ChannelType) int {
+	switch t {
+	case ChannelTypeGuildCategory:
+		return 0
+	case ChannelTypeGuildVoice, ChannelTypeGuildStageVoice:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// sortChannels sorts the channels of a guild as the Discord client lists
+// them: channels outside any category first, then each category followed
+// by its channels; text channels before voice channels, then by position
+// and ID.
+func sortChannels(channels []*Channel) {
+	categories := make(map[string]*Channel)
+	for _, c := range channels {
+		if c.Type == ChannelTypeGuildCategory {
+			categories[c.ID] = c
+		}
+	}
+
+	// category returns the category a channel is listed under, if any.
+	category := func(c *Channel) *Channel {
+		if c.Type == ChannelTypeGuildCategory {
+			return c
+		}
+		return categories[c.ParentID]
+	}
+
+	less := func(a, b *Channel) bool {
+		if ga, gb := channelGroup(a.Type), channelGroup(b.Type); ga != gb {
+			return ga < gb
+		}
+		if a.Position != b.Position {
+			return a.Position < b.Position
+		}
+		return lessID(a.ID, b.ID)
+	}
+
+	sort.SliceStable(channels, func(i, j int) bool {
+		a, b := channels[i], channels[j]
+		ca, cb := category(a), category(b)
+		switch {
+		case ca == cb:
+			return less(a, b)
+		case ca == nil:
+			return true
+		case cb == nil:
+			return false
+		}
+		return less(ca, cb)
+	})
+}
+
+// guildChannels returns a copy of the channels of a guild.
+func (s *State) guildChannels(guildID string) ([]*Channel, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	channels, err := s.store.Channels(guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]*Channel(nil), channels...), nil
+}
+
+// FindChannels returns the channels of a guild for which match returns
+// true, in the order the Discord client lists them.  match is called with
+// the state read-locked, a batch of channels at a time, and must not call
+// methods of the state.
+func (s *State) FindChannels(guildID string, match func(*Channel) bool) ([]*Channel, error) {
+	if s == nil {
+		return nil, ErrNilState
+	}
+
+	channels, err := s.findChannels(guildID, match)
+	if err != nil {
+		return nil, err
+	}
+
+	s.RLock()
+	s.copyChannels(channels)
+	s.RUnlock()
+
+	return channels, nil
+}
+
+// findChannels is FindChannels, returning the channels the state holds.
+func (s *State) findChannels(guildID string, match func(*Channel) bool) ([]*Channel, error) {
+	all, err := s.guildChannels(guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	var channels []*Channel
+	s.scan(len(all), func(i int) {
+		if match(all[i]) {
+			channels = append(channels, all[i])
+		}
+	})
+
+	s.RLock()
+	sortChannels(channels)
+	s.RUnlock()
+
+	return channels, nil
+}
+
+// FindChannel finds a channel of a guild by name, ignoring case and any
+// leading '#'.  The first in the order of the Discord client is returned.
+func (s *State) FindChannel(guildID, name string) (*Channel, error) {
+	name = strings.ToLower(strings.TrimPrefix(name, "#"))
+
+	channels, err := s.FindChannels(guildID, func(c *Channel) bool {
+		return strings.ToLower(c.Name) == name
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(channels) == 0 {
+		return nil, ErrStateNotFound
+	}
+
+	return channels[0], nil
+}
+
+// SearchChannels returns the channels of a guild whose name matches query,
+// as SearchMembers matches names.  At most limit are returned, unless limit
+// is zero.
+func (s *State) SearchChannels(guildID, query string, limit int) ([]*Channel, error) {
+	query = strings.ToLower(strings.TrimPrefix(query, "#"))
+
+	matches := make(map[*Channel]nameMatch)
+	channels, err := s.findChannels(guildID, func(c *Channel) bool {
+		m := matchName(strings.ToLower(c.Name), query)
+		if m == matchNone {
+			return false
+		}
+		matches[c] = m
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(channels, func(i, j int) bool {
+		return matches[channels[i]] < matches[channels[j]]
+	})
+
+	if limit > 0 && len(channels) > limit {
+		channels = channels[:limit]
+	}
+
+	s.RLock()
+	s.copyChannels(channels)
+	s.RUnlock()
+
+	return channels, nil
+}
+
+// CategoryChannels returns the channels in a category of a guild, in the
+// order the Discord client lists them.
+func (s *State) CategoryChannels(guildID, categoryID string) ([]*Channel, error) {
+	return s.FindChannels(guildID, func(c *Channel) bool {
+		return c.ParentID == categoryID && c.Type != ChannelTypeGuildCategory
+	})
+}
+
+// guildRoles returns a copy of the roles of a guild.
+func (s *State) guildRoles(guildID string) ([]*Role, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	roles, err := s.store.Roles(guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]*Role(nil), roles...), nil
+}
+
+// FindRoles returns the roles of a guild for which match returns true, in
+// the order the Discord client lists them, from the highest.  match is
+// called with the state read-locked and must not call methods of the state.
+func (s *State) FindRoles(guildID string, match func(*Role) bool) ([]*Role, error) {
+	if s == nil {
+		return nil, ErrNilState
+	}
+
+	roles, err := s.findRoles(guildID, match)
+	if err != nil {
+		return nil, err
+	}
+
+	s.RLock()
+	s.copyRoles(roles)
+	s.RUnlock()
+
+	return roles, nil
+}
+
+// findRoles is FindRoles, returning the roles the state holds.
+func (s *State) findRoles(guildID string, match func(*Role) bool) ([]*Role, error) {
+	all, err := s.guildRoles(guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	var roles Roles
+	s.scan(len(all), func(i int) {
+		if match(all[i]) {
+			roles = append(roles, all[i])
+		}
+	})
+
+	s.RLock()
+	sort.Sort(roles)
+	s.RUnlock()
+
+	return roles, nil
+}
+
+// FindRole finds a role of a guild by name, ignoring case and any leading
+// '@'.  The highest role of the name is returned.
+func (s *State) FindRole(guildID, name string) (*Role, error) {
+	name = strings.ToLower(strings.TrimPrefix(name, "@"))
+
+	roles, err := s.FindRoles(guildID, func(r *Role) bool {
+		return strings.ToLower(r.Name) == name
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(roles) == 0 {
+		return nil, ErrStateNotFound
+	}
+
+	return roles[0], nil
+}
+
+// SearchRoles returns the roles of a guild whose name matches query, as
+// SearchMembers matches names.  At most limit are returned, unless limit is
+// zero.
+func (s *State) SearchRoles(guildID, query string, limit int) ([]*Role, error) {
+	query = strings.ToLower(strings.TrimPrefix(query, "@"))
+
+	matches := make(map[*Role]nameMatch)
+	roles, err := s.findRoles(guildID, func(r *Role) bool {
+		m := matchName(strings.ToLower(r.Name), query)
+		if m == matchNone {
+			return false
+		}
+		matches[r] = m
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(roles, func(i, j int) bool {
+		return matches[roles[i]] < matches[roles[j]]
+	})
+
+	if limit > 0 && len(roles) > limit {
+		roles = roles[:limit]
+	}
+
+	s.RLock()
+	s.copyRoles(roles)
+	s.RUnlock()
+
+	return roles, nil
+}
+
+// RolesAbove returns the roles of a guild above a position, from the
+// highest.
+func (s *State) RolesAbove(guildID string, position int) ([]*Role, error) {
+	return s.FindRoles(guildID, func(r *Role) bool {
+		return r.Position > position
+	})
+}
@@ -0,0 +1,49 @@
+// Discord bindings for the Hrngh bot.
+// Available at https://github.com/abeiron/hrngh
+
+// Copyright 2020-2021, Undying Memory <abeiron@outlook.com>.  All rights reserved.
+// Use of this source code is governed by the Microsoft Public License
+// that can be found in the LICENSE file.
+
+// This file contains tests of the member indices.
+
+package discord
+
+import "testing"
+
+// TestMemberGen checks that a change of the members of a guild invalidates
+// only the indices of that guild being built.
+func TestMemberGen(t *testing.T) {
+	s := NewState()
+
+	a, b := s.memberGen("a"), s.memberGen("b")
+
+	s.bumpMemberGen("b")
+	if s.memberGen("a") != a {
+		t.Error("a change of guild b changed the generation of guild a")
+	}
+	if s.memberGen("b") == b {
+		t.Error("a change of guild b left its generation")
+	}
+
+	b = s.memberGen("b")
+	s.bumpMemberGen("a")
+	if s.memberGen("a") == a || s.memberGen("b") != b {
+		t.Error("a change of guild a changed the wrong generation")
+	}
+
+	a, b = s.memberGen("a"), s.memberGen("b")
+	c := s.memberGen("c")
+	s.bumpMemberGen("")
+	if s.memberGen("a") == a || s.memberGen("b") == b || s.memberGen("c") == c {
+		t.Error("a change of all guilds left a generation")
+	}
+
+	// Generations never repeat, even once all guilds changed.
+	a = s.memberGen("a")
+	s.bumpMemberGen("b")
+	s.bumpMemberGen("a")
+	if s.memberGen("a") <= a {
+		t.Errorf("got generation %d after %d", s.memberGen("a"), a)
+	}
+}
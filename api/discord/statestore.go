@@ -0,0 +1,748 @@
+// Discord bindings for the Hrngh bot.
+// Available at https://github.com/abeiron/hrngh
+
+// Copyright 2020-2021, Undying Memory <abeiron@outlook.com>.  All rights reserved.
+// Use of this source code is governed by the Microsoft Public License
+// that can be found in the LICENSE file.
+
+// This file contains code related to the storage behind the State.  A
+// StateStore holds the cached guilds, channels, members, roles, emojis,
+// messages, presences and voice states; the State decides what goes in it.
+
+package discord
+
+// A StateStore holds the entities cached by a State.  MemoryStore, the
+// default, keeps them in memory; DiskStore keeps them in a file.
+//
+// The State calls a store only while holding its lock, so a store need not
+// be safe for concurrent use, except that methods which only read may be
+// called concurrently with each other.  A store returns ErrStateNotFound
+// for an entity it doesn't hold, including one whose guild or channel it
+// doesn't hold.
+//
+// Entities are merged by the State before they are set, so a store replaces
+// what it holds with what it is given.  The exception is the slices of a
+// Guild: a nil Channels, Threads, Roles, Emojis, Members, Presences or VoiceStates
+// leaves what the store holds of that kind for the guild unchanged, while a
+// non-nil one replaces it.  A store other than MemoryStore may return
+// guilds without their Members, Presences and VoiceStates, which are got
+// through Members, Presences and VoiceStates instead.
+type StateStore interface {
+	// Guild returns a guild by ID.
+	Guild(guildID string) (*Guild, error)
+	// Guilds returns all the guilds.
+	Guilds() ([]*Guild, error)
+	// SetGuild adds or replaces a guild.
+	SetGuild(guild *Guild) error
+	// DeleteGuild deletes a guild and everything in it.
+	DeleteGuild(guildID string) error
+
+	// Channel returns a channel by ID, in any guild or private.
+	Channel(channelID string) (*Channel, error)
+	// Channels returns the channels of a guild, or the private channels
+	// if guildID is empty, without the threads.
+	Channels(guildID string) ([]*Channel, error)
+	// Threads returns the threads of a guild.
+	Threads(guildID string) ([]*Channel, error)
+	// SetChannel adds or replaces a channel or thread.
+	SetChannel(channel *Channel) error
+	// DeleteChannel deletes a channel or thread and its messages.
+	DeleteChannel(channelID string) error
+
+	// Member returns a member of a guild by user ID.
+	Member(guildID, userID string) (*Member, error)
+	// Members returns the members of a guild.
+	Members(guildID string) ([]*Member, error)
+	// SetMember adds or replaces a member in the guild of member.GuildID.
+	SetMember(member *Member) error
+	// DeleteMember deletes a member of a guild.
+	DeleteMember(guildID, userID string) error
+
+	// Role returns a role of a guild by ID.
+	Role(guildID, roleID string) (*Role, error)
+	// Roles returns the roles of a guild.
+	Roles(guildID string) ([]*Role, error)
+	// SetRole adds or replaces a role of a guild.
+	SetRole(guildID string, role *Role) error
+	// DeleteRole deletes a role of a guild.
+	DeleteRole(guildID, roleID string) error
+
+	// Emoji returns an emoji of a guild by ID.
+	Emoji(guildID, emojiID string) (*Emoji, error)
+	// Emojis returns the emojis of a guild.
+	Emojis(guildID string) ([]*Emoji, error)
+	// SetEmoji adds or replaces an emoji of a guild.
+	SetEmoji(guildID string, emoji *Emoji) error
+	// DeleteEmoji deletes an emoji of a guild.
+	DeleteEmoji(guildID, emojiID string) error
+
+	// Message returns a message of a channel by ID.
+	Message(channelID, messageID string) (*Message, error)
+	// Messages returns the messages of a channel, oldest first.
+	Messages(channelID string) ([]*Message, error)
+	// SetMessage adds or replaces a message in the channel of
+	// message.ChannelID.  If limit is positive, the oldest messages of the
+	// channel past limit are deleted.
+	SetMessage(message *Message, limit int) error
+	// DeleteMessage deletes a message of a channel.
+	DeleteMessage(channelID, messageID string) error
+
+	// Presence returns the presence of a user in a guild.
+	Presence(guildID, userID string) (*Presence, error)
+	// Presences returns the presences in a guild.
+	Presences(guildID string) ([]*Presence, error)
+	// SetPresence adds or replaces the presence of presence.User in a guild.
+	SetPresence(guildID string, presence *Presence) error
+	// DeletePresence deletes the presence of a user in a guild.
+	DeletePresence(guildID, userID string) error
+
+	// VoiceState returns the voice state of a user in a guild.
+	VoiceState(guildID, userID string) (*VoiceState, error)
+	// VoiceStates returns the voice states in a guild.
+	VoiceStates(guildID string) ([]*VoiceState, error)
+	// SetVoiceState adds or replaces the voice state of
+	// voiceState.UserID in a guild.
+	SetVoiceState(guildID string, voiceState *VoiceState) error
+	// DeleteVoiceState deletes the voice state of a user in a guild.
+	DeleteVoiceState(guildID, userID string) error
+}
+
+// A guildIDStore is a StateStore which lists the IDs of its guilds without
+// reading them, as a DiskStore does.
+type guildIDStore interface {
+	GuildIDs() ([]string, error)
+}
+
+// A MemoryStore is a StateStore keeping the entities in memory, as the
+// slices of the Guild and Channel structs they belong to, indexed by maps.
+// It returns pointers to what it holds, so they stay current as the state
+// is updated.
+//
+// The store of a State also keeps its Ready.Guilds and
+// Ready.PrivateChannels.
+type MemoryStore struct {
+	ready *Ready
+
+	guildMap   map[string]*Guild
+	channelMap map[string]*Channel
+	memberMap  map[string]map[string]*Member
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	m := &MemoryStore{
+		ready: &Ready{
+			PrivateChannels: []*Channel{},
+			Guilds:          []*Guild{},
+		},
+	}
+	m.reset()
+
+	return m
+}
+
+// bind makes the store keep its guilds and private channels in r.
+func (m *MemoryStore) bind(r *Ready) {
+	r.Guilds = m.ready.Guilds
+	r.PrivateChannels = m.ready.PrivateChannels
+	m.ready = r
+}
+
+// reset empties the indexes of the store.
+func (m *MemoryStore) reset() {
+	m.guildMap = make(map[string]*Guild)
+	m.channelMap = make(map[string]*Channel)
+	m.memberMap = make(map[string]map[string]*Member)
+}
+
+func (m *MemoryStore) createMemberMap(guild *Guild) {
+	members := make(map[string]*Member)
+	for _, member := range guild.Members {
+		members[member.User.ID] = member
+	}
+	m.memberMap[guild.ID] = members
+}
+
+// Guild implements StateStore.
+func (m *MemoryStore) Guild(guildID string) (*Guild, error) {
+	if g, ok := m.guildMap[guildID]; ok {
+		return g, nil
+	}
+
+	return nil, ErrStateNotFound
+}
+
+// Guilds implements StateStore.
+func (m *MemoryStore) Guilds() ([]*Guild, error) {
+	return m.ready.Guilds, nil
+}
+
+// SetGuild implements StateStore.
+func (m *MemoryStore) SetGuild(guild *Guild) error {
+	// If this guild contains a new member slice, we must regenerate the member map so the pointers stay valid
+	if guild.Members != nil {
+		m.createMemberMap(guild)
+	} else if _, ok := m.memberMap[guild.ID]; !ok {
+		// Even if we have no new member slice, we still initialize the member map for this guild if it doesn't exist
+		m.memberMap[guild.ID] = make(map[string]*Member)
+	}
+
+	g, ok := m.guildMap[guild.ID]
+	if ok {
+		if guild.Channels == nil {
+			guild.Channels = g.Channels
+		} else {
+			for _, c := range g.Channels {
+				delete(m.channelMap, c.ID)
+			}
+		}
+		if guild.Threads == nil {
+			guild.Threads = g.Threads
+		} else {
+			for _, c := range g.Threads {
+				delete(m.channelMap, c.ID)
+			}
+		}
+		if guild.Roles == nil {
+			guild.Roles = g.Roles
+		}
+		if guild.Emojis == nil {
+			guild.Emojis = g.Emojis
+		}
+		if guild.Members == nil {
+			guild.Members = g.Members
+		}
+		if guild.Presences == nil {
+			guild.Presences = g.Presences
+		}
+		if guild.VoiceStates == nil {
+			guild.VoiceStates = g.VoiceStates
+		}
+		*g = *guild
+	} else {
+		g = guild
+		m.ready.Guilds = append(m.ready.Guilds, g)
+		m.guildMap[g.ID] = g
+	}
+
+	// Update the channels to point to the right guild, adding them to the channelMap as we go
+	for _, c := range g.Channels {
+		m.channelMap[c.ID] = c
+	}
+	for _, c := range g.Threads {
+		m.channelMap[c.ID] = c
+	}
+
+	return nil
+}
+
+// DeleteGuild implements StateStore.
+func (m *MemoryStore) DeleteGuild(guildID string) error {
+	g, ok := m.guildMap[guildID]
+	if !ok {
+		return ErrStateNotFound
+	}
+
+	for _, c := range g.Channels {
+		delete(m.channelMap, c.ID)
+	}
+	for _, c := range g.Threads {
+		delete(m.channelMap, c.ID)
+	}
+	delete(m.memberMap, guildID)
+	delete(m.guildMap, guildID)
+
+	for i, g := range m.ready.Guilds {
+		if g.ID == guildID {
+			m.ready.Guilds = append(m.ready.Guilds[:i], m.ready.Guilds[i+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
+
+// Channel implements StateStore.
+func (m *MemoryStore) Channel(channelID string) (*Channel, error) {
+	if c, ok := m.channelMap[channelID]; ok {
+		return c, nil
+	}
+
+	return nil, ErrStateNotFound
+}
+
+// Channels implements StateStore.
+func (m *MemoryStore) Channels(guildID string) ([]*Channel, error) {
+	if guildID == "" {
+		return m.ready.PrivateChannels, nil
+	}
+
+	g, ok := m.guildMap[guildID]
+	if !ok {
+		return nil, ErrStateNotFound
+	}
+
+	return g.Channels, nil
+}
+
+// Threads implements StateStore.
+func (m *MemoryStore) Threads(guildID string) ([]*Channel, error) {
+	g, ok := m.guildMap[guildID]
+	if !ok {
+		return nil, ErrStateNotFound
+	}
+
+	return g.Threads, nil
+}
+
+// SetChannel implements StateStore.
+func (m *MemoryStore) SetChannel(channel *Channel) error {
+	// If the channel exists, replace it
+	if c, ok := m.channelMap[channel.ID]; ok {
+		*c = *channel
+		return nil
+	}
+
+	if isPrivateChannel(channel) {
+		m.ready.PrivateChannels = append(m.ready.PrivateChannels, channel)
+	} else {
+		guild, ok := m.guildMap[channel.GuildID]
+		if !ok {
+			return ErrStateNotFound
+		}
+
+		if channel.IsThread() {
+			guild.Threads = append(guild.Threads, channel)
+		} else {
+			guild.Channels = append(guild.Channels, channel)
+		}
+	}
+
+	m.channelMap[channel.ID] = channel
+
+	return nil
+}
+
+// DeleteChannel implements StateStore.
+func (m *MemoryStore) DeleteChannel(channelID string) error {
+	channel, ok := m.channelMap[channelID]
+	if !ok {
+		return ErrStateNotFound
+	}
+
+	if isPrivateChannel(channel) {
+		for i, c := range m.ready.PrivateChannels {
+			if c.ID == channelID {
+				m.ready.PrivateChannels = append(m.ready.PrivateChannels[:i], m.ready.PrivateChannels[i+1:]...)
+				break
+			}
+		}
+	} else if guild, ok := m.guildMap[channel.GuildID]; ok && channel.IsThread() {
+		for i, c := range guild.Threads {
+			if c.ID == channelID {
+				guild.Threads = append(guild.Threads[:i], guild.Threads[i+1:]...)
+				break
+			}
+		}
+	} else if ok {
+		for i, c := range guild.Channels {
+			if c.ID == channelID {
+				guild.Channels = append(guild.Channels[:i], guild.Channels[i+1:]...)
+				break
+			}
+		}
+	}
+
+	delete(m.channelMap, channelID)
+
+	return nil
+}
+
+// Member implements StateStore.
+func (m *MemoryStore) Member(guildID, userID string) (*Member, error) {
+	members, ok := m.memberMap[guildID]
+	if !ok {
+		return nil, ErrStateNotFound
+	}
+
+	if member, ok := members[userID]; ok {
+		return member, nil
+	}
+
+	return nil, ErrStateNotFound
+}
+
+// Members implements StateStore.
+func (m *MemoryStore) Members(guildID string) ([]*Member, error) {
+	g, ok := m.guildMap[guildID]
+	if !ok {
+		return nil, ErrStateNotFound
+	}
+
+	return g.Members, nil
+}
+
+// SetMember implements StateStore.
+func (m *MemoryStore) SetMember(member *Member) error {
+	guild, ok := m.guildMap[member.GuildID]
+	if !ok {
+		return ErrStateNotFound
+	}
+
+	members, ok := m.memberMap[member.GuildID]
+	if !ok {
+		return ErrStateNotFound
+	}
+
+	if old, ok := members[member.User.ID]; ok {
+		*old = *member
+		return nil
+	}
+
+	members[member.User.ID] = member
+	guild.Members = append(guild.Members, member)
+
+	return nil
+}
+
+// DeleteMember implements StateStore.
+func (m *MemoryStore) DeleteMember(guildID, userID string) error {
+	guild, ok := m.guildMap[guildID]
+	if !ok {
+		return ErrStateNotFound
+	}
+
+	members, ok := m.memberMap[guildID]
+	if !ok {
+		return ErrStateNotFound
+	}
+
+	if _, ok := members[userID]; !ok {
+		return ErrStateNotFound
+	}
+	delete(members, userID)
+
+	for i, member := range guild.Members {
+		if member.User.ID == userID {
+			guild.Members = append(guild.Members[:i], guild.Members[i+1:]...)
+			return nil
+		}
+	}
+
+	return ErrStateNotFound
+}
+
+// Role implements StateStore.
+func (m *MemoryStore) Role(guildID, roleID string) (*Role, error) {
+	guild, ok := m.guildMap[guildID]
+	if !ok {
+		return nil, ErrStateNotFound
+	}
+
+	for _, r := range guild.Roles {
+		if r.ID == roleID {
+			return r, nil
+		}
+	}
+
+	return nil, ErrStateNotFound
+}
+
+// Roles implements StateStore.
+func (m *MemoryStore) Roles(guildID string) ([]*Role, error) {
+	guild, ok := m.guildMap[guildID]
+	if !ok {
+		return nil, ErrStateNotFound
+	}
+
+	return guild.Roles, nil
+}
+
+// SetRole implements StateStore.
+func (m *MemoryStore) SetRole(guildID string, role *Role) error {
+	guild, ok := m.guildMap[guildID]
+	if !ok {
+		return ErrStateNotFound
+	}
+
+	for i, r := range guild.Roles {
+		if r.ID == role.ID {
+			guild.Roles[i] = role
+			return nil
+		}
+	}
+
+	guild.Roles = append(guild.Roles, role)
+	return nil
+}
+
+// DeleteRole implements StateStore.
+func (m *MemoryStore) DeleteRole(guildID, roleID string) error {
+	guild, ok := m.guildMap[guildID]
+	if !ok {
+		return ErrStateNotFound
+	}
+
+	for i, r := range guild.Roles {
+		if r.ID == roleID {
+			guild.Roles = append(guild.Roles[:i], guild.Roles[i+1:]...)
+			return nil
+		}
+	}
+
+	return ErrStateNotFound
+}
+
+// Emoji implements StateStore.
+func (m *MemoryStore) Emoji(guildID, emojiID string) (*Emoji, error) {
+	guild, ok := m.guildMap[guildID]
+	if !ok {
+		return nil, ErrStateNotFound
+	}
+
+	for _, e := range guild.Emojis {
+		if e.ID == emojiID {
+			return e, nil
+		}
+	}
+
+	return nil, ErrStateNotFound
+}
+
+// Emojis implements StateStore.
+func (m *MemoryStore) Emojis(guildID string) ([]*Emoji, error) {
+	guild, ok := m.guildMap[guildID]
+	if !ok {
+		return nil, ErrStateNotFound
+	}
+
+	return guild.Emojis, nil
+}
+
+// SetEmoji implements StateStore.
+func (m *MemoryStore) SetEmoji(guildID string, emoji *Emoji) error {
+	guild, ok := m.guildMap[guildID]
+	if !ok {
+		return ErrStateNotFound
+	}
+
+	for i, e := range guild.Emojis {
+		if e.ID == emoji.ID {
+			guild.Emojis[i] = emoji
+			return nil
+		}
+	}
+
+	guild.Emojis = append(guild.Emojis, emoji)
+	return nil
+}
+
+// DeleteEmoji implements StateStore.
+func (m *MemoryStore) DeleteEmoji(guildID, emojiID string) error {
+	guild, ok := m.guildMap[guildID]
+	if !ok {
+		return ErrStateNotFound
+	}
+
+	for i, e := range guild.Emojis {
+		if e.ID == emojiID {
+			guild.Emojis = append(guild.Emojis[:i], guild.Emojis[i+1:]...)
+			return nil
+		}
+	}
+
+	return ErrStateNotFound
+}
+
+// Message implements StateStore.
+func (m *MemoryStore) Message(channelID, messageID string) (*Message, error) {
+	c, ok := m.channelMap[channelID]
+	if !ok {
+		return nil, ErrStateNotFound
+	}
+
+	for _, msg := range c.Messages {
+		if msg.ID == messageID {
+			return msg, nil
+		}
+	}
+
+	return nil, ErrStateNotFound
+}
+
+// Messages implements StateStore.
+func (m *MemoryStore) Messages(channelID string) ([]*Message, error) {
+	c, ok := m.channelMap[channelID]
+	if !ok {
+		return nil, ErrStateNotFound
+	}
+
+	return c.Messages, nil
+}
+
+// SetMessage implements StateStore.
+func (m *MemoryStore) SetMessage(message *Message, limit int) error {
+	c, ok := m.channelMap[message.ChannelID]
+	if !ok {
+		return ErrStateNotFound
+	}
+
+	for i, msg := range c.Messages {
+		if msg.ID == message.ID {
+			c.Messages[i] = message
+			return nil
+		}
+	}
+
+	c.Messages = append(c.Messages, message)
+
+	if limit > 0 && len(c.Messages) > limit {
+		c.Messages = c.Messages[len(c.Messages)-limit:]
+	}
+	return nil
+}
+
+// DeleteMessage implements StateStore.
+func (m *MemoryStore) DeleteMessage(channelID, messageID string) error {
+	c, ok := m.channelMap[channelID]
+	if !ok {
+		return ErrStateNotFound
+	}
+
+	for i, msg := range c.Messages {
+		if msg.ID == messageID {
+			c.Messages = append(c.Messages[:i], c.Messages[i+1:]...)
+			return nil
+		}
+	}
+
+	return ErrStateNotFound
+}
+
+// Presence implements StateStore.
+func (m *MemoryStore) Presence(guildID, userID string) (*Presence, error) {
+	guild, ok := m.guildMap[guildID]
+	if !ok {
+		return nil, ErrStateNotFound
+	}
+
+	for _, p := range guild.Presences {
+		if p.User.ID == userID {
+			return p, nil
+		}
+	}
+
+	return nil, ErrStateNotFound
+}
+
+// Presences implements StateStore.
+func (m *MemoryStore) Presences(guildID string) ([]*Presence, error) {
+	guild, ok := m.guildMap[guildID]
+	if !ok {
+		return nil, ErrStateNotFound
+	}
+
+	return guild.Presences, nil
+}
+
+// SetPresence implements StateStore.
+func (m *MemoryStore) SetPresence(guildID string, presence *Presence) error {
+	guild, ok := m.guildMap[guildID]
+	if !ok {
+		return ErrStateNotFound
+	}
+
+	for i, p := range guild.Presences {
+		if p.User.ID == presence.User.ID {
+			guild.Presences[i] = presence
+			return nil
+		}
+	}
+
+	guild.Presences = append(guild.Presences, presence)
+	return nil
+}
+
+// DeletePresence implements StateStore.
+func (m *MemoryStore) DeletePresence(guildID, userID string) error {
+	guild, ok := m.guildMap[guildID]
+	if !ok {
+		return ErrStateNotFound
+	}
+
+	for i, p := range guild.Presences {
+		if p.User.ID == userID {
+			guild.Presences = append(guild.Presences[:i], guild.Presences[i+1:]...)
+			return nil
+		}
+	}
+
+	return ErrStateNotFound
+}
+
+// VoiceState implements StateStore.
+func (m *MemoryStore) VoiceState(guildID, userID string) (*VoiceState, error) {
+	guild, ok := m.guildMap[guildID]
+	if !ok {
+		return nil, ErrStateNotFound
+	}
+
+	for _, state := range guild.VoiceStates {
+		if state.UserID == userID {
+			return state, nil
+		}
+	}
+
+	return nil, ErrStateNotFound
+}
+
+// VoiceStates implements StateStore.
+func (m *MemoryStore) VoiceStates(guildID string) ([]*VoiceState, error) {
+	guild, ok := m.guildMap[guildID]
+	if !ok {
+		return nil, ErrStateNotFound
+	}
+
+	return guild.VoiceStates, nil
+}
+
+// SetVoiceState implements StateStore.
+func (m *MemoryStore) SetVoiceState(guildID string, voiceState *VoiceState) error {
+	guild, ok := m.guildMap[guildID]
+	if !ok {
+		return ErrStateNotFound
+	}
+
+	for i, state := range guild.VoiceStates {
+		if state.UserID == voiceState.UserID {
+			guild.VoiceStates[i] = voiceState
+			return nil
+		}
+	}
+
+	guild.VoiceStates = append(guild.VoiceStates, voiceState)
+	return nil
+}
+
+// DeleteVoiceState implements StateStore.
+func (m *MemoryStore) DeleteVoiceState(guildID, userID string) error {
+	guild, ok := m.guildMap[guildID]
+	if !ok {
+		return ErrStateNotFound
+	}
+
+	for i, state := range guild.VoiceStates {
+		if state.UserID == userID {
+			guild.VoiceStates = append(guild.VoiceStates[:i], guild.VoiceStates[i+1:]...)
+			return nil
+		}
+	}
+
+	return ErrStateNotFound
+}
+
+// isPrivateChannel reports whether a channel is a DM or group DM, which
+// belongs to no guild.
+func isPrivateChannel(c *Channel) bool {
+	return c.Type == ChannelTypeDM || c.Type == ChannelTypeGroupDM
+}
@@ -0,0 +1,216 @@
+// Discord bindings for the Hrngh bot.
+// Available at https://github.com/abeiron/hrngh
+
+// Copyright 2020-2021, Undying Memory <abeiron@outlook.com>.  All rights reserved.
+// Use of this source code is governed by the Microsoft Public License
+// that can be found in the LICENSE file.
+
+// This file contains code related to the threads held by the State.  A
+// thread is a channel kept with its guild, as Guild.Threads, and listed
+// under the channel it was started in, its ParentID.
+
+package discord
+
+import "sort"
+
+// sortThreads sorts threads newest first, as the Discord client lists them.
+func sortThreads(threads []*Channel) {
+	sort.Slice(threads, func(i, j int) bool {
+		return lessID(threads[j].ID, threads[i].ID)
+	})
+}
+
+// GuildThreads returns the threads the state holds in a guild, newest
+// first.  These are the threads which were active when the guild was
+// created, and those created, updated or synced since; an archived thread
+// stays until it is deleted or a ThreadListSync drops it.
+func (s *State) GuildThreads(guildID string) ([]*Channel, error) {
+	return s.FindThreads(guildID, func(*Channel) bool { return true })
+}
+
+// ChannelThreads returns the threads the state holds under a channel of a
+// guild, newest first.
+func (s *State) ChannelThreads(guildID, channelID string) ([]*Channel, error) {
+	return s.FindThreads(guildID, func(c *Channel) bool {
+		return c.ParentID == channelID
+	})
+}
+
+// FindThreads returns the threads of a guild for which match returns true,
+// newest first.  match is called with the state read-locked, and must not
+// call methods of the state.
+func (s *State) FindThreads(guildID string, match func(*Channel) bool) ([]*Channel, error) {
+	if s == nil {
+		return nil, ErrNilState
+	}
+
+	s.RLock()
+	defer s.RUnlock()
+
+	all, err := s.store.Threads(guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	threads := []*Channel{}
+	for _, c := range all {
+		if match(c) {
+			threads = append(threads, c)
+		}
+	}
+	sortThreads(threads)
+	s.copyChannels(threads)
+
+	return threads, nil
+}
+
+// removeThreads removes the threads of a guild for which match returns
+// true.  The lock of s must be held.
+func (s *State) removeThreads(guildID string, match func(*Channel) bool) error {
+	threads, err := s.store.Threads(guildID)
+	if err != nil {
+		return err
+	}
+
+	// The store may remove from the slice it returned.
+	var ids []string
+	for _, c := range threads {
+		if match(c) {
+			ids = append(ids, c.ID)
+		}
+	}
+
+	for _, id := range ids {
+		if s.MessageCache != nil {
+			s.MessageCache.RemoveChannel(id)
+		}
+		if err = s.store.DeleteChannel(id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// threadUpdate sets a thread the state holds to a copy changed by f.  The
+// lock of s must be held.
+func (s *State) threadUpdate(threadID string, f func(*Channel)) error {
+	c, err := s.store.Channel(threadID)
+	if err != nil {
+		return err
+	}
+
+	update := *c
+	f(&update)
+
+	return s.store.SetChannel(&update)
+}
+
+// threadListSync replaces the threads of the channels of a ThreadListSync,
+// or of its whole guild, with those it lists.
+func (s *State) threadListSync(t *ThreadListSync) error {
+	s.Lock()
+	defer s.Unlock()
+
+	parents := make(map[string]bool, len(t.ChannelIDs))
+	for _, id := range t.ChannelIDs {
+		parents[id] = true
+	}
+	synced := make(map[string]bool, len(t.Threads))
+	for _, c := range t.Threads {
+		synced[c.ID] = true
+	}
+
+	// Threads which are synced again keep their cached messages.
+	err := s.removeThreads(t.GuildID, func(c *Channel) bool {
+		return !synced[c.ID] && (len(parents) == 0 || parents[c.ParentID])
+	})
+	if err != nil {
+		return err
+	}
+
+	members := make(map[string]*ThreadMember, len(t.Members))
+	for _, m := range t.Members {
+		members[m.ID] = m
+	}
+
+	for _, c := range t.Threads {
+		if c.GuildID == "" {
+			c.GuildID = t.GuildID
+		}
+		m, ok := members[c.ID]
+		if ok {
+			member := *m
+			c.Member = &member
+		}
+		if err = s.channelAdd(c); err != nil {
+			return err
+		}
+
+		// The members are those of the current user, so a thread
+		// without one is a thread the user is not in.
+		if !ok {
+			err = s.threadUpdate(c.ID, func(c *Channel) {
+				c.Member = nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// threadMemberUpdate sets the thread member of the current user in a
+// thread.
+func (s *State) threadMemberUpdate(t *ThreadMemberUpdate) error {
+	s.Lock()
+	defer s.Unlock()
+
+	member := *t.ThreadMember
+	return s.threadUpdate(t.ID, func(c *Channel) {
+		c.Member = &member
+	})
+}
+
+// threadMembersUpdate updates the member count of a thread, and the thread
+// member of the current user if it was added or removed.  The guild members
+// added with the thread members are added to the state.
+func (s *State) threadMembersUpdate(t *ThreadMembersUpdate) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, m := range t.AddedMembers {
+		if s.TrackMembers && m.Member != nil && m.Member.User != nil {
+			m.Member.GuildID = t.GuildID
+			if err := s.memberAdd(m.Member); err != nil {
+				return err
+			}
+		}
+		if s.TrackPresences && m.Presence != nil {
+			if err := s.presenceAdd(t.GuildID, m.Presence); err != nil {
+				return err
+			}
+		}
+	}
+
+	return s.threadUpdate(t.ID, func(c *Channel) {
+		c.MemberCount = t.MemberCount
+		if s.User == nil {
+			return
+		}
+
+		for _, m := range t.AddedMembers {
+			if m.ThreadMember != nil && m.UserID == s.User.ID {
+				member := *m.ThreadMember
+				c.Member = &member
+			}
+		}
+		for _, id := range t.RemovedMembers {
+			if id == s.User.ID {
+				c.Member = nil
+			}
+		}
+	})
+}
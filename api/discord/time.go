@@ -42,24 +42,3 @@ func (t *TimeStamps) UnmarshalJSON(b []byte) error {
 	t.StartTimestamp = int64(temp.Start)
 	return nil
 }
-
-// A TimeStamps struct contains start and end times used in the rich presence "playing .." Game
-type TimeStamps struct {
-	EndTimestamp   int64 `json:"end,omitempty"`
-	StartTimestamp int64 `json:"start,omitempty"`
-}
-
-// UnmarshalJSON unmarshals JSON into TimeStamps struct
-func (t *TimeStamps) UnmarshalJSON(b []byte) error {
-	temp := struct {
-		End   float64 `json:"end,omitempty"`
-		Start float64 `json:"start,omitempty"`
-	}{}
-	err := json.Unmarshal(b, &temp)
-	if err != nil {
-		return err
-	}
-	t.EndTimestamp = int64(temp.End)
-	t.StartTimestamp = int64(temp.Start)
-	return nil
-}
@@ -23,6 +23,19 @@ import (
   "golang.org/x/crypto/nacl/secretbox"
 )
 
+// A VoiceState stores the voice states of Guilds
+type VoiceState struct {
+  UserID    string `json:"user_id"`
+  SessionID string `json:"session_id"`
+  ChannelID string `json:"channel_id"`
+  GuildID   string `json:"guild_id"`
+  Suppress  bool   `json:"suppress"`
+  SelfMute  bool   `json:"self_mute"`
+  SelfDeaf  bool   `json:"self_deaf"`
+  Mute      bool   `json:"mute"`
+  Deaf      bool   `json:"deaf"`
+}
+
 // ------------------------------------------------------------------------------------------------
 // Code related to both VoiceConnection Websocket and UDP connections.
 // ------------------------------------------------------------------------------------------------
@@ -64,7 +77,7 @@ type VoiceConnection struct {
   op4 voiceOP4
   op2 voiceOP2
 
-  voiceSpeakingUpdatehandlers []VoiceSpeakingUpdateHandler
+  voiceSpeakingUpdateHandlers []VoiceSpeakingUpdateHandler
 }
 
 // VoiceSpeakingUpdateHandler type provides a functiond definition for the
@@ -94,7 +107,7 @@ func (v *VoiceConnection) Speaking(b bool) (err error) {
 
   data := voiceSpeakingOp{5, voiceSpeakingData{b, 0}}
   v.wsMutex.Lock()
-  err = v.wsConn.WriteJSON(data)
+  err = ws.JSON.Send(v.wsConn, data)
   v.wsMutex.Unlock()
 
   v.Lock()
@@ -119,7 +132,7 @@ func (v *VoiceConnection) ChangeChannel(channelID string, mute, deaf bool) (err
 
   data := voiceChannelJoinOp{4, voiceChannelJoinData{&v.GuildID, &channelID, mute, deaf}}
   v.wsMutex.Lock()
-  err = v.session.wsConn.WriteJSON(data)
+  err = ws.JSON.Send(v.session.wsConn, data)
   v.wsMutex.Unlock()
 
   if err != nil {
@@ -142,7 +155,7 @@ func (v *VoiceConnection) Disconnect() (err error) {
   if v.sessionID != "" {
     data := voiceChannelJoinOp{4, voiceChannelJoinData{&v.GuildID, nil, true, true}}
     v.session.wsMutex.Lock()
-    err = v.session.wsConn.WriteJSON(data)
+    err = ws.JSON.Send(v.session.wsConn, data)
     v.session.wsMutex.Unlock()
     v.sessionID = ""
   }
@@ -186,27 +199,18 @@ func (v *VoiceConnection) Close() {
   }
 
   if v.wsConn != nil {
-    v.log(LogInformational, "sending close frame")
+    v.log(LogInformational, "closing websocket")
 
     // To cleanly close a connection, a client should send a close
     // frame and wait for the server to close the connection.
     v.wsMutex.Lock()
-    err := v.wsConn.WriteMessage(ws.CloseMessage, ws.FormatCloseMessage(ws.CloseNormalClosure, ""))
+    err := v.wsConn.CloseWithReason(ws.CloseNormalClosure, "", 1*time.Second)
     v.wsMutex.Unlock()
 
     if err != nil {
       v.log(LogError, "error closing websocket: %s", err)
     }
 
-    time.Sleep(1 * time.Second)
-
-    v.log(LogInformational, "closing websocket")
-
-    err = v.wsConn.Close()
-    if err != nil {
-      v.log(LogError, "error closing websocket connection: %s", err)
-    }
-
     v.wsConn = nil
   }
 }
@@ -303,7 +307,7 @@ func (v *VoiceConnection) open() (err error) {
   // Connect to VoiceConnection Websocket
   vg := "wss://" + strings.TrimSuffix(v.endpoint, ":80")
   v.log(LogInformational, "connecting to voice endpoint %s", vg)
-  v.wsConn, _, err = websocket.DefaultDialer.Dial(vg, nil)
+  v.wsConn, err = ws.Dial(vg, "", "https://discord.com")
   if err != nil {
     v.log(LogWarning, "error connecting to voice endpoint %s, %s", vg, err)
     v.log(LogDebug, "voice struct: %#v\n", v)
@@ -322,7 +326,7 @@ func (v *VoiceConnection) open() (err error) {
   }
   data := voiceHandshakeOp{0, voiceHandshakeData{v.GuildID, v.UserID, v.sessionID, v.token}}
 
-  err = v.wsConn.WriteJSON(data)
+  err = ws.JSON.Send(v.wsConn, data)
   if err != nil {
     v.log(LogWarning, "error sending init packet, %s", err)
     return
@@ -340,16 +344,17 @@ func (v *VoiceConnection) open() (err error) {
 
 // wsListen listens on the voice websocket for messages and passes them
 // to the voice event handler.  This is automatically called by the Open func
-func (v *VoiceConnection) wsListen(wsConn *websocket.Conn, close <-chan struct{}) {
+func (v *VoiceConnection) wsListen(wsConn *ws.Conn, close <-chan struct{}) {
 
   v.log(LogInformational, "called")
 
   for {
-    _, message, err := v.wsConn.ReadMessage()
+    var message []byte
+    err := ws.Message.Recv(wsConn, &message)
     if err != nil {
       // 4014 indicates a manual disconnection by someone in the guild;
       // we shouldn't reconnect.
-      if websocket.IsCloseError(err, 4014) {
+      if ws.IsCloseError(err, 4014) {
         v.log(LogInformational, "received 4014 manual disconnection")
 
         // Abandon the voice WS connection
@@ -490,7 +495,7 @@ type voiceHeartbeatOp struct {
 // wsHeartbeat sends regular heartbeats to voice Discord so it knows the client
 // is still connected.  If you do not send these heartbeats Discord will
 // disconnect the websocket connection after a few seconds.
-func (v *VoiceConnection) wsHeartbeat(wsConn *websocket.Conn, close <-chan struct{}, i time.Duration) {
+func (v *VoiceConnection) wsHeartbeat(wsConn *ws.Conn, close <-chan struct{}, i time.Duration) {
 
   if close == nil || wsConn == nil {
     return
@@ -502,7 +507,7 @@ func (v *VoiceConnection) wsHeartbeat(wsConn *websocket.Conn, close <-chan struc
   for {
     v.log(LogDebug, "sending heartbeat packet")
     v.wsMutex.Lock()
-    err = wsConn.WriteJSON(voiceHeartbeatOp{3, int(time.Now().Unix())})
+    err = ws.JSON.Send(wsConn, voiceHeartbeatOp{3, int(time.Now().Unix())})
     v.wsMutex.Unlock()
     if err != nil {
       v.log(LogError, "error sending heartbeat to voice endpoint %s, %s", v.endpoint, err)
@@ -621,7 +626,7 @@ func (v *VoiceConnection) udpOpen() (err error) {
   data := voiceUDPOp{1, voiceUDPD{"udp", voiceUDPData{ip, port, "xsalsa20_poly1305"}}}
 
   v.wsMutex.Lock()
-  err = v.wsConn.WriteJSON(data)
+  err = ws.JSON.Send(v.wsConn, data)
   v.wsMutex.Unlock()
   if err != nil {
     v.log(LogWarning, "udp write error, %#v, %s", data, err)
@@ -897,7 +902,7 @@ func (v *VoiceConnection) reconnect() {
     // Send a OP4 with a nil channel to disconnect
     data := voiceChannelJoinOp{4, voiceChannelJoinData{&v.GuildID, nil, true, true}}
     v.session.wsMutex.Lock()
-    err = v.session.wsConn.WriteJSON(data)
+    err = ws.JSON.Send(v.session.wsConn, data)
     v.session.wsMutex.Unlock()
     if err != nil {
       v.log(LogError, "error sending disconnect packet, %s", err)
@@ -42,5 +42,16 @@ type WebhookParams struct {
 	TTS             bool                    `json:"tts,omitempty"`
 	File            string                  `json:"file,omitempty"`
 	Embeds          []*MessageEmbed         `json:"embeds,omitempty"`
+	Components      []MessageComponent      `json:"components,omitempty"`
+	AllowedMentions *MessageAllowedMentions `json:"allowed_mentions,omitempty"`
+	// NOTE: Works only for followup messages.
+	Flags MessageFlags `json:"flags,omitempty"`
+}
+
+// WebhookEdit stores data for editing of a webhook message.
+type WebhookEdit struct {
+	Content         string                  `json:"content,omitempty"`
+	Components      []MessageComponent      `json:"components,omitempty"`
+	Embeds          []*MessageEmbed         `json:"embeds,omitempty"`
 	AllowedMentions *MessageAllowedMentions `json:"allowed_mentions,omitempty"`
 }
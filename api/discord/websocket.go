@@ -12,6 +12,8 @@ package discord
 
 import (
   "errors"
+
+  "github.com/abeiron/hrngh/api/ws"
 )
 
 // ErrWsAlreadyOpen is thrown when you attempt to open
@@ -34,3 +36,189 @@ type resumePacket struct {
     Sequence  string `json:"seq"`
   } `json:"d"`
 }
+
+type requestGuildMembersData struct {
+  GuildID   string `json:"guild_id"`
+  Query     string `json:"query"`
+  Limit     int    `json:"limit"`
+  Nonce     string `json:"nonce,omitempty"`
+  Presences bool   `json:"presences"`
+}
+
+type requestGuildMembersOp struct {
+  Op   int                     `json:"op"`
+  Data requestGuildMembersData `json:"d"`
+}
+
+// RequestGuildMembers requests guild members from the gateway.
+// The gateway responds with GuildMembersChunk events.
+// guildID   : The ID of the guild to request members of.
+// query     : String that username starts with, leave empty to return all members.
+// limit     : Max number of items to return, or 0 to request all members matched.
+// nonce     : Identifies the GuildMembersChunk events answering this request, at most 32 bytes.
+// presences : Whether to request presences of guild members.
+func (s *Session) RequestGuildMembers(guildID, query string, limit int, nonce string, presences bool) (err error) {
+  s.RLock()
+  defer s.RUnlock()
+  if s.wsConn == nil {
+    return ErrWsNotFound
+  }
+
+  data := requestGuildMembersData{
+    GuildID:   guildID,
+    Query:     query,
+    Limit:     limit,
+    Nonce:     nonce,
+    Presences: presences,
+  }
+
+  s.wsMutex.Lock()
+  err = ws.JSON.Send(s.wsConn, requestGuildMembersOp{8, data})
+  s.wsMutex.Unlock()
+
+  return
+}
+
+type voiceChannelJoinData struct {
+  GuildID   *string `json:"guild_id"`
+  ChannelID *string `json:"channel_id"`
+  SelfMute  bool    `json:"self_mute"`
+  SelfDeaf  bool    `json:"self_deaf"`
+}
+
+type voiceChannelJoinOp struct {
+  Op   int                  `json:"op"`
+  Data voiceChannelJoinData `json:"d"`
+}
+
+// ChannelVoiceJoin joins the session user to a voice channel.
+//
+//    gID     : Guild ID of the channel to join.
+//    cID     : Channel ID of the channel to join.
+//    mute    : If true, you will be set to muted upon joining.
+//    deaf    : If true, you will be set to deafened upon joining.
+func (s *Session) ChannelVoiceJoin(gID, cID string, mute, deaf bool) (voice *VoiceConnection, err error) {
+  s.log(LogInformational, "called")
+
+  s.Lock()
+  if s.VoiceConnections == nil {
+    s.VoiceConnections = make(map[string]*VoiceConnection)
+  }
+  voice = s.VoiceConnections[gID]
+  if voice == nil {
+    voice = &VoiceConnection{LogLevel: s.LogLevel}
+    s.VoiceConnections[gID] = voice
+  }
+  s.Unlock()
+
+  voice.Lock()
+  voice.GuildID = gID
+  voice.ChannelID = cID
+  voice.deaf = deaf
+  voice.mute = mute
+  voice.session = s
+  voice.Unlock()
+
+  err = s.ChannelVoiceJoinManual(gID, cID, mute, deaf)
+  if err != nil {
+    return
+  }
+
+  err = voice.waitUntilConnected()
+  if err != nil {
+    s.log(LogWarning, "error waiting for voice to connect, %s", err)
+    voice.Close()
+    return
+  }
+
+  return
+}
+
+// ChannelVoiceJoinManual initiates a voice session to a voice channel, but does not complete it.
+//
+// This should only be used when the VoiceServerUpdate will be intercepted and used elsewhere.
+//
+//    gID     : Guild ID of the channel to join.
+//    cID     : Channel ID of the channel to join, leave empty to disconnect.
+//    mute    : If true, you will be set to muted upon joining.
+//    deaf    : If true, you will be set to deafened upon joining.
+func (s *Session) ChannelVoiceJoinManual(gID, cID string, mute, deaf bool) (err error) {
+  s.log(LogInformational, "called")
+
+  s.RLock()
+  defer s.RUnlock()
+  if s.wsConn == nil {
+    return ErrWsNotFound
+  }
+
+  var channelID *string
+  if cID != "" {
+    channelID = &cID
+  }
+
+  data := voiceChannelJoinOp{4, voiceChannelJoinData{&gID, channelID, mute, deaf}}
+  s.wsMutex.Lock()
+  err = ws.JSON.Send(s.wsConn, data)
+  s.wsMutex.Unlock()
+
+  return
+}
+
+// onVoiceStateUpdate handles VoiceStateUpdate events on the gateway
+// connection, keeping the voice session ID of our own VoiceConnections.
+func (s *Session) onVoiceStateUpdate(st *VoiceStateUpdate) {
+  // If we don't have a connection for the channel, don't bother.
+  if st.ChannelID == "" {
+    return
+  }
+
+  s.RLock()
+  voice, exists := s.VoiceConnections[st.GuildID]
+  s.RUnlock()
+  if !exists {
+    return
+  }
+
+  // We only care about events that are about us.
+  if s.State == nil || s.State.User == nil || s.State.User.ID != st.UserID {
+    return
+  }
+
+  voice.Lock()
+  voice.UserID = st.UserID
+  voice.sessionID = st.SessionID
+  voice.ChannelID = st.ChannelID
+  voice.Unlock()
+}
+
+// onVoiceServerUpdate handles the VoiceServerUpdate event on the gateway
+// connection, (re)opening the voice connection of the guild.
+func (s *Session) onVoiceServerUpdate(st *VoiceServerUpdate) {
+  s.log(LogInformational, "called")
+
+  s.RLock()
+  voice, exists := s.VoiceConnections[st.GuildID]
+  s.RUnlock()
+
+  // If no VoiceConnection exists, just skip this.
+  if !exists {
+    return
+  }
+
+  // If currently connected to voice ws/udp, then disconnect.
+  // Has no effect if not connected.
+  voice.Close()
+
+  // Store values for later use.
+  voice.Lock()
+  voice.token = st.Token
+  voice.endpoint = st.Endpoint
+  voice.GuildID = st.GuildID
+  voice.Unlock()
+
+  // Open a connection to the voice server.
+  err := voice.open()
+  if err != nil {
+    s.log(LogError, "onVoiceServerUpdate voice.open, %s", err)
+  }
+}
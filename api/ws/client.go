@@ -9,24 +9,17 @@ package ws
 
 import (
 	"bufio"
+	"context"
+	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"net/url"
+	"time"
 
 	"github.com/abeiron/hrngh/internal/config"
 )
 
-// DialError is an error that occurs while dialing a WebSocket server.
-type DialError struct {
-	*config.Ws
-	Err error
-}
-
-func (e *DialError) Error() string {
-	return "websocket.Dial " + e.Ws.Location.String() + ": " + e.Err.Error()
-}
-
 // NewConfig creates a new WebSocket configuraton for client connection.
 func NewConfig(server, origin string) (cfg *config.Ws, err error) {
 	cfg = new(config.Ws)
@@ -49,13 +42,21 @@ func NewConfig(server, origin string) (cfg *config.Ws, err error) {
 func NewClient(cfg *config.Ws, rwc io.ReadWriteCloser) (ws *Conn, err error) {
 	br := bufio.NewReader(rwc)
 	bw := bufio.NewWriter(rwc)
-	err = hybiClientHandshake(cfg, br, bw)
+
+	if cfg.Observer != nil {
+		cfg.Observer.HandshakeStart(true)
+		start := time.Now()
+		defer func() { cfg.Observer.HandshakeFinish(true, time.Since(start), err) }()
+	}
+
+	deflate, err := hybiClientHandshake(cfg, br, bw)
 	if err != nil {
 		return
 	}
 
 	buf := bufio.NewReadWriter(br, bw)
 	ws = newHybiClientConn(cfg, buf, rwc)
+	ws.setDeflate(deflate)
 
 	return
 }
@@ -80,42 +81,103 @@ var portMap = map[string]string{
 }
 
 func parseAuthority(location *url.URL) string {
-	if _, ok := portMap[location.Schema]; ok {
+	if _, ok := portMap[location.Scheme]; ok {
 		if _, _, err := net.SplitHostPort(location.Host); err != nil {
-			return net.JoinHostPort(location.Host, portMap[location.Schema])
+			return net.JoinHostPort(location.Host, portMap[location.Scheme])
 		}
 	}
 
 	return location.Host
 }
 
+// DialConfig opens a new client connection to a WebSocket server with
+// the given configuration.
 func DialConfig(cfg *config.Ws) (ws *Conn, err error) {
-	var client net.Conn
+	return DialContext(context.Background(), cfg)
+}
+
+// DialContext opens a new client connection to a WebSocket server with
+// the given configuration.  If ctx is done before the connection is
+// established, the dial is aborted; once established, the connection is
+// not affected by ctx.  cfg.HandshakeTimeout further limits the time the
+// dial may take.
+//
+// Errors are of type *DialError.  If the server or a proxy refuses the
+// connection, the error holds the HTTP status and body of its response.
+func DialContext(ctx context.Context, cfg *config.Ws) (ws *Conn, err error) {
 	if cfg.Location == nil {
-		return nil, &DialError{cfg, ErrBadLocation}
+		return nil, &DialError{Ws: cfg, Err: ErrBadLocation}
 	}
 	if cfg.Origin == nil {
-		return nil, &DialError{cfg, ErrBadOrigin}
+		return nil, &DialError{Ws: cfg, Err: ErrBadOrigin}
 	}
 
-	dialer := cfg.Dialer
-	if dialer == nil {
-		dialer = &net.Dialer{}
+	if cfg.HandshakeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.HandshakeTimeout)
+		defer cancel()
 	}
 
-	client, err = dialWithDialer(dialer, config)
+	client, err := dialContext(ctx, cfg)
 	if err != nil {
-		goto Error
+		return nil, newDialError(ctx, cfg, err)
 	}
 
-	ws, err = NewClient(cfg, client)
+	err = withContext(ctx, client, func() (err error) {
+		ws, err = NewClient(cfg, client)
+		return
+	})
 	if err != nil {
 		client.Close()
-		goto Error
+		return nil, newDialError(ctx, cfg, err)
 	}
 
-	return
+	return ws, nil
+}
+
+// DialError is an error that occurs while dialing a WebSocket server.
+type DialError struct {
+	*config.Ws
+	Err error
+
+	// StatusCode, Header and Body hold the response of the server or the
+	// proxy which refused the connection, if any.  Body is truncated.
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+func (e *DialError) Error() string {
+	msg := "websocket.Dial: " + e.Err.Error()
+	if e.Ws != nil && e.Ws.Location != nil {
+		msg = "websocket.Dial " + e.Ws.Location.String() + ": " + e.Err.Error()
+	}
+	if e.StatusCode != 0 {
+		msg += fmt.Sprintf(" (%d %s)", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+
+	return msg
+}
+
+// Unwrap returns the underlying error.
+func (e *DialError) Unwrap() error { return e.Err }
+
+// newDialError wraps an error of a dial, preferring the context's error
+// if it is what ended the dial.
+func newDialError(ctx context.Context, cfg *config.Ws, err error) *DialError {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		if ne, ok := err.(net.Error); (ok && ne.Timeout()) || err == io.EOF {
+			err = ctxErr
+		}
+	}
+
+	de := &DialError{Ws: cfg, Err: err}
+	if se, ok := err.(*statusError); ok {
+		de.Err = se.err
+		de.StatusCode = se.resp.StatusCode
+		de.Header = se.resp.Header
+		de.Body = se.body
+	}
 
-Error:
-	return nil, &DialError{cfg, err}
+	return de
 }
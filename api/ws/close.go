@@ -0,0 +1,246 @@
+// WebSocket implementation for the Hrngh bot.
+// Available at https://github.com/abeiron/hrngh
+
+// Copyright 2020-2021, Undying Memory <abeiron@outlook.com>.  All rights reserved.
+// Use of this source code is governed by the Microsoft Public License
+// that can be found in the LICENSE file.
+
+// This file contains code related to the closing handshake.
+// https://tools.ietf.org/html/rfc6455#section-7
+
+package ws
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+	"unicode/utf8"
+)
+
+// Close codes defined in RFC 6455, section 11.7.
+const (
+	CloseNormalClosure           = 1000
+	CloseGoingAway               = 1001
+	CloseProtocolError           = 1002
+	CloseUnsupportedData         = 1003
+	CloseNoStatusReceived        = 1005
+	CloseAbnormalClosure         = 1006
+	CloseInvalidFramePayloadData = 1007
+	ClosePolicyViolation         = 1008
+	CloseMessageTooBig           = 1009
+	CloseMandatoryExtension      = 1010
+	CloseInternalServerErr       = 1011
+	CloseServiceRestart          = 1012
+	CloseTryAgainLater           = 1013
+	CloseBadGateway              = 1014
+	CloseTLSHandshake            = 1015
+)
+
+// maxCloseReasonLength is the longest reason which fits in a close frame
+// after its code.
+const maxCloseReasonLength = maxControlFramePayloadLength - 2
+
+var (
+	ErrBadCloseCode   = &ProtocolError{"bad close code"}
+	ErrBadCloseReason = &ProtocolError{"bad close reason"}
+	ErrCloseSent      = &ProtocolError{"close frame already sent"}
+	ErrCloseTimeout   = &ProtocolError{"timed out waiting for close frame"}
+)
+
+var closeCodeNames = map[int]string{
+	CloseNormalClosure:           "normal",
+	CloseGoingAway:               "going away",
+	CloseProtocolError:           "protocol error",
+	CloseUnsupportedData:         "unsupported data",
+	CloseNoStatusReceived:        "no status",
+	CloseAbnormalClosure:         "abnormal closure",
+	CloseInvalidFramePayloadData: "invalid payload data",
+	ClosePolicyViolation:         "policy violation",
+	CloseMessageTooBig:           "message too big",
+	CloseMandatoryExtension:      "mandatory extension missing",
+	CloseInternalServerErr:       "internal server error",
+	CloseServiceRestart:          "service restart",
+	CloseTryAgainLater:           "try again later",
+	CloseBadGateway:              "bad gateway",
+	CloseTLSHandshake:            "TLS handshake error",
+}
+
+// CloseError is returned by reads once the peer has sent a close frame.
+// Code is CloseNoStatusReceived if the frame carried no code.
+type CloseError struct {
+	Code int
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	s := fmt.Sprintf("websocket: close %d", e.Code)
+	if name, ok := closeCodeNames[e.Code]; ok {
+		s += " (" + name + ")"
+	}
+	if e.Text != "" {
+		s += ": " + e.Text
+	}
+
+	return s
+}
+
+// IsCloseError reports whether err is a *CloseError with one of codes.
+func IsCloseError(err error, codes ...int) bool {
+	var e *CloseError
+	if !errors.As(err, &e) {
+		return false
+	}
+
+	for _, code := range codes {
+		if e.Code == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validCloseCode reports whether code may be sent in a close frame.  Codes
+// 3000-4999 are left to libraries and applications, such as the Discord
+// gateway's 4000-4014.
+func validCloseCode(code int) bool {
+	switch {
+	case code >= CloseNormalClosure && code <= CloseUnsupportedData:
+		return true
+	case code >= CloseInvalidFramePayloadData && code <= CloseBadGateway:
+		return true
+	case code >= 3000 && code <= 4999:
+		return true
+	}
+
+	return false
+}
+
+// CloseWithReason performs the closing handshake: it sends a close frame
+// with code and text, waits up to timeout for the peer's close frame, and
+// closes the connection.  Messages received meanwhile are discarded, unless
+// another goroutine is reading them.  If timeout is zero, it does not wait.
+//
+// Code must be valid to send, and text at most 123 bytes of UTF-8.
+func (ws *Conn) CloseWithReason(code int, text string, timeout time.Duration) error {
+	if !validCloseCode(code) {
+		return ErrBadCloseCode
+	}
+	if len(text) > maxCloseReasonLength || !utf8.ValidString(text) {
+		return ErrBadCloseReason
+	}
+
+	ws.stopQueue()
+
+	err := ws.writeClose(code, text)
+	if err == nil && timeout > 0 {
+		err = ws.awaitClose(timeout)
+	}
+
+	err1 := ws.rwc.Close()
+	if err != nil {
+		return err
+	}
+
+	return err1
+}
+
+// awaitClose waits for the peer's close frame, reading it unless another
+// goroutine is reading already.
+func (ws *Conn) awaitClose(timeout time.Duration) error {
+	ws.SetReadDeadline(time.Now().Add(timeout))
+
+	go func() {
+		ws.rio.Lock()
+		defer ws.rio.Unlock()
+
+		for {
+			if _, err := ws.nextMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+
+	select {
+	case <-ws.closeReceived:
+		return nil
+	case <-t.C:
+		return ErrCloseTimeout
+	}
+}
+
+// writeClose sends a close frame, unless one was sent already.
+// CloseNoStatusReceived sends a frame without a code.
+func (ws *Conn) writeClose(code int, text string) error {
+	ws.wio.Lock()
+	defer ws.wio.Unlock()
+
+	if ws.closeSent {
+		return ErrCloseSent
+	}
+	ws.closeSent = true
+
+	w, err := ws.frameWriterFactory.NewFrameWriter(CloseFrame)
+	if err != nil {
+		return err
+	}
+
+	var msg []byte
+	if code != CloseNoStatusReceived {
+		msg = make([]byte, 2, 2+len(text))
+		binary.BigEndian.PutUint16(msg, uint16(code))
+		msg = append(msg, text...)
+	}
+
+	if _, err = w.Write(msg); err == nil && ws.observer != nil {
+		ws.observer.Close(code, true)
+	}
+	w.Close()
+	return err
+}
+
+// readClose reads the close frame of the peer, which HandleFrame has checked
+// is at most 125 bytes long, and answers it.  It returns the *CloseError
+// reads return from then on, or another error if the frame is malformed.
+// ws.rio must be held.
+func (ws *Conn) readClose(frame *hybiFrameReader) error {
+	msg, err := ioutil.ReadAll(frame)
+	if err != nil {
+		return err
+	}
+
+	closeErr := &CloseError{Code: CloseNoStatusReceived}
+	switch {
+	case len(msg) == 1:
+		ws.writeClose(CloseProtocolError, "")
+		return io.EOF
+	case len(msg) >= 2:
+		closeErr.Code = int(binary.BigEndian.Uint16(msg))
+		closeErr.Text = string(msg[2:])
+		if !validCloseCode(closeErr.Code) {
+			ws.writeClose(CloseProtocolError, "")
+			return io.EOF
+		}
+		if !utf8.ValidString(closeErr.Text) {
+			ws.writeClose(CloseInvalidFramePayloadData, "")
+			return io.EOF
+		}
+	}
+
+	if ws.observer != nil {
+		ws.observer.Close(closeErr.Code, false)
+	}
+
+	// Echo the code, unless the close frame answers ours.
+	ws.writeClose(closeErr.Code, "")
+
+	ws.closeErr = closeErr
+	close(ws.closeReceived)
+	return closeErr
+}
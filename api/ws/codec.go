@@ -7,25 +7,80 @@
 
 package ws
 
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
 // Codec represents a symmetric pair of functions that implement a codec.
+//
+// Encode and Decode are optional.  If set, Send encodes into a pooled buffer
+// rather than a fresh slice, and Recv decodes from the message as it is
+// read rather than from a copy of it.
 type Codec struct {
 	Marshal   func(v interface{}) (data []byte, pt byte, err error)
 	Unmarshal func(data []byte, pt byte, v interface{}) (err error)
+
+	Encode func(buf *bytes.Buffer, v interface{}) (pt byte, err error)
+	Decode func(r io.Reader, pt byte, v interface{}) (err error)
+}
+
+// maxPooledBuffer is the capacity past which buffers are not put back in
+// bufferPool, so that a few large messages do not pin their memory.
+const maxPooledBuffer = 64 << 10
+
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBuffer {
+		return
+	}
+
+	buf.Reset()
+	bufferPool.Put(buf)
 }
 
 // Send sends a 'v' marshalled by c.Marshal as a single frame to 'ws'.
 func (c Codec) Send(ws *Conn, v interface{}) (err error) {
-	data, pt, err := c.Marshal(v)
+	var data []byte
+	var pt byte
+
+	if c.Encode != nil {
+		buf := getBuffer()
+		defer putBuffer(buf)
+
+		pt, err = c.Encode(buf, v)
+		data = buf.Bytes()
+	} else {
+		data, pt, err = c.Marshal(v)
+	}
 	if err != nil {
 		return err
 	}
 
+	if ws.queue != nil {
+		msg := make([]byte, len(data))
+		copy(msg, data)
+		return ws.enqueueData(pt, msg)
+	}
+
+	ws.mio.Lock()
+	defer ws.mio.Unlock()
 	ws.wio.Lock()
 	defer ws.wio.Unlock()
 
-	w, err := ws.frameWriterFactory.NewFrameWriter(pt)
+	w, err := ws.newDataFrameWriter(pt)
 	if err != nil {
-		return nil
+		return err
 	}
 
 	_, err = w.Write(data)
@@ -34,62 +89,32 @@ func (c Codec) Send(ws *Conn, v interface{}) (err error) {
 	return err
 }
 
-// Recv receives single frame from ws, unmarshalled by c.Unmarshal and stores
-// in 'v'. The whole frame payload is read to an in-memory buffer; max size of
-// payload is defined by ws.MaxPayloadBytes. If frame payload size exceeds
-// limit, ErrFrameTooLarge is returned; in this case frame is not read off wire
-// completely. The next call to Receive would read and discard leftover data of
-// previous oversized frame before processing next frame.
+// Recv receives a single message from ws, unmarshalled by c.Unmarshal and
+// stores in 'v'. The whole message payload, reassembled from its frames, is
+// read to an in-memory buffer; max size of payload is defined by
+// ws.MaxPayloadBytes. If message payload size exceeds limit, ErrFrameTooLarge
+// is returned; in this case message is not read off wire completely. The next
+// call to Receive would read and discard leftover data of previous oversized
+// message before processing next message.
 func (c Codec) Recv(ws *Conn, v interface{}) (err error) {
 	ws.rio.Lock()
 	defer ws.rio.Unlock()
 
-	if ws.frameReader != nil {
-		_, err = io.Copy(ioutil.Discard, ws.frameReader)
-		if err != nil {
-			return err
-		}
-
-		ws.frameReader = nil
-	}
-
-again:
-	frame, err := ws.frameReaderFactory.NewFrameReader()
+	r, err := ws.nextMessage()
 	if err != nil {
 		return err
 	}
 
-	frame, err = ws.frameHandler.HandleFrame(frame)
-	if err != nil {
-		return err
+	if c.Decode != nil {
+		return c.Decode(r, r.payloadType, v)
 	}
 
-	if frame == nil {
-		goto again
-	}
-
-	maxPayloadBytes := ws.MaxPayloadBytes
-	if maxPayloadBytes == 0 {
-		maxPayloadBytes = DefaultMaxPayloadBytes
-	}
-
-	if hf, ok := frame.(*hybiFrameReader); ok && hf.header.Length > int64(maxPayloadBytes) {
-		// Payload size exceeds limit, so there is no need to call Unmarshal.
-		//
-		// Set frameReader to current oversized frame so that
-		// the next call to this function can drain any leftover
-		// data before processing the next frame.
-		ws.frameReader = frame
-		return ErrFrameTooLarge
-	}
-
-	pt := frame.PayloadType()
-	data, err := ioutil.ReadAll(frame)
+	data, err := ioutil.ReadAll(r)
 	if err != nil {
 		return err
 	}
 
-	return c.Unmarshal(data, pt, v)
+	return c.Unmarshal(data, r.payloadType, v)
 }
 
 func marshal(v interface{}) (msg []byte, pt byte, err error) {
@@ -135,7 +160,7 @@ Trivial usage:
 	data = []byte{0, 1, 2}
 	ws.Message.Send(ws, data)
 */
-var Message = Codec{marshal, unmarshal}
+var Message = Codec{Marshal: marshal, Unmarshal: unmarshal}
 
 func jsonMarshal(v interface{}) (msg []byte, payloadType byte, err error) {
 	msg, err = json.Marshal(v)
@@ -160,4 +185,98 @@ Trivial usage:
 	// send JSON type T
 	ws.JSON.Send(ws, data)
 */
-var JSON = Codec{jsonMarshal, jsonUnmarshal}
+var JSON = Codec{Marshal: jsonMarshal, Unmarshal: jsonUnmarshal}
+
+func jsonEncode(buf *bytes.Buffer, v interface{}) (payloadType byte, err error) {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err = enc.Encode(v); err != nil {
+		return TextFrame, err
+	}
+
+	// Drop the newline Encode ends with.
+	buf.Truncate(buf.Len() - 1)
+	return TextFrame, nil
+}
+
+// ErrJSONTrailing is returned by StreamJSON for a message holding more than
+// a JSON value, which json.Unmarshal rejects too.
+var ErrJSONTrailing = &ProtocolError{"json: data after the value"}
+
+func jsonDecode(r io.Reader, payloadType byte, v interface{}) (err error) {
+	dec := json.NewDecoder(r)
+	if err = dec.Decode(v); err != nil {
+		// An empty message is not the end of the connection.
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	if _, err = dec.Token(); err != io.EOF {
+		if err == nil {
+			return ErrJSONTrailing
+		}
+		return err
+	}
+
+	return nil
+}
+
+/*
+StreamJSON is a codec to send/receive JSON data like JSON, which encodes into
+a pooled buffer and decodes from the frames as they are read: Send does not
+allocate the message, and Recv does not copy it.  It does not escape HTML
+characters in strings.
+Trivial usage:
+
+	import "github.com/abeiron/hrngh/api/ws"
+	var data T
+	ws.StreamJSON.Recv(ws, &data)
+	ws.StreamJSON.Send(ws, data)
+*/
+var StreamJSON = Codec{
+	Marshal:   jsonMarshal,
+	Unmarshal: jsonUnmarshal,
+	Encode:    jsonEncode,
+	Decode:    jsonDecode,
+}
+
+var (
+	codecMu sync.RWMutex
+	codecs  = map[string]Codec{
+		"etf":     ETF,
+		"json":    StreamJSON,
+		"msgpack": MessagePack,
+	}
+)
+
+// RegisterCodec registers the codec for a subprotocol, replacing any
+// registered before.  "etf", "json" and "msgpack" are registered by default.
+func RegisterCodec(subprotocol string, c Codec) {
+	codecMu.Lock()
+	defer codecMu.Unlock()
+
+	codecs[subprotocol] = c
+}
+
+// LookupCodec returns the codec registered for a subprotocol.
+func LookupCodec(subprotocol string) (c Codec, ok bool) {
+	codecMu.RLock()
+	defer codecMu.RUnlock()
+
+	c, ok = codecs[subprotocol]
+	return c, ok
+}
+
+// Codec returns the codec registered for the subprotocol negotiated in the
+// handshake, or Message if there is none.
+func (ws *Conn) Codec() Codec {
+	if len(ws.cfg.Protocol) == 1 {
+		if c, ok := LookupCodec(ws.cfg.Protocol[0]); ok {
+			return c
+		}
+	}
+
+	return Message
+}
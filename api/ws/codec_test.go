@@ -0,0 +1,300 @@
+// WebSocket implementation for the Hrngh bot.
+// Available at https://github.com/abeiron/hrngh
+
+// Copyright 2020-2021, Undying Memory <abeiron@outlook.com>.  All rights reserved.
+// Use of this source code is governed by the Microsoft Public License
+// that can be found in the LICENSE file.
+
+// This file contains tests of the codecs, and benchmarks comparing their time
+// and allocations per message, sending and receiving a gateway event over a
+// connection whose other end is a raw peer on an in-memory pipe, so that only
+// the codec and the ws.Conn allocate.  Run them with:
+//
+//	go test ./api/ws -run '^$' -bench . -benchmem
+
+package ws_test
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/abeiron/hrngh/api/ws"
+)
+
+// A gatewayEvent is shaped like a MESSAGE_CREATE dispatch of the Discord
+// gateway.
+type gatewayEvent struct {
+	Op       int            `json:"op"`
+	Sequence int64          `json:"s"`
+	Type     string         `json:"t"`
+	Data     gatewayMessage `json:"d"`
+}
+
+type gatewayMessage struct {
+	ID        string        `json:"id"`
+	ChannelID string        `json:"channel_id"`
+	GuildID   string        `json:"guild_id"`
+	Content   string        `json:"content"`
+	Timestamp string        `json:"timestamp"`
+	TTS       bool          `json:"tts"`
+	Author    gatewayUser   `json:"author"`
+	Mentions  []gatewayUser `json:"mentions"`
+	Roles     []string      `json:"mention_roles"`
+}
+
+type gatewayUser struct {
+	ID            string `json:"id"`
+	Username      string `json:"username"`
+	Discriminator string `json:"discriminator"`
+	Avatar        string `json:"avatar"`
+	Bot           bool   `json:"bot"`
+}
+
+var sampleEvent = gatewayEvent{
+	Op:       0,
+	Sequence: 42,
+	Type:     "MESSAGE_CREATE",
+	Data: gatewayMessage{
+		ID:        "812359872391036938",
+		ChannelID: "769297128736309278",
+		GuildID:   "769297128736309274",
+		Content:   "The quick brown fox jumps over the lazy dog, twice: the quick brown fox jumps over the lazy dog.",
+		Timestamp: "2021-02-19T17:42:01.354000+00:00",
+		Author: gatewayUser{
+			ID:            "160549817593757696",
+			Username:      "abeiron",
+			Discriminator: "0001",
+			Avatar:        "a_4d1b3c2e6f7a8b9c0d1e2f3a4b5c6d7e",
+		},
+		Mentions: []gatewayUser{{ID: "235088799074484224", Username: "Rythm", Discriminator: "3722", Bot: true}},
+		Roles:    []string{"769297128736309275", "769297128736309276"},
+	},
+}
+
+var benchCodecs = []struct {
+	name  string
+	codec ws.Codec
+}{
+	{"JSON", ws.JSON},
+	{"StreamJSON", ws.StreamJSON},
+	{"MessagePack", ws.MessagePack},
+	{"ETF", ws.ETF},
+}
+
+// pipe returns a client connection whose server end is a raw peer, past the
+// handshake.
+func pipe() (*ws.Conn, net.Conn, error) {
+	client, server := net.Pipe()
+
+	go func() {
+		br := bufio.NewReader(server)
+		req, err := http.ReadRequest(br)
+		if err != nil {
+			server.Close()
+			return
+		}
+
+		h := sha1.New()
+		io.WriteString(h, req.Header.Get("Sec-WebSocket-Key")+websocketGUID)
+		io.WriteString(server, "HTTP/1.1 101 Switching Protocols\r\n"+
+			"Upgrade: websocket\r\n"+
+			"Connection: Upgrade\r\n"+
+			"Sec-WebSocket-Accept: "+base64.StdEncoding.EncodeToString(h.Sum(nil))+"\r\n\r\n")
+	}()
+
+	cfg, err := ws.NewConfig("ws://localhost/", "http://localhost/")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c, err := ws.NewClient(cfg, client)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return c, server, nil
+}
+
+// TestCodecs sends the sample event with every codec and receives it back.
+func TestCodecs(t *testing.T) {
+	for _, bc := range benchCodecs {
+		bc := bc
+		t.Run(bc.name, func(t *testing.T) {
+			msg, pt, err := bc.codec.Marshal(&sampleEvent)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var e gatewayEvent
+			if err = bc.codec.Unmarshal(msg, pt, &e); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(e, sampleEvent) {
+				t.Errorf("Unmarshal: got %+v, want %+v", e, sampleEvent)
+			}
+
+			c, server, err := pipe()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+			defer server.Close()
+
+			go server.Write(frame{fin: true, opcode: pt, payload: msg}.encode(false))
+
+			e = gatewayEvent{}
+			if err = bc.codec.Recv(c, &e); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(e, sampleEvent) {
+				t.Errorf("Recv: got %+v, want %+v", e, sampleEvent)
+			}
+		})
+	}
+}
+
+// TestETF decodes terms the way the Discord gateway encodes them.
+func TestETF(t *testing.T) {
+	// #{op => 0, s => nil, t => <<"READY">>, d => #{id => 3000000000, v => [9]}},
+	// with the keys as atoms, 3000000000 as a bignum and [9] as a string.
+	term := []byte{
+		131, 116, 0, 0, 0, 4,
+		119, 2, 'o', 'p', 97, 0,
+		119, 1, 's', 119, 3, 'n', 'i', 'l',
+		119, 1, 't', 109, 0, 0, 0, 5, 'R', 'E', 'A', 'D', 'Y',
+		119, 1, 'd', 116, 0, 0, 0, 2,
+		119, 2, 'i', 'd', 110, 4, 0, 0x00, 0x5e, 0xd0, 0xb2,
+		119, 1, 'v', 107, 0, 1, 9,
+	}
+
+	var e struct {
+		Op       int    `json:"op"`
+		Sequence *int64 `json:"s"`
+		Type     string `json:"t"`
+		Data     struct {
+			ID      string `json:"id"`
+			Version []int  `json:"v"`
+		} `json:"d"`
+	}
+	if err := ws.ETF.Unmarshal(term, ws.BinaryFrame, &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Op != 0 || e.Sequence != nil || e.Type != "READY" || e.Data.ID != "3000000000" || !reflect.DeepEqual(e.Data.Version, []int{9}) {
+		t.Errorf("got %+v", e)
+	}
+
+	var v interface{}
+	if err := ws.ETF.Unmarshal(term, ws.BinaryFrame, &v); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"op": int64(0),
+		"s":  nil,
+		"t":  "READY",
+		"d":  map[string]interface{}{"id": int64(3000000000), "v": []interface{}{int64(9)}},
+	}
+	if !reflect.DeepEqual(v, want) {
+		t.Errorf("got %#v, want %#v", v, want)
+	}
+
+	if err := ws.ETF.Unmarshal(append(term, 106), ws.BinaryFrame, &v); err != ws.ErrEtfTrailing {
+		t.Errorf("trailing data: got %v, want %v", err, ws.ErrEtfTrailing)
+	}
+}
+
+// TestStreamJSONTrailing checks that StreamJSON rejects what json.Unmarshal
+// rejects.
+func TestStreamJSONTrailing(t *testing.T) {
+	for _, msg := range []string{`{"op":1} {"op":2}`, `{"op":1}}`, ``} {
+		c, server, err := pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		go server.Write(frame{fin: true, opcode: opText, payload: []byte(msg)}.encode(false))
+
+		var e gatewayEvent
+		if err = ws.StreamJSON.Recv(c, &e); err == nil {
+			t.Errorf("%q: no error", msg)
+		}
+
+		server.Close()
+		c.Close()
+	}
+}
+
+func benchSend(codec ws.Codec) func(b *testing.B) {
+	return func(b *testing.B) {
+		c, server, err := pipe()
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer server.Close()
+		defer c.Close()
+		go io.Copy(ioutil.Discard, server)
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if err := codec.Send(c, &sampleEvent); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func benchRecv(codec ws.Codec) func(b *testing.B) {
+	return func(b *testing.B) {
+		msg, pt, err := codec.Marshal(&sampleEvent)
+		if err != nil {
+			b.Fatal(err)
+		}
+		f := frame{fin: true, opcode: pt, payload: msg}.encode(false)
+
+		c, server, err := pipe()
+		if err != nil {
+			b.Fatal(err)
+		}
+		// Nothing reads the close frame, so close the peer first.
+		defer c.Close()
+		defer server.Close()
+
+		n := b.N
+		go func() {
+			for i := 0; i < n; i++ {
+				if _, err := server.Write(f); err != nil {
+					return
+				}
+			}
+		}()
+
+		b.ReportAllocs()
+		b.SetBytes(int64(len(msg)))
+		b.ResetTimer()
+		for i := 0; i < n; i++ {
+			var e gatewayEvent
+			if err := codec.Recv(c, &e); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkSend(b *testing.B) {
+	for _, bc := range benchCodecs {
+		b.Run(bc.name, benchSend(bc.codec))
+	}
+}
+
+func BenchmarkRecv(b *testing.B) {
+	for _, bc := range benchCodecs {
+		b.Run(bc.name, benchRecv(bc.codec))
+	}
+}
@@ -0,0 +1,440 @@
+// WebSocket implementation for the Hrngh bot.
+// Available at https://github.com/abeiron/hrngh
+
+// Copyright 2020-2021, Undying Memory <abeiron@outlook.com>.  All rights reserved.
+// Use of this source code is governed by the Microsoft Public License
+// that can be found in the LICENSE file.
+
+// This file implements the permessage-deflate extension.
+// https://tools.ietf.org/html/rfc7692
+
+package ws
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/abeiron/hrngh/internal/config"
+)
+
+const (
+	permessageDeflate = "permessage-deflate"
+
+	// maxWindowBits is the size of the LZ77 window compress/flate uses.
+	maxWindowBits = 15
+	maxWindowSize = 1 << maxWindowBits
+)
+
+// deflateTail is appended to a compressed message to recover the empty
+// stored block stripped by the sender, followed by a final empty block so
+// that the decompressor reaches the end of its input cleanly.
+var deflateTail = []byte{0x00, 0x00, 0xff, 0xff, 0x01, 0x00, 0x00, 0xff, 0xff}
+
+// deflateParams are the negotiated parameters of permessage-deflate.
+type deflateParams struct {
+	clientNoContextTakeover bool
+	serverNoContextTakeover bool
+	serverMaxWindowBits     int
+}
+
+// String formats the parameters as an extension header value.
+func (p *deflateParams) String() string {
+	s := permessageDeflate
+	if p.clientNoContextTakeover {
+		s += "; client_no_context_takeover"
+	}
+	if p.serverNoContextTakeover {
+		s += "; server_no_context_takeover"
+	}
+	if p.serverMaxWindowBits != 0 {
+		s += "; server_max_window_bits=" + strconv.Itoa(p.serverMaxWindowBits)
+	}
+
+	return s
+}
+
+// An extension is one entry of a Sec-WebSocket-Extensions header.
+type extension struct {
+	name   string
+	params map[string]string
+}
+
+// parseExtensions parses the values of Sec-WebSocket-Extensions headers.
+func parseExtensions(values []string) (exts []extension) {
+	for _, value := range values {
+		for _, e := range strings.Split(value, ",") {
+			parts := strings.Split(e, ";")
+
+			ext := extension{
+				name:   strings.ToLower(strings.TrimSpace(parts[0])),
+				params: make(map[string]string),
+			}
+			if ext.name == "" {
+				continue
+			}
+
+			for _, p := range parts[1:] {
+				kv := strings.SplitN(p, "=", 2)
+				key := strings.ToLower(strings.TrimSpace(kv[0]))
+				if key == "" {
+					continue
+				}
+
+				val := ""
+				if len(kv) == 2 {
+					val = strings.Trim(strings.TrimSpace(kv[1]), `"`)
+				}
+				ext.params[key] = val
+			}
+
+			exts = append(exts, ext)
+		}
+	}
+
+	return
+}
+
+// parseWindowBits parses a window bits parameter.  An empty value is
+// allowed if allowEmpty is set, and yields zero.
+func parseWindowBits(val string, allowEmpty bool) (int, bool) {
+	if val == "" {
+		return 0, allowEmpty
+	}
+
+	n, err := strconv.Atoi(val)
+	if err != nil || n < 8 || n > maxWindowBits {
+		return 0, false
+	}
+
+	return n, true
+}
+
+// deflateOffer returns the permessage-deflate offer a client sends.
+func deflateOffer(cfg *config.Ws) string {
+	p := &deflateParams{
+		clientNoContextTakeover: cfg.ClientNoContextTakeover,
+		serverNoContextTakeover: cfg.ServerNoContextTakeover,
+	}
+	if cfg.ServerMaxWindowBits >= 8 && cfg.ServerMaxWindowBits < maxWindowBits {
+		p.serverMaxWindowBits = cfg.ServerMaxWindowBits
+	}
+
+	return p.String()
+}
+
+// acceptDeflateResponse checks the server's response to a client's
+// permessage-deflate offer.  It returns nil if the server did not accept
+// the extension.
+func acceptDeflateResponse(cfg *config.Ws, values []string) (*deflateParams, error) {
+	exts := parseExtensions(values)
+	if len(exts) == 0 {
+		return nil, nil
+	}
+
+	if !cfg.EnableCompression || len(exts) != 1 || exts[0].name != permessageDeflate {
+		return nil, ErrUnsupportedExtensions
+	}
+
+	p := &deflateParams{
+		clientNoContextTakeover: cfg.ClientNoContextTakeover,
+	}
+	for key, val := range exts[0].params {
+		switch key {
+		case "client_no_context_takeover":
+			p.clientNoContextTakeover = true
+		case "server_no_context_takeover":
+			p.serverNoContextTakeover = true
+		case "server_max_window_bits":
+			// Any window fits in the decompressor's.
+			bits, ok := parseWindowBits(val, false)
+			if !ok {
+				return nil, ErrUnsupportedExtensions
+			}
+			p.serverMaxWindowBits = bits
+		default:
+			// client_max_window_bits was not offered, as compress/flate
+			// cannot limit its window; nor are other parameters known.
+			return nil, ErrUnsupportedExtensions
+		}
+	}
+
+	if cfg.ServerNoContextTakeover && !p.serverNoContextTakeover {
+		return nil, ErrUnsupportedExtensions
+	}
+
+	return p, nil
+}
+
+// acceptDeflateOffer selects the first permessage-deflate offer of a client
+// which the server can accept, and returns the parameters to respond
+// with.  It returns nil if no offer is acceptable.
+func acceptDeflateOffer(cfg *config.Ws, values []string) *deflateParams {
+	if !cfg.EnableCompression {
+		return nil
+	}
+
+offers:
+	for _, ext := range parseExtensions(values) {
+		if ext.name != permessageDeflate {
+			continue
+		}
+
+		p := &deflateParams{
+			clientNoContextTakeover: cfg.ClientNoContextTakeover,
+			serverNoContextTakeover: cfg.ServerNoContextTakeover,
+		}
+		for key, val := range ext.params {
+			switch key {
+			case "client_no_context_takeover":
+				p.clientNoContextTakeover = true
+			case "server_no_context_takeover":
+				p.serverNoContextTakeover = true
+			case "server_max_window_bits":
+				// compress/flate always uses the largest window, so only
+				// a limit of that size can be honoured.
+				bits, ok := parseWindowBits(val, false)
+				if !ok || bits < maxWindowBits {
+					continue offers
+				}
+				p.serverMaxWindowBits = bits
+			case "client_max_window_bits":
+				// The client supports the parameter; there is no need to
+				// ask it for a smaller window.
+				if _, ok := parseWindowBits(val, true); !ok {
+					continue offers
+				}
+			default:
+				continue offers
+			}
+		}
+
+		return p
+	}
+
+	return nil
+}
+
+// A compressor compresses outgoing messages of a connection.
+type compressor struct {
+	level             int
+	noContextTakeover bool
+
+	buf bytes.Buffer
+	fw  *flate.Writer
+}
+
+// compress compresses a message, returning the compressed payload.  The
+// returned slice is only valid until the next call.
+func (c *compressor) compress(msg []byte) ([]byte, error) {
+	if err := c.begin(); err != nil {
+		return nil, err
+	}
+	if err := c.write(msg); err != nil {
+		return nil, err
+	}
+
+	return c.end()
+}
+
+// begin starts compressing a message.  Its compressed payload is then
+// written to c.buf as the message is written.
+func (c *compressor) begin() (err error) {
+	c.buf.Reset()
+
+	switch {
+	case c.fw == nil:
+		c.fw, err = flate.NewWriter(&c.buf, c.level)
+	case c.noContextTakeover:
+		c.fw.Reset(&c.buf)
+	}
+
+	return err
+}
+
+// write compresses the next part of a message.
+func (c *compressor) write(p []byte) error {
+	_, err := c.fw.Write(p)
+	return err
+}
+
+// end finishes compressing a message, returning the rest of its compressed
+// payload which is in c.buf.  The returned slice is only valid until the
+// next message.
+func (c *compressor) end() ([]byte, error) {
+	if err := c.fw.Flush(); err != nil {
+		return nil, err
+	}
+
+	// Strip the empty stored block ending the flush, as required by
+	// RFC 7692, section 7.2.1.
+	b := c.buf.Bytes()
+	if bytes.HasSuffix(b, deflateTail[:4]) {
+		b = b[:len(b)-4]
+	}
+
+	return b, nil
+}
+
+// setLevel changes the compression level, which starts a new context.
+func (c *compressor) setLevel(level int) error {
+	if level != flate.DefaultCompression && (level < flate.HuffmanOnly || level > flate.BestCompression) {
+		return ErrBadCompressionLevel
+	}
+
+	c.level = level
+	c.fw = nil
+	return nil
+}
+
+// A decompressor decompresses incoming messages of a connection.
+type decompressor struct {
+	noContextTakeover bool
+
+	fr     io.ReadCloser
+	window []byte
+}
+
+// reader returns a reader of the decompressed message whose compressed
+// payload is read from src.
+func (d *decompressor) reader(src io.Reader) io.Reader {
+	src = io.MultiReader(src, bytes.NewReader(deflateTail))
+
+	var dict []byte
+	if !d.noContextTakeover {
+		dict = d.window
+		if len(dict) > maxWindowSize {
+			dict = dict[len(dict)-maxWindowSize:]
+		}
+	}
+
+	if d.fr == nil {
+		d.fr = flate.NewReaderDict(src, dict)
+	} else {
+		// Resetting a flate reader cannot fail.
+		d.fr.(flate.Resetter).Reset(src, dict)
+	}
+
+	if d.noContextTakeover {
+		return d.fr
+	}
+
+	return windowReader{d}
+}
+
+// A windowReader reads a decompressed message, keeping its end as the
+// dictionary of the next message.
+type windowReader struct{ d *decompressor }
+
+func (w windowReader) Read(p []byte) (int, error) {
+	n, err := w.d.fr.Read(p)
+
+	// The window is only trimmed once in a while, rather than copied on
+	// every read.
+	w.d.window = append(w.d.window, p[:n]...)
+	if len(w.d.window) > 2*maxWindowSize {
+		w.d.window = append(w.d.window[:0], w.d.window[len(w.d.window)-maxWindowSize:]...)
+	}
+
+	return n, err
+}
+
+// ErrBadCompressionLevel is returned by Conn.SetCompressionLevel for levels
+// compress/flate does not support.
+var ErrBadCompressionLevel = &ProtocolError{"bad compression level"}
+
+// setDeflate enables permessage-deflate on a connection with the
+// negotiated parameters.
+func (ws *Conn) setDeflate(p *deflateParams) {
+	if p == nil {
+		return
+	}
+
+	writeNoContextTakeover, readNoContextTakeover := p.clientNoContextTakeover, p.serverNoContextTakeover
+	if ws.IsServer() {
+		writeNoContextTakeover, readNoContextTakeover = readNoContextTakeover, writeNoContextTakeover
+	}
+
+	ws.compressor = &compressor{level: flate.DefaultCompression, noContextTakeover: writeNoContextTakeover}
+	if ws.cfg.CompressionLevel != 0 {
+		// An invalid level leaves the default in place.
+		ws.compressor.setLevel(ws.cfg.CompressionLevel)
+	}
+	ws.decompressor = &decompressor{noContextTakeover: readNoContextTakeover}
+	ws.compress = true
+}
+
+// CompressionNegotiated reports whether the permessage-deflate extension
+// was negotiated for the connection.
+func (ws *Conn) CompressionNegotiated() bool {
+	return ws.decompressor != nil
+}
+
+// EnableWriteCompression enables or disables compression of the messages
+// written to the connection afterwards.  It has no effect if compression
+// was not negotiated.  Incoming messages are decompressed regardless.
+func (ws *Conn) EnableWriteCompression(enable bool) {
+	ws.mio.Lock()
+	defer ws.mio.Unlock()
+
+	ws.compress = enable
+}
+
+// SetCompressionLevel sets the flate compression level of the messages
+// written to the connection afterwards.  Valid levels range from
+// flate.HuffmanOnly to flate.BestCompression.
+func (ws *Conn) SetCompressionLevel(level int) error {
+	ws.mio.Lock()
+	defer ws.mio.Unlock()
+
+	if ws.compressor == nil {
+		return nil
+	}
+
+	return ws.compressor.setLevel(level)
+}
+
+// newDataFrameWriter creates a writer for a text or binary frame, which
+// compresses its payload if compression is enabled.  ws.mio and ws.wio must
+// be held.
+func (ws *Conn) newDataFrameWriter(payloadType byte) (frameWriter, error) {
+	if ws.closeSent {
+		return nil, ErrCloseSent
+	}
+
+	w, err := ws.frameWriterFactory.NewFrameWriter(payloadType)
+	if err != nil {
+		return nil, err
+	}
+
+	hw, ok := w.(*hybiFrameWriter)
+	if !ok || !ws.compress || ws.compressor == nil {
+		return w, nil
+	}
+
+	return &deflateFrameWriter{frame: hw, compressor: ws.compressor}, nil
+}
+
+// A deflateFrameWriter writes a compressed data frame.
+type deflateFrameWriter struct {
+	frame      *hybiFrameWriter
+	compressor *compressor
+}
+
+func (w *deflateFrameWriter) Write(msg []byte) (int, error) {
+	data, err := w.compressor.compress(msg)
+	if err != nil {
+		return 0, err
+	}
+
+	w.frame.header.Rsv[0] = true
+	if _, err = w.frame.Write(data); err != nil {
+		return 0, err
+	}
+
+	return len(msg), nil
+}
+
+func (w *deflateFrameWriter) Close() error { return w.frame.Close() }
@@ -0,0 +1,598 @@
+// WebSocket implementation for the Hrngh bot.
+// Available at https://github.com/abeiron/hrngh
+
+// Copyright 2020-2021, Undying Memory <abeiron@outlook.com>.  All rights reserved.
+// Use of this source code is governed by the Microsoft Public License
+// that can be found in the LICENSE file.
+
+// This file contains conformance tests of api/ws, after the cases of the Autobahn testsuite.
+// Echo servers built on ws.Server are started on the loopback interface,
+// and raw peers writing frames by hand check how they handle framing,
+// masking, control frames, fragmentation, reserved bits and opcodes, UTF-8,
+// closing and compression.  Other cases run ws clients against raw servers.
+//
+// Run a section with, for instance:
+//
+//	go test ./api/ws -run 'TestConformance/5\.'
+
+package ws_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abeiron/hrngh/api/ws"
+	"github.com/abeiron/hrngh/internal/config"
+)
+
+// A testCase is a case of the suite.  Cases are numbered after the
+// sections of the Autobahn testsuite they mirror.
+type testCase struct {
+	id   string
+	desc string
+	run  func(e *env) error
+}
+
+// env is what cases run against.
+type env struct {
+	// addr is the address of the echo servers.
+	addr string
+}
+
+// echo sends every message received back.  Messages over the size limit
+// are skipped, as ws.Codec does.
+func echo(c *ws.Conn) {
+	for {
+		messageType, r, err := c.NextReader()
+		if err != nil {
+			return
+		}
+
+		msg, err := ioutil.ReadAll(r)
+		if err == ws.ErrFrameTooLarge {
+			continue
+		}
+		if err != nil {
+			return
+		}
+
+		w, err := c.NextWriter(messageType)
+		if err != nil {
+			return
+		}
+		w.Write(msg)
+		if err = w.Close(); err != nil {
+			return
+		}
+	}
+}
+
+// startServers starts the echo servers.
+func startServers() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/echo", ws.Handler(echo))
+	mux.Handle("/limited", ws.Handler(func(c *ws.Conn) {
+		c.MaxPayloadBytes = 1024
+		echo(c)
+	}))
+	mux.Handle("/deflate", ws.Server{
+		Config:  config.Ws{EnableCompression: true},
+		Handler: echo,
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func TestConformance(t *testing.T) {
+	srv := startServers()
+	defer srv.Close()
+
+	e := &env{addr: strings.TrimPrefix(srv.URL, "http://")}
+	for _, c := range allCases() {
+		c := c
+		t.Run(c.id, func(t *testing.T) {
+			if err := c.run(e); err != nil {
+				t.Errorf("%s: %s", c.desc, err)
+			}
+		})
+	}
+}
+
+// An expectation is something a peer should receive.
+type expectation struct {
+	check func(p *peer) error
+
+	// closes is set if the server closes the connection after it.
+	closes bool
+}
+
+// message expects a data message.
+func message(opcode byte, payload []byte) expectation {
+	return expectation{check: func(p *peer) error {
+		got, msg, err := p.readMessage()
+		if err != nil {
+			return err
+		}
+		if got != opcode || !bytes.Equal(msg, payload) {
+			return fmt.Errorf("got message of opcode %d and %d bytes, want opcode %d and %d bytes", got, len(msg), opcode, len(payload))
+		}
+
+		return nil
+	}}
+}
+
+// pong expects a pong frame.
+func pong(payload []byte) expectation {
+	return expectation{check: func(p *peer) error {
+		f, err := p.read()
+		if err != nil {
+			return err
+		}
+		if f.opcode != opPong || !bytes.Equal(f.payload, payload) {
+			return fmt.Errorf("got %s, want a pong frame of %d bytes", f, len(payload))
+		}
+
+		return nil
+	}}
+}
+
+// closed expects a close frame with one of codes, after which the server
+// closes the connection.
+func closed(codes ...int) expectation {
+	return expectation{closes: true, check: func(p *peer) error {
+		code, err := p.readClose()
+		if err != nil {
+			return err
+		}
+
+		ok := false
+		for _, c := range codes {
+			ok = ok || c == code
+		}
+		if !ok {
+			return fmt.Errorf("got close code %d, want %v", code, codes)
+		}
+
+		return p.expectEOF()
+	}}
+}
+
+// script sends frames to the echo server at path, and checks what it
+// answers.  Unless the server is expected to close the connection, the case
+// ends with a clean close.
+func script(path string, frames []frame, expect ...expectation) func(*env) error {
+	return func(e *env) error {
+		extensions := ""
+		if path == "/deflate" {
+			extensions = "permessage-deflate; client_no_context_takeover"
+		}
+
+		p, err := dialPeer(e.addr, path, extensions)
+		if err != nil {
+			return err
+		}
+		defer p.Close()
+
+		closes := false
+		for _, x := range expect {
+			closes = closes || x.closes
+		}
+
+		// The server may close the connection before all is written, if
+		// it is expected to.
+		if err := p.write(frames...); err != nil && !closes {
+			return err
+		}
+
+		for _, x := range expect {
+			if err := x.check(p); err != nil {
+				return err
+			}
+		}
+
+		if closes {
+			return nil
+		}
+
+		if err := p.write(closeFrame(closePayload(ws.CloseNormalClosure, ""))); err != nil {
+			return err
+		}
+		return closed(ws.CloseNormalClosure).check(p)
+	}
+}
+
+// clientCase runs client against a raw server running server.
+func clientCase(configure func(cfg *config.Ws), server func(p *peer) error, client func(c *ws.Conn) error) func(*env) error {
+	return func(*env) error {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return err
+		}
+		defer ln.Close()
+
+		serverErr := make(chan error, 1)
+		go func() {
+			p, err := acceptPeer(ln)
+			if err != nil {
+				serverErr <- err
+				return
+			}
+			defer p.Close()
+
+			serverErr <- server(p)
+		}()
+
+		addr := ln.Addr().String()
+		cfg, err := ws.NewConfig("ws://"+addr+"/", "http://"+addr)
+		if err != nil {
+			return err
+		}
+		if configure != nil {
+			configure(cfg)
+		}
+
+		c, err := ws.DialConfig(cfg)
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+
+		if err := client(c); err != nil {
+			return err
+		}
+
+		return <-serverErr
+	}
+}
+
+func text(s string) frame        { return frame{fin: true, opcode: opText, payload: []byte(s)} }
+func binaryFrame(b []byte) frame { return frame{fin: true, opcode: opBinary, payload: b} }
+func ping(b []byte) frame        { return frame{fin: true, opcode: opPing, payload: b} }
+func closeFrame(b []byte) frame  { return frame{fin: true, opcode: opClose, payload: b} }
+
+// fragment returns a frame of a fragmented message.
+func fragment(opcode byte, payload string, fin bool) frame {
+	return frame{fin: fin, opcode: opcode, payload: []byte(payload)}
+}
+
+// fragments splits a message into frames of size bytes.
+func fragments(opcode byte, payload []byte, size int) (frames []frame) {
+	for {
+		n := size
+		if n > len(payload) {
+			n = len(payload)
+		}
+
+		frames = append(frames, frame{opcode: opcode, payload: payload[:n]})
+		opcode = opContinuation
+		payload = payload[n:]
+
+		if len(payload) == 0 {
+			frames[len(frames)-1].fin = true
+			return frames
+		}
+	}
+}
+
+func frames(f ...frame) []frame { return f }
+
+// pattern returns n bytes of a repeated pattern.
+func pattern(n int) []byte {
+	return bytes.Repeat([]byte("*"), n)
+}
+
+// allCases returns the cases of the suite, in order.
+func allCases() (cases []testCase) {
+	add := func(id, desc string, run func(*env) error) {
+		cases = append(cases, testCase{id, desc, run})
+	}
+
+	// 1. Framing: payload lengths in 7, 16 and 64 bits, and masking.
+	for i, n := range []int{0, 125, 126, 127, 128, 65535, 65536} {
+		add(fmt.Sprintf("1.1.%d", i+1), fmt.Sprintf("text message of %d bytes", n),
+			script("/echo", frames(text(string(pattern(n)))), message(opText, pattern(n))))
+	}
+	for i, n := range []int{0, 125, 126, 127, 128, 65535, 65536} {
+		add(fmt.Sprintf("1.2.%d", i+1), fmt.Sprintf("binary message of %d bytes", n),
+			script("/echo", frames(binaryFrame(pattern(n))), message(opBinary, pattern(n))))
+	}
+	add("1.3.1", "unmasked frame from the client", script("/echo",
+		frames(frame{fin: true, opcode: opText, payload: []byte("hello"), badMask: true}), closed(ws.CloseProtocolError)))
+
+	// 2. Pings and pongs.
+	add("2.1", "ping without payload", script("/echo", frames(ping(nil)), pong(nil)))
+	add("2.2", "ping with text payload", script("/echo", frames(ping([]byte("Hello, world!"))), pong([]byte("Hello, world!"))))
+	bin := []byte{0x00, 0xff, 0xfe, 0xfd, 0xfc, 0xfb, 0x00, 0xff}
+	add("2.3", "ping with binary payload", script("/echo", frames(ping(bin)), pong(bin)))
+	add("2.4", "ping with 125 bytes of payload", script("/echo", frames(ping(pattern(125))), pong(pattern(125))))
+	add("2.5", "ping with 126 bytes of payload", script("/echo", frames(ping(pattern(126))), closed(ws.CloseProtocolError)))
+	add("2.6", "unsolicited pong", script("/echo",
+		frames(frame{fin: true, opcode: opPong, payload: []byte("unsolicited")}, text("hi")), message(opText, []byte("hi"))))
+	var pings []frame
+	var pongs []expectation
+	for i := 0; i < 10; i++ {
+		payload := []byte(fmt.Sprintf("ping %d", i))
+		pings = append(pings, ping(payload))
+		pongs = append(pongs, pong(payload))
+	}
+	add("2.7", "ten pings in a row", script("/echo", pings, pongs...))
+
+	// 3. Reserved bits.
+	add("3.1", "text frame with RSV2", script("/echo",
+		frames(frame{fin: true, rsv: rsv2, opcode: opText, payload: []byte("hi")}), closed(ws.CloseProtocolError)))
+	add("3.2", "text frame with RSV3", script("/echo",
+		frames(frame{fin: true, rsv: rsv3, opcode: opText, payload: []byte("hi")}), closed(ws.CloseProtocolError)))
+	add("3.3", "text frame with RSV1 and no extension", script("/echo",
+		frames(frame{fin: true, rsv: rsv1, opcode: opText, payload: []byte("hi")}), closed(ws.CloseProtocolError)))
+	add("3.4", "binary frame with RSV2 and RSV3", script("/echo",
+		frames(frame{fin: true, rsv: rsv2 | rsv3, opcode: opBinary, payload: bin}), closed(ws.CloseProtocolError)))
+	add("3.5", "ping frame with all RSV bits", script("/echo",
+		frames(frame{fin: true, rsv: rsv1 | rsv2 | rsv3, opcode: opPing}), closed(ws.CloseProtocolError)))
+	add("3.6", "text message, then ping frame with RSV2", script("/echo",
+		frames(text("ok"), frame{fin: true, rsv: rsv2, opcode: opPing}), message(opText, []byte("ok")), closed(ws.CloseProtocolError)))
+
+	// 4. Reserved opcodes.
+	for i, op := range []byte{3, 4, 5, 6, 7} {
+		add(fmt.Sprintf("4.1.%d", i+1), fmt.Sprintf("reserved data opcode %d", op),
+			script("/echo", frames(frame{fin: true, opcode: op, payload: []byte("hi")}), closed(ws.CloseProtocolError)))
+	}
+	for i, op := range []byte{11, 12, 13, 14, 15} {
+		add(fmt.Sprintf("4.2.%d", i+1), fmt.Sprintf("reserved control opcode %d", op),
+			script("/echo", frames(frame{fin: true, opcode: op}), closed(ws.CloseProtocolError)))
+	}
+
+	// 5. Fragmentation.
+	add("5.1", "fragmented ping", script("/echo",
+		frames(fragment(opPing, "frag1", false), fragment(opContinuation, "frag2", true)), closed(ws.CloseProtocolError)))
+	add("5.2", "fragmented pong", script("/echo",
+		frames(fragment(opPong, "frag1", false), fragment(opContinuation, "frag2", true)), closed(ws.CloseProtocolError)))
+	add("5.3", "text message in two fragments", script("/echo",
+		frames(fragment(opText, "fragment1", false), fragment(opContinuation, "fragment2", true)),
+		message(opText, []byte("fragment1fragment2"))))
+	add("5.4", "ping between the fragments of a text message", script("/echo",
+		frames(fragment(opText, "fragment1", false), ping([]byte("ping")), fragment(opContinuation, "fragment2", true)),
+		pong([]byte("ping")), message(opText, []byte("fragment1fragment2"))))
+	add("5.5", "text message in fragments of one byte", script("/echo",
+		fragments(opText, []byte("Hello, world!"), 1), message(opText, []byte("Hello, world!"))))
+	add("5.6", "final continuation without a message", script("/echo",
+		frames(fragment(opContinuation, "fragment", true)), closed(ws.CloseProtocolError)))
+	add("5.7", "continuation without a message, then text message", script("/echo",
+		frames(fragment(opContinuation, "fragment", false), text("hi")), closed(ws.CloseProtocolError)))
+	add("5.8", "text message before the last is finished", script("/echo",
+		frames(fragment(opText, "fragment1", false), text("hi")), closed(ws.CloseProtocolError)))
+	add("5.9", "binary message in fragments of 64 KiB", script("/echo",
+		fragments(opBinary, pattern(3<<16), 1<<16), message(opBinary, pattern(3<<16))))
+	add("5.10", "text message of empty fragments", script("/echo",
+		frames(fragment(opText, "", false), fragment(opContinuation, "", false), fragment(opContinuation, "", true)),
+		message(opText, []byte{})))
+
+	// 6. UTF-8 handling.
+	const kosme = "\xce\xba\xe1\xbd\xb9\xcf\x83\xce\xbc\xce\xb5"
+	add("6.1", "valid UTF-8 text message", script("/echo", frames(text(kosme)), message(opText, []byte(kosme))))
+	for i := 1; i < len(kosme); i++ {
+		add(fmt.Sprintf("6.2.%d", i), fmt.Sprintf("valid UTF-8 split after byte %d", i), script("/echo",
+			frames(fragment(opText, kosme[:i], false), fragment(opContinuation, kosme[i:], true)),
+			message(opText, []byte(kosme))))
+	}
+	invalid := []string{
+		kosme + "\xed\xa0\x80edited",
+		"\xff",
+		"\xc0\xaf",
+		"\xe0\x80\xaf",
+		"\xf4\x90\x80\x80",
+		"\xed\xbf\xbf",
+		"\x80",
+		"\xce",
+	}
+	for i, s := range invalid {
+		add(fmt.Sprintf("6.3.%d", i+1), fmt.Sprintf("invalid UTF-8 %q", s), script("/echo",
+			frames(text(s)), closed(ws.CloseInvalidFramePayloadData)))
+	}
+	add("6.4", "invalid UTF-8 split over fragments", script("/echo",
+		frames(fragment(opText, kosme+"\xed", false), fragment(opContinuation, "\xa0\x80edited", true)),
+		closed(ws.CloseInvalidFramePayloadData)))
+	add("6.5", "text message ending in a truncated rune", script("/echo",
+		frames(fragment(opText, kosme, false), fragment(opContinuation, "\xce", true)),
+		closed(ws.CloseInvalidFramePayloadData)))
+	add("6.6", "binary message which is not UTF-8", script("/echo",
+		frames(binaryFrame([]byte("\xff\xfe"))), message(opBinary, []byte("\xff\xfe"))))
+	add("6.7", "rune split around a ping", script("/echo",
+		frames(fragment(opText, kosme[:1], false), ping(nil), fragment(opContinuation, kosme[1:], true)),
+		pong(nil), message(opText, []byte(kosme))))
+
+	// 7. Closing.
+	add("7.1.1", "close", script("/echo",
+		frames(closeFrame(closePayload(1000, ""))), closed(1000)))
+	add("7.1.2", "text message after close", script("/echo",
+		frames(closeFrame(closePayload(1000, "")), text("ignored")), closed(1000)))
+	add("7.1.3", "text message, then close", script("/echo",
+		frames(text("hi"), closeFrame(closePayload(1000, ""))), message(opText, []byte("hi")), closed(1000)))
+	add("7.1.4", "ping after close", script("/echo",
+		frames(closeFrame(closePayload(1000, "")), ping([]byte("ignored"))), closed(1000)))
+	add("7.1.5", "close between the fragments of a message", script("/echo",
+		frames(fragment(opText, "fragment1", false), closeFrame(closePayload(1000, "")), fragment(opContinuation, "fragment2", true)),
+		closed(1000)))
+	add("7.3.1", "close without payload", script("/echo", frames(closeFrame(nil)), closed(noStatus)))
+	add("7.3.2", "close with one byte of payload", script("/echo",
+		frames(closeFrame([]byte{0x03})), closed(ws.CloseProtocolError)))
+	add("7.3.3", "close with a reason", script("/echo",
+		frames(closeFrame(closePayload(1000, "Hello World!"))), closed(1000)))
+	add("7.3.4", "close with a reason of 123 bytes", script("/echo",
+		frames(closeFrame(closePayload(1000, string(pattern(123))))), closed(1000)))
+	add("7.3.5", "close with a reason of 124 bytes", script("/echo",
+		frames(closeFrame(closePayload(1000, string(pattern(124))))), closed(ws.CloseProtocolError)))
+	add("7.5.1", "close with an invalid UTF-8 reason", script("/echo",
+		frames(closeFrame(closePayload(1000, kosme+"\xed\xa0\x80"))), closed(ws.CloseInvalidFramePayloadData)))
+	for i, code := range []int{1000, 1001, 1002, 1003, 1007, 1008, 1009, 1010, 1011, 1012, 1013, 1014, 3000, 3999, 4000, 4004, 4014, 4999} {
+		add(fmt.Sprintf("7.7.%d", i+1), fmt.Sprintf("close with code %d", code), script("/echo",
+			frames(closeFrame(closePayload(code, ""))), closed(code)))
+	}
+	for i, code := range []int{0, 999, 1004, 1005, 1006, 1015, 1016, 1100, 2000, 2999, 5000, 65535} {
+		add(fmt.Sprintf("7.9.%d", i+1), fmt.Sprintf("close with invalid code %d", code), script("/echo",
+			frames(closeFrame(closePayload(code, ""))), closed(ws.CloseProtocolError)))
+	}
+
+	// 9. Limits: the /limited server takes messages of up to 1 KiB.
+	add("9.1", "message at the size limit", script("/limited",
+		frames(binaryFrame(pattern(1024))), message(opBinary, pattern(1024))))
+	add("9.2", "fragmented message over the size limit, then text message", script("/limited",
+		append(fragments(opBinary, pattern(2048), 512), text("ok")), message(opText, []byte("ok"))))
+	add("9.3", "message over the size limit, then text message", script("/limited",
+		frames(binaryFrame(pattern(2048)), text("ok")), message(opText, []byte("ok"))))
+
+	// 10. Client behaviour, against a raw server.
+	add("10.1", "client masks its frames", clientCase(nil, func(p *peer) error {
+		f, err := p.read()
+		if err != nil {
+			return err
+		}
+		if f.opcode != opText || string(f.payload) != "hello" {
+			return fmt.Errorf("got %s, want the text message", f)
+		}
+		return nil
+	}, func(c *ws.Conn) error {
+		_, err := c.Write([]byte("hello"))
+		return err
+	}))
+	add("10.2", "masked frame from the server", clientCase(nil, func(p *peer) error {
+		if err := p.write(frame{fin: true, opcode: opText, payload: []byte("hi"), badMask: true}); err != nil {
+			return err
+		}
+		code, err := p.readClose()
+		if err == nil && code != ws.CloseProtocolError {
+			err = fmt.Errorf("got close code %d, want %d", code, ws.CloseProtocolError)
+		}
+		return err
+	}, func(c *ws.Conn) error {
+		if _, _, err := c.NextReader(); err == nil {
+			return errors.New("masked frame accepted")
+		}
+		return nil
+	}))
+	add("10.3", "ping between the fragments of a message to the client", clientCase(nil, func(p *peer) error {
+		if err := p.write(fragment(opText, "fragment1", false), ping([]byte("ping")), fragment(opContinuation, "fragment2", true)); err != nil {
+			return err
+		}
+		return pong([]byte("ping")).check(p)
+	}, func(c *ws.Conn) error {
+		_, r, err := c.NextReader()
+		if err != nil {
+			return err
+		}
+		msg, err := ioutil.ReadAll(r)
+		if err == nil && string(msg) != "fragment1fragment2" {
+			err = fmt.Errorf("got message %q", msg)
+		}
+		return err
+	}))
+	add("10.4", "close from the server", clientCase(nil, func(p *peer) error {
+		if err := p.write(closeFrame(closePayload(4004, "Authentication failed."))); err != nil {
+			return err
+		}
+		code, err := p.readClose()
+		if err == nil && code != 4004 {
+			err = fmt.Errorf("got close code %d, want 4004", code)
+		}
+		return err
+	}, func(c *ws.Conn) error {
+		_, _, err := c.NextReader()
+		e, ok := err.(*ws.CloseError)
+		if !ok || e.Code != 4004 || e.Text != "Authentication failed." {
+			return fmt.Errorf("got %v, want close error 4004", err)
+		}
+		return nil
+	}))
+	add("10.5", "invalid UTF-8 from the server", clientCase(nil, func(p *peer) error {
+		if err := p.write(text("\xff")); err != nil {
+			return err
+		}
+		code, err := p.readClose()
+		if err == nil && code != ws.CloseInvalidFramePayloadData {
+			err = fmt.Errorf("got close code %d, want %d", code, ws.CloseInvalidFramePayloadData)
+		}
+		return err
+	}, func(c *ws.Conn) error {
+		_, r, err := c.NextReader()
+		if err != nil {
+			return err
+		}
+		if _, err = ioutil.ReadAll(r); err != ws.ErrInvalidUTF8 {
+			return fmt.Errorf("got %v, want %v", err, ws.ErrInvalidUTF8)
+		}
+		return nil
+	}))
+	add("10.6", "closing handshake from the client", clientCase(nil, func(p *peer) error {
+		code, err := p.readClose()
+		if err != nil {
+			return err
+		}
+		if code != 4000 {
+			return fmt.Errorf("got close code %d, want 4000", code)
+		}
+		if err := p.write(closeFrame(closePayload(code, ""))); err != nil {
+			return err
+		}
+		return p.expectEOF()
+	}, func(c *ws.Conn) error {
+		return c.CloseWithReason(4000, "reconnecting", time.Second)
+	}))
+	add("10.7", "keepalive with a silent server", clientCase(func(cfg *config.Ws) {
+		cfg.KeepAlive = 50 * time.Millisecond
+	}, func(p *peer) error {
+		f, err := p.read()
+		if err != nil {
+			return err
+		}
+		if f.opcode != opPing {
+			return fmt.Errorf("got %s, want a ping frame", f)
+		}
+
+		// Stay silent until the client gives up.
+		for {
+			if _, err := p.read(); err != nil {
+				return nil
+			}
+		}
+	}, func(c *ws.Conn) error {
+		_, _, err := c.NextReader()
+		if !ws.IsCloseError(err, ws.CloseAbnormalClosure) {
+			return fmt.Errorf("got %v, want close error %d", err, ws.CloseAbnormalClosure)
+		}
+		return nil
+	}))
+
+	// 12. permessage-deflate: the /deflate server compresses its messages.
+	long := []byte(strings.Repeat("Hello, compressed world! ", 200))
+	add("12.1", "compressed text message", script("/deflate",
+		frames(frame{fin: true, rsv: rsv1, opcode: opText, payload: compress(long)}), message(opText, long)))
+	compressed := fragments(opText, compress(long), 20)
+	compressed[0].rsv = rsv1
+	add("12.2", "compressed text message in fragments", script("/deflate", compressed, message(opText, long)))
+	badCompressed := fragments(opText, compress(long), 20)
+	badCompressed[0].rsv = rsv1
+	badCompressed[1].rsv = rsv1
+	add("12.3", "continuation frame with RSV1", script("/deflate", badCompressed, closed(ws.CloseProtocolError)))
+	add("12.4", "uncompressed message on a compressed connection", script("/deflate",
+		frames(text("plain")), message(opText, []byte("plain"))))
+	add("12.5", "compressed invalid UTF-8", script("/deflate",
+		frames(frame{fin: true, rsv: rsv1, opcode: opText, payload: compress([]byte("ok \xff"))}), closed(ws.CloseInvalidFramePayloadData)))
+	var many []frame
+	var echoes []expectation
+	for i := 0; i < 5; i++ {
+		many = append(many, frame{fin: true, rsv: rsv1, opcode: opBinary, payload: compress(long)})
+		echoes = append(echoes, message(opBinary, long))
+	}
+	add("12.6", "compressed messages with context takeover", script("/deflate", many, echoes...))
+	add("12.7", "compressed ping", script("/deflate",
+		frames(frame{fin: true, rsv: rsv1, opcode: opPing}), closed(ws.CloseProtocolError)))
+
+	return cases
+}
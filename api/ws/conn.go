@@ -11,6 +11,7 @@ package ws
 
 import (
 	"bufio"
+	"errors"
 	"io"
 	"net"
 	"net/http"
@@ -32,66 +33,104 @@ type Conn struct {
 
 	rio sync.Mutex
 	frameReaderFactory
-	frameReader
+	reader *messageReader
 
+	// mio is held while a message is written, and wio while a frame is, so
+	// that control frames may be sent between the frames of a message.
+	mio sync.Mutex
 	wio sync.Mutex
 	frameWriterFactory
 
+	// queue, if started, writes the messages of Write and Send.
+	queue *writeQueue
+
+	observer Observer
+
+	// permessage-deflate state, if the extension was negotiated.
+	compressor   *compressor
+	decompressor *decompressor
+	compress     bool
+
 	frameHandler
 	PayloadType        byte
 	defaultCloseStatus int
 
-	// MaxPayloadBytes limits the size of the frame payload received over Conn
-	// by Codec's Recv method.
+	// closeSent is set once a close frame is sent, under wio; closeErr
+	// once one is received, under rio, when closeReceived is closed.
+	closeSent     bool
+	closeErr      error
+	closeReceived chan struct{}
+
+	// Ping and pong state, under pingMu.
+	pingMu      sync.Mutex
+	pingHandler func(string) error
+	pongHandler func(string) error
+	pingData    string
+	pingSent    time.Time
+	rtt         time.Duration
+	pongWait    bool
+	timedOut    bool
+
+	// writeDeadline is the write deadline last set by SetDeadline or
+	// SetWriteDeadline, under deadlineMu; the write queue restores it once
+	// it wrote a message with a deadline of its own.
+	deadlineMu    sync.Mutex
+	writeDeadline time.Time
+
+	// MaxPayloadBytes limits the size of the messages received over Conn,
+	// once reassembled and decompressed.
 	//
 	// If zero, DefaultMaxPayloadBytes is used.
 	MaxPayloadBytes int
 }
 
 // Read implements the io.Reader interface:
-// it reads data of a frame from the WebSocket connection.
-// if msg is not large enough for the frame data, it fills the msg and next Read
-// will read the rest of the frame data.
-// it reads Text frame or Binary frame.
+// it reads the data of messages from the WebSocket connection, one after
+// the other.
+// if msg is not large enough for the message data, it fills the msg and next
+// Read will read the rest of the message data.
+// it reads Text messages or Binary messages.
 func (ws *Conn) Read(msg []byte) (n int, err error) {
 	ws.rio.Lock()
 	defer ws.rio.Unlock()
-again:
-	if ws.frameReader == nil {
-		frame, err := ws.frameReaderFactory.NewFrameReader()
-		if err != nil {
-			return 0, err
-		}
 
-		ws.frameReader, err = ws.framehandler.HandleFrame(frame)
-		if err != nil {
-			return 0, err
+	for {
+		if ws.reader == nil || ws.reader.err != nil {
+			if _, err = ws.nextMessage(); err != nil {
+				return 0, err
+			}
 		}
 
-		if ws.frameReader == nil {
-			goto again
+		n, err = ws.reader.Read(msg)
+		if err == io.EOF {
+			if n == 0 {
+				continue
+			}
+			err = nil
 		}
-	}
 
-	n, err = ws.frameReader.Read(msg)
-	if err == io.EOF {
-		if trailer := ws.frameReader.TrailerReader(); trailer != nil {
-			io.Copy(ioutil.Discard, trailer)
-		}
-		ws.frameReader = nil
-		goto again
+		return n, err
 	}
-
-	return n, err
 }
 
 // Write implements the io.Writer interface:
 // it writes the data as a frame to the WebSocket connection.
 func (ws *Conn) Write(msg []byte) (n int, err error) {
+	if ws.queue != nil {
+		data := make([]byte, len(msg))
+		copy(data, msg)
+		if err = ws.enqueueData(ws.PayloadType, data); err != nil {
+			return 0, err
+		}
+		return len(msg), nil
+	}
+
+	ws.mio.Lock()
+	defer ws.mio.Unlock()
 	ws.wio.Lock()
 	defer ws.wio.Unlock()
 
-	w, err := ws.frameWriterFactory.NewFrameWriter(ws.PayloadType)
+	w, err := ws.newDataFrameWriter(ws.PayloadType)
 	if err != nil {
 		return 0, err
 	}
@@ -104,6 +143,8 @@ func (ws *Conn) Write(msg []byte) (n int, err error) {
 
 // Close implements the io.Closer interface.
 func (ws *Conn) Close() error {
+	ws.stopQueue()
+
 	err := ws.frameHandler.WriteClose(ws.defaultCloseStatus)
 	err1 := ws.rwc.Close()
 
@@ -118,26 +159,26 @@ func (ws *Conn) Close() error {
 func (ws *Conn) IsClient() bool { return ws.req == nil }
 
 // IsServer reports whether ws is a server-side connection.
-func (ws *Conn) IsServer() bool { return wq.req != nil }
+func (ws *Conn) IsServer() bool { return ws.req != nil }
 
 // LocalAddr returns the WebSocket-Origin for the connection for client,
 // or the WebSocket-Location for server.
 func (ws *Conn) LocalAddr() net.Addr {
 	if ws.IsClient() {
-		return &Address{ws.config.Origin}
+		return &Address{ws.cfg.Origin}
 	}
 
-	return &Address{ws.config.Location}
+	return &Address{ws.cfg.Location}
 }
 
 // RemoteAddr returns the WebSocket-Location for the connection for client,
 // or the WebSocket-Origin for server.
 func (ws *Conn) RemoteAddr() net.Addr {
 	if ws.IsClient() {
-		return &Address{ws.config.Location}
+		return &Address{ws.cfg.Location}
 	}
 
-	return &Address{ws.config.Origin}
+	return &Address{ws.cfg.Origin}
 }
 
 var errSetDeadline = errors.New("websocket: cannot set deadline: not using a net.Conn")
@@ -145,6 +186,9 @@ var errSetDeadline = errors.New("websocket: cannot set deadline: not using a net
 // SetDeadline sets the connection's network read/write deadlines.
 func (ws *Conn) SetDeadline(t time.Time) error {
 	if conn, ok := ws.rwc.(net.Conn); ok {
+		ws.deadlineMu.Lock()
+		defer ws.deadlineMu.Unlock()
+		ws.writeDeadline = t
 		return conn.SetDeadline(t)
 	}
 
@@ -163,12 +207,39 @@ func (ws *Conn) SetReadDeadline(t time.Time) error {
 // SetWriteDeadline sets the connection's network write deadline.
 func (ws *Conn) SetWriteDeadline(t time.Time) error {
 	if conn, ok := ws.rwc.(net.Conn); ok {
+		ws.deadlineMu.Lock()
+		defer ws.deadlineMu.Unlock()
+		ws.writeDeadline = t
 		return conn.SetWriteDeadline(t)
 	}
 
 	return errSetDeadline
 }
 
+// setWriteDeadlineFor sets the network write deadline to t, or to the write
+// deadline set by the user if it is earlier, until restoreWriteDeadline is
+// called.
+func (ws *Conn) setWriteDeadlineFor(t time.Time) {
+	if conn, ok := ws.rwc.(net.Conn); ok {
+		ws.deadlineMu.Lock()
+		defer ws.deadlineMu.Unlock()
+		if !ws.writeDeadline.IsZero() && ws.writeDeadline.Before(t) {
+			t = ws.writeDeadline
+		}
+		conn.SetWriteDeadline(t)
+	}
+}
+
+// restoreWriteDeadline sets the network write deadline back to the one set
+// by the user.
+func (ws *Conn) restoreWriteDeadline() {
+	if conn, ok := ws.rwc.(net.Conn); ok {
+		ws.deadlineMu.Lock()
+		defer ws.deadlineMu.Unlock()
+		conn.SetWriteDeadline(ws.writeDeadline)
+	}
+}
+
 // Config returns the WebSocket config.
 func (ws *Conn) Config() *config.Ws { return ws.cfg }
 
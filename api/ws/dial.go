@@ -8,23 +8,389 @@
 package ws
 
 import (
+	"bufio"
+	"context"
 	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/abeiron/hrngh/internal/config"
 )
 
-func dialWithDialer(dialer *net.Dialer, cfg *config.Ws) (conn net.Conn, err error) {
-	switch cfg.Location.Schema {
-	case "ws":
-		conn, err = dialer.Dial("tcp", parseAuthority(cfg.Location))
+var (
+	ErrBadProxy       = &ProtocolError{"missing or bad proxy"}
+	ErrBadProxyStatus = &ProtocolError{"proxy refused connection"}
+)
 
+var (
+	// aLongTimeAgo is a deadline in the past, which aborts pending I/O.
+	aLongTimeAgo = time.Unix(1, 0)
+
+	// noDeadline clears a deadline.
+	noDeadline = time.Time{}
+)
+
+// dialContext opens the connection to the server a WebSocket handshake is
+// then made over, through a proxy and with TLS as configured.
+func dialContext(ctx context.Context, cfg *config.Ws) (conn net.Conn, err error) {
+	var secure bool
+	switch cfg.Location.Scheme {
+	case "ws":
 	case "wss":
-		conn, err = tls.dialWithDialer(dialer, "tcp", parseAuthority(cfg.Location), cfg.TlsConfig)
+		secure = true
+	default:
+		return nil, ErrBadSchema
+	}
+
+	dialer := cfg.Dialer
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+
+	addr := parseAuthority(cfg.Location)
+
+	proxyURL, err := proxyFor(cfg, secure)
+	if err != nil {
+		return nil, err
+	}
+
+	if proxyURL == nil {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialProxy(ctx, dialer, proxyURL, addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if secure {
+		conn, err = clientTLS(ctx, conn, cfg.TlsConfig, cfg.Location.Hostname())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+// proxyFor returns the proxy to reach the server through, if any.
+func proxyFor(cfg *config.Ws, secure bool) (*url.URL, error) {
+	proxy := cfg.Proxy
+	if proxy == nil {
+		proxy = http.ProxyFromEnvironment
+	}
+
+	// Proxies are chosen as for the HTTP request the handshake starts as.
+	u := *cfg.Location
+	u.Scheme = "http"
+	if secure {
+		u.Scheme = "https"
+	}
+
+	return proxy(&http.Request{Method: "GET", URL: &u, Header: make(http.Header)})
+}
+
+// clientTLS runs a TLS client handshake over conn.  conn is closed if the
+// handshake fails.
+func clientTLS(ctx context.Context, conn net.Conn, tlsConfig *tls.Config, serverName string) (net.Conn, error) {
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.ServerName = serverName
+	}
+
+	tc := tls.Client(conn, tlsConfig)
+	if err := withContext(ctx, conn, tc.Handshake); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return tc, nil
+}
+
+// withContext runs f, which does I/O on conn, aborting it by expiring the
+// deadline of conn if ctx is done first.  The deadline is cleared
+// afterwards.
+func withContext(ctx context.Context, conn net.Conn, f func() error) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	done := make(chan struct{})
+	aborted := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(aLongTimeAgo)
+			aborted <- true
+		case <-done:
+			aborted <- false
+		}
+	}()
+
+	err := f()
+	close(done)
+
+	if <-aborted {
+		return ctx.Err()
+	}
+
+	conn.SetDeadline(noDeadline)
+	return err
+}
+
+// dialProxy connects to addr through the proxy.
+func dialProxy(ctx context.Context, dialer *net.Dialer, proxyURL *url.URL, addr string) (net.Conn, error) {
+	var port string
+	switch proxyURL.Scheme {
+	case "http":
+		port = "80"
+	case "https":
+		port = "443"
+	case "socks5", "socks5h":
+		port = "1080"
+	default:
+		return nil, ErrBadProxy
+	}
+
+	proxyAddr := proxyURL.Host
+	if proxyURL.Port() == "" {
+		proxyAddr = net.JoinHostPort(proxyURL.Hostname(), port)
+	}
+
+	conn, err := dialer.DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	if proxyURL.Scheme == "https" {
+		conn, err = clientTLS(ctx, conn, nil, proxyURL.Hostname())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = withContext(ctx, conn, func() error {
+		if proxyURL.Scheme == "socks5" || proxyURL.Scheme == "socks5h" {
+			return socks5Connect(ctx, conn, proxyURL, addr)
+		}
+		return httpConnect(conn, proxyURL, addr)
+	})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// httpConnect asks an HTTP proxy to open a tunnel to addr.
+func httpConnect(conn net.Conn, proxyURL *url.URL, addr string) error {
+	req := &http.Request{
+		Method: "CONNECT",
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+
+	if u := proxyURL.User; u != nil {
+		password, _ := u.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(u.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+
+	if err := req.Write(conn); err != nil {
+		return err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+		return &statusError{ErrBadProxyStatus, resp, body}
+	}
+
+	// The server speaks only after the handshake request, so nothing may
+	// be left over from the proxy's response.
+	if br.Buffered() > 0 {
+		return ErrBadProxy
+	}
+
+	return nil
+}
+
+// SOCKS5 constants, from RFC 1928 and RFC 1929.
+const (
+	socks5Version = 0x05
+
+	socks5AuthNone     = 0x00
+	socks5AuthPassword = 0x02
+	socks5AuthNoMethod = 0xff
+
+	socks5CmdConnect = 0x01
+
+	socks5AddrIPv4   = 0x01
+	socks5AddrDomain = 0x03
+	socks5AddrIPv6   = 0x04
+)
+
+// socks5Replies holds the meaning of SOCKS5 reply codes.
+var socks5Replies = []string{
+	"succeeded",
+	"general SOCKS server failure",
+	"connection not allowed by ruleset",
+	"network unreachable",
+	"host unreachable",
+	"connection refused",
+	"TTL expired",
+	"command not supported",
+	"address type not supported",
+}
+
+// socks5Connect asks a SOCKS5 proxy to connect to addr.  With the socks5h
+// scheme the proxy resolves the host name; with socks5 it is resolved
+// locally.
+func socks5Connect(ctx context.Context, conn net.Conn, proxyURL *url.URL, addr string) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return err
+	}
+
+	// Negotiate the authentication method.
+	methods := []byte{socks5AuthNone}
+	if proxyURL.User != nil {
+		methods = append(methods, socks5AuthPassword)
+	}
+
+	msg := append([]byte{socks5Version, byte(len(methods))}, methods...)
+	if _, err = conn.Write(msg); err != nil {
+		return err
+	}
+
+	reply := make([]byte, 2)
+	if _, err = io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != socks5Version {
+		return errors.New("socks5: bad version in reply")
+	}
+
+	switch reply[1] {
+	case socks5AuthNone:
+	case socks5AuthPassword:
+		if proxyURL.User == nil {
+			return errors.New("socks5: proxy asked for unoffered authentication")
+		}
+
+		user := proxyURL.User.Username()
+		password, _ := proxyURL.User.Password()
+		if len(user) > 255 || len(password) > 255 {
+			return errors.New("socks5: credentials too long")
+		}
+
+		msg = []byte{0x01, byte(len(user))}
+		msg = append(msg, user...)
+		msg = append(msg, byte(len(password)))
+		msg = append(msg, password...)
+		if _, err = conn.Write(msg); err != nil {
+			return err
+		}
+
+		if _, err = io.ReadFull(conn, reply); err != nil {
+			return err
+		}
+		if reply[1] != 0x00 {
+			return errors.New("socks5: authentication failed")
+		}
+	case socks5AuthNoMethod:
+		return errors.New("socks5: no acceptable authentication method")
+	default:
+		return fmt.Errorf("socks5: unsupported authentication method %d", reply[1])
+	}
+
+	// Ask for the connection.
+	msg = []byte{socks5Version, socks5CmdConnect, 0x00}
+
+	ip := net.ParseIP(host)
+	if ip == nil && proxyURL.Scheme == "socks5" {
+		ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return err
+		}
+		ip = ips[0].IP
+	}
+
+	switch {
+	case ip == nil:
+		if len(host) > 255 {
+			return errors.New("socks5: host name too long")
+		}
+		msg = append(msg, socks5AddrDomain, byte(len(host)))
+		msg = append(msg, host...)
+	case ip.To4() != nil:
+		msg = append(msg, socks5AddrIPv4)
+		msg = append(msg, ip.To4()...)
+	default:
+		msg = append(msg, socks5AddrIPv6)
+		msg = append(msg, ip.To16()...)
+	}
+
+	msg = append(msg, 0, 0)
+	binary.BigEndian.PutUint16(msg[len(msg)-2:], uint16(port))
+	if _, err = conn.Write(msg); err != nil {
+		return err
+	}
+
+	// Read the reply, discarding the bound address.
+	header := make([]byte, 4)
+	if _, err = io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	if header[0] != socks5Version {
+		return errors.New("socks5: bad version in reply")
+	}
+	if header[1] != 0x00 {
+		if int(header[1]) < len(socks5Replies) {
+			return errors.New("socks5: " + socks5Replies[header[1]])
+		}
+		return fmt.Errorf("socks5: unknown reply %d", header[1])
+	}
 
+	var skip int
+	switch header[3] {
+	case socks5AddrIPv4:
+		skip = net.IPv4len
+	case socks5AddrIPv6:
+		skip = net.IPv6len
+	case socks5AddrDomain:
+		if _, err = io.ReadFull(conn, header[:1]); err != nil {
+			return err
+		}
+		skip = int(header[0])
 	default:
-		err = ErrBadSchema
+		return errors.New("socks5: bad address type in reply")
 	}
 
-	return
+	_, err = io.CopyN(ioutil.Discard, conn, int64(skip)+2)
+	return err
 }
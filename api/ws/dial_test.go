@@ -0,0 +1,386 @@
+// WebSocket implementation for the Hrngh bot.
+// Available at https://github.com/abeiron/hrngh
+
+// Copyright 2020-2021, Undying Memory <abeiron@outlook.com>.  All rights reserved.
+// Use of this source code is governed by the Microsoft Public License
+// that can be found in the LICENSE file.
+
+// This file contains tests of dialing, directly and through fake HTTP and
+// SOCKS5 proxies on the loopback interface.  The proxies record what they
+// receive, and then answer the WebSocket handshake themselves rather than
+// connect anywhere, so that the servers dialed need not exist.
+
+package ws_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/abeiron/hrngh/api/ws"
+)
+
+// A proxyResult is what a fake proxy received, up to the WebSocket
+// handshake.
+type proxyResult struct {
+	got []byte
+	req *http.Request
+	err error
+}
+
+// startProxy runs serve on the first connection to a listener on the
+// loopback interface, and returns its address and the result.
+func startProxy(t *testing.T, serve func(conn net.Conn) proxyResult) (string, <-chan proxyResult) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	result := make(chan proxyResult, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			result <- proxyResult{err: err}
+			return
+		}
+		defer conn.Close()
+
+		conn.SetDeadline(time.Now().Add(timeout))
+		result <- serve(conn)
+	}()
+
+	return ln.Addr().String(), result
+}
+
+// dialThrough dials server through the proxy at proxyURL.
+func dialThrough(server string, proxyURL *url.URL) (*ws.Conn, error) {
+	cfg, err := ws.NewConfig("ws://"+server+"/gateway", "http://"+server)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Proxy = http.ProxyURL(proxyURL)
+
+	return ws.DialConfig(cfg)
+}
+
+// asDialError returns err as a *DialError, holding want.
+func asDialError(err error, want string) (*ws.DialError, error) {
+	var de *ws.DialError
+	if !errors.As(err, &de) {
+		return nil, fmt.Errorf("got error %v, want a *DialError", err)
+	}
+	if de.Err == nil || de.Err.Error() != want {
+		return nil, fmt.Errorf("got error %v, want %q", de.Err, want)
+	}
+
+	return de, nil
+}
+
+// httpProxy answers a CONNECT request with response, and then the handshake
+// if response is a 200.
+func httpProxy(response string) func(conn net.Conn) proxyResult {
+	return func(conn net.Conn) proxyResult {
+		br := bufio.NewReader(conn)
+		req, err := http.ReadRequest(br)
+		if err != nil {
+			return proxyResult{err: err}
+		}
+		if _, err = io.WriteString(conn, response); err != nil {
+			return proxyResult{req: req, err: err}
+		}
+
+		if req.Method == "CONNECT" && bytes.HasPrefix([]byte(response), []byte("HTTP/1.1 200 ")) {
+			_, err = serverPeer(conn, br)
+		}
+		return proxyResult{req: req, err: err}
+	}
+}
+
+func TestDialHTTPProxy(t *testing.T) {
+	addr, result := startProxy(t, httpProxy("HTTP/1.1 200 Connection established\r\n\r\n"))
+
+	c, err := dialThrough("gateway.discord.test:8080", &url.URL{
+		Scheme: "http",
+		User:   url.UserPassword("hrngh", "s3cret:pass"),
+		Host:   addr,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+
+	r := <-result
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	if r.req.Method != "CONNECT" || r.req.RequestURI != "gateway.discord.test:8080" || r.req.Host != "gateway.discord.test:8080" {
+		t.Errorf("got %s %s for host %s, want CONNECT gateway.discord.test:8080", r.req.Method, r.req.RequestURI, r.req.Host)
+	}
+
+	want := "Basic " + base64.StdEncoding.EncodeToString([]byte("hrngh:s3cret:pass"))
+	if got := r.req.Header.Get("Proxy-Authorization"); got != want {
+		t.Errorf("got Proxy-Authorization %q, want %q", got, want)
+	}
+}
+
+func TestDialHTTPProxyRefused(t *testing.T) {
+	addr, result := startProxy(t, httpProxy("HTTP/1.1 407 Proxy Authentication Required\r\n"+
+		"Proxy-Authenticate: Basic realm=\"proxy\"\r\n"+
+		"Content-Length: 6\r\n\r\n"+
+		"denied"))
+
+	_, err := dialThrough("gateway.discord.test:8080", &url.URL{Scheme: "http", Host: addr})
+	de, err := asDialError(err, ws.ErrBadProxyStatus.Error())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if de.StatusCode != http.StatusProxyAuthRequired {
+		t.Errorf("got status %d, want %d", de.StatusCode, http.StatusProxyAuthRequired)
+	}
+	if got := de.Header.Get("Proxy-Authenticate"); got != `Basic realm="proxy"` {
+		t.Errorf("got Proxy-Authenticate %q", got)
+	}
+	if string(de.Body) != "denied" {
+		t.Errorf("got body %q, want %q", de.Body, "denied")
+	}
+
+	r := <-result
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	if got := r.req.Header.Get("Proxy-Authorization"); got != "" {
+		t.Errorf("got Proxy-Authorization %q without credentials", got)
+	}
+}
+
+func TestDialRefusedUpgrade(t *testing.T) {
+	addr, _ := startProxy(t, func(conn net.Conn) proxyResult {
+		req, err := http.ReadRequest(bufio.NewReader(conn))
+		if err == nil {
+			_, err = io.WriteString(conn, "HTTP/1.1 403 Forbidden\r\n"+
+				"X-Reason: banned\r\n"+
+				"Content-Length: 9\r\n\r\n"+
+				"go away\r\n")
+		}
+		return proxyResult{req: req, err: err}
+	})
+
+	cfg, err := ws.NewConfig("ws://"+addr+"/gateway", "http://"+addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Proxy = func(*http.Request) (*url.URL, error) { return nil, nil }
+
+	_, err = ws.DialConfig(cfg)
+	de, err := asDialError(err, ws.ErrBadStatus.Error())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if de.Ws != cfg {
+		t.Errorf("got config %p, want the one dialed, %p", de.Ws, cfg)
+	}
+	if de.StatusCode != http.StatusForbidden {
+		t.Errorf("got status %d, want %d", de.StatusCode, http.StatusForbidden)
+	}
+	if got := de.Header.Get("X-Reason"); got != "banned" {
+		t.Errorf("got X-Reason %q, want %q", got, "banned")
+	}
+	if string(de.Body) != "go away\r\n" {
+		t.Errorf("got body %q, want %q", de.Body, "go away\r\n")
+	}
+	if msg := de.Error(); msg != "websocket.Dial ws://"+addr+"/gateway: bad status (403 Forbidden)" {
+		t.Errorf("got message %q", msg)
+	}
+}
+
+// A socks5Proxy is a fake SOCKS5 proxy.
+type socks5Proxy struct {
+	// method is the authentication method the proxy picks, and authStatus
+	// its verdict on the credentials if it is the password.
+	method     byte
+	authStatus byte
+
+	// reply is the reply code to the connect request.
+	reply byte
+}
+
+// serve reads the messages of the client as their lengths say, answering
+// them, and then the handshake if the proxy granted the connection.
+func (sp socks5Proxy) serve(conn net.Conn) proxyResult {
+	var got bytes.Buffer
+	r := io.TeeReader(conn, &got)
+
+	read := func(n int) ([]byte, error) {
+		b := make([]byte, n)
+		_, err := io.ReadFull(r, b)
+		return b, err
+	}
+	result := func(err error) proxyResult { return proxyResult{got: got.Bytes(), err: err} }
+
+	// Methods offered.
+	b, err := read(2)
+	if err == nil {
+		_, err = read(int(b[1]))
+	}
+	if err == nil {
+		_, err = conn.Write([]byte{0x05, sp.method})
+	}
+	if err != nil || sp.method == 0xff {
+		return result(err)
+	}
+
+	// Credentials.
+	if sp.method == 0x02 {
+		if b, err = read(2); err == nil {
+			_, err = read(int(b[1]))
+		}
+		if err == nil {
+			if b, err = read(1); err == nil {
+				_, err = read(int(b[0]))
+			}
+		}
+		if err == nil {
+			_, err = conn.Write([]byte{0x01, sp.authStatus})
+		}
+		if err != nil || sp.authStatus != 0x00 {
+			return result(err)
+		}
+	}
+
+	// Connect request.
+	if b, err = read(4); err != nil {
+		return result(err)
+	}
+	switch b[3] {
+	case 0x01:
+		_, err = read(4 + 2)
+	case 0x03:
+		if b, err = read(1); err == nil {
+			_, err = read(int(b[0]) + 2)
+		}
+	case 0x04:
+		_, err = read(16 + 2)
+	default:
+		err = fmt.Errorf("address type %d", b[3])
+	}
+	if err == nil {
+		_, err = conn.Write([]byte{0x05, sp.reply, 0x00, 0x01, 127, 0, 0, 1, 0x1f, 0x90})
+	}
+	if err != nil || sp.reply != 0x00 {
+		return result(err)
+	}
+
+	_, err = serverPeer(conn, bufio.NewReader(conn))
+	return result(err)
+}
+
+func TestDialSOCKS5(t *testing.T) {
+	// The request for 127.0.0.1:8080 and for gateway.discord.test:8080.
+	connectIP := []byte{0x05, 0x01, 0x00, 0x01, 127, 0, 0, 1, 0x1f, 0x90}
+	connectName := append([]byte{0x05, 0x01, 0x00, 0x03, 20}, "gateway.discord.test"...)
+	connectName = append(connectName, 0x1f, 0x90)
+
+	credentials := append([]byte{0x01, 5}, "hrngh"...)
+	credentials = append(credentials, 6)
+	credentials = append(credentials, "s3cret"...)
+
+	cases := []struct {
+		name   string
+		scheme string
+		user   *url.Userinfo
+		server string
+		proxy  socks5Proxy
+
+		// want is what the proxy should receive, and err the error of
+		// the dial.
+		want []byte
+		err  string
+	}{{
+		name:   "no authentication",
+		scheme: "socks5",
+		server: "127.0.0.1:8080",
+		want:   append([]byte{0x05, 0x01, 0x00}, connectIP...),
+	}, {
+		name:   "password",
+		scheme: "socks5",
+		user:   url.UserPassword("hrngh", "s3cret"),
+		server: "127.0.0.1:8080",
+		proxy:  socks5Proxy{method: 0x02},
+		want:   append(append([]byte{0x05, 0x02, 0x00, 0x02}, credentials...), connectIP...),
+	}, {
+		name:   "remote resolution",
+		scheme: "socks5h",
+		server: "gateway.discord.test:8080",
+		want:   append([]byte{0x05, 0x01, 0x00}, connectName...),
+	}, {
+		name:   "authentication failed",
+		scheme: "socks5",
+		user:   url.UserPassword("hrngh", "s3cret"),
+		server: "127.0.0.1:8080",
+		proxy:  socks5Proxy{method: 0x02, authStatus: 0x01},
+		want:   append([]byte{0x05, 0x02, 0x00, 0x02}, credentials...),
+		err:    "socks5: authentication failed",
+	}, {
+		name:   "no acceptable method",
+		scheme: "socks5",
+		server: "127.0.0.1:8080",
+		proxy:  socks5Proxy{method: 0xff},
+		want:   []byte{0x05, 0x01, 0x00},
+		err:    "socks5: no acceptable authentication method",
+	}, {
+		name:   "connection refused",
+		scheme: "socks5h",
+		server: "gateway.discord.test:8080",
+		proxy:  socks5Proxy{reply: 0x05},
+		want:   append([]byte{0x05, 0x01, 0x00}, connectName...),
+		err:    "socks5: connection refused",
+	}}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			addr, result := startProxy(t, tc.proxy.serve)
+
+			c, err := dialThrough(tc.server, &url.URL{Scheme: tc.scheme, User: tc.user, Host: addr})
+			if tc.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				c.Close()
+			} else if _, err = asDialError(err, tc.err); err != nil {
+				t.Fatal(err)
+			}
+
+			r := <-result
+			if r.err != nil {
+				t.Fatal(r.err)
+			}
+			if !bytes.Equal(r.got, tc.want) {
+				t.Errorf("proxy got % x, want % x", r.got, tc.want)
+			}
+		})
+	}
+}
+
+// TestDialBadProxy checks that proxies of unknown schemes are refused.
+func TestDialBadProxy(t *testing.T) {
+	cfg, err := ws.NewConfig("ws://127.0.0.1:8080/", "http://127.0.0.1:8080")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Proxy = http.ProxyURL(&url.URL{Scheme: "ftp", Host: "127.0.0.1:21"})
+
+	_, err = ws.DialConfig(cfg)
+	if _, err = asDialError(err, ws.ErrBadProxy.Error()); err != nil {
+		t.Fatal(err)
+	}
+}
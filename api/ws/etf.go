@@ -0,0 +1,927 @@
+// WebSocket implementation for the Hrngh bot.
+// Available at https://github.com/abeiron/hrngh
+
+// Copyright 2020-2021, Undying Memory <abeiron@outlook.com>.  All rights reserved.
+// Use of this source code is governed by the Microsoft Public License
+// that can be found in the LICENSE file.
+
+// This file contains the ETF codec, for the External Term Format of Erlang
+// which the Discord gateway speaks with encoding=etf.
+// https://www.erlang.org/doc/apps/erts/erl_ext_dist.html
+
+package ws
+
+import (
+	"bytes"
+	"encoding"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+)
+
+// ETF tags.
+const (
+	etfVersion       = 131
+	etfNewFloat      = 70
+	etfSmallInteger  = 97
+	etfInteger       = 98
+	etfFloat         = 99
+	etfAtom          = 100
+	etfSmallTuple    = 104
+	etfLargeTuple    = 105
+	etfNil           = 106
+	etfString        = 107
+	etfList          = 108
+	etfBinary        = 109
+	etfSmallBig      = 110
+	etfLargeBig      = 111
+	etfMap           = 116
+	etfSmallAtom     = 115
+	etfAtomUTF8      = 118
+	etfSmallAtomUTF8 = 119
+)
+
+// maxEtfDepth bounds the nesting of the terms decoded.
+const maxEtfDepth = 1000
+
+var (
+	ErrEtfTarget    = &ProtocolError{"etf: decoding needs a non-nil pointer"}
+	ErrEtfVersion   = &ProtocolError{"etf: bad version"}
+	ErrEtfTruncated = &ProtocolError{"etf: unexpected end of data"}
+	ErrEtfTrailing  = &ProtocolError{"etf: data after the term"}
+	ErrEtfTooDeep   = &ProtocolError{"etf: terms nested too deep"}
+	ErrEtfTag       = &ProtocolError{"etf: unknown or unsupported tag"}
+	ErrEtfImproper  = &ProtocolError{"etf: improper list"}
+)
+
+// EtfTypeError is returned when an ETF term cannot be decoded into a Go
+// value, or a Go value cannot be encoded.
+type EtfTypeError struct {
+	Term string // the ETF term, empty when encoding
+	Type reflect.Type
+}
+
+func (e *EtfTypeError) Error() string {
+	if e.Term == "" {
+		return "etf: cannot encode value of type " + e.Type.String()
+	}
+
+	return "etf: cannot decode " + e.Term + " into value of type " + e.Type.String()
+}
+
+func etfMarshal(v interface{}) (msg []byte, payloadType byte, err error) {
+	var buf bytes.Buffer
+	if _, err = etfEncode(&buf, v); err != nil {
+		return nil, BinaryFrame, err
+	}
+
+	return buf.Bytes(), BinaryFrame, nil
+}
+
+func etfUnmarshal(msg []byte, payloadType byte, v interface{}) (err error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return ErrEtfTarget
+	}
+
+	if len(msg) == 0 || msg[0] != etfVersion {
+		return ErrEtfVersion
+	}
+
+	d := etfDecoder{data: msg, off: 1}
+	if err = d.decode(rv.Elem()); err != nil {
+		return err
+	}
+	if d.off != len(d.data) {
+		return ErrEtfTrailing
+	}
+
+	return nil
+}
+
+func etfEncode(buf *bytes.Buffer, v interface{}) (payloadType byte, err error) {
+	buf.WriteByte(etfVersion)
+	return BinaryFrame, etfEncodeValue(buf, reflect.ValueOf(v))
+}
+
+func etfDecode(r io.Reader, payloadType byte, v interface{}) (err error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	if _, err = buf.ReadFrom(r); err != nil {
+		return err
+	}
+
+	return etfUnmarshal(buf.Bytes(), payloadType, v)
+}
+
+/*
+ETF is a codec to send/receive terms of the External Term Format of Erlang in
+a binary frame from a WebSocket connection, as the Discord gateway does with
+encoding=etf.  Structs are encoded as maps keyed by field name, which the
+struct tags change as for MessagePack.  nil is encoded as the atom nil, bools
+as the atoms true and false, strings as binaries, and slices as lists; values
+implementing encoding.TextMarshaler are encoded as binaries.  Atoms other than
+nil, true and false are decoded as strings, and so are integers decoded into
+strings, as Discord sends some snowflakes as integers.  Compressed terms,
+references, ports, pids and funs are not supported.
+Trivial usage:
+
+	import "github.com/abeiron/hrngh/api/ws"
+	var data T
+	ws.ETF.Recv(ws, &data)
+	ws.ETF.Send(ws, data)
+*/
+var ETF = Codec{
+	Marshal:   etfMarshal,
+	Unmarshal: etfUnmarshal,
+	Encode:    etfEncode,
+	Decode:    etfDecode,
+}
+
+func etfEncodeValue(buf *bytes.Buffer, v reflect.Value) error {
+	if !v.IsValid() {
+		writeEtfAtom(buf, "nil")
+		return nil
+	}
+
+	if v.Type().Implements(textMarshalerType) {
+		if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+			writeEtfAtom(buf, "nil")
+			return nil
+		}
+
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return err
+		}
+		writeEtfBinary(buf, text)
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			writeEtfAtom(buf, "nil")
+			return nil
+		}
+		return etfEncodeValue(buf, v.Elem())
+
+	case reflect.Bool:
+		if v.Bool() {
+			writeEtfAtom(buf, "true")
+		} else {
+			writeEtfAtom(buf, "false")
+		}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		writeEtfInt(buf, v.Int())
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		writeEtfUint(buf, v.Uint(), false)
+
+	case reflect.Float32, reflect.Float64:
+		buf.WriteByte(etfNewFloat)
+		writeBigEndian(buf, math.Float64bits(v.Float()), 8)
+
+	case reflect.String:
+		writeEtfBinary(buf, []byte(v.String()))
+
+	case reflect.Slice:
+		if v.IsNil() {
+			writeEtfAtom(buf, "nil")
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			writeEtfBinary(buf, v.Bytes())
+			return nil
+		}
+		return etfEncodeList(buf, v)
+
+	case reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			writeEtfBinary(buf, b)
+			return nil
+		}
+		return etfEncodeList(buf, v)
+
+	case reflect.Map:
+		if v.IsNil() {
+			writeEtfAtom(buf, "nil")
+			return nil
+		}
+
+		buf.WriteByte(etfMap)
+		writeBigEndian(buf, uint64(v.Len()), 4)
+		iter := v.MapRange()
+		for iter.Next() {
+			if err := etfEncodeValue(buf, iter.Key()); err != nil {
+				return err
+			}
+			if err := etfEncodeValue(buf, iter.Value()); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Struct:
+		fields := msgpackFields(v.Type())
+
+		n := 0
+		for _, f := range fields {
+			if msgpackEncoded(v, f) {
+				n++
+			}
+		}
+
+		buf.WriteByte(etfMap)
+		writeBigEndian(buf, uint64(n), 4)
+		for _, f := range fields {
+			if !msgpackEncoded(v, f) {
+				continue
+			}
+			writeEtfBinary(buf, []byte(f.name))
+			if err := etfEncodeValue(buf, msgpackFieldValue(v, f.index, false)); err != nil {
+				return err
+			}
+		}
+
+	default:
+		return &EtfTypeError{Type: v.Type()}
+	}
+
+	return nil
+}
+
+func etfEncodeList(buf *bytes.Buffer, v reflect.Value) error {
+	if v.Len() == 0 {
+		buf.WriteByte(etfNil)
+		return nil
+	}
+
+	buf.WriteByte(etfList)
+	writeBigEndian(buf, uint64(v.Len()), 4)
+	for i := 0; i < v.Len(); i++ {
+		if err := etfEncodeValue(buf, v.Index(i)); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte(etfNil)
+
+	return nil
+}
+
+func writeEtfAtom(buf *bytes.Buffer, name string) {
+	buf.WriteByte(etfSmallAtomUTF8)
+	buf.WriteByte(byte(len(name)))
+	buf.WriteString(name)
+}
+
+func writeEtfBinary(buf *bytes.Buffer, b []byte) {
+	buf.WriteByte(etfBinary)
+	writeBigEndian(buf, uint64(len(b)), 4)
+	buf.Write(b)
+}
+
+func writeEtfInt(buf *bytes.Buffer, i int64) {
+	switch {
+	case i >= 0:
+		writeEtfUint(buf, uint64(i), false)
+	case i >= math.MinInt32:
+		buf.WriteByte(etfInteger)
+		writeBigEndian(buf, uint64(i), 4)
+	default:
+		writeEtfUint(buf, uint64(-i), true)
+	}
+}
+
+// writeEtfUint writes an integer of magnitude u, negative if neg is set.
+func writeEtfUint(buf *bytes.Buffer, u uint64, neg bool) {
+	switch {
+	case !neg && u <= math.MaxUint8:
+		buf.WriteByte(etfSmallInteger)
+		buf.WriteByte(byte(u))
+	case !neg && u <= math.MaxInt32:
+		buf.WriteByte(etfInteger)
+		writeBigEndian(buf, u, 4)
+	default:
+		// A bignum, its digits little-endian.
+		var digits [8]byte
+		n := 0
+		for ; u > 0; u >>= 8 {
+			digits[n] = byte(u)
+			n++
+		}
+
+		buf.WriteByte(etfSmallBig)
+		buf.WriteByte(byte(n))
+		if neg {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+		buf.Write(digits[:n])
+	}
+}
+
+// An etfDecoder decodes an ETF term from data.
+type etfDecoder struct {
+	data  []byte
+	off   int
+	depth int
+}
+
+// Families of ETF terms.
+const (
+	etfKindAtom = iota
+	etfKindInt
+	etfKindFloat
+	etfKindBinary
+	etfKindString
+	etfKindList
+	etfKindTuple
+	etfKindMap
+)
+
+var etfKindNames = [...]string{
+	etfKindAtom:   "atom",
+	etfKindInt:    "integer",
+	etfKindFloat:  "float",
+	etfKindBinary: "binary",
+	etfKindString: "string",
+	etfKindList:   "list",
+	etfKindTuple:  "tuple",
+	etfKindMap:    "map",
+}
+
+// An etfHeader is the start of a term: its family, and its value or length,
+// as the family says.  An integer is held as its magnitude u and its sign
+// neg; an atom as its name b, and a string, which is a list of small
+// integers, as its bytes b.
+type etfHeader struct {
+	kind int
+	u    uint64
+	neg  bool
+	f    float64
+	b    []byte
+	n    int
+}
+
+// int returns the integer of h, and whether it fits an int64.
+func (h etfHeader) int() (int64, bool) {
+	if h.neg {
+		return -int64(h.u), h.u <= 1<<63
+	}
+	return int64(h.u), h.u <= math.MaxInt64
+}
+
+func (d *etfDecoder) readN(n int) ([]byte, error) {
+	if n < 0 || n > len(d.data)-d.off {
+		return nil, ErrEtfTruncated
+	}
+
+	b := d.data[d.off : d.off+n]
+	d.off += n
+	return b, nil
+}
+
+func (d *etfDecoder) readUint(n int) (uint64, error) {
+	b, err := d.readN(n)
+	if err != nil {
+		return 0, err
+	}
+
+	var u uint64
+	for _, c := range b {
+		u = u<<8 | uint64(c)
+	}
+
+	return u, nil
+}
+
+// readHeader reads the start of the next term.
+func (d *etfDecoder) readHeader() (h etfHeader, err error) {
+	b, err := d.readN(1)
+	if err != nil {
+		return h, err
+	}
+
+	var u uint64
+	switch b[0] {
+	case etfSmallInteger:
+		h.kind = etfKindInt
+		h.u, err = d.readUint(1)
+	case etfInteger:
+		h.kind = etfKindInt
+		u, err = d.readUint(4)
+		i := int32(u)
+		h.u, h.neg = uint64(i), i < 0
+		if h.neg {
+			h.u = uint64(-int64(i))
+		}
+	case etfSmallBig, etfLargeBig:
+		h.kind = etfKindInt
+		err = d.readBig(b[0] == etfLargeBig, &h)
+
+	case etfNewFloat:
+		h.kind = etfKindFloat
+		u, err = d.readUint(8)
+		h.f = math.Float64frombits(u)
+	case etfFloat:
+		h.kind = etfKindFloat
+		if b, err = d.readN(31); err == nil {
+			h.f, err = strconv.ParseFloat(string(bytes.TrimRight(b, "\x00")), 64)
+		}
+
+	case etfAtom, etfAtomUTF8:
+		h.kind = etfKindAtom
+		if u, err = d.readUint(2); err == nil {
+			h.b, err = d.readN(int(u))
+		}
+	case etfSmallAtom, etfSmallAtomUTF8:
+		h.kind = etfKindAtom
+		if u, err = d.readUint(1); err == nil {
+			h.b, err = d.readN(int(u))
+		}
+
+	case etfBinary:
+		h.kind = etfKindBinary
+		u, err = d.readUint(4)
+		h.n = int(u)
+	case etfString:
+		h.kind = etfKindString
+		if u, err = d.readUint(2); err == nil {
+			h.b, err = d.readN(int(u))
+			h.n = len(h.b)
+		}
+	case etfNil:
+		h.kind = etfKindList
+	case etfList:
+		h.kind = etfKindList
+		u, err = d.readUint(4)
+		h.n = int(u)
+	case etfSmallTuple:
+		h.kind = etfKindTuple
+		u, err = d.readUint(1)
+		h.n = int(u)
+	case etfLargeTuple:
+		h.kind = etfKindTuple
+		u, err = d.readUint(4)
+		h.n = int(u)
+	case etfMap:
+		h.kind = etfKindMap
+		u, err = d.readUint(4)
+		h.n = int(u)
+
+	default:
+		return h, ErrEtfTag
+	}
+	if err != nil {
+		return h, err
+	}
+
+	// Every element takes a byte at least, so a length past the end of
+	// the data is bad and should not be allocated.
+	if h.kind != etfKindString && (h.n < 0 || h.n > len(d.data)-d.off) {
+		return h, ErrEtfTruncated
+	}
+
+	return h, nil
+}
+
+// readBig reads a bignum into h, which fails if it does not fit 64 bits.
+func (d *etfDecoder) readBig(large bool, h *etfHeader) error {
+	size := 1
+	if large {
+		size = 4
+	}
+	n, err := d.readUint(size)
+	if err != nil {
+		return err
+	}
+	sign, err := d.readN(1)
+	if err != nil {
+		return err
+	}
+	digits, err := d.readN(int(n))
+	if err != nil {
+		return err
+	}
+
+	for i := len(digits) - 1; i >= 0; i-- {
+		if h.u>>56 != 0 {
+			return &EtfTypeError{Term: "integer", Type: reflect.TypeOf(h.u)}
+		}
+		h.u = h.u<<8 | uint64(digits[i])
+	}
+	h.neg = sign[0] != 0 && h.u != 0
+
+	return nil
+}
+
+// listEnd reads the tail of a list, which must be the empty list.
+func (d *etfDecoder) listEnd(h etfHeader) error {
+	if h.kind != etfKindList || h.n == 0 {
+		return nil
+	}
+
+	b, err := d.readN(1)
+	if err != nil {
+		return err
+	}
+	if b[0] != etfNil {
+		return ErrEtfImproper
+	}
+
+	return nil
+}
+
+// skip skips the rest of a term whose header was read.
+func (d *etfDecoder) skip(h etfHeader) error {
+	switch h.kind {
+	case etfKindBinary:
+		_, err := d.readN(h.n)
+		return err
+	case etfKindList, etfKindTuple, etfKindMap:
+		n := h.n
+		if h.kind == etfKindMap {
+			n *= 2
+		}
+		for i := 0; i < n; i++ {
+			if err := d.skipValue(); err != nil {
+				return err
+			}
+		}
+		return d.listEnd(h)
+	}
+
+	return nil
+}
+
+func (d *etfDecoder) skipValue() error {
+	d.depth++
+	defer func() { d.depth-- }()
+	if d.depth > maxEtfDepth {
+		return ErrEtfTooDeep
+	}
+
+	h, err := d.readHeader()
+	if err != nil {
+		return err
+	}
+
+	return d.skip(h)
+}
+
+func (d *etfDecoder) typeError(h etfHeader, t reflect.Type) error {
+	return &EtfTypeError{Term: etfKindNames[h.kind], Type: t}
+}
+
+// decode decodes the next term into v.
+func (d *etfDecoder) decode(v reflect.Value) error {
+	d.depth++
+	defer func() { d.depth-- }()
+	if d.depth > maxEtfDepth {
+		return ErrEtfTooDeep
+	}
+
+	h, err := d.readHeader()
+	if err != nil {
+		return err
+	}
+
+	return d.decodeHeader(h, v)
+}
+
+func (d *etfDecoder) decodeHeader(h etfHeader, v reflect.Value) error {
+	if h.kind == etfKindAtom && string(h.b) == "nil" {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return d.decodeHeader(h, v.Elem())
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			return d.typeError(h, v.Type())
+		}
+		x, err := d.decodeAny(h)
+		if err != nil {
+			return err
+		}
+		if x != nil {
+			v.Set(reflect.ValueOf(x))
+		}
+		return nil
+	}
+
+	if (h.kind == etfKindBinary || h.kind == etfKindAtom) && reflect.PtrTo(v.Type()).Implements(textUnmarshalerType) && v.CanAddr() {
+		text, err := d.text(h)
+		if err != nil {
+			return err
+		}
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText(text)
+	}
+
+	switch h.kind {
+	case etfKindAtom:
+		switch {
+		case v.Kind() == reflect.Bool && (string(h.b) == "true" || string(h.b) == "false"):
+			v.SetBool(string(h.b) == "true")
+		case v.Kind() == reflect.String:
+			v.SetString(string(h.b))
+		default:
+			return d.typeError(h, v.Type())
+		}
+
+	case etfKindInt, etfKindFloat:
+		return d.setNumber(h, v)
+
+	case etfKindBinary:
+		b, err := d.readN(h.n)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case v.Kind() == reflect.String:
+			v.SetString(string(b))
+		case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+			v.SetBytes(append([]byte(nil), b...))
+		case v.Kind() == reflect.Array && v.Type().Elem().Kind() == reflect.Uint8 && len(b) <= v.Len():
+			reflect.Copy(v, reflect.ValueOf(b))
+		default:
+			return d.typeError(h, v.Type())
+		}
+
+	case etfKindString:
+		// A list of small integers, which may be text.
+		switch {
+		case v.Kind() == reflect.String:
+			v.SetString(string(h.b))
+		case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+			v.SetBytes(append([]byte(nil), h.b...))
+		default:
+			return d.decodeList(h, v)
+		}
+
+	case etfKindList, etfKindTuple:
+		return d.decodeList(h, v)
+
+	case etfKindMap:
+		switch v.Kind() {
+		case reflect.Map:
+			return d.decodeMap(h, v)
+		case reflect.Struct:
+			return d.decodeStruct(h, v)
+		}
+		return d.typeError(h, v.Type())
+	}
+
+	return nil
+}
+
+// text returns the bytes of a binary or an atom.
+func (d *etfDecoder) text(h etfHeader) ([]byte, error) {
+	if h.kind == etfKindAtom {
+		return h.b, nil
+	}
+	return d.readN(h.n)
+}
+
+// setNumber sets v to the integer or float of h.
+func (d *etfDecoder) setNumber(h etfHeader, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := h.int()
+		if h.kind != etfKindInt || !ok || v.OverflowInt(i) {
+			return d.typeError(h, v.Type())
+		}
+		v.SetInt(i)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if h.kind != etfKindInt || (h.neg && h.u != 0) || v.OverflowUint(h.u) {
+			return d.typeError(h, v.Type())
+		}
+		v.SetUint(h.u)
+
+	case reflect.Float32, reflect.Float64:
+		if h.kind == etfKindFloat {
+			v.SetFloat(h.f)
+		} else if h.neg {
+			v.SetFloat(-float64(h.u))
+		} else {
+			v.SetFloat(float64(h.u))
+		}
+
+	case reflect.String:
+		if h.kind != etfKindInt {
+			return d.typeError(h, v.Type())
+		}
+		s := strconv.FormatUint(h.u, 10)
+		if h.neg {
+			s = "-" + s
+		}
+		v.SetString(s)
+
+	default:
+		return d.typeError(h, v.Type())
+	}
+
+	return nil
+}
+
+// decodeList decodes a list, a string or a tuple into a slice or an array.
+func (d *etfDecoder) decodeList(h etfHeader, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), h.n, h.n))
+	case reflect.Array:
+		if h.n > v.Len() {
+			return d.typeError(h, v.Type())
+		}
+		v.Set(reflect.Zero(v.Type()))
+	default:
+		return d.typeError(h, v.Type())
+	}
+
+	for i := 0; i < h.n; i++ {
+		if h.kind == etfKindString {
+			if err := d.setNumber(etfHeader{kind: etfKindInt, u: uint64(h.b[i])}, v.Index(i)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := d.decode(v.Index(i)); err != nil {
+			return err
+		}
+	}
+
+	return d.listEnd(h)
+}
+
+func (d *etfDecoder) decodeMap(h etfHeader, v reflect.Value) error {
+	t := v.Type()
+	if v.IsNil() {
+		v.Set(reflect.MakeMapWithSize(t, h.n))
+	}
+
+	for i := 0; i < h.n; i++ {
+		key := reflect.New(t.Key()).Elem()
+		if err := d.decode(key); err != nil {
+			return err
+		}
+
+		elem := reflect.New(t.Elem()).Elem()
+		if err := d.decode(elem); err != nil {
+			return err
+		}
+
+		v.SetMapIndex(key, elem)
+	}
+
+	return nil
+}
+
+func (d *etfDecoder) decodeStruct(h etfHeader, v reflect.Value) error {
+	fields := msgpackFields(v.Type())
+
+	for i := 0; i < h.n; i++ {
+		kh, err := d.readHeader()
+		if err != nil {
+			return err
+		}
+
+		var key []byte
+		switch kh.kind {
+		case etfKindAtom, etfKindString:
+			key = kh.b
+		case etfKindBinary:
+			if key, err = d.readN(kh.n); err != nil {
+				return err
+			}
+		default:
+			if err = d.skip(kh); err != nil {
+				return err
+			}
+			if err = d.skipValue(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		f := findMsgpackField(fields, key)
+		if f == nil {
+			if err = d.skipValue(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err = d.decode(msgpackFieldValue(v, f.index, true)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// decodeAny decodes a term whose header was read into an interface{}: nil,
+// bool, int64 (or uint64 past math.MaxInt64), float64, string for atoms and
+// binaries, []interface{} for lists, strings and tuples, or
+// map[string]interface{} (or map[interface{}]interface{} if some key is not
+// an atom or a binary).
+func (d *etfDecoder) decodeAny(h etfHeader) (interface{}, error) {
+	switch h.kind {
+	case etfKindAtom:
+		switch string(h.b) {
+		case "nil":
+			return nil, nil
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		return string(h.b), nil
+
+	case etfKindInt:
+		if i, ok := h.int(); ok {
+			return i, nil
+		}
+		if !h.neg {
+			return h.u, nil
+		}
+		return nil, &EtfTypeError{Term: "integer", Type: reflect.TypeOf(int64(0))}
+
+	case etfKindFloat:
+		return h.f, nil
+
+	case etfKindBinary:
+		b, err := d.readN(h.n)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+
+	case etfKindString:
+		a := make([]interface{}, h.n)
+		for i, c := range h.b {
+			a[i] = int64(c)
+		}
+		return a, nil
+
+	case etfKindList, etfKindTuple:
+		a := make([]interface{}, h.n)
+		for i := range a {
+			if err := d.decode(reflect.ValueOf(&a[i]).Elem()); err != nil {
+				return nil, err
+			}
+		}
+		return a, d.listEnd(h)
+
+	case etfKindMap:
+		keys := make([]interface{}, h.n)
+		values := make([]interface{}, h.n)
+		stringKeys := true
+		for i := 0; i < h.n; i++ {
+			if err := d.decode(reflect.ValueOf(&keys[i]).Elem()); err != nil {
+				return nil, err
+			}
+			if err := d.decode(reflect.ValueOf(&values[i]).Elem()); err != nil {
+				return nil, err
+			}
+
+			switch keys[i].(type) {
+			case string:
+			case []interface{}, map[string]interface{}, map[interface{}]interface{}:
+				return nil, fmt.Errorf("etf: unhashable map key of type %T", keys[i])
+			default:
+				stringKeys = false
+			}
+		}
+
+		if stringKeys {
+			m := make(map[string]interface{}, h.n)
+			for i, k := range keys {
+				m[k.(string)] = values[i]
+			}
+			return m, nil
+		}
+
+		m := make(map[interface{}]interface{}, h.n)
+		for i, k := range keys {
+			m[k] = values[i]
+		}
+		return m, nil
+	}
+
+	return nil, &EtfTypeError{Term: etfKindNames[h.kind], Type: reflect.TypeOf((*interface{})(nil)).Elem()}
+}
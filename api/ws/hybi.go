@@ -16,7 +16,6 @@ import (
 	"crypto/rand"
 	"crypto/sha1"
 	"encoding/base64"
-	"encoding/binary"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -185,6 +184,7 @@ func (buf hybiFrameReaderFactory) NewFrameReader() (frame frameReader, err error
 // A HybiFrameWriter is a writer for hybi frame.
 type hybiFrameWriter struct {
 	writer *bufio.Writer
+	conn   *Conn
 
 	header *hybiFrameHeader
 }
@@ -238,19 +238,33 @@ func (frame *hybiFrameWriter) Write(msg []byte) (n int, err error) {
 		}
 		frame.writer.Write(data)
 		err = frame.writer.Flush()
+		frame.observe(length, err)
 		return length, err
 	}
 	frame.writer.Write(header)
 	frame.writer.Write(msg)
 	err = frame.writer.Flush()
+	frame.observe(length, err)
 	return length, err
 }
 
+// observe tells the connection's observer of the frame written, if the
+// write succeeded.
+func (frame *hybiFrameWriter) observe(length int, err error) {
+	if err != nil || frame.conn == nil || frame.conn.observer == nil {
+		return
+	}
+
+	h := frame.header
+	frame.conn.observer.FrameWritten(h.OpCode, int64(length), h.Rsv[0])
+}
+
 func (frame *hybiFrameWriter) Close() error { return nil }
 
 type hybiFrameWriterFactory struct {
 	*bufio.Writer
 	needMaskingKey bool
+	conn           *Conn
 }
 
 func (buf hybiFrameWriterFactory) NewFrameWriter(payloadType byte) (frame frameWriter, err error) {
@@ -261,7 +275,7 @@ func (buf hybiFrameWriterFactory) NewFrameWriter(payloadType byte) (frame frameW
 			return nil, err
 		}
 	}
-	return &hybiFrameWriter{writer: buf.Writer, header: frameHeader}, nil
+	return &hybiFrameWriter{writer: buf.Writer, conn: buf.conn, header: frameHeader}, nil
 }
 
 type hybiFrameHandler struct {
@@ -270,7 +284,7 @@ type hybiFrameHandler struct {
 }
 
 func (handler *hybiFrameHandler) HandleFrame(frame frameReader) (frameReader, error) {
-	if handler.conn.IsServerConn() {
+	if handler.conn.IsServer() {
 		// The client MUST mask all frames sent to the server.
 		if frame.(*hybiFrameReader).header.MaskingKey == nil {
 			handler.WriteClose(closeStatusProtocolError)
@@ -283,16 +297,38 @@ func (handler *hybiFrameHandler) HandleFrame(frame frameReader) (frameReader, er
 			return nil, io.EOF
 		}
 	}
+	// RSV1 marks the first frame of a compressed data message; the other
+	// bits are not used by any extension this package knows.
+	rsv := frame.(*hybiFrameReader).header.Rsv
+	if rsv[1] || rsv[2] || (rsv[0] && (handler.conn.decompressor == nil || frame.PayloadType() != TextFrame && frame.PayloadType() != BinaryFrame)) {
+		handler.WriteClose(closeStatusProtocolError)
+		return nil, io.EOF
+	}
+	// Control frames must not be fragmented, and are at most 125 bytes long.
+	if hf := frame.(*hybiFrameReader); hf.header.OpCode >= CloseFrame && (!hf.header.Fin || hf.header.Length > maxControlFramePayloadLength) {
+		handler.WriteClose(closeStatusProtocolError)
+		return nil, io.EOF
+	}
 	if header := frame.HeaderReader(); header != nil {
 		io.Copy(ioutil.Discard, header)
 	}
 	switch frame.PayloadType() {
 	case ContinuationFrame:
+		// A continuation frame must follow an unfinished data frame.
+		if handler.payloadType == ContinuationFrame {
+			handler.WriteClose(closeStatusProtocolError)
+			return nil, io.EOF
+		}
 		frame.(*hybiFrameReader).header.OpCode = handler.payloadType
 	case TextFrame, BinaryFrame:
+		// A new message must not start before the last one is finished.
+		if handler.payloadType != ContinuationFrame {
+			handler.WriteClose(closeStatusProtocolError)
+			return nil, io.EOF
+		}
 		handler.payloadType = frame.PayloadType()
 	case CloseFrame:
-		return nil, io.EOF
+		return nil, handler.conn.readClose(frame.(*hybiFrameReader))
 	case PingFrame, PongFrame:
 		b := make([]byte, maxControlFramePayloadLength)
 		n, err := io.ReadFull(frame, b)
@@ -301,41 +337,28 @@ func (handler *hybiFrameHandler) HandleFrame(frame frameReader) (frameReader, er
 		}
 		io.Copy(ioutil.Discard, frame)
 		if frame.PayloadType() == PingFrame {
-			if _, err := handler.WritePong(b[:n]); err != nil {
-				return nil, err
-			}
+			return nil, handler.conn.handlePing(string(b[:n]))
 		}
-		return nil, nil
+		return nil, handler.conn.handlePong(string(b[:n]))
+	default:
+		// The other opcodes are reserved.
+		handler.WriteClose(closeStatusProtocolError)
+		return nil, io.EOF
+	}
+	if frame.(*hybiFrameReader).header.Fin {
+		handler.payloadType = ContinuationFrame
 	}
 	return frame, nil
 }
 
 func (handler *hybiFrameHandler) WriteClose(status int) (err error) {
-	handler.conn.wio.Lock()
-	defer handler.conn.wio.Unlock()
-	w, err := handler.conn.frameWriterFactory.NewFrameWriter(CloseFrame)
-	if err != nil {
-		return err
+	err = handler.conn.writeClose(status, "")
+	if err == ErrCloseSent {
+		return nil
 	}
-	msg := make([]byte, 2)
-	binary.BigEndian.PutUint16(msg, uint16(status))
-	_, err = w.Write(msg)
-	w.Close()
 	return err
 }
 
-func (handler *hybiFrameHandler) WritePong(msg []byte) (n int, err error) {
-	handler.conn.wio.Lock()
-	defer handler.conn.wio.Unlock()
-	w, err := handler.conn.frameWriterFactory.NewFrameWriter(PongFrame)
-	if err != nil {
-		return 0, err
-	}
-	n, err = w.Write(msg)
-	w.Close()
-	return n, err
-}
-
 // newHybiConn creates a new WebSocket connection speaking hybi draft protocol.
 func newHybiConn(config *config.Ws, buf *bufio.ReadWriter, rwc io.ReadWriteCloser, request *http.Request) *Conn {
 	if buf == nil {
@@ -343,13 +366,17 @@ func newHybiConn(config *config.Ws, buf *bufio.ReadWriter, rwc io.ReadWriteClose
 		bw := bufio.NewWriter(rwc)
 		buf = bufio.NewReadWriter(br, bw)
 	}
-	ws := &Conn{config: config, request: request, buf: buf, rwc: rwc,
+	ws := &Conn{cfg: config, req: request, buf: buf, rwc: rwc,
 		frameReaderFactory: hybiFrameReaderFactory{buf.Reader},
-		frameWriterFactory: hybiFrameWriterFactory{
-			buf.Writer, request == nil},
 		PayloadType:        TextFrame,
-		defaultCloseStatus: closeStatusNormal}
+		defaultCloseStatus: closeStatusNormal,
+		closeReceived:      make(chan struct{}),
+		observer:           config.Observer}
+	ws.frameWriterFactory = hybiFrameWriterFactory{buf.Writer, request == nil, ws}
 	ws.frameHandler = &hybiFrameHandler{conn: ws}
+	if config.KeepAlive > 0 {
+		go ws.keepAlive(config.KeepAlive)
+	}
 	return ws
 }
 
@@ -407,7 +434,7 @@ func getNonceAccept(nonce []byte) (expected []byte, err error) {
 }
 
 // Client handshake described in draft-ietf-hybi-thewebsocket-protocol-17
-func hybiClientHandshake(config *config.Ws, br *bufio.Reader, bw *bufio.Writer) (err error) {
+func hybiClientHandshake(config *config.Ws, br *bufio.Reader, bw *bufio.Writer) (deflate *deflateParams, err error) {
 	bw.WriteString("GET " + config.Location.RequestURI() + " HTTP/1.1\r\n")
 
 	// According to RFC 6874, an HTTP client, proxy, or other
@@ -417,51 +444,52 @@ func hybiClientHandshake(config *config.Ws, br *bufio.Reader, bw *bufio.Writer)
 	bw.WriteString("Upgrade: websocket\r\n")
 	bw.WriteString("Connection: Upgrade\r\n")
 	nonce := generateNonce()
-	if config.handshakeData != nil {
-		nonce = []byte(config.handshakeData["key"])
-	}
 	bw.WriteString("Sec-WebSocket-Key: " + string(nonce) + "\r\n")
 	bw.WriteString("Origin: " + strings.ToLower(config.Origin.String()) + "\r\n")
 
 	if config.Version != ProtocolVersionHybi13 {
-		return ErrBadProtocolVersion
+		return nil, ErrBadProtocolVer
 	}
 
 	bw.WriteString("Sec-WebSocket-Version: " + fmt.Sprintf("%d", config.Version) + "\r\n")
 	if len(config.Protocol) > 0 {
 		bw.WriteString("Sec-WebSocket-Protocol: " + strings.Join(config.Protocol, ", ") + "\r\n")
 	}
-	// TODO(ukai): send Sec-WebSocket-Extensions.
+	if config.EnableCompression {
+		bw.WriteString("Sec-WebSocket-Extensions: " + deflateOffer(config) + "\r\n")
+	}
 	err = config.Header.WriteSubset(bw, handshakeHeader)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	bw.WriteString("\r\n")
 	if err = bw.Flush(); err != nil {
-		return err
+		return nil, err
 	}
 
 	resp, err := http.ReadResponse(br, &http.Request{Method: "GET"})
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if resp.StatusCode != 101 {
-		return ErrBadStatus
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+		return nil, &statusError{ErrBadStatus, resp, body}
 	}
 	if strings.ToLower(resp.Header.Get("Upgrade")) != "websocket" ||
 		strings.ToLower(resp.Header.Get("Connection")) != "upgrade" {
-		return ErrBadUpgrade
+		return nil, ErrBadUpgrade
 	}
 	expectedAccept, err := getNonceAccept(nonce)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if resp.Header.Get("Sec-WebSocket-Accept") != string(expectedAccept) {
-		return ErrChallengeResponse
+		return nil, ErrChallengeResp
 	}
-	if resp.Header.Get("Sec-WebSocket-Extensions") != "" {
-		return ErrUnsupportedExtensions
+	deflate, err = acceptDeflateResponse(config, resp.Header["Sec-Websocket-Extensions"])
+	if err != nil {
+		return nil, err
 	}
 	offeredProtocol := resp.Header.Get("Sec-WebSocket-Protocol")
 	if offeredProtocol != "" {
@@ -473,14 +501,31 @@ func hybiClientHandshake(config *config.Ws, br *bufio.Reader, bw *bufio.Writer)
 			}
 		}
 		if !protocolMatched {
-			return ErrBadWebSocketProtocol
+			return nil, ErrBadProtocol
 		}
 		config.Protocol = []string{offeredProtocol}
+	} else {
+		// The server chose no subprotocol.
+		config.Protocol = nil
 	}
 
-	return nil
+	return deflate, nil
 }
 
+// maxErrorBodyBytes limits how much of the body of a response refusing
+// a handshake is kept for the error.
+const maxErrorBodyBytes = 4 << 10
+
+// A statusError carries the response refusing a handshake or a proxy
+// connection.
+type statusError struct {
+	err  error
+	resp *http.Response
+	body []byte
+}
+
+func (e *statusError) Error() string { return e.err.Error() }
+
 // newHybiClientConn creates a client WebSocket connection after handshake.
 func newHybiClientConn(config *config.Ws, buf *bufio.ReadWriter, rwc io.ReadWriteCloser) *Conn {
 	return newHybiConn(config, buf, rwc, nil)
@@ -488,14 +533,15 @@ func newHybiClientConn(config *config.Ws, buf *bufio.ReadWriter, rwc io.ReadWrit
 
 // A HybiServerHandshaker performs a server handshake using hybi draft protocol.
 type hybiServerHandshaker struct {
-	*Config
-	accept []byte
+	*config.Ws
+	accept  []byte
+	deflate *deflateParams
 }
 
 func (c *hybiServerHandshaker) ReadHandshake(buf *bufio.Reader, req *http.Request) (code int, err error) {
 	c.Version = ProtocolVersionHybi13
 	if req.Method != "GET" {
-		return http.StatusMethodNotAllowed, ErrBadRequestMethod
+		return http.StatusMethodNotAllowed, ErrBadReqMethod
 	}
 	// HTTP version can be safely ignored.
 
@@ -506,14 +552,14 @@ func (c *hybiServerHandshaker) ReadHandshake(buf *bufio.Reader, req *http.Reques
 
 	key := req.Header.Get("Sec-Websocket-Key")
 	if key == "" {
-		return http.StatusBadRequest, ErrChallengeResponse
+		return http.StatusBadRequest, ErrChallengeResp
 	}
 	version := req.Header.Get("Sec-Websocket-Version")
 	switch version {
 	case "13":
 		c.Version = ProtocolVersionHybi13
 	default:
-		return http.StatusBadRequest, ErrBadWebSocketVersion
+		return http.StatusBadRequest, ErrBadVersion
 	}
 	var scheme string
 	if req.TLS != nil {
@@ -532,6 +578,7 @@ func (c *hybiServerHandshaker) ReadHandshake(buf *bufio.Reader, req *http.Reques
 			c.Protocol = append(c.Protocol, strings.TrimSpace(protocols[i]))
 		}
 	}
+	c.deflate = acceptDeflateOffer(c.Ws, req.Header["Sec-Websocket-Extensions"])
 	c.accept, err = getNonceAccept([]byte(key))
 	if err != nil {
 		return http.StatusInternalServerError, err
@@ -557,7 +604,7 @@ func (c *hybiServerHandshaker) AcceptHandshake(buf *bufio.Writer) (err error) {
 	if len(c.Protocol) > 0 {
 		if len(c.Protocol) != 1 {
 			// You need choose a Protocol in Handshake func in Server.
-			return ErrBadWebSocketProtocol
+			return ErrBadProtocol
 		}
 	}
 	buf.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
@@ -567,7 +614,9 @@ func (c *hybiServerHandshaker) AcceptHandshake(buf *bufio.Writer) (err error) {
 	if len(c.Protocol) > 0 {
 		buf.WriteString("Sec-WebSocket-Protocol: " + c.Protocol[0] + "\r\n")
 	}
-	// TODO(ukai): send Sec-WebSocket-Extensions.
+	if c.deflate != nil {
+		buf.WriteString("Sec-WebSocket-Extensions: " + c.deflate.String() + "\r\n")
+	}
 	if c.Header != nil {
 		err := c.Header.WriteSubset(buf, handshakeHeader)
 		if err != nil {
@@ -579,7 +628,9 @@ func (c *hybiServerHandshaker) AcceptHandshake(buf *bufio.Writer) (err error) {
 }
 
 func (c *hybiServerHandshaker) NewServerConn(buf *bufio.ReadWriter, rwc io.ReadWriteCloser, request *http.Request) *Conn {
-	return newHybiServerConn(c.Config, buf, rwc, request)
+	ws := newHybiServerConn(c.Ws, buf, rwc, request)
+	ws.setDeflate(c.deflate)
+	return ws
 }
 
 // newHybiServerConn returns a new WebSocket connection speaking hybi draft protocol.
@@ -0,0 +1,462 @@
+// WebSocket implementation for the Hrngh bot.
+// Available at https://github.com/abeiron/hrngh
+
+// Copyright 2020-2021, Undying Memory <abeiron@outlook.com>.  All rights reserved.
+// Use of this source code is governed by the Microsoft Public License
+// that can be found in the LICENSE file.
+
+// This file contains code related to reading and writing whole messages,
+// which may be fragmented over several frames.
+
+package ws
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+	"unicode/utf8"
+)
+
+// messageFrameSize is the size of the frames NextWriter splits messages
+// into.
+const messageFrameSize = 4096
+
+var (
+	ErrBadMessageType = &ProtocolError{"bad message type"}
+	ErrInvalidUTF8    = &ProtocolError{"invalid UTF-8 in text message"}
+)
+
+var (
+	errStaleReader  = errors.New("websocket: read from a reader after the next message")
+	errWriterClosed = errors.New("websocket: write to a closed writer")
+)
+
+// NextReader returns the type of the next message received, TextFrame or
+// BinaryFrame, and a reader for its payload, reassembled from all of its
+// frames and decompressed.  Control frames received in between are handled
+// as they arrive.
+//
+// The reader returns ErrFrameTooLarge once the message grows larger than
+// MaxPayloadBytes, and ErrInvalidUTF8 if a text message is not valid UTF-8,
+// in which case the connection is closed.  Any part of the message left
+// unread is discarded by the next call to NextReader, Read or a Codec's
+// Recv, after which the reader must no longer be used.
+func (ws *Conn) NextReader() (messageType byte, r io.Reader, err error) {
+	ws.rio.Lock()
+	defer ws.rio.Unlock()
+
+	mr, err := ws.nextMessage()
+	if err != nil {
+		return UnknownFrame, nil, err
+	}
+
+	return mr.payloadType, nextReader{mr}, nil
+}
+
+// NextWriter returns a writer for a new message of messageType, TextFrame
+// or BinaryFrame.  The payload is sent in continuation frames as it is
+// written, and the message ends when the writer is closed.  Other messages
+// wait to be sent until then, so the writer must always be closed; control
+// frames may still be sent in between.
+func (ws *Conn) NextWriter(messageType byte) (io.WriteCloser, error) {
+	if messageType != TextFrame && messageType != BinaryFrame {
+		return nil, ErrBadMessageType
+	}
+
+	ws.mio.Lock()
+
+	w := &messageWriter{ws: ws, payloadType: messageType}
+	if ws.compress && ws.compressor != nil {
+		if err := ws.compressor.begin(); err != nil {
+			ws.mio.Unlock()
+			return nil, err
+		}
+
+		w.compressor = ws.compressor
+		w.compressed = true
+	} else {
+		w.buf = make([]byte, 0, messageFrameSize)
+	}
+
+	return w, nil
+}
+
+// nextMessage discards what is left of the message being read, and starts
+// reading the next one.  ws.rio must be held.
+func (ws *Conn) nextMessage() (*messageReader, error) {
+	if ws.reader != nil {
+		err := ws.reader.discard()
+		ws.reader = nil
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	frame, err := ws.nextFrame()
+	if err != nil {
+		return nil, err
+	}
+
+	r := &messageReader{
+		ws:          ws,
+		payloadType: frame.PayloadType(),
+		frame:       frame,
+		remaining:   frame.header.Length,
+		length:      frame.header.Length,
+		max:         int64(ws.maxPayloadBytes()),
+	}
+
+	r.src = payloadReader{r}
+	if frame.header.Rsv[0] {
+		r.src = ws.decompressor.reader(r.src)
+		r.compressed = true
+	}
+	if r.payloadType == TextFrame {
+		r.utf8 = new(utf8Validator)
+	}
+
+	ws.reader = r
+	return r, nil
+}
+
+// nextFrame reads the next data frame, handling the control frames before
+// it.  ws.rio must be held.
+func (ws *Conn) nextFrame() (*hybiFrameReader, error) {
+	if ws.closeErr != nil {
+		return nil, ws.closeErr
+	}
+
+	for {
+		frame, err := ws.frameReaderFactory.NewFrameReader()
+		if err != nil {
+			return nil, ws.readError(err)
+		}
+		if ws.observer != nil {
+			h := frame.(*hybiFrameReader).header
+			ws.observer.FrameRead(h.OpCode, h.Length, h.Rsv[0])
+		}
+
+		frame, err = ws.frameHandler.HandleFrame(frame)
+		if err != nil {
+			return nil, err
+		}
+
+		if frame != nil {
+			return frame.(*hybiFrameReader), nil
+		}
+	}
+}
+
+// maxPayloadBytes returns the limit on the size of incoming messages.
+func (ws *Conn) maxPayloadBytes() int {
+	if ws.MaxPayloadBytes == 0 {
+		return DefaultMaxPayloadBytes
+	}
+
+	return ws.MaxPayloadBytes
+}
+
+// A messageReader reads a message, frame after frame.
+type messageReader struct {
+	ws          *Conn
+	payloadType byte
+
+	// frame is the frame being read, or nil once the last one has been.
+	frame     *hybiFrameReader
+	remaining int64
+
+	// length is the payload length of the frames so far, and compressed
+	// whether that is the length of the compressed message.
+	length     int64
+	compressed bool
+
+	// src reads the payload, decompressed if needed; n bytes of it have
+	// been read.
+	src io.Reader
+	n   int64
+
+	max  int64
+	utf8 *utf8Validator
+	err  error
+}
+
+func (r *messageReader) Read(p []byte) (n int, err error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	n, err = r.src.Read(p)
+	r.n += int64(n)
+	if r.n > r.max {
+		n -= int(r.n - r.max)
+		r.n = r.max
+		err = ErrFrameTooLarge
+	}
+
+	if r.utf8 != nil && err != ErrFrameTooLarge {
+		if !r.utf8.write(p[:n]) || err == io.EOF && !r.utf8.complete() {
+			r.ws.frameHandler.WriteClose(closeStatusBadMessageData)
+			n, err = 0, ErrInvalidUTF8
+		}
+	}
+
+	if err != nil {
+		r.err = err
+	}
+
+	return n, err
+}
+
+// readPayload reads the payload of the message as it was received.
+func (r *messageReader) readPayload(p []byte) (n int, err error) {
+	for r.frame != nil {
+		// The size of a compressed message is checked as it is
+		// decompressed instead.
+		if !r.compressed && r.length > r.max {
+			return 0, ErrFrameTooLarge
+		}
+
+		n, err = r.frame.Read(p)
+		r.remaining -= int64(n)
+		switch {
+		case err == io.EOF && r.remaining > 0:
+			return n, r.ws.readError(io.ErrUnexpectedEOF)
+		case err == io.EOF:
+			err = r.nextFrame()
+		case err != nil:
+			return n, r.ws.readError(err)
+		}
+
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+
+	return 0, io.EOF
+}
+
+// nextFrame moves on to the next frame of the message, if any.
+func (r *messageReader) nextFrame() error {
+	if r.frame.header.Fin {
+		r.frame = nil
+		return nil
+	}
+
+	frame, err := r.ws.nextFrame()
+	if err != nil {
+		return err
+	}
+
+	r.frame = frame
+	r.remaining = frame.header.Length
+	r.length += frame.header.Length
+	return nil
+}
+
+// discard reads the rest of the message off the connection.  A compressed
+// message is decompressed all the same, as the messages after it may refer
+// to its content.
+func (r *messageReader) discard() error {
+	r.max = math.MaxInt64
+
+	_, err := io.Copy(ioutil.Discard, r.src)
+	return err
+}
+
+// A payloadReader reads the payload of a message as it was received.
+type payloadReader struct{ r *messageReader }
+
+func (p payloadReader) Read(b []byte) (int, error) { return p.r.readPayload(b) }
+
+// A nextReader is a reader returned by NextReader, which goes stale once
+// the next message is read.
+type nextReader struct{ r *messageReader }
+
+func (nr nextReader) Read(p []byte) (int, error) {
+	ws := nr.r.ws
+
+	ws.rio.Lock()
+	defer ws.rio.Unlock()
+
+	if ws.reader != nr.r {
+		return 0, errStaleReader
+	}
+
+	return nr.r.Read(p)
+}
+
+// A messageWriter writes a message in as many frames as it takes.
+type messageWriter struct {
+	ws *Conn
+
+	// payloadType is the opcode of the next frame, and compressed whether
+	// it is the first frame of a compressed message.
+	payloadType byte
+	compressed  bool
+
+	compressor *compressor
+	buf        []byte
+	err        error
+	closed     bool
+}
+
+func (w *messageWriter) Write(p []byte) (n int, err error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	if w.compressor != nil {
+		if err = w.compressor.write(p); err != nil {
+			w.err = err
+			return 0, err
+		}
+
+		// The last bytes are held back, as they may be the end of the
+		// flush which Close strips.
+		out := &w.compressor.buf
+		for out.Len() > messageFrameSize+4 {
+			if err = w.writeFrame(out.Next(messageFrameSize), false); err != nil {
+				return 0, err
+			}
+		}
+
+		return len(p), nil
+	}
+
+	for len(p) > 0 {
+		if len(w.buf) == cap(w.buf) {
+			if err = w.writeFrame(w.buf, false); err != nil {
+				return n, err
+			}
+			w.buf = w.buf[:0]
+		}
+
+		m := copy(w.buf[len(w.buf):cap(w.buf)], p)
+		w.buf = w.buf[:len(w.buf)+m]
+		p = p[m:]
+		n += m
+	}
+
+	return n, nil
+}
+
+// Close sends the last frame of the message.
+func (w *messageWriter) Close() error {
+	if w.closed {
+		return errWriterClosed
+	}
+	defer w.ws.mio.Unlock()
+
+	err := w.err
+	w.closed = true
+	w.err = errWriterClosed
+	if err != nil {
+		return err
+	}
+
+	data := w.buf
+	if w.compressor != nil {
+		if data, err = w.compressor.end(); err != nil {
+			return err
+		}
+
+		for len(data) > messageFrameSize {
+			if err = w.writeFrame(data[:messageFrameSize], false); err != nil {
+				return err
+			}
+			data = data[messageFrameSize:]
+		}
+	}
+
+	return w.writeFrame(data, true)
+}
+
+// writeFrame sends a frame of the message.
+func (w *messageWriter) writeFrame(data []byte, fin bool) error {
+	w.ws.wio.Lock()
+	defer w.ws.wio.Unlock()
+
+	if w.ws.closeSent {
+		w.err = ErrCloseSent
+		return w.err
+	}
+
+	frame, err := w.ws.frameWriterFactory.NewFrameWriter(w.payloadType)
+	if err != nil {
+		w.err = err
+		return err
+	}
+
+	if hf, ok := frame.(*hybiFrameWriter); ok {
+		hf.header.Fin = fin
+		hf.header.Rsv[0] = w.compressed
+	}
+
+	_, err = frame.Write(data)
+	if err == nil {
+		err = frame.Close()
+	}
+	if err != nil {
+		w.err = err
+		return err
+	}
+
+	w.payloadType = ContinuationFrame
+	w.compressed = false
+	return nil
+}
+
+// A utf8Validator checks that a text message is valid UTF-8 as it is read,
+// in pieces which may split runes.
+type utf8Validator struct {
+	partial [utf8.UTFMax]byte
+	n       int
+}
+
+// write validates the next piece of the message.
+func (v *utf8Validator) write(p []byte) bool {
+	if v.n > 0 {
+		// Complete the rune split by the previous piece.
+		for len(p) > 0 && !utf8.FullRune(v.partial[:v.n]) {
+			v.partial[v.n] = p[0]
+			v.n++
+			p = p[1:]
+		}
+
+		if !utf8.FullRune(v.partial[:v.n]) {
+			return true
+		}
+		if r, size := utf8.DecodeRune(v.partial[:v.n]); r == utf8.RuneError && size == 1 {
+			return false
+		}
+		v.n = 0
+	}
+
+	for i := 0; i < len(p); {
+		if p[i] < utf8.RuneSelf {
+			i++
+			continue
+		}
+
+		if !utf8.FullRune(p[i:]) {
+			v.n = copy(v.partial[:], p[i:])
+			return true
+		}
+
+		r, size := utf8.DecodeRune(p[i:])
+		if r == utf8.RuneError && size == 1 {
+			return false
+		}
+		i += size
+	}
+
+	return true
+}
+
+// complete reports whether the message read so far does not end in the
+// middle of a rune.
+func (v *utf8Validator) complete() bool { return v.n == 0 }
@@ -0,0 +1,288 @@
+// WebSocket implementation for the Hrngh bot.
+// Available at https://github.com/abeiron/hrngh
+
+// Copyright 2020-2021, Undying Memory <abeiron@outlook.com>.  All rights reserved.
+// Use of this source code is governed by the Microsoft Public License
+// that can be found in the LICENSE file.
+
+// This file contains an Observer exporting metrics in the Prometheus text
+// format.
+// https://prometheus.io/docs/instrumenting/exposition_formats/
+
+package ws
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Bucket bounds of the histograms of Metrics.
+var (
+	handshakeBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	rttBuckets       = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5}
+	frameBuckets     = []float64{16, 64, 256, 1024, 4096, 16384, 65536, 262144, 1048576}
+)
+
+// Indices of the arrays of Metrics.
+const (
+	sideServer = iota
+	sideClient
+)
+
+const (
+	dirRead = iota
+	dirWritten
+)
+
+var (
+	sideNames = [...]string{"server", "client"}
+	dirNames  = [...]string{"read", "written"}
+)
+
+// Metrics is an Observer counting the events of connections, which it
+// serves in the Prometheus text format as an http.Handler.  The metrics are
+// named hrngh_ws_*.  Its zero value is not ready for use; call NewMetrics.
+//
+//	m := ws.NewMetrics()
+//	cfg.Observer = m
+//	http.Handle("/metrics", m)
+type Metrics struct {
+	// handshakes counts the handshakes by side and success.
+	handshakes        [2][2]uint64
+	handshakeDuration [2]*histogram
+
+	// frames counts the frames by direction, opcode and compression, and
+	// bytes their payload bytes by direction.
+	frames     [2][16][2]uint64
+	bytes      [2]uint64
+	frameBytes [2]*histogram
+
+	pingRTT *histogram
+
+	// closes counts the close frames by direction and code.
+	mu     sync.Mutex
+	closes map[closeKey]uint64
+}
+
+type closeKey struct {
+	code int
+	sent bool
+}
+
+// NewMetrics returns a new Metrics.
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		pingRTT: newHistogram(rttBuckets),
+		closes:  make(map[closeKey]uint64),
+	}
+	for i := range m.handshakeDuration {
+		m.handshakeDuration[i] = newHistogram(handshakeBuckets)
+		m.frameBytes[i] = newHistogram(frameBuckets)
+	}
+
+	return m
+}
+
+func sideIndex(client bool) int {
+	if client {
+		return sideClient
+	}
+	return sideServer
+}
+
+func boolIndex(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (m *Metrics) HandshakeStart(client bool) {}
+
+func (m *Metrics) HandshakeFinish(client bool, elapsed time.Duration, err error) {
+	side := sideIndex(client)
+	atomic.AddUint64(&m.handshakes[side][boolIndex(err == nil)], 1)
+	m.handshakeDuration[side].observe(elapsed.Seconds())
+}
+
+func (m *Metrics) FrameRead(opcode byte, length int64, compressed bool) {
+	m.frame(dirRead, opcode, length, compressed)
+}
+
+func (m *Metrics) FrameWritten(opcode byte, length int64, compressed bool) {
+	m.frame(dirWritten, opcode, length, compressed)
+}
+
+func (m *Metrics) frame(dir int, opcode byte, length int64, compressed bool) {
+	atomic.AddUint64(&m.frames[dir][opcode&0xf][boolIndex(compressed)], 1)
+	atomic.AddUint64(&m.bytes[dir], uint64(length))
+	m.frameBytes[dir].observe(float64(length))
+}
+
+func (m *Metrics) PingRTT(rtt time.Duration) {
+	m.pingRTT.observe(rtt.Seconds())
+}
+
+func (m *Metrics) Close(code int, sent bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.closes[closeKey{code, sent}]++
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var buf bytes.Buffer
+	m.WriteTo(&buf)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+// WriteTo writes the metrics in the Prometheus text format to w.
+func (m *Metrics) WriteTo(w io.Writer) (n int64, err error) {
+	var buf bytes.Buffer
+
+	writeHelp(&buf, "hrngh_ws_handshakes_total", "counter", "WebSocket opening handshakes by side and result.")
+	for side := range m.handshakes {
+		for ok, name := range [...]string{"error", "ok"} {
+			fmt.Fprintf(&buf, "hrngh_ws_handshakes_total{side=%q,result=%q} %d\n",
+				sideNames[side], name, atomic.LoadUint64(&m.handshakes[side][ok]))
+		}
+	}
+
+	writeHelp(&buf, "hrngh_ws_handshake_duration_seconds", "histogram", "Duration of WebSocket opening handshakes by side.")
+	for side, h := range m.handshakeDuration {
+		h.write(&buf, "hrngh_ws_handshake_duration_seconds", fmt.Sprintf("side=%q", sideNames[side]))
+	}
+
+	writeHelp(&buf, "hrngh_ws_frames_total", "counter", "WebSocket frames by direction, opcode and compression.")
+	for dir := range m.frames {
+		for opcode := range m.frames[dir] {
+			for compressed := range m.frames[dir][opcode] {
+				count := atomic.LoadUint64(&m.frames[dir][opcode][compressed])
+				if count == 0 {
+					continue
+				}
+				fmt.Fprintf(&buf, "hrngh_ws_frames_total{direction=%q,opcode=%q,compressed=\"%t\"} %d\n",
+					dirNames[dir], opcodeName(byte(opcode)), compressed == 1, count)
+			}
+		}
+	}
+
+	writeHelp(&buf, "hrngh_ws_frame_bytes_total", "counter", "WebSocket frame payload bytes by direction.")
+	for dir := range m.bytes {
+		fmt.Fprintf(&buf, "hrngh_ws_frame_bytes_total{direction=%q} %d\n",
+			dirNames[dir], atomic.LoadUint64(&m.bytes[dir]))
+	}
+
+	writeHelp(&buf, "hrngh_ws_frame_size_bytes", "histogram", "Size of WebSocket frame payloads by direction.")
+	for dir, h := range m.frameBytes {
+		h.write(&buf, "hrngh_ws_frame_size_bytes", fmt.Sprintf("direction=%q", dirNames[dir]))
+	}
+
+	writeHelp(&buf, "hrngh_ws_ping_rtt_seconds", "histogram", "Round trip time of WebSocket pings.")
+	m.pingRTT.write(&buf, "hrngh_ws_ping_rtt_seconds", "")
+
+	writeHelp(&buf, "hrngh_ws_closes_total", "counter", "WebSocket close frames by direction and code; dropped connections count as received 1006.")
+	m.mu.Lock()
+	keys := make([]closeKey, 0, len(m.closes))
+	for k := range m.closes {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].sent != keys[j].sent {
+			return !keys[i].sent
+		}
+		return keys[i].code < keys[j].code
+	})
+	for _, k := range keys {
+		dir := "received"
+		if k.sent {
+			dir = "sent"
+		}
+		fmt.Fprintf(&buf, "hrngh_ws_closes_total{direction=%q,code=\"%d\"} %d\n", dir, k.code, m.closes[k])
+	}
+	m.mu.Unlock()
+
+	return buf.WriteTo(w)
+}
+
+func writeHelp(buf *bytes.Buffer, name, typ, help string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// opcodeName returns the name of an opcode for a label.
+func opcodeName(opcode byte) string {
+	switch opcode {
+	case ContinuationFrame:
+		return "continuation"
+	case TextFrame:
+		return "text"
+	case BinaryFrame:
+		return "binary"
+	case CloseFrame:
+		return "close"
+	case PingFrame:
+		return "ping"
+	case PongFrame:
+		return "pong"
+	}
+
+	return strconv.Itoa(int(opcode))
+}
+
+// A histogram counts observations in buckets, as a Prometheus histogram.
+type histogram struct {
+	mu     sync.Mutex
+	bounds []float64
+	counts []uint64 // by bucket, the last for observations past the bounds
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+func (h *histogram) observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v)
+
+	h.mu.Lock()
+	h.counts[i]++
+	h.sum += v
+	h.count++
+	h.mu.Unlock()
+}
+
+// write writes the histogram's series, with labels added to each.
+func (h *histogram) write(buf *bytes.Buffer, name, labels string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sep := ""
+	if labels != "" {
+		sep = ","
+	}
+
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		fmt.Fprintf(buf, "%s_bucket{%s%sle=\"%s\"} %d\n",
+			name, labels, sep, strconv.FormatFloat(bound, 'f', -1, 64), cumulative)
+	}
+	fmt.Fprintf(buf, "%s_bucket{%s%sle=\"+Inf\"} %d\n", name, labels, sep, h.count)
+
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(buf, "%s_sum%s %s\n", name, labels, strconv.FormatFloat(h.sum, 'g', -1, 64))
+	fmt.Fprintf(buf, "%s_count%s %d\n", name, labels, h.count)
+}
@@ -0,0 +1,981 @@
+// WebSocket implementation for the Hrngh bot.
+// Available at https://github.com/abeiron/hrngh
+
+// Copyright 2020-2021, Undying Memory <abeiron@outlook.com>.  All rights reserved.
+// Use of this source code is governed by the Microsoft Public License
+// that can be found in the LICENSE file.
+
+// This file contains the MessagePack codec.
+// https://github.com/msgpack/msgpack/blob/master/spec.md
+
+package ws
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// MessagePack format bytes.
+const (
+	mpNil      = 0xc0
+	mpFalse    = 0xc2
+	mpTrue     = 0xc3
+	mpBin8     = 0xc4
+	mpBin16    = 0xc5
+	mpBin32    = 0xc6
+	mpExt8     = 0xc7
+	mpExt16    = 0xc8
+	mpExt32    = 0xc9
+	mpFloat32  = 0xca
+	mpFloat64  = 0xcb
+	mpUint8    = 0xcc
+	mpUint16   = 0xcd
+	mpUint32   = 0xce
+	mpUint64   = 0xcf
+	mpInt8     = 0xd0
+	mpInt16    = 0xd1
+	mpInt32    = 0xd2
+	mpInt64    = 0xd3
+	mpFixExt1  = 0xd4
+	mpFixExt2  = 0xd5
+	mpFixExt4  = 0xd6
+	mpFixExt8  = 0xd7
+	mpFixExt16 = 0xd8
+	mpStr8     = 0xd9
+	mpStr16    = 0xda
+	mpStr32    = 0xdb
+	mpArray16  = 0xdc
+	mpArray32  = 0xdd
+	mpMap16    = 0xde
+	mpMap32    = 0xdf
+)
+
+// maxMsgpackDepth bounds the nesting of the values decoded.
+const maxMsgpackDepth = 1000
+
+var (
+	ErrMsgpackTarget    = &ProtocolError{"msgpack: decoding needs a non-nil pointer"}
+	ErrMsgpackTruncated = &ProtocolError{"msgpack: unexpected end of data"}
+	ErrMsgpackTrailing  = &ProtocolError{"msgpack: data after the value"}
+	ErrMsgpackTooDeep   = &ProtocolError{"msgpack: values nested too deep"}
+	ErrMsgpackFormat    = &ProtocolError{"msgpack: unknown format"}
+)
+
+// MsgpackTypeError is returned when a MessagePack value cannot be decoded
+// into a Go value, or a Go value cannot be encoded.
+type MsgpackTypeError struct {
+	Value string // the MessagePack value, empty when encoding
+	Type  reflect.Type
+}
+
+func (e *MsgpackTypeError) Error() string {
+	if e.Value == "" {
+		return "msgpack: cannot encode value of type " + e.Type.String()
+	}
+
+	return "msgpack: cannot decode " + e.Value + " into value of type " + e.Type.String()
+}
+
+var (
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+func msgpackMarshal(v interface{}) (msg []byte, payloadType byte, err error) {
+	var buf bytes.Buffer
+	if err = msgpackEncodeValue(&buf, reflect.ValueOf(v)); err != nil {
+		return nil, BinaryFrame, err
+	}
+
+	return buf.Bytes(), BinaryFrame, nil
+}
+
+func msgpackUnmarshal(msg []byte, payloadType byte, v interface{}) (err error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return ErrMsgpackTarget
+	}
+
+	d := msgpackDecoder{data: msg}
+	if err = d.decode(rv.Elem()); err != nil {
+		return err
+	}
+	if d.off != len(d.data) {
+		return ErrMsgpackTrailing
+	}
+
+	return nil
+}
+
+func msgpackEncode(buf *bytes.Buffer, v interface{}) (payloadType byte, err error) {
+	return BinaryFrame, msgpackEncodeValue(buf, reflect.ValueOf(v))
+}
+
+func msgpackDecode(r io.Reader, payloadType byte, v interface{}) (err error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	if _, err = buf.ReadFrom(r); err != nil {
+		return err
+	}
+
+	return msgpackUnmarshal(buf.Bytes(), payloadType, v)
+}
+
+/*
+MessagePack is a codec to send/receive MessagePack data in a binary frame from
+a WebSocket connection.  Structs are encoded as maps keyed by field name, which
+the "msgpack" struct tag, or failing it the "json" tag, may change as for
+encoding/json, including "-" and ",omitempty".  Values implementing
+encoding.TextMarshaler are encoded as strings.  Extension types are not
+supported.
+Trivial usage:
+
+	import "github.com/abeiron/hrngh/api/ws"
+	var data T
+	ws.MessagePack.Recv(ws, &data)
+	ws.MessagePack.Send(ws, data)
+*/
+var MessagePack = Codec{
+	Marshal:   msgpackMarshal,
+	Unmarshal: msgpackUnmarshal,
+	Encode:    msgpackEncode,
+	Decode:    msgpackDecode,
+}
+
+// A msgpackField is a struct field encoded as a map entry.
+type msgpackField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+var msgpackFieldCache sync.Map // map[reflect.Type][]msgpackField
+
+// msgpackFields returns the fields of a struct type which are encoded,
+// including those of embedded structs.
+func msgpackFields(t reflect.Type) []msgpackField {
+	if f, ok := msgpackFieldCache.Load(t); ok {
+		return f.([]msgpackField)
+	}
+
+	fields := appendMsgpackFields(nil, t, nil)
+	msgpackFieldCache.Store(t, fields)
+	return fields
+}
+
+func appendMsgpackFields(fields []msgpackField, t reflect.Type, index []int) []msgpackField {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+
+		tag, ok := sf.Tag.Lookup("msgpack")
+		if !ok {
+			tag = sf.Tag.Get("json")
+		}
+		if tag == "-" {
+			continue
+		}
+
+		name := tag
+		var opts string
+		if i := strings.IndexByte(tag, ','); i >= 0 {
+			name, opts = tag[:i], tag[i:]
+		}
+
+		fi := make([]int, len(index)+1)
+		copy(fi, index)
+		fi[len(index)] = i
+
+		if sf.Anonymous && name == "" {
+			ft := sf.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				fields = appendMsgpackFields(fields, ft, fi)
+				continue
+			}
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = sf.Name
+		}
+		fields = append(fields, msgpackField{
+			name:      name,
+			index:     fi,
+			omitEmpty: strings.Contains(opts, ",omitempty"),
+		})
+	}
+
+	return fields
+}
+
+// msgpackFieldValue returns the field of v at index.  It returns an invalid
+// value if an embedded pointer on the way is nil, unless alloc is set, when
+// it allocates it.
+func msgpackFieldValue(v reflect.Value, index []int, alloc bool) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !alloc {
+					return reflect.Value{}
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+
+	return v
+}
+
+// msgpackEncoded reports whether the field f of the struct v is encoded.
+func msgpackEncoded(v reflect.Value, f msgpackField) bool {
+	fv := msgpackFieldValue(v, f.index, false)
+	return fv.IsValid() && !(f.omitEmpty && isEmptyValue(fv))
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+
+	return false
+}
+
+func msgpackEncodeValue(buf *bytes.Buffer, v reflect.Value) error {
+	if !v.IsValid() {
+		buf.WriteByte(mpNil)
+		return nil
+	}
+
+	if v.Type().Implements(textMarshalerType) {
+		if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+			buf.WriteByte(mpNil)
+			return nil
+		}
+
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return err
+		}
+		writeMsgpackString(buf, mpStr8, 0xa0, text)
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			buf.WriteByte(mpNil)
+			return nil
+		}
+		return msgpackEncodeValue(buf, v.Elem())
+
+	case reflect.Bool:
+		if v.Bool() {
+			buf.WriteByte(mpTrue)
+		} else {
+			buf.WriteByte(mpFalse)
+		}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		writeMsgpackInt(buf, v.Int())
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		writeMsgpackUint(buf, v.Uint())
+
+	case reflect.Float32:
+		buf.WriteByte(mpFloat32)
+		writeBigEndian(buf, uint64(math.Float32bits(float32(v.Float()))), 4)
+
+	case reflect.Float64:
+		buf.WriteByte(mpFloat64)
+		writeBigEndian(buf, math.Float64bits(v.Float()), 8)
+
+	case reflect.String:
+		writeMsgpackString(buf, mpStr8, 0xa0, []byte(v.String()))
+
+	case reflect.Slice:
+		if v.IsNil() {
+			buf.WriteByte(mpNil)
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			writeMsgpackString(buf, mpBin8, 0, v.Bytes())
+			return nil
+		}
+		return msgpackEncodeArray(buf, v)
+
+	case reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			writeMsgpackString(buf, mpBin8, 0, b)
+			return nil
+		}
+		return msgpackEncodeArray(buf, v)
+
+	case reflect.Map:
+		if v.IsNil() {
+			buf.WriteByte(mpNil)
+			return nil
+		}
+
+		writeMsgpackLength(buf, mpMap16, 0x80, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			if err := msgpackEncodeValue(buf, iter.Key()); err != nil {
+				return err
+			}
+			if err := msgpackEncodeValue(buf, iter.Value()); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Struct:
+		fields := msgpackFields(v.Type())
+
+		n := 0
+		for _, f := range fields {
+			if msgpackEncoded(v, f) {
+				n++
+			}
+		}
+
+		writeMsgpackLength(buf, mpMap16, 0x80, n)
+		for _, f := range fields {
+			if !msgpackEncoded(v, f) {
+				continue
+			}
+			writeMsgpackString(buf, mpStr8, 0xa0, []byte(f.name))
+			if err := msgpackEncodeValue(buf, msgpackFieldValue(v, f.index, false)); err != nil {
+				return err
+			}
+		}
+
+	default:
+		return &MsgpackTypeError{Type: v.Type()}
+	}
+
+	return nil
+}
+
+func msgpackEncodeArray(buf *bytes.Buffer, v reflect.Value) error {
+	writeMsgpackLength(buf, mpArray16, 0x90, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		if err := msgpackEncodeValue(buf, v.Index(i)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeBigEndian(buf *bytes.Buffer, x uint64, n int) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], x)
+	buf.Write(b[8-n:])
+}
+
+func writeMsgpackInt(buf *bytes.Buffer, i int64) {
+	switch {
+	case i >= 0:
+		writeMsgpackUint(buf, uint64(i))
+	case i >= -32:
+		buf.WriteByte(byte(i))
+	case i >= math.MinInt8:
+		buf.WriteByte(mpInt8)
+		buf.WriteByte(byte(i))
+	case i >= math.MinInt16:
+		buf.WriteByte(mpInt16)
+		writeBigEndian(buf, uint64(i), 2)
+	case i >= math.MinInt32:
+		buf.WriteByte(mpInt32)
+		writeBigEndian(buf, uint64(i), 4)
+	default:
+		buf.WriteByte(mpInt64)
+		writeBigEndian(buf, uint64(i), 8)
+	}
+}
+
+func writeMsgpackUint(buf *bytes.Buffer, u uint64) {
+	switch {
+	case u <= 0x7f:
+		buf.WriteByte(byte(u))
+	case u <= math.MaxUint8:
+		buf.WriteByte(mpUint8)
+		buf.WriteByte(byte(u))
+	case u <= math.MaxUint16:
+		buf.WriteByte(mpUint16)
+		writeBigEndian(buf, u, 2)
+	case u <= math.MaxUint32:
+		buf.WriteByte(mpUint32)
+		writeBigEndian(buf, u, 4)
+	default:
+		buf.WriteByte(mpUint64)
+		writeBigEndian(buf, u, 8)
+	}
+}
+
+// writeMsgpackString writes a str or bin: format8 is its 8-bit length
+// format, followed by the 16 and 32-bit ones, and fix the fixstr format,
+// or zero for bin.
+func writeMsgpackString(buf *bytes.Buffer, format8, fix byte, b []byte) {
+	n := len(b)
+	switch {
+	case fix != 0 && n < 32:
+		buf.WriteByte(fix | byte(n))
+	case n <= math.MaxUint8:
+		buf.WriteByte(format8)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(format8 + 1)
+		writeBigEndian(buf, uint64(n), 2)
+	default:
+		buf.WriteByte(format8 + 2)
+		writeBigEndian(buf, uint64(n), 4)
+	}
+
+	buf.Write(b)
+}
+
+// writeMsgpackLength writes the header of an array or map: format16 is its
+// 16-bit length format, followed by the 32-bit one, and fix its fix format.
+func writeMsgpackLength(buf *bytes.Buffer, format16, fix byte, n int) {
+	switch {
+	case n < 16:
+		buf.WriteByte(fix | byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(format16)
+		writeBigEndian(buf, uint64(n), 2)
+	default:
+		buf.WriteByte(format16 + 1)
+		writeBigEndian(buf, uint64(n), 4)
+	}
+}
+
+// A msgpackDecoder decodes a MessagePack value from data.
+type msgpackDecoder struct {
+	data  []byte
+	off   int
+	depth int
+}
+
+// Families of MessagePack formats.
+const (
+	mpKindNil = iota
+	mpKindBool
+	mpKindInt
+	mpKindUint
+	mpKindFloat
+	mpKindStr
+	mpKindBin
+	mpKindArray
+	mpKindMap
+	mpKindExt
+)
+
+var mpKindNames = [...]string{
+	mpKindNil:   "nil",
+	mpKindBool:  "bool",
+	mpKindInt:   "integer",
+	mpKindUint:  "integer",
+	mpKindFloat: "float",
+	mpKindStr:   "str",
+	mpKindBin:   "bin",
+	mpKindArray: "array",
+	mpKindMap:   "map",
+	mpKindExt:   "ext",
+}
+
+// A msgpackHeader is the start of a value: its family, and its value or
+// length, as the family says.
+type msgpackHeader struct {
+	kind int
+	b    bool
+	i    int64
+	u    uint64
+	f    float64
+	n    int
+}
+
+func (d *msgpackDecoder) readN(n int) ([]byte, error) {
+	if n < 0 || n > len(d.data)-d.off {
+		return nil, ErrMsgpackTruncated
+	}
+
+	b := d.data[d.off : d.off+n]
+	d.off += n
+	return b, nil
+}
+
+func (d *msgpackDecoder) readUint(n int) (uint64, error) {
+	b, err := d.readN(n)
+	if err != nil {
+		return 0, err
+	}
+
+	var u uint64
+	for _, c := range b {
+		u = u<<8 | uint64(c)
+	}
+
+	return u, nil
+}
+
+// readHeader reads the start of the next value.
+func (d *msgpackDecoder) readHeader() (h msgpackHeader, err error) {
+	b, err := d.readN(1)
+	if err != nil {
+		return h, err
+	}
+	c := b[0]
+
+	var u uint64
+	switch {
+	case c <= 0x7f:
+		h.kind, h.u = mpKindUint, uint64(c)
+	case c >= 0xe0:
+		h.kind, h.i = mpKindInt, int64(int8(c))
+	case c&0xf0 == 0x80:
+		h.kind, h.n = mpKindMap, int(c&0x0f)
+	case c&0xf0 == 0x90:
+		h.kind, h.n = mpKindArray, int(c&0x0f)
+	case c&0xe0 == 0xa0:
+		h.kind, h.n = mpKindStr, int(c&0x1f)
+
+	case c == mpNil:
+		h.kind = mpKindNil
+	case c == mpFalse, c == mpTrue:
+		h.kind, h.b = mpKindBool, c == mpTrue
+
+	case c >= mpUint8 && c <= mpUint64:
+		h.kind = mpKindUint
+		h.u, err = d.readUint(1 << (c - mpUint8))
+	case c >= mpInt8 && c <= mpInt64:
+		n := 1 << (c - mpInt8)
+		h.kind = mpKindInt
+		u, err = d.readUint(n)
+		h.i = int64(u<<(64-8*n)) >> (64 - 8*n)
+
+	case c == mpFloat32:
+		h.kind = mpKindFloat
+		u, err = d.readUint(4)
+		h.f = float64(math.Float32frombits(uint32(u)))
+	case c == mpFloat64:
+		h.kind = mpKindFloat
+		u, err = d.readUint(8)
+		h.f = math.Float64frombits(u)
+
+	case c >= mpStr8 && c <= mpStr32:
+		h.kind = mpKindStr
+		u, err = d.readUint(1 << (c - mpStr8))
+		h.n = int(u)
+	case c >= mpBin8 && c <= mpBin32:
+		h.kind = mpKindBin
+		u, err = d.readUint(1 << (c - mpBin8))
+		h.n = int(u)
+	case c == mpArray16, c == mpArray32:
+		h.kind = mpKindArray
+		u, err = d.readUint(2 << (c - mpArray16))
+		h.n = int(u)
+	case c == mpMap16, c == mpMap32:
+		h.kind = mpKindMap
+		u, err = d.readUint(2 << (c - mpMap16))
+		h.n = int(u)
+
+	case c >= mpFixExt1 && c <= mpFixExt16:
+		// The type byte, then the data.
+		h.kind, h.n = mpKindExt, 1+1<<(c-mpFixExt1)
+	case c >= mpExt8 && c <= mpExt32:
+		h.kind = mpKindExt
+		u, err = d.readUint(1 << (c - mpExt8))
+		h.n = 1 + int(u)
+
+	default:
+		return h, ErrMsgpackFormat
+	}
+	if err != nil {
+		return h, err
+	}
+
+	// Every element takes a byte at least, so a length past the end of
+	// the data is bad and should not be allocated.
+	if h.n < 0 || h.n > len(d.data)-d.off {
+		return h, ErrMsgpackTruncated
+	}
+
+	return h, nil
+}
+
+// skip skips the rest of a value whose header was read.
+func (d *msgpackDecoder) skip(h msgpackHeader) error {
+	switch h.kind {
+	case mpKindStr, mpKindBin, mpKindExt:
+		_, err := d.readN(h.n)
+		return err
+	case mpKindArray, mpKindMap:
+		n := h.n
+		if h.kind == mpKindMap {
+			n *= 2
+		}
+		for i := 0; i < n; i++ {
+			if err := d.skipValue(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (d *msgpackDecoder) skipValue() error {
+	h, err := d.readHeader()
+	if err != nil {
+		return err
+	}
+
+	return d.skip(h)
+}
+
+func (d *msgpackDecoder) typeError(h msgpackHeader, t reflect.Type) error {
+	return &MsgpackTypeError{Value: mpKindNames[h.kind], Type: t}
+}
+
+// decode decodes the next value into v.
+func (d *msgpackDecoder) decode(v reflect.Value) error {
+	d.depth++
+	defer func() { d.depth-- }()
+	if d.depth > maxMsgpackDepth {
+		return ErrMsgpackTooDeep
+	}
+
+	h, err := d.readHeader()
+	if err != nil {
+		return err
+	}
+
+	return d.decodeHeader(h, v)
+}
+
+func (d *msgpackDecoder) decodeHeader(h msgpackHeader, v reflect.Value) error {
+	if h.kind == mpKindNil {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return d.decodeHeader(h, v.Elem())
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			return d.typeError(h, v.Type())
+		}
+		x, err := d.decodeAny(h)
+		if err != nil {
+			return err
+		}
+		if x != nil {
+			v.Set(reflect.ValueOf(x))
+		}
+		return nil
+	}
+
+	if h.kind == mpKindStr && reflect.PtrTo(v.Type()).Implements(textUnmarshalerType) && v.CanAddr() {
+		text, err := d.readN(h.n)
+		if err != nil {
+			return err
+		}
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText(text)
+	}
+
+	switch h.kind {
+	case mpKindBool:
+		if v.Kind() != reflect.Bool {
+			return d.typeError(h, v.Type())
+		}
+		v.SetBool(h.b)
+
+	case mpKindInt, mpKindUint, mpKindFloat:
+		return d.setNumber(h, v)
+
+	case mpKindStr, mpKindBin:
+		b, err := d.readN(h.n)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case v.Kind() == reflect.String:
+			v.SetString(string(b))
+		case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+			v.SetBytes(append([]byte(nil), b...))
+		case v.Kind() == reflect.Array && v.Type().Elem().Kind() == reflect.Uint8 && len(b) <= v.Len():
+			reflect.Copy(v, reflect.ValueOf(b))
+		default:
+			return d.typeError(h, v.Type())
+		}
+
+	case mpKindArray:
+		switch v.Kind() {
+		case reflect.Slice:
+			v.Set(reflect.MakeSlice(v.Type(), h.n, h.n))
+		case reflect.Array:
+			if h.n > v.Len() {
+				return d.typeError(h, v.Type())
+			}
+			v.Set(reflect.Zero(v.Type()))
+		default:
+			return d.typeError(h, v.Type())
+		}
+
+		for i := 0; i < h.n; i++ {
+			if err := d.decode(v.Index(i)); err != nil {
+				return err
+			}
+		}
+
+	case mpKindMap:
+		switch v.Kind() {
+		case reflect.Map:
+			return d.decodeMap(h, v)
+		case reflect.Struct:
+			return d.decodeStruct(h, v)
+		}
+		return d.typeError(h, v.Type())
+
+	default:
+		return d.typeError(h, v.Type())
+	}
+
+	return nil
+}
+
+// setNumber sets v to the integer or float of h.
+func (d *msgpackDecoder) setNumber(h msgpackHeader, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i := h.i
+		switch {
+		case h.kind == mpKindUint && h.u <= math.MaxInt64:
+			i = int64(h.u)
+		case h.kind != mpKindInt:
+			return d.typeError(h, v.Type())
+		}
+		if v.OverflowInt(i) {
+			return d.typeError(h, v.Type())
+		}
+		v.SetInt(i)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := h.u
+		switch {
+		case h.kind == mpKindInt && h.i >= 0:
+			u = uint64(h.i)
+		case h.kind != mpKindUint:
+			return d.typeError(h, v.Type())
+		}
+		if v.OverflowUint(u) {
+			return d.typeError(h, v.Type())
+		}
+		v.SetUint(u)
+
+	case reflect.Float32, reflect.Float64:
+		switch h.kind {
+		case mpKindInt:
+			v.SetFloat(float64(h.i))
+		case mpKindUint:
+			v.SetFloat(float64(h.u))
+		default:
+			v.SetFloat(h.f)
+		}
+
+	default:
+		return d.typeError(h, v.Type())
+	}
+
+	return nil
+}
+
+func (d *msgpackDecoder) decodeMap(h msgpackHeader, v reflect.Value) error {
+	t := v.Type()
+	if v.IsNil() {
+		v.Set(reflect.MakeMapWithSize(t, h.n))
+	}
+
+	for i := 0; i < h.n; i++ {
+		key := reflect.New(t.Key()).Elem()
+		if err := d.decode(key); err != nil {
+			return err
+		}
+
+		elem := reflect.New(t.Elem()).Elem()
+		if err := d.decode(elem); err != nil {
+			return err
+		}
+
+		v.SetMapIndex(key, elem)
+	}
+
+	return nil
+}
+
+func (d *msgpackDecoder) decodeStruct(h msgpackHeader, v reflect.Value) error {
+	fields := msgpackFields(v.Type())
+
+	for i := 0; i < h.n; i++ {
+		kh, err := d.readHeader()
+		if err != nil {
+			return err
+		}
+		if kh.kind != mpKindStr {
+			if err = d.skip(kh); err != nil {
+				return err
+			}
+			if err = d.skipValue(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		key, err := d.readN(kh.n)
+		if err != nil {
+			return err
+		}
+
+		f := findMsgpackField(fields, key)
+		if f == nil {
+			if err = d.skipValue(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err = d.decode(msgpackFieldValue(v, f.index, true)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// findMsgpackField returns the field named key, preferring an exact match
+// to a case-insensitive one.
+func findMsgpackField(fields []msgpackField, key []byte) *msgpackField {
+	for i := range fields {
+		if fields[i].name == string(key) {
+			return &fields[i]
+		}
+	}
+
+	for i := range fields {
+		if strings.EqualFold(fields[i].name, string(key)) {
+			return &fields[i]
+		}
+	}
+
+	return nil
+}
+
+// decodeAny decodes a value whose header was read into an interface{}: nil,
+// bool, int64 (or uint64 past math.MaxInt64), float64, string, []byte,
+// []interface{}, or map[string]interface{} (or map[interface{}]interface{}
+// if some key is not a string).
+func (d *msgpackDecoder) decodeAny(h msgpackHeader) (interface{}, error) {
+	switch h.kind {
+	case mpKindNil:
+		return nil, nil
+	case mpKindBool:
+		return h.b, nil
+	case mpKindInt:
+		return h.i, nil
+	case mpKindUint:
+		if h.u <= math.MaxInt64 {
+			return int64(h.u), nil
+		}
+		return h.u, nil
+	case mpKindFloat:
+		return h.f, nil
+
+	case mpKindStr, mpKindBin:
+		b, err := d.readN(h.n)
+		if err != nil {
+			return nil, err
+		}
+		if h.kind == mpKindStr {
+			return string(b), nil
+		}
+		return append([]byte(nil), b...), nil
+
+	case mpKindArray:
+		a := make([]interface{}, h.n)
+		for i := range a {
+			if err := d.decode(reflect.ValueOf(&a[i]).Elem()); err != nil {
+				return nil, err
+			}
+		}
+		return a, nil
+
+	case mpKindMap:
+		keys := make([]interface{}, h.n)
+		values := make([]interface{}, h.n)
+		stringKeys := true
+		for i := 0; i < h.n; i++ {
+			if err := d.decode(reflect.ValueOf(&keys[i]).Elem()); err != nil {
+				return nil, err
+			}
+			if err := d.decode(reflect.ValueOf(&values[i]).Elem()); err != nil {
+				return nil, err
+			}
+
+			switch keys[i].(type) {
+			case string:
+			case []byte, []interface{}, map[string]interface{}, map[interface{}]interface{}:
+				return nil, fmt.Errorf("msgpack: unhashable map key of type %T", keys[i])
+			default:
+				stringKeys = false
+			}
+		}
+
+		if stringKeys {
+			m := make(map[string]interface{}, h.n)
+			for i, k := range keys {
+				m[k.(string)] = values[i]
+			}
+			return m, nil
+		}
+
+		m := make(map[interface{}]interface{}, h.n)
+		for i, k := range keys {
+			m[k] = values[i]
+		}
+		return m, nil
+	}
+
+	return nil, &MsgpackTypeError{Value: mpKindNames[h.kind], Type: reflect.TypeOf((*interface{})(nil)).Elem()}
+}
@@ -0,0 +1,65 @@
+// WebSocket implementation for the Hrngh bot.
+// Available at https://github.com/abeiron/hrngh
+
+// Copyright 2020-2021, Undying Memory <abeiron@outlook.com>.  All rights reserved.
+// Use of this source code is governed by the Microsoft Public License
+// that can be found in the LICENSE file.
+
+// This file contains code related to observing connections.
+
+package ws
+
+import (
+	"time"
+
+	"github.com/abeiron/hrngh/internal/config"
+)
+
+// Observer is told of the handshakes, frames, pings and closes of
+// connections; see config.WsObserver.  Metrics is an Observer exporting
+// them to Prometheus.
+type Observer = config.WsObserver
+
+// SetObserver sets the observer of the connection, which defaults to the
+// Observer of its configuration.  It must be called before the connection
+// is used.
+func (ws *Conn) SetObserver(o Observer) { ws.observer = o }
+
+// Observers tells each of its observers of every event.
+type Observers []Observer
+
+func (os Observers) HandshakeStart(client bool) {
+	for _, o := range os {
+		o.HandshakeStart(client)
+	}
+}
+
+func (os Observers) HandshakeFinish(client bool, elapsed time.Duration, err error) {
+	for _, o := range os {
+		o.HandshakeFinish(client, elapsed, err)
+	}
+}
+
+func (os Observers) FrameRead(opcode byte, length int64, compressed bool) {
+	for _, o := range os {
+		o.FrameRead(opcode, length, compressed)
+	}
+}
+
+func (os Observers) FrameWritten(opcode byte, length int64, compressed bool) {
+	for _, o := range os {
+		o.FrameWritten(opcode, length, compressed)
+	}
+}
+
+func (os Observers) PingRTT(rtt time.Duration) {
+	for _, o := range os {
+		o.PingRTT(rtt)
+	}
+}
+
+func (os Observers) Close(code int, sent bool) {
+	for _, o := range os {
+		o.Close(code, sent)
+	}
+}
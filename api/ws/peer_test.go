@@ -0,0 +1,395 @@
+// WebSocket implementation for the Hrngh bot.
+// Available at https://github.com/abeiron/hrngh
+
+// Copyright 2020-2021, Undying Memory <abeiron@outlook.com>.  All rights reserved.
+// Use of this source code is governed by the Microsoft Public License
+// that can be found in the LICENSE file.
+
+// This file contains the raw WebSocket peers of the conformance tests, which
+// write frames by hand so that they may break the protocol.
+
+package ws_test
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Opcodes, as sent on the wire.
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+// RSV bits, as they are given to frames.
+const (
+	rsv1 = 4
+	rsv2 = 2
+	rsv3 = 1
+)
+
+// noStatus stands for a close frame without a code.
+const noStatus = 1005
+
+const (
+	handshakeKey    = "dGhlIHNhbXBsZSBub25jZQ=="
+	handshakeAccept = "s3pPLMBiTxaQ9kYGzzhZRbK+xOo="
+	websocketGUID   = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+)
+
+// timeout bounds every read of a peer, so that a missing answer fails the
+// case rather than hanging the suite.
+const timeout = 2 * time.Second
+
+// A frame is a WebSocket frame, built by hand so that it may break the
+// protocol.
+type frame struct {
+	fin     bool
+	rsv     byte
+	opcode  byte
+	payload []byte
+
+	// masked is set on frames read which were masked; badMask on frames
+	// to write masked the wrong way for their sender.
+	masked  bool
+	badMask bool
+}
+
+// A peer is the raw end of a connection under test, which writes frames as
+// they are given and reads them as they come.
+type peer struct {
+	conn net.Conn
+	br   *bufio.Reader
+
+	// client is set if the peer is the client, which masks its frames and
+	// expects unmasked ones.
+	client bool
+
+	// window holds the end of the messages decompressed so far, which
+	// the next compressed message may refer to.
+	window []byte
+}
+
+// dialPeer connects to a server as a raw client, offering extensions if not
+// empty.
+func dialPeer(addr, path, extensions string) (*peer, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	req := "GET " + path + " HTTP/1.1\r\n" +
+		"Host: " + addr + "\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: " + handshakeKey + "\r\n" +
+		"Sec-WebSocket-Version: 13\r\n"
+	if extensions != "" {
+		req += "Sec-WebSocket-Extensions: " + extensions + "\r\n"
+	}
+	req += "\r\n"
+
+	conn.SetDeadline(time.Now().Add(timeout))
+	if _, err = io.WriteString(conn, req); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		conn.Close()
+		return nil, fmt.Errorf("handshake: status %s", resp.Status)
+	}
+	if accept := resp.Header.Get("Sec-WebSocket-Accept"); accept != handshakeAccept {
+		conn.Close()
+		return nil, fmt.Errorf("handshake: bad accept key %q", accept)
+	}
+	conn.SetDeadline(time.Time{})
+
+	return &peer{conn: conn, br: br, client: true}, nil
+}
+
+// acceptPeer accepts a connection from a client as a raw server.
+func acceptPeer(ln net.Listener) (*peer, error) {
+	conn, err := ln.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	return serverPeer(conn, bufio.NewReader(conn))
+}
+
+// serverPeer answers the handshake of a client on conn, read through br, as
+// a raw server.
+func serverPeer(conn net.Conn, br *bufio.Reader) (*peer, error) {
+	conn.SetDeadline(time.Now().Add(timeout))
+	req, err := http.ReadRequest(br)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	h := sha1.New()
+	io.WriteString(h, req.Header.Get("Sec-WebSocket-Key")+websocketGUID)
+	accept := base64.StdEncoding.EncodeToString(h.Sum(nil))
+
+	resp := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + accept + "\r\n\r\n"
+	if _, err = io.WriteString(conn, resp); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	return &peer{conn: conn, br: br}, nil
+}
+
+func (p *peer) Close() error { return p.conn.Close() }
+
+// write sends frames, masked if the peer is the client unless they say
+// otherwise.
+func (p *peer) write(frames ...frame) error {
+	for _, f := range frames {
+		if _, err := p.conn.Write(f.encode(p.client != f.badMask)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// encode formats a frame, with a random masking key if mask is set.
+func (f frame) encode(mask bool) []byte {
+	b0 := f.rsv<<4 | f.opcode
+	if f.fin {
+		b0 |= 0x80
+	}
+	buf := []byte{b0, 0}
+
+	n := len(f.payload)
+	switch {
+	case n <= 125:
+		buf[1] = byte(n)
+	case n <= 0xffff:
+		buf[1] = 126
+		buf = append(buf, 0, 0)
+		binary.BigEndian.PutUint16(buf[2:], uint16(n))
+	default:
+		buf[1] = 127
+		buf = append(buf, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(buf[2:], uint64(n))
+	}
+
+	payload := f.payload
+	if mask {
+		buf[1] |= 0x80
+		key := make([]byte, 4)
+		rand.Read(key)
+		buf = append(buf, key...)
+
+		payload = make([]byte, n)
+		for i := range payload {
+			payload[i] = f.payload[i] ^ key[i%4]
+		}
+	}
+
+	return append(buf, payload...)
+}
+
+// read reads the next frame.  Frames masked the wrong way are an error.
+func (p *peer) read() (f frame, err error) {
+	p.conn.SetReadDeadline(time.Now().Add(timeout))
+
+	var head [2]byte
+	if _, err = io.ReadFull(p.br, head[:]); err != nil {
+		return f, err
+	}
+
+	f.fin = head[0]&0x80 != 0
+	f.rsv = head[0] >> 4 & 7
+	f.opcode = head[0] & 0xf
+	f.masked = head[1]&0x80 != 0
+
+	n := uint64(head[1] & 0x7f)
+	switch n {
+	case 126:
+		var b [2]byte
+		if _, err = io.ReadFull(p.br, b[:]); err != nil {
+			return f, err
+		}
+		n = uint64(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		if _, err = io.ReadFull(p.br, b[:]); err != nil {
+			return f, err
+		}
+		n = binary.BigEndian.Uint64(b[:])
+	}
+
+	var key [4]byte
+	if f.masked {
+		if _, err = io.ReadFull(p.br, key[:]); err != nil {
+			return f, err
+		}
+	}
+
+	f.payload = make([]byte, n)
+	if _, err = io.ReadFull(p.br, f.payload); err != nil {
+		return f, err
+	}
+	if f.masked {
+		for i := range f.payload {
+			f.payload[i] ^= key[i%4]
+		}
+	}
+
+	switch {
+	case p.client && f.masked:
+		return f, errors.New("server sent a masked frame")
+	case !p.client && !f.masked:
+		return f, errors.New("client sent an unmasked frame")
+	}
+
+	return f, nil
+}
+
+// readMessage reads a whole data message, decompressing it if needed.
+func (p *peer) readMessage() (opcode byte, payload []byte, err error) {
+	f, err := p.read()
+	if err != nil {
+		return 0, nil, err
+	}
+	if f.opcode != opText && f.opcode != opBinary {
+		return 0, nil, fmt.Errorf("got %s, want a data frame", f)
+	}
+
+	opcode = f.opcode
+	compressed := f.rsv&rsv1 != 0
+	payload = f.payload
+
+	for !f.fin {
+		if f, err = p.read(); err != nil {
+			return 0, nil, err
+		}
+		if f.opcode != opContinuation {
+			return 0, nil, fmt.Errorf("got %s, want a continuation frame", f)
+		}
+		if f.rsv != 0 {
+			return 0, nil, fmt.Errorf("got %s with RSV bits", f)
+		}
+		payload = append(payload, f.payload...)
+	}
+
+	if compressed {
+		if payload, err = p.inflate(payload); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	return opcode, payload, nil
+}
+
+// inflate decompresses a message, with the context of the previous ones.
+func (p *peer) inflate(payload []byte) ([]byte, error) {
+	payload = append(payload, 0x00, 0x00, 0xff, 0xff, 0x01, 0x00, 0x00, 0xff, 0xff)
+
+	msg, err := ioutil.ReadAll(flate.NewReaderDict(bytes.NewReader(payload), p.window))
+	if err != nil {
+		return nil, err
+	}
+
+	p.window = append(p.window, msg...)
+	if len(p.window) > 1<<15 {
+		p.window = p.window[len(p.window)-1<<15:]
+	}
+
+	return msg, nil
+}
+
+// readClose reads frames up to a close frame, and returns its code.
+func (p *peer) readClose() (code int, err error) {
+	f, err := p.read()
+	if err != nil {
+		return 0, err
+	}
+	if f.opcode != opClose {
+		return 0, fmt.Errorf("got %s, want a close frame", f)
+	}
+	if len(f.payload) < 2 {
+		return noStatus, nil
+	}
+
+	return int(binary.BigEndian.Uint16(f.payload)), nil
+}
+
+// expectEOF checks that the other end closes the connection.
+func (p *peer) expectEOF() error {
+	f, err := p.read()
+	if err == nil {
+		return fmt.Errorf("got %s, want the connection closed", f)
+	}
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return errors.New("connection left open")
+	}
+
+	return nil
+}
+
+func (f frame) String() string {
+	names := map[byte]string{
+		opContinuation: "continuation",
+		opText:         "text",
+		opBinary:       "binary",
+		opClose:        "close",
+		opPing:         "ping",
+		opPong:         "pong",
+	}
+
+	name, ok := names[f.opcode]
+	if !ok {
+		name = fmt.Sprintf("opcode %d", f.opcode)
+	}
+
+	return fmt.Sprintf("%s frame (%d bytes, fin=%v)", name, len(f.payload), f.fin)
+}
+
+// compress compresses a message as permessage-deflate does, without
+// context takeover.
+func compress(msg []byte) []byte {
+	var buf bytes.Buffer
+	fw, _ := flate.NewWriter(&buf, flate.BestSpeed)
+	fw.Write(msg)
+	fw.Flush()
+
+	return bytes.TrimSuffix(buf.Bytes(), []byte{0x00, 0x00, 0xff, 0xff})
+}
+
+// closePayload formats the payload of a close frame.
+func closePayload(code int, reason string) []byte {
+	b := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(b, uint16(code))
+	return append(b, reason...)
+}
@@ -0,0 +1,191 @@
+// WebSocket implementation for the Hrngh bot.
+// Available at https://github.com/abeiron/hrngh
+
+// Copyright 2020-2021, Undying Memory <abeiron@outlook.com>.  All rights reserved.
+// Use of this source code is governed by the Microsoft Public License
+// that can be found in the LICENSE file.
+
+// This file contains code related to pings, pongs and keepalive.
+
+package ws
+
+import (
+	"strconv"
+	"time"
+)
+
+// ErrBadControlPayload is returned when sending a control frame with a
+// payload longer than 125 bytes.
+var ErrBadControlPayload = &ProtocolError{"control frame payload too long"}
+
+// Ping sends a ping frame with payload, of at most 125 bytes.  The time
+// until the matching pong is received is reported by RTT.
+func (ws *Conn) Ping(payload []byte) error {
+	return ws.ping(payload, false)
+}
+
+// ping sends a ping frame, which the keepalive then waits for the pong of.
+func (ws *Conn) ping(payload []byte, keepAlive bool) error {
+	if len(payload) > maxControlFramePayloadLength {
+		return ErrBadControlPayload
+	}
+
+	ws.pingMu.Lock()
+	ws.pingData = string(payload)
+	ws.pingSent = time.Now()
+	if keepAlive {
+		ws.pongWait = true
+	}
+	ws.pingMu.Unlock()
+
+	return ws.writeControl(PingFrame, payload)
+}
+
+// RTT returns the round-trip time measured by the last ping which was
+// answered, or zero if none was.
+func (ws *Conn) RTT() time.Duration {
+	ws.pingMu.Lock()
+	defer ws.pingMu.Unlock()
+
+	return ws.rtt
+}
+
+// SetPingHandler sets the handler called with the payload of the pings
+// received.  The default handler, which h == nil restores, answers them
+// with a pong.
+//
+// The handler is called by the goroutine reading from the connection, and
+// an error it returns is returned by the read.
+func (ws *Conn) SetPingHandler(h func(payload string) error) {
+	ws.pingMu.Lock()
+	defer ws.pingMu.Unlock()
+
+	ws.pingHandler = h
+}
+
+// SetPongHandler sets the handler called with the payload of the pongs
+// received, like SetPingHandler.  By default, pongs are only used to
+// measure the round-trip time.
+func (ws *Conn) SetPongHandler(h func(payload string) error) {
+	ws.pingMu.Lock()
+	defer ws.pingMu.Unlock()
+
+	ws.pongHandler = h
+}
+
+// handlePing handles a ping received.  ws.rio must be held.
+func (ws *Conn) handlePing(payload string) error {
+	ws.pingMu.Lock()
+	h := ws.pingHandler
+	ws.pingMu.Unlock()
+
+	if h != nil {
+		return h(payload)
+	}
+
+	err := ws.writeControl(PongFrame, []byte(payload))
+	if err == ErrCloseSent {
+		// The peer stops expecting pongs once it knows of the close.
+		return nil
+	}
+	return err
+}
+
+// handlePong handles a pong received.  ws.rio must be held.
+func (ws *Conn) handlePong(payload string) error {
+	ws.pingMu.Lock()
+	var rtt time.Duration
+	if !ws.pingSent.IsZero() && payload == ws.pingData {
+		rtt = time.Since(ws.pingSent)
+		ws.rtt = rtt
+		ws.pingSent = time.Time{}
+	}
+	ws.pongWait = false
+	h := ws.pongHandler
+	ws.pingMu.Unlock()
+
+	if rtt > 0 && ws.observer != nil {
+		ws.observer.PingRTT(rtt)
+	}
+
+	if h != nil {
+		return h(payload)
+	}
+	return nil
+}
+
+// writeControl sends a ping or pong frame.
+func (ws *Conn) writeControl(payloadType byte, payload []byte) error {
+	ws.wio.Lock()
+	defer ws.wio.Unlock()
+
+	if ws.closeSent {
+		return ErrCloseSent
+	}
+
+	w, err := ws.frameWriterFactory.NewFrameWriter(payloadType)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(payload)
+	w.Close()
+	return err
+}
+
+// keepAlive pings the peer at every interval, until the connection is
+// closed or the peer misses a pong.
+func (ws *Conn) keepAlive(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ws.closeReceived:
+			return
+		case <-t.C:
+		}
+
+		ws.pingMu.Lock()
+		dead := ws.pongWait
+		ws.pingMu.Unlock()
+
+		if dead {
+			ws.abort()
+			return
+		}
+
+		payload := strconv.FormatInt(time.Now().UnixNano(), 36)
+		if err := ws.ping([]byte(payload), true); err != nil {
+			return
+		}
+	}
+}
+
+// abort closes the connection of a peer which missed a pong.  The reads
+// fail from then on with a close error of code CloseAbnormalClosure.
+func (ws *Conn) abort() {
+	ws.pingMu.Lock()
+	ws.timedOut = true
+	ws.pingMu.Unlock()
+
+	if ws.observer != nil {
+		ws.observer.Close(CloseAbnormalClosure, false)
+	}
+	ws.rwc.Close()
+}
+
+// readError returns the error reads return for an error reading from the
+// connection.  ws.rio must be held.
+func (ws *Conn) readError(err error) error {
+	ws.pingMu.Lock()
+	timedOut := ws.timedOut
+	ws.pingMu.Unlock()
+
+	if timedOut {
+		ws.closeErr = &CloseError{Code: CloseAbnormalClosure, Text: "keepalive timed out"}
+		return ws.closeErr
+	}
+
+	return err
+}
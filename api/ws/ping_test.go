@@ -0,0 +1,113 @@
+// WebSocket implementation for the Hrngh bot.
+// Available at https://github.com/abeiron/hrngh
+
+// Copyright 2020-2021, Undying Memory <abeiron@outlook.com>.  All rights reserved.
+// Use of this source code is governed by the Microsoft Public License
+// that can be found in the LICENSE file.
+
+// This file contains tests of the keepalive, which run clients against raw
+// servers on the loopback interface.
+
+package ws_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/abeiron/hrngh/api/ws"
+	"github.com/abeiron/hrngh/internal/config"
+)
+
+const keepAlive = 100 * time.Millisecond
+
+func withKeepAlive(cfg *config.Ws) { cfg.KeepAlive = keepAlive }
+
+// TestKeepAliveAbort checks that a client aborts the connection of a server
+// which does not answer its pings, once it misses the pong of the first.
+func TestKeepAliveAbort(t *testing.T) {
+	run := clientCase(withKeepAlive, func(p *peer) error {
+		// Stay silent until the client gives up.
+		for {
+			if _, err := p.read(); err != nil {
+				return nil
+			}
+		}
+	}, func(c *ws.Conn) error {
+		start := time.Now()
+
+		_, _, err := c.NextReader()
+		if !ws.IsCloseError(err, ws.CloseAbnormalClosure) {
+			return fmt.Errorf("got %v, want close error %d", err, ws.CloseAbnormalClosure)
+		}
+
+		// The first ping goes out after an interval, and the connection is
+		// aborted at the next one.
+		if elapsed := time.Since(start); elapsed < 2*keepAlive || elapsed > 3*keepAlive {
+			return fmt.Errorf("aborted after %v, want about %v", elapsed, 2*keepAlive)
+		}
+
+		if _, err = c.Read(make([]byte, 1)); !ws.IsCloseError(err, ws.CloseAbnormalClosure) {
+			return fmt.Errorf("next Read: got %v, want close error %d", err, ws.CloseAbnormalClosure)
+		}
+
+		return nil
+	})
+
+	if err := run(nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestKeepAliveRTT checks that the pongs of a server answering the pings
+// give the round-trip time.
+func TestKeepAliveRTT(t *testing.T) {
+	run := clientCase(withKeepAlive, func(p *peer) error {
+		for {
+			f, err := p.read()
+			if err != nil {
+				return err
+			}
+
+			switch f.opcode {
+			case opPing:
+				if err = p.write(frame{fin: true, opcode: opPong, payload: f.payload}); err != nil {
+					return err
+				}
+			case opClose:
+				return nil
+			default:
+				return fmt.Errorf("got %s, want a ping frame", f)
+			}
+		}
+	}, func(c *ws.Conn) error {
+		// The pongs are handled by the reads.
+		readErr := make(chan error, 1)
+		go func() {
+			_, _, err := c.NextReader()
+			readErr <- err
+		}()
+
+		for end := time.Now().Add(timeout); c.RTT() <= 0; {
+			if time.Now().After(end) {
+				return fmt.Errorf("got RTT %v after %v", c.RTT(), timeout)
+			}
+			time.Sleep(time.Millisecond)
+		}
+
+		// The connection stays open past the interval at which a missed
+		// pong aborts it.
+		select {
+		case err := <-readErr:
+			return fmt.Errorf("connection closed: %v", err)
+		case <-time.After(3 * keepAlive):
+		}
+
+		// The server answers pings until the close frame.
+		return c.Close()
+	})
+
+	if err := run(nil); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,409 @@
+// WebSocket implementation for the Hrngh bot.
+// Available at https://github.com/abeiron/hrngh
+
+// Copyright 2020-2021, Undying Memory <abeiron@outlook.com>.  All rights reserved.
+// Use of this source code is governed by the Microsoft Public License
+// that can be found in the LICENSE file.
+
+// This file contains code related to the outbound write queue.
+
+package ws
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+// DefaultWriteQueueSize is the size of a write queue if none is given.
+const DefaultWriteQueueSize = 64
+
+var (
+	ErrQueueFull    = &ProtocolError{"write queue full"}
+	ErrQueueClosed  = &ProtocolError{"write queue closed"}
+	ErrMessageDrop  = &ProtocolError{"message dropped from full write queue"}
+	ErrWriteExpired = &ProtocolError{"message deadline passed before it was written"}
+)
+
+// A QueuePolicy says what happens to a message written to a full queue.
+type QueuePolicy int
+
+const (
+	// QueueBlock makes the write wait for room, until the message's
+	// deadline if it has one.
+	QueueBlock QueuePolicy = iota
+
+	// QueueReject makes the write fail with ErrQueueFull.
+	QueueReject
+
+	// QueueDropOldest makes room by dropping the oldest message queued,
+	// which fails with ErrMessageDrop.
+	QueueDropOldest
+)
+
+// WriteQueueConfig configures a write queue.
+type WriteQueueConfig struct {
+	// Size is the number of messages the queue holds besides those of the
+	// priority lane, which is not bounded.  If zero, DefaultWriteQueueSize
+	// is used.
+	Size int
+
+	// Policy applies when the queue is full.
+	Policy QueuePolicy
+
+	// Timeout is the deadline of messages queued without one, from the
+	// time they are queued.  If zero, they have none.
+	Timeout time.Duration
+}
+
+// A QueuedMessage is a message sent through a write queue.
+type QueuedMessage struct {
+	// Type is TextFrame or BinaryFrame, or a control frame: PingFrame,
+	// PongFrame or CloseFrame, whose Data is then the payload.
+	Type byte
+	Data []byte
+
+	// Priority puts the message in the priority lane, which is written
+	// ahead of the other messages and is never full.  Control frames
+	// always are.
+	Priority bool
+
+	// Deadline is the time by which the message must be written; it is
+	// dropped with ErrWriteExpired if it is not written by then, and also
+	// bounds the write itself.
+	Deadline time.Time
+
+	// Done, if not nil, receives the result of the write.  It should be
+	// buffered, or it blocks the queue.
+	Done chan<- error
+
+	queued time.Time
+}
+
+// WriteQueueStats are the metrics of a write queue.
+type WriteQueueStats struct {
+	// Depth is the number of messages queued, and PriorityDepth the
+	// number of them in the priority lane.
+	Depth         int
+	PriorityDepth int
+
+	// Written counts the messages written, Rejected those refused by a
+	// full queue, Dropped those dropped from it, and Expired those whose
+	// deadline passed.
+	Written  uint64
+	Rejected uint64
+	Dropped  uint64
+	Expired  uint64
+
+	// The latency of a message is the time from it being queued to it
+	// being written.  TotalLatency sums those of all the messages written.
+	LastLatency  time.Duration
+	MaxLatency   time.Duration
+	TotalLatency time.Duration
+}
+
+// A writeQueue writes the messages queued on a connection from a goroutine
+// of its own.
+type writeQueue struct {
+	ws  *Conn
+	cfg WriteQueueConfig
+
+	mu       sync.Mutex
+	priority []*QueuedMessage
+	normal   []*QueuedMessage
+	err      error
+	stats    WriteQueueStats
+
+	// wake wakes the writer when a message is queued, and room is closed
+	// when a message leaves the queue.
+	wake chan struct{}
+	room chan struct{}
+	done chan struct{}
+}
+
+// StartWriteQueue makes the messages written by Write and Codec's Send go
+// through a queue, written to the connection by a goroutine of its own, so
+// that writers do not wait for a slow peer.  Errors writing a message are
+// returned by the writes after it.  Messages written by NextWriter, and
+// the control frames which Ping, Close and the answers to the peer's pings
+// send, bypass the queue.
+//
+// It must be called before the connection is written to, and only once.
+// Closing the connection stops the queue, failing the messages left with
+// ErrQueueClosed.
+func (ws *Conn) StartWriteQueue(cfg WriteQueueConfig) {
+	if cfg.Size <= 0 {
+		cfg.Size = DefaultWriteQueueSize
+	}
+
+	q := &writeQueue{
+		ws:   ws,
+		cfg:  cfg,
+		wake: make(chan struct{}, 1),
+		room: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	ws.queue = q
+
+	go q.run()
+}
+
+// Enqueue queues a message.  It returns once the message is queued, or
+// fails according to the queue's policy; the result of the write itself is
+// sent to m.Done.  m.Data must not be modified until then.
+func (ws *Conn) Enqueue(m *QueuedMessage) error {
+	if ws.queue == nil {
+		return ErrQueueClosed
+	}
+
+	return ws.queue.push(m)
+}
+
+// WriteQueueStats returns the metrics of the write queue, if one was
+// started.
+func (ws *Conn) WriteQueueStats() WriteQueueStats {
+	if ws.queue == nil {
+		return WriteQueueStats{}
+	}
+
+	q := ws.queue
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	stats := q.stats
+	stats.PriorityDepth = len(q.priority)
+	stats.Depth = len(q.priority) + len(q.normal)
+	return stats
+}
+
+// enqueueData queues a data message with the default deadline, and waits
+// for room as the policy says.  data must be owned by the queue.
+func (ws *Conn) enqueueData(payloadType byte, data []byte) error {
+	return ws.queue.push(&QueuedMessage{Type: payloadType, Data: data})
+}
+
+// stopQueue stops the write queue, if one was started.
+func (ws *Conn) stopQueue() {
+	if ws.queue != nil {
+		ws.queue.stop(ErrQueueClosed)
+	}
+}
+
+func (q *writeQueue) push(m *QueuedMessage) error {
+	m.queued = time.Now()
+	if m.Deadline.IsZero() && q.cfg.Timeout > 0 {
+		m.Deadline = m.queued.Add(q.cfg.Timeout)
+	}
+	if m.Type != TextFrame && m.Type != BinaryFrame {
+		m.Priority = true
+	}
+
+	q.mu.Lock()
+	for {
+		if q.err != nil {
+			err := q.err
+			q.mu.Unlock()
+			return err
+		}
+
+		if m.Priority || len(q.normal) < q.cfg.Size {
+			break
+		}
+
+		switch q.cfg.Policy {
+		case QueueReject:
+			q.stats.Rejected++
+			q.mu.Unlock()
+			return ErrQueueFull
+		case QueueDropOldest:
+			old := q.normal[0]
+			q.normal = q.normal[1:]
+			q.stats.Dropped++
+			old.finish(ErrMessageDrop)
+			continue
+		}
+
+		// Wait for room.
+		room := q.room
+		q.mu.Unlock()
+
+		if !q.wait(room, m.Deadline) {
+			q.mu.Lock()
+			q.stats.Expired++
+			q.mu.Unlock()
+			return ErrWriteExpired
+		}
+
+		q.mu.Lock()
+	}
+
+	if m.Priority {
+		q.priority = append(q.priority, m)
+	} else {
+		q.normal = append(q.normal, m)
+	}
+	q.mu.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// wait waits for room to be closed or the queue to stop, and reports
+// whether either happened before deadline.
+func (q *writeQueue) wait(room chan struct{}, deadline time.Time) bool {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		t := time.NewTimer(time.Until(deadline))
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	select {
+	case <-room:
+	case <-q.done:
+	case <-timeout:
+		return false
+	}
+
+	return true
+}
+
+// pop takes the next message to write, waiting for one.  It returns nil
+// once the queue is stopped.
+func (q *writeQueue) pop() *QueuedMessage {
+	for {
+		q.mu.Lock()
+		if q.err != nil {
+			q.mu.Unlock()
+			return nil
+		}
+
+		var m *QueuedMessage
+		switch {
+		case len(q.priority) > 0:
+			m, q.priority = q.priority[0], q.priority[1:]
+		case len(q.normal) > 0:
+			m, q.normal = q.normal[0], q.normal[1:]
+			close(q.room)
+			q.room = make(chan struct{})
+		}
+		q.mu.Unlock()
+
+		if m != nil {
+			return m
+		}
+
+		select {
+		case <-q.wake:
+		case <-q.done:
+		}
+	}
+}
+
+// run writes the messages queued until the queue is stopped or a write
+// fails.
+func (q *writeQueue) run() {
+	for {
+		m := q.pop()
+		if m == nil {
+			return
+		}
+
+		if !m.Deadline.IsZero() && time.Now().After(m.Deadline) {
+			q.mu.Lock()
+			q.stats.Expired++
+			q.mu.Unlock()
+			m.finish(ErrWriteExpired)
+			continue
+		}
+
+		err := q.write(m)
+		m.finish(err)
+		if err != nil {
+			q.stop(err)
+			return
+		}
+
+		latency := time.Since(m.queued)
+
+		q.mu.Lock()
+		q.stats.Written++
+		q.stats.LastLatency = latency
+		q.stats.TotalLatency += latency
+		if latency > q.stats.MaxLatency {
+			q.stats.MaxLatency = latency
+		}
+		q.mu.Unlock()
+	}
+}
+
+// write writes a message to the connection.
+func (q *writeQueue) write(m *QueuedMessage) error {
+	ws := q.ws
+
+	if !m.Deadline.IsZero() {
+		ws.setWriteDeadlineFor(m.Deadline)
+		defer ws.restoreWriteDeadline()
+	}
+
+	switch m.Type {
+	case PingFrame, PongFrame:
+		if len(m.Data) > maxControlFramePayloadLength {
+			return ErrBadControlPayload
+		}
+		return ws.writeControl(m.Type, m.Data)
+	case CloseFrame:
+		if len(m.Data) < 2 {
+			return ws.writeClose(CloseNoStatusReceived, "")
+		}
+		return ws.writeClose(int(binary.BigEndian.Uint16(m.Data)), string(m.Data[2:]))
+	case TextFrame, BinaryFrame:
+	default:
+		return ErrBadMessageType
+	}
+
+	ws.mio.Lock()
+	defer ws.mio.Unlock()
+	ws.wio.Lock()
+	defer ws.wio.Unlock()
+
+	w, err := ws.newDataFrameWriter(m.Type)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(m.Data)
+	w.Close()
+	return err
+}
+
+// stop stops the queue, failing the messages left with err, which the
+// writes after return too.
+func (q *writeQueue) stop(err error) {
+	q.mu.Lock()
+	if q.err != nil {
+		q.mu.Unlock()
+		return
+	}
+
+	q.err = err
+	left := append(q.priority, q.normal...)
+	q.priority, q.normal = nil, nil
+	close(q.done)
+	q.mu.Unlock()
+
+	for _, m := range left {
+		m.finish(err)
+	}
+}
+
+// finish reports the result of writing a message.
+func (m *QueuedMessage) finish(err error) {
+	if m.Done != nil {
+		m.Done <- err
+	}
+}
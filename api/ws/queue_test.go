@@ -0,0 +1,267 @@
+// WebSocket implementation for the Hrngh bot.
+// Available at https://github.com/abeiron/hrngh
+
+// Copyright 2020-2021, Undying Memory <abeiron@outlook.com>.  All rights reserved.
+// Use of this source code is governed by the Microsoft Public License
+// that can be found in the LICENSE file.
+
+// This file contains tests of the write queue.  The client writes to a raw
+// peer over an in-memory pipe, whose writes wait for the peer to read them,
+// so that the peer holds the queue's writer on a message for as long as it
+// does not read.
+
+package ws_test
+
+import (
+	"bufio"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/abeiron/hrngh/api/ws"
+)
+
+// pipePeer returns a client connection and the raw server peer at the other
+// end of an in-memory pipe.
+func pipePeer() (*ws.Conn, *peer, error) {
+	c, server, err := pipe()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return c, &peer{conn: server, br: bufio.NewReader(server)}, nil
+}
+
+// startQueue starts a write queue on a pipe, and holds its writer on a
+// first message, which the peer must read to let the writer go on.
+func startQueue(t *testing.T, cfg ws.WriteQueueConfig) (*ws.Conn, *peer) {
+	c, p, err := pipePeer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Nothing reads the close frame, so close the peer first.
+	t.Cleanup(func() { c.Close() })
+	t.Cleanup(func() { p.Close() })
+
+	c.StartWriteQueue(cfg)
+	if err = c.Enqueue(&ws.QueuedMessage{Type: ws.TextFrame, Data: []byte("first")}); err != nil {
+		t.Fatal(err)
+	}
+	waitDepth(t, c, 0)
+
+	return c, p
+}
+
+// waitDepth waits for the queue to hold depth messages.
+func waitDepth(t *testing.T, c *ws.Conn, depth int) {
+	for end := time.Now().Add(timeout); c.WriteQueueStats().Depth != depth; {
+		if time.Now().After(end) {
+			t.Fatalf("queue depth is %d, want %d", c.WriteQueueStats().Depth, depth)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// expectMessages reads the text messages of payloads.
+func expectMessages(p *peer, payloads ...string) error {
+	for _, want := range payloads {
+		opcode, msg, err := p.readMessage()
+		if err != nil {
+			return err
+		}
+		if opcode != opText || string(msg) != want {
+			return fmt.Errorf("got message %q of opcode %d, want text %q", msg, opcode, want)
+		}
+	}
+
+	return nil
+}
+
+// result waits for the result of a message.
+func result(t *testing.T, done <-chan error) error {
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(timeout):
+		t.Fatal("no result for the message")
+		return nil
+	}
+}
+
+func TestQueueReject(t *testing.T) {
+	c, p := startQueue(t, ws.WriteQueueConfig{Size: 1, Policy: ws.QueueReject})
+
+	if err := c.Enqueue(&ws.QueuedMessage{Type: ws.TextFrame, Data: []byte("second")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Enqueue(&ws.QueuedMessage{Type: ws.TextFrame, Data: []byte("third")}); err != ws.ErrQueueFull {
+		t.Errorf("full queue: got %v, want %v", err, ws.ErrQueueFull)
+	}
+	if _, err := c.Write([]byte("fourth")); err != ws.ErrQueueFull {
+		t.Errorf("Write to a full queue: got %v, want %v", err, ws.ErrQueueFull)
+	}
+
+	if err := expectMessages(p, "first", "second"); err != nil {
+		t.Fatal(err)
+	}
+	if stats := c.WriteQueueStats(); stats.Rejected != 2 || stats.Dropped != 0 {
+		t.Errorf("got %d rejected and %d dropped, want 2 and 0", stats.Rejected, stats.Dropped)
+	}
+}
+
+func TestQueueDropOldest(t *testing.T) {
+	c, p := startQueue(t, ws.WriteQueueConfig{Size: 1, Policy: ws.QueueDropOldest})
+
+	dropped := make(chan error, 1)
+	if err := c.Enqueue(&ws.QueuedMessage{Type: ws.TextFrame, Data: []byte("second"), Done: dropped}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Enqueue(&ws.QueuedMessage{Type: ws.TextFrame, Data: []byte("third")}); err != nil {
+		t.Fatalf("full queue: got %v, want the oldest message dropped", err)
+	}
+	if err := result(t, dropped); err != ws.ErrMessageDrop {
+		t.Errorf("dropped message: got %v, want %v", err, ws.ErrMessageDrop)
+	}
+
+	if err := expectMessages(p, "first", "third"); err != nil {
+		t.Fatal(err)
+	}
+	if stats := c.WriteQueueStats(); stats.Dropped != 1 || stats.Rejected != 0 {
+		t.Errorf("got %d dropped and %d rejected, want 1 and 0", stats.Dropped, stats.Rejected)
+	}
+}
+
+func TestQueuePriority(t *testing.T) {
+	t.Run("ping", func(t *testing.T) {
+		c, p := startQueue(t, ws.WriteQueueConfig{})
+
+		if err := c.Enqueue(&ws.QueuedMessage{Type: ws.TextFrame, Data: []byte("second")}); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Enqueue(&ws.QueuedMessage{Type: ws.PingFrame, Data: []byte("ping")}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := expectMessages(p, "first"); err != nil {
+			t.Fatal(err)
+		}
+		f, err := p.read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.opcode != opPing || string(f.payload) != "ping" {
+			t.Fatalf("got %s, want the ping queued behind the data", f)
+		}
+		if err = expectMessages(p, "second"); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("close", func(t *testing.T) {
+		c, p := startQueue(t, ws.WriteQueueConfig{})
+
+		if err := c.Enqueue(&ws.QueuedMessage{Type: ws.TextFrame, Data: []byte("second")}); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Enqueue(&ws.QueuedMessage{Type: ws.CloseFrame, Data: closePayload(ws.CloseGoingAway, "")}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := expectMessages(p, "first"); err != nil {
+			t.Fatal(err)
+		}
+		code, err := p.readClose()
+		if err != nil {
+			t.Fatalf("%v, want the close queued behind the data", err)
+		}
+		if code != ws.CloseGoingAway {
+			t.Errorf("got close code %d, want %d", code, ws.CloseGoingAway)
+		}
+	})
+}
+
+func TestQueueDeadline(t *testing.T) {
+	c, p := startQueue(t, ws.WriteQueueConfig{})
+
+	expired := make(chan error, 1)
+	err := c.Enqueue(&ws.QueuedMessage{
+		Type:     ws.TextFrame,
+		Data:     []byte("expired"),
+		Deadline: time.Now().Add(20 * time.Millisecond),
+		Done:     expired,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Enqueue(&ws.QueuedMessage{Type: ws.TextFrame, Data: []byte("third")}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Hold the writer past the deadline.
+	time.Sleep(50 * time.Millisecond)
+
+	if err = expectMessages(p, "first", "third"); err != nil {
+		t.Fatal(err)
+	}
+	if err = result(t, expired); err != ws.ErrWriteExpired {
+		t.Errorf("expired message: got %v, want %v", err, ws.ErrWriteExpired)
+	}
+	if stats := c.WriteQueueStats(); stats.Expired != 1 {
+		t.Errorf("got %d expired, want 1", stats.Expired)
+	}
+}
+
+func TestQueueStats(t *testing.T) {
+	c, p := startQueue(t, ws.WriteQueueConfig{})
+
+	done := make(chan error, 2)
+	if err := c.Enqueue(&ws.QueuedMessage{Type: ws.TextFrame, Data: []byte("second"), Done: done}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Enqueue(&ws.QueuedMessage{Type: ws.PingFrame, Done: done}); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := c.WriteQueueStats()
+	if stats.Depth != 2 || stats.PriorityDepth != 1 {
+		t.Errorf("got depth %d and priority depth %d, want 2 and 1", stats.Depth, stats.PriorityDepth)
+	}
+	if stats.Written != 0 {
+		t.Errorf("got %d written before the peer read, want 0", stats.Written)
+	}
+
+	// Hold the writer, so that the messages wait in the queue.
+	time.Sleep(10 * time.Millisecond)
+
+	if err := expectMessages(p, "first"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.read(); err != nil {
+		t.Fatal(err)
+	}
+	if err := expectMessages(p, "second"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := result(t, done); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The result of the last message is sent before its write is counted.
+	for end := time.Now().Add(timeout); c.WriteQueueStats().Written != 3 && time.Now().Before(end); {
+		time.Sleep(time.Millisecond)
+	}
+
+	stats = c.WriteQueueStats()
+	if stats.Depth != 0 || stats.PriorityDepth != 0 {
+		t.Errorf("got depth %d and priority depth %d, want 0 and 0", stats.Depth, stats.PriorityDepth)
+	}
+	if stats.Written != 3 || stats.Rejected != 0 || stats.Dropped != 0 || stats.Expired != 0 {
+		t.Errorf("got %d written, %d rejected, %d dropped and %d expired, want 3, 0, 0 and 0",
+			stats.Written, stats.Rejected, stats.Dropped, stats.Expired)
+	}
+	if stats.LastLatency < 10*time.Millisecond || stats.MaxLatency < stats.LastLatency || stats.TotalLatency < stats.MaxLatency {
+		t.Errorf("got latencies last %v, max %v and total %v", stats.LastLatency, stats.MaxLatency, stats.TotalLatency)
+	}
+}
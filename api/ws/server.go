@@ -14,11 +14,195 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/abeiron/hrngh/internal/config"
 )
 
-func newServerConn(rwc io.ReadWriteCloser, buf *bufio.ReadWriter, config *config.Ws, handshake func(*config.Ws, *http.Request) error) (conn *Conn, err error) {
-	var hs serverHandshaker = &hybiServerHandshaker{Config: config}
+func newServerConn(rwc io.ReadWriteCloser, buf *bufio.ReadWriter, req *http.Request, cfg *config.Ws, handshake func(*config.Ws, *http.Request) error) (conn *Conn, err error) {
+	var hs serverHandshaker = &hybiServerHandshaker{Ws: cfg}
 
+	code, err := hs.ReadHandshake(buf.Reader, req)
+	if err == ErrBadVersion {
+		fmt.Fprintf(buf, "HTTP/1.1 %03d %s\r\n", code, http.StatusText(code))
+		fmt.Fprintf(buf, "Sec-WebSocket-Version: %s\r\n", SupportedProtocolVersion)
+		buf.WriteString("\r\n")
+		buf.WriteString(err.Error())
+		buf.Flush()
+		return
+	}
+	if err != nil {
+		writeHandshakeError(buf, code, err)
+		return
+	}
+
+	if handshake != nil {
+		err = handshake(cfg, req)
+		if err != nil {
+			writeHandshakeError(buf, http.StatusForbidden, err)
+			return
+		}
+	}
+
+	err = hs.AcceptHandshake(buf.Writer)
+	if err != nil {
+		writeHandshakeError(buf, http.StatusBadRequest, err)
+		return
+	}
+
+	conn = hs.NewServerConn(buf, rwc, req)
+	return
+}
+
+// writeHandshakeError writes an HTTP error response refusing a handshake.
+func writeHandshakeError(buf *bufio.ReadWriter, code int, err error) {
+	fmt.Fprintf(buf, "HTTP/1.1 %03d %s\r\n", code, http.StatusText(code))
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Connection: close\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(err.Error())
+	buf.Flush()
+}
+
+// Handler is a simple interface to a WebSocket connection.  The connection
+// is closed when the handler returns.
+type Handler func(*Conn)
+
+// ServeHTTP implements the http.Handler interface for a WebSocket, refusing
+// connections from other origins than the server's own.
+func (h Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s := Server{Handler: h}
+	s.serveWebSocket(w, req)
+}
+
+/*
+Server represents a server of a WebSocket.  It implements http.Handler,
+so it can be mounted on any http.ServeMux:
+
+	http.Handle("/events", ws.Server{
+		Config: config.Ws{Protocol: []string{"events.v2", "events.v1"}},
+		Handler: func(conn *ws.Conn) {
+			ws.JSON.Send(conn, hello)
+			...
+		},
+	})
+
+Config is copied for every connection.  Its Protocol field lists the
+subprotocols the server speaks, in order of preference; the first of them
+which the client offers is selected, and can be read back from
+conn.Config().Protocol.  Its Header field holds extra headers sent with
+the handshake response.
+*/
+type Server struct {
+	// Config is a WebSocket configuration for the server.
+	Config config.Ws
+
+	// Handshake is an optional function called after the client handshake
+	// has been read and a subprotocol selected, before it is accepted.  It
+	// may change the selected subprotocol in the config's Protocol field,
+	// which must hold at most one entry on return.  If Handshake returns an
+	// error, the handshake is refused with http.StatusForbidden.
+	//
+	// If Handshake is nil, the default checks that the client's Origin, if
+	// it sends one, is the same as the request's host.
+	Handshake func(*config.Ws, *http.Request) error
+
+	// Handler handles the WebSocket connection.
+	Handler
+}
+
+// ServeHTTP implements the http.Handler interface for a WebSocket.
+func (s Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.serveWebSocket(w, req)
+}
+
+func (s Server) serveWebSocket(w http.ResponseWriter, req *http.Request) {
+	conn, err := s.Upgrade(w, req)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	s.Handler(conn)
+}
+
+// Upgrade performs the server handshake on a request and returns the
+// resulting connection, without calling the Handler.  The HTTP connection
+// is hijacked from w; on failure, the handshake is refused with an HTTP
+// error response and the connection is closed.
+func (s Server) Upgrade(w http.ResponseWriter, req *http.Request) (*Conn, error) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket: response does not support hijacking", http.StatusInternalServerError)
+		return nil, ErrNotHijacker
+	}
+
+	rwc, buf, err := hj.Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("websocket: hijack failed: %s", err)
+	}
+
+	supported := s.Config.Protocol
+	cfg := s.Config
+	cfg.Protocol = nil
+
+	handshake := func(cfg *config.Ws, req *http.Request) error {
+		cfg.Protocol = selectProtocol(supported, cfg.Protocol)
+		if s.Handshake != nil {
+			return s.Handshake(cfg, req)
+		}
+		return checkSameOrigin(cfg, req)
+	}
+
+	if cfg.Observer != nil {
+		cfg.Observer.HandshakeStart(false)
+		start := time.Now()
+		defer func() { cfg.Observer.HandshakeFinish(false, time.Since(start), err) }()
+	}
+
+	conn, err := newServerConn(rwc, buf, req, &cfg, handshake)
+	if err != nil {
+		rwc.Close()
+		return nil, err
+	}
+	if conn == nil {
+		panic("unexpected nil conn")
+	}
+
+	return conn, nil
+}
+
+// ErrNotHijacker is returned by Server.Upgrade if the http.ResponseWriter
+// cannot be hijacked.
+var ErrNotHijacker = &ProtocolError{"response does not implement http.Hijacker"}
+
+// selectProtocol selects the first of the supported subprotocols which the
+// client offered.  It returns nil if none of them was offered.
+func selectProtocol(supported, offered []string) []string {
+	for _, p := range supported {
+		for _, o := range offered {
+			if p == o {
+				return []string{p}
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkSameOrigin refuses handshakes from browsers on other origins.
+// Requests without an Origin header, such as from bots and other non-browser
+// clients, are accepted.
+func checkSameOrigin(cfg *config.Ws, req *http.Request) (err error) {
+	cfg.Origin, err = Origin(cfg, req)
+	if err != nil {
+		return err
+	}
+
+	if cfg.Origin != nil && !strings.EqualFold(cfg.Origin.Host, req.Host) {
+		return fmt.Errorf("websocket: origin %s not allowed", cfg.Origin)
+	}
+
+	return nil
 }
@@ -11,11 +11,8 @@ import (
 	"bufio"
 	"errors"
 	"io"
-	"io/ioutil"
 	"net/http"
 	"net/url"
-
-	"github.com/abeiron/hrngh/internal/config"
 )
 
 const (
@@ -36,10 +33,10 @@ const (
 
 // ProtocolError represents WebSocket protocol errors.
 type ProtocolError struct {
-	Error string
+	ErrorString string
 }
 
-func (err *ProtocolError) Error() string { return err.Error }
+func (err *ProtocolError) Error() string { return err.ErrorString }
 
 var (
 	ErrBadProtocolVer   = &ProtocolError{"bad protocol version"}
@@ -56,6 +53,7 @@ var (
 	ErrNotWebSocket     = &ProtocolError{"not websocket protocol"}
 	ErrBadReqMethod     = &ProtocolError{"bad method"}
 	ErrUnsupported      = &ProtocolError{"unsupported"}
+	ErrNotSupported     = &ProtocolError{"not supported"}
 )
 
 // ErrFrameTooLarge is returned by Codec's Receive method if payload size
@@ -64,7 +62,7 @@ var ErrFrameTooLarge = errors.New("websocket: frame payload size exceeds limitat
 
 // Address is an implementation of net.Addr for WebSocket
 type Address struct {
-	*url.Url
+	*url.URL
 }
 
 // Network returns the network type for a WebSocket: "websocket".
@@ -8,7 +8,6 @@ import (
 
 func main() {
 	var cfg = config.AppConfig()
-	var token = cfg.Discord().Token()
 
 	var err = cfg.SaveConfig()
 	if err != nil {
@@ -3,4 +3,8 @@ module github.com/abeiron/hrngh
 go 1.15
 
 require github.com/hashicorp/hcl/v2 v2.8.2
-require github.com/gorilla/websocket v1.4.2
+
+require (
+	github.com/gorilla/websocket v1.4.2
+	golang.org/x/crypto v0.0.0-20190426145343-a29dc8fdc734
+)
@@ -1,11 +1,9 @@
 package config
 
 import (
-	"errors"
+	"encoding/json"
 	"fmt"
-	"os"
-
-	hcl "github.com/hashicorp/hcl/v2"
+	"io/ioutil"
 )
 
 // App represents the customizable end-user configuration for the application.
@@ -19,7 +17,8 @@ type App struct {
 // AppConfig creates a new instance of the default app configuration.
 func AppConfig() *App {
 	return &App{
-		DiscordConfig(),
+		DbConfig(),
+		*DiscordConfig(),
 		"am a bot",
 		"0.1.0",
 	}
@@ -45,73 +44,69 @@ func (app *App) Database() Database {
 	return (*app).db
 }
 
+// configFile is the file the configuration is saved to and loaded from.
+const configFile = "config.json"
+
+// appFile is the layout of the configuration file.  Only exported fields are
+// encoded and decoded, so App and Discord are copied to and from it.
+type appFile struct {
+	Tag     string      `json:"tag"`
+	Ver     string      `json:"ver"`
+	Discord discordFile `json:"discord"`
+}
+
+type discordFile struct {
+	Token  string `json:"token"`
+	Secret string `json:"secret"`
+	Status string `json:"status"`
+}
+
 // SaveConfig saves the current instance of App to a file.
 func (app *App) SaveConfig() error {
-	str, err := toml.Marshal(&app)
+	str, err := json.MarshalIndent(&appFile{
+		Tag: app.tag,
+		Ver: app.ver,
+		Discord: discordFile{
+			Token:  app.discord.token,
+			Secret: app.discord.secret,
+			Status: app.discord.status,
+		},
+	}, "", "  ")
 	if err != nil {
-		fmt.Printf("error marshalling application configuration: %d", err)
+		fmt.Printf("error marshalling application configuration: %s", err)
 		return err
 	}
 
-	f, err0 := os.Create("config.toml")
-	if err0 != nil {
-		fmt.Printf("error creating configuration: %d", err0)
-		return err0
-	}
-
-	defer f.Close()
-
-
-
-	_, err1 := f.Write(str)
-	if err1 != nil {
-		fmt.Printf("error writing to file: %d", err1)
-		return err1
+	err = ioutil.WriteFile(configFile, str, 0600)
+	if err != nil {
+		fmt.Printf("error writing configuration: %s", err)
+		return err
 	}
 
-	f.Sync()
-
-
-
 	return nil
 }
 
 // LoadConfig loads the configuration from its file.
 func (app *App) LoadConfig() (_ *App, e error) {
-	if app != AppConfig() {
-		return app, errors.New("default configuration not present")
-	}
-
-	f, err := os.Open("config.toml")
+	str, err := ioutil.ReadFile(configFile)
 	if err != nil {
-		fmt.Printf("error opening file: %d", err)
+		fmt.Printf("error reading configuration: %s", err)
 		return app, err
 	}
 
-	defer f.Close()
-
-
-
-	str := new(string)
-	_, err0 := f.Read([]byte(*str))
-	if err0 != nil {
-		fmt.Printf("error reading from file: %d", err0)
-		return app, err0
-	}
-
-	config, err1 := toml.Load(string(*str))
-	if err1 != nil {
-		fmt.Printf("error loading config from file: %d", err1)
-		return app, err1
+	var file appFile
+	err = json.Unmarshal(str, &file)
+	if err != nil {
+		fmt.Printf("error unmarshalling configuration: %s", err)
+		return app, err
 	}
 
-	err2 := config.Unmarshal(&app)
-	if err2 != nil {
-		fmt.Printf("error unmarshalling configuration: %d", err2)
-		return app, err2
+	app.tag, app.ver = file.Tag, file.Ver
+	app.discord = Discord{
+		token:  file.Discord.Token,
+		secret: file.Discord.Secret,
+		status: file.Discord.Status,
 	}
 
-
-
 	return app, nil
 }
@@ -1,20 +1,18 @@
 package config
 
-import "github.com/abeiron/hrngh/api/discord"
-
 // Discord represents the Discord configuration.
 type Discord struct {
 	token 	string 				`hcl:"token"`
 	secret 	string 				`hcl:"secret"`
-	status 	discord.Status 	`hcl:"status"`
+	status 	string 				`hcl:"status"`
 }
 
 // DiscordConfig creates a new instance of the default Discord configuration.
 func DiscordConfig() *Discord {
-	return *Discord{
+	return &Discord{
 		"BOT_TOKEN",
 		"BOT_SECRET",
-		discord.StatusOnline,
+		"online",
 	}
 }
 
@@ -52,10 +50,11 @@ func (d *Discord) SetSecret(secret string) (_ *Discord, err error) {
 
 // SetStatus
 //
-// `status`: The status to be displayed for the bot in the Discord client.
+// `status`: The status to be displayed for the bot in the Discord client, one
+// of the values of discord.Status.
 //
 // Sets the status for the bot account.
-func (d *Discord) SetStatus(status discord.Status) (_ *Discord, err error) {
+func (d *Discord) SetStatus(status string) (_ *Discord, err error) {
 	d.status = status
 
 	return d, err
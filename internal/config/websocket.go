@@ -14,15 +14,16 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"time"
 )
 
 // Ws is a WebSocket configuration
 type Ws struct {
 	// A WebSocket server address.
-	Location *url.Url
+	Location *url.URL
 
 	// A WebSocket client origin
-	Origin *url.Url
+	Origin *url.URL
 
 	// WebSocket subprotocols.
 	Protocol []string
@@ -39,5 +40,73 @@ type Ws struct {
 	// Dialer used when opening WebSocket connections.
 	Dialer *net.Dialer
 
-	handshakeData map[string]string
+	// Proxy returns the proxy to open WebSocket connections through, for
+	// a request to the server with an http or https scheme.  Proxies with
+	// http and https schemes are used with HTTP CONNECT, and proxies with
+	// socks5 and socks5h schemes with SOCKS5; credentials are taken from
+	// the URL's user info.  If the function returns a nil URL, no proxy is
+	// used.
+	//
+	// If Proxy is nil, http.ProxyFromEnvironment is used, so HTTPS_PROXY
+	// applies to wss servers and HTTP_PROXY to ws servers.
+	Proxy func(*http.Request) (*url.URL, error)
+
+	// HandshakeTimeout limits the time taken to connect to the server,
+	// including proxy and TLS negotiation, and to complete the WebSocket
+	// handshake.  If zero, only the context given to the dial limits it.
+	HandshakeTimeout time.Duration
+
+	// EnableCompression enables negotiation of the permessage-deflate
+	// extension (RFC 7692), offered by clients and accepted by servers.
+	EnableCompression bool
+
+	// CompressionLevel is the flate level used to compress outgoing
+	// messages.  If zero, flate.DefaultCompression is used.
+	CompressionLevel int
+
+	// ClientNoContextTakeover and ServerNoContextTakeover ask for the
+	// compressor of the client or the server to be reset after every
+	// message, which saves memory at the cost of compression ratio.
+	ClientNoContextTakeover bool
+	ServerNoContextTakeover bool
+
+	// ServerMaxWindowBits asks the server to limit the size of its
+	// compression window to 2^ServerMaxWindowBits bytes, from 8 to 15.
+	// It is only used by clients; if zero, no limit is asked for.
+	ServerMaxWindowBits int
+
+	// KeepAlive, if set, makes connections send a ping at this interval.
+	// If the pong has not arrived by the next one, the peer is taken for
+	// dead and the connection is closed, reads returning a close error
+	// with code 1006.
+	KeepAlive time.Duration
+
+	// Observer, if set, is told of the handshakes, frames, pings and
+	// closes of the connections made with this configuration.
+	Observer WsObserver
+}
+
+// WsObserver is told of the events of WebSocket connections.  Its methods
+// are called from the goroutines reading and writing the connection, so
+// they must be safe for concurrent use and return quickly.
+type WsObserver interface {
+	// HandshakeStart and HandshakeFinish are called around the opening
+	// handshake of a client or server connection.  err is nil if it
+	// succeeded.
+	HandshakeStart(client bool)
+	HandshakeFinish(client bool, elapsed time.Duration, err error)
+
+	// FrameRead and FrameWritten are called for every frame, control
+	// frames included, with its opcode, payload length and whether it
+	// starts a compressed message.
+	FrameRead(opcode byte, length int64, compressed bool)
+	FrameWritten(opcode byte, length int64, compressed bool)
+
+	// PingRTT is called when the pong answering a ping arrives.
+	PingRTT(rtt time.Duration)
+
+	// Close is called when a close frame is sent or received, with its
+	// code, and when a connection is dropped for a missed pong, with code
+	// 1006.
+	Close(code int, sent bool)
 }
@@ -14,7 +14,7 @@ import "github.com/abeiron/hrngh/api/discord"
 // New creates a new instance of a Discord client.
 //
 // `token`: Represents the bot token required for connecting to the Discord API.
-func New(args ...interface{}) (c *discord.Client, e error) {
+func New(args ...interface{}) (c *discord.Session, e error) {
 
 	return c, nil
 }
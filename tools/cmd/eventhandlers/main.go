@@ -98,7 +98,7 @@ func constCase(name string) string {
 
 func isDiscordEvent(name string) bool {
 	switch {
-	case name == "Connect", name == "Disconnect", name == "Event", name == "RateLimit", name == "Interface":
+	case name == "Connect", name == "Disconnect", name == "Event", name == "RateLimit", name == "Interface", name == "GuildMembersReady":
 		return false
 	default:
 		return true
@@ -0,0 +1,339 @@
+// Command statestress replays gateway events into a discord.State while
+// readers query it and handlers read the events, as a session does with
+// SyncEnabled unset.  Run under the race detector, it reports any data
+// race between the state and its readers:
+//
+//	go run -race ./tools/cmd/statestress [-d 10s] [-readers 8] [-copy=true] [-presences]
+//
+// With -copy=false the state returns the values it caches, and races are
+// expected.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/abeiron/hrngh/api/discord"
+)
+
+var (
+	durationFlag = flag.Duration("d", 10*time.Second, "how long to run")
+	readersFlag  = flag.Int("readers", 8, "number of concurrent readers")
+	copyFlag     = flag.Bool("copy", true, "set State.CopyOnRead")
+	membersFlag  = flag.Int("members", 2000, "members per guild")
+	presFlag     = flag.Bool("presences", false, "set State.PresenceCache")
+)
+
+const (
+	guilds   = 4
+	channels = 8
+	roles    = 6
+)
+
+func guildID(g int) string      { return strconv.Itoa(1000 + g) }
+func channelID(g, c int) string { return strconv.Itoa(10000 + g*100 + c) }
+func roleID(g, r int) string    { return strconv.Itoa(20000 + g*100 + r) }
+func userID(u int) string       { return strconv.Itoa(100000 + u) }
+
+func newUser(u int, rnd *rand.Rand) *discord.User {
+	return &discord.User{
+		ID:            userID(u),
+		Username:      "user" + strconv.Itoa(rnd.Intn(10000)),
+		Discriminator: fmt.Sprintf("%04d", u%10000),
+	}
+}
+
+func newMember(g, u int, rnd *rand.Rand) *discord.Member {
+	m := &discord.Member{
+		GuildID: guildID(g),
+		User:    newUser(u, rnd),
+		Roles:   []string{roleID(g, rnd.Intn(roles))},
+	}
+	if rnd.Intn(2) == 0 {
+		m.Nick = "nick" + strconv.Itoa(rnd.Intn(10000))
+	}
+
+	return m
+}
+
+func newChannel(g, c int, rnd *rand.Rand) *discord.Channel {
+	typ := discord.ChannelTypeGuildText
+	if c%4 == 3 {
+		typ = discord.ChannelTypeGuildVoice
+	}
+
+	return &discord.Channel{
+		ID:       channelID(g, c),
+		GuildID:  guildID(g),
+		Name:     "channel-" + strconv.Itoa(rnd.Intn(100)),
+		Type:     typ,
+		Position: rnd.Intn(channels),
+	}
+}
+
+func newRole(g, r int, rnd *rand.Rand) *discord.Role {
+	return &discord.Role{
+		ID:       roleID(g, r),
+		Name:     "role-" + strconv.Itoa(rnd.Intn(100)),
+		Position: rnd.Intn(roles),
+		Color:    rnd.Intn(0xffffff),
+	}
+}
+
+func newGuild(g int, rnd *rand.Rand) *discord.Guild {
+	guild := &discord.Guild{
+		ID:          guildID(g),
+		Name:        "guild " + strconv.Itoa(g),
+		MemberCount: *membersFlag,
+	}
+	for c := 0; c < channels; c++ {
+		guild.Channels = append(guild.Channels, newChannel(g, c, rnd))
+	}
+	for r := 0; r < roles; r++ {
+		guild.Roles = append(guild.Roles, newRole(g, r, rnd))
+	}
+	for u := 0; u < *membersFlag; u++ {
+		guild.Members = append(guild.Members, newMember(g, u, rnd))
+	}
+
+	return guild
+}
+
+// nextEvent returns a random event, each a new value as from the gateway.
+func nextEvent(rnd *rand.Rand, n int) interface{} {
+	g := rnd.Intn(guilds)
+	u := rnd.Intn(*membersFlag)
+	c := rnd.Intn(channels)
+
+	switch rnd.Intn(10) {
+	case 0:
+		return &discord.GuildMemberAdd{Member: newMember(g, u, rnd)}
+	case 1:
+		return &discord.GuildMemberRemove{Member: newMember(g, u, rnd)}
+	case 2:
+		return &discord.ChannelUpdate{Channel: newChannel(g, c, rnd)}
+	case 3:
+		return &discord.GuildRoleUpdate{GuildRole: &discord.GuildRole{GuildID: guildID(g), Role: newRole(g, rnd.Intn(roles), rnd)}}
+	case 4:
+		status := discord.StatusOnline
+		if rnd.Intn(3) == 0 {
+			status = discord.StatusOffline
+		}
+		return &discord.PresenceUpdate{
+			GuildID: guildID(g),
+			Presence: discord.Presence{
+				User:       newUser(u, rnd),
+				Status:     status,
+				Activities: []*discord.Activity{{Name: "game " + strconv.Itoa(rnd.Intn(10))}},
+			},
+		}
+	case 5, 6:
+		return &discord.MessageCreate{Message: &discord.Message{
+			ID:        strconv.Itoa(n),
+			ChannelID: channelID(g, c),
+			GuildID:   guildID(g),
+			Content:   "message " + strconv.Itoa(n),
+			Author:    newUser(u, rnd),
+		}}
+	case 7:
+		return &discord.MessageUpdate{Message: &discord.Message{
+			ID:        strconv.Itoa(n - rnd.Intn(50) - 1),
+			ChannelID: channelID(g, c),
+			Content:   "edited " + strconv.Itoa(n),
+		}}
+	default:
+		return &discord.GuildMemberUpdate{Member: newMember(g, u, rnd)}
+	}
+}
+
+// handle reads an event as a handler would, after the state has handled it.
+func handle(i interface{}) int {
+	n := 0
+	switch t := i.(type) {
+	case *discord.GuildMemberAdd:
+		n += len(t.Nick) + len(t.User.Username) + len(t.Roles)
+	case *discord.GuildMemberUpdate:
+		n += len(t.Nick) + len(t.User.Username)
+		if t.BeforeUpdate != nil {
+			n += len(t.BeforeUpdate.Nick)
+		}
+	case *discord.ChannelUpdate:
+		n += len(t.Name) + t.Position
+	case *discord.GuildRoleUpdate:
+		n += len(t.Role.Name) + t.Role.Position
+	case *discord.MessageCreate:
+		n += len(t.Content) + len(t.Author.Username)
+	case *discord.MessageUpdate:
+		n += len(t.Content)
+	case *discord.PresenceUpdate:
+		n += len(t.User.Username) + len(t.Status)
+	}
+
+	return n
+}
+
+// read reads the state as a command would.
+func read(st *discord.State, rnd *rand.Rand) int {
+	g := rnd.Intn(guilds)
+	n := 0
+
+	switch rnd.Intn(10) {
+	case 0:
+		if guild, err := st.Guild(guildID(g)); err == nil {
+			for _, c := range guild.Channels {
+				n += len(c.Name)
+			}
+			for _, m := range guild.Members {
+				n += len(m.Nick)
+			}
+		}
+	case 1:
+		if m, err := st.Member(guildID(g), userID(rnd.Intn(*membersFlag))); err == nil {
+			n += len(m.Nick) + len(m.User.Username) + len(m.Roles)
+		}
+	case 2:
+		if c, err := st.Channel(channelID(g, rnd.Intn(channels))); err == nil {
+			n += len(c.Name) + len(c.Messages)
+			for _, m := range c.Messages {
+				n += len(m.Content)
+			}
+		}
+	case 3:
+		members, _ := st.MembersWithPrefix(guildID(g), "nick1", 20)
+		for _, m := range members {
+			n += len(m.Nick)
+		}
+	case 4:
+		members, _ := st.SearchMembers(guildID(g), "user123", 10)
+		for _, m := range members {
+			n += len(m.User.Username)
+		}
+	case 5:
+		channels, _ := st.FindChannels(guildID(g), func(c *discord.Channel) bool { return true })
+		for _, c := range channels {
+			n += c.Position
+		}
+	case 6:
+		roles, _ := st.RolesAbove(guildID(g), 2)
+		for _, r := range roles {
+			n += len(r.Name)
+		}
+	case 7:
+		count, _ := st.OnlineCount(guildID(g))
+		n += count
+	case 8:
+		members, _ := st.MembersWithActivity(guildID(g), discord.ActivityTypeGame, "game 3")
+		n += len(members)
+	default:
+		n += st.UserColor(userID(rnd.Intn(*membersFlag)), channelID(g, rnd.Intn(channels)))
+	}
+
+	return n
+}
+
+func main() {
+	flag.Parse()
+	log.SetFlags(0)
+
+	st := discord.NewState()
+	st.MaxMessageCount = 50
+	st.CopyOnRead = *copyFlag
+	if *presFlag {
+		st.PresenceCache = discord.NewPresenceCache(false)
+	}
+	se := &discord.Session{StateEnabled: true, State: st}
+
+	rnd := rand.New(rand.NewSource(1))
+	err := st.OnInterface(se, &discord.Ready{User: &discord.User{ID: "1"}})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// The guilds are created in one batch.
+	err = st.Update(func(tx *discord.StateTx) error {
+		for g := 0; g < guilds; g++ {
+			if err := tx.GuildAdd(newGuild(g, rnd)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var (
+		stop    = make(chan struct{})
+		wg      sync.WaitGroup
+		events  int64
+		reads   int64
+		handled = make(chan interface{}, 256)
+		sink    int64
+	)
+
+	// The writer handles events in order, then passes them to a handler.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(handled)
+
+		rnd := rand.New(rand.NewSource(2))
+		for n := 1; ; n++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			e := nextEvent(rnd, n)
+			st.OnInterface(se, e)
+			handled <- e
+			atomic.AddInt64(&events, 1)
+		}
+	}()
+
+	// Handlers read each event while the next are handled.
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for e := range handled {
+				atomic.AddInt64(&sink, int64(handle(e)))
+			}
+		}()
+	}
+
+	for i := 0; i < *readersFlag; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+
+			rnd := rand.New(rand.NewSource(seed))
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+
+				atomic.AddInt64(&sink, int64(read(st, rnd)))
+				atomic.AddInt64(&reads, 1)
+			}
+		}(int64(10 + i))
+	}
+
+	time.Sleep(*durationFlag)
+	close(stop)
+	wg.Wait()
+
+	fmt.Printf("%d events, %d reads in %s with CopyOnRead %t\n", events, reads, *durationFlag, *copyFlag)
+	if st.PresenceCache != nil {
+		fmt.Printf("%d presences cached\n", st.PresenceCache.Len())
+	}
+}